@@ -36,17 +36,53 @@ func InitDB() {
 	}
 
 	var err error
-	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	// 后台任务与请求并发写入，使用 WAL 并在数据库忙时等待
+	DB, err = gorm.Open(sqlite.Open(dbPath+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"), &gorm.Config{})
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
 	// 自动迁移
-	err = DB.AutoMigrate(&models.Registry{}, &models.User{})
+	err = DB.AutoMigrate(
+		&models.Registry{},
+		&models.User{},
+		&models.SigningKey{},
+		&models.PackageInventory{},
+		&models.InventoryPackage{},
+		&models.InventoryImage{},
+		&models.Advisory{},
+		&models.AdvisoryAffected{},
+		&models.VulnerabilityDB{},
+		&models.VulnerabilityScan{},
+		&models.ImageVulnerability{},
+		&models.Job{},
+		&models.JobLog{},
+		&models.RegistryEvent{},
+		&models.WebhookTarget{},
+		&models.WebhookDelivery{},
+		&models.RegistryHealthCheck{},
+		&models.CatalogRepository{},
+		&models.CrawlStatus{},
+		&models.TagHistory{},
+		&models.CatalogTag{},
+		&models.CatalogManifest{},
+		&models.CatalogReference{},
+		&models.StorageSnapshot{},
+		&models.StorageUsage{},
+	)
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	// 镜像搜索的全文索引，每个标签一行，由爬取任务维护
+	err = DB.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS catalog_search USING fts5(
+		registry_id UNINDEXED, repository, tag, digest UNINDEXED, os, arch,
+		labels, env, entrypoint, history, created UNINDEXED
+	)`).Error
+	if err != nil {
+		log.Fatalf("Failed to create search index: %v", err)
+	}
+
 	// 初始化管理员账户
 	initAdminUser()
 
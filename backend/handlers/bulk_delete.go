@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"dgui/models"
+	"dgui/services"
+)
+
+// bindBulkDeleteRequest 解析并校验批量删除请求
+func bindBulkDeleteRequest(c *gin.Context) (*models.BulkDeleteRequest, bool) {
+	var req models.BulkDeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err := services.ValidateBulkDeleteRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &req, true
+}
+
+// PreviewBulkDelete 预览批量删除：列出选中的标签及其 digest，并提示会被一并删除的未选中标签
+func PreviewBulkDelete(c *gin.Context) {
+	req, ok := bindBulkDeleteRequest(c)
+	if !ok {
+		return
+	}
+
+	client, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+	if rejectMirror(c, registry) {
+		return
+	}
+
+	preview, err := services.PreviewBulkDelete(client, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// BulkDelete 在后台任务中解析选中的标签并执行批量删除，返回任务，结果中包含每个标签的处理状态。
+// 请求带有 confirmed 时只删除预览中确认过且 digest 未变的标签
+func BulkDelete(c *gin.Context) {
+	req, ok := bindBulkDeleteRequest(c)
+	if !ok {
+		return
+	}
+
+	_, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+	if rejectMirror(c, registry) {
+		return
+	}
+
+	job, err := services.EnqueueJob(models.JobTypeBulkDelete, registry.ID, services.BulkDeleteParams{
+		RegistryID: registry.ID,
+		Request:    *req,
+		Actor:      c.GetString("username"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
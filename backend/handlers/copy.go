@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"dgui/models"
+	"dgui/services"
+)
+
+// CopyImage 将镜像复制到另一个 Registry 或仓库，在后台执行并返回任务，通过 /api/jobs 查询进度
+func CopyImage(c *gin.Context) {
+	var req models.ImageCopyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var source *services.RegistryClient
+	var sourceRegistry *models.Registry
+	var err error
+	if req.SourceRegistryID == 0 {
+		source, sourceRegistry, err = getActiveRegistryClient()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+			return
+		}
+	} else {
+		source, sourceRegistry, err = services.GetRegistryClient(req.SourceRegistryID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Source registry not found"})
+			return
+		}
+	}
+
+	_, targetRegistry, err := services.GetRegistryClient(req.TargetRegistryID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Target registry not found"})
+		return
+	}
+	if rejectMirror(c, targetRegistry) {
+		return
+	}
+
+	targetRepo := req.TargetRepo
+	if targetRepo == "" {
+		targetRepo = req.SourceRepo
+	}
+	targetTag := req.TargetTag
+	if targetTag == "" {
+		targetTag = req.SourceRef
+	}
+	if services.SameRegistry(sourceRegistry, targetRegistry) && targetRepo == req.SourceRepo && targetTag == req.SourceRef {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source and target are the same image"})
+		return
+	}
+
+	// 入队前确认源镜像存在，避免创建注定失败的任务
+	if _, err := source.ResolveDigest(req.SourceRepo, req.SourceRef); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.SourceRegistryID = sourceRegistry.ID
+	req.TargetRepo = targetRepo
+	req.TargetTag = targetTag
+	job, err := services.EnqueueJob(models.JobTypeCopy, targetRegistry.ID, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
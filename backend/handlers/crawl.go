@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"dgui/services"
+)
+
+// GetCrawlStatus 获取所有 Registry 的爬取状态、上次结果与耗时
+func GetCrawlStatus(c *gin.Context) {
+	statuses, err := services.ListCrawlStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, statuses)
+}
+
+// StartCrawl 立即爬取当前 Registry，默认增量爬取 ?full=1
+func StartCrawl(c *gin.Context) {
+	_, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+
+	full := c.Query("full") == "1" || c.Query("full") == "true"
+	job, err := services.EnqueueCrawl(registry.ID, full, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// CrawlRepository 立即刷新当前 Registry 中的单个仓库 ?repo=xxx
+func CrawlRepository(c *gin.Context) {
+	repo := c.Query("repo")
+	if repo == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "repo parameter is required"})
+		return
+	}
+	_, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+
+	job, err := services.EnqueueCrawl(registry.ID, true, repo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
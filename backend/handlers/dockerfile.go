@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"dgui/services"
+)
+
+// GetImageDockerfile 根据构建历史还原 Dockerfile
+// ?repo=xxx&tag=xxx&empty=skip&download=1
+func GetImageDockerfile(c *gin.Context) {
+	repository := c.Query("repo")
+	tag := c.Query("tag")
+	if repository == "" || tag == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "repo and tag parameters are required"})
+		return
+	}
+
+	client, _, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+
+	info, err := client.GetImageInfo(repository, tag)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := services.ReconstructDockerfile(info, c.Query("empty") == "skip")
+
+	// 下载为文本文件
+	if c.Query("download") == "1" || c.Query("format") == "text" {
+		if c.Query("download") == "1" {
+			filename := strings.NewReplacer("/", "_", ":", "_").Replace(repository) + "_" + tag + ".Dockerfile"
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		}
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(result.Dockerfile))
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"dgui/config"
+	"dgui/models"
+	"dgui/services"
+)
+
+// ReceiveRegistryNotification 接收 Registry 的通知回调 ?registry_id=xxx
+// 该接口不需要登录，使用 Registry 配置的 webhook_token 校验，token 可以放在
+// Authorization: Bearer、X-Registry-Token 请求头或 token 查询参数中
+func ReceiveRegistryNotification(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Query("registry_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "registry_id parameter is required"})
+		return
+	}
+	var registry models.Registry
+	if err := config.DB.First(&registry, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Registry not found"})
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" || token == c.GetHeader("Authorization") {
+		token = c.GetHeader("X-Registry-Token")
+	}
+	if token == "" {
+		token = c.Query("token")
+	}
+	if registry.WebhookToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(registry.WebhookToken)) != 1 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid webhook token"})
+		return
+	}
+
+	var notification models.RegistryNotification
+	if err := c.ShouldBindJSON(&notification); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := services.HandleRegistryNotification(registry.ID, &notification)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GetActivity 获取当前 Registry 的最近活动（带分页）?repo=xxx&action=push&page=1&page_size=20
+func GetActivity(c *gin.Context) {
+	_, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+	page, pageSize := parsePagination(c)
+
+	events, total, err := services.ListRegistryEvents(registry.ID, c.Query("repo"), c.Query("action"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, paginated(events, int(total), page, pageSize))
+}
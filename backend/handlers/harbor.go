@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"dgui/models"
+	"dgui/services"
+)
+
+// harborErrorStatus Harbor 接口错误对应的 HTTP 状态码
+func harborErrorStatus(err error) int {
+	if errors.Is(err, services.ErrNotHarbor) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// GetHarborProjects 获取当前 Harbor 的项目列表及存储配额
+func GetHarborProjects(c *gin.Context) {
+	client, _, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+
+	projects, err := services.ListHarborProjects(client)
+	if err != nil {
+		c.JSON(harborErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, projects)
+}
+
+// GetHarborScanReport 获取 Harbor 中镜像已有的扫描结果（漏洞带分页）
+// ?repo=xxx&ref=xxx&severity=CRITICAL,HIGH&search=xxx&page=1&page_size=20
+func GetHarborScanReport(c *gin.Context) {
+	repository := c.Query("repo")
+	reference := c.Query("ref")
+	if repository == "" || reference == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "repo and ref parameters are required"})
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+
+	client, _, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+
+	report, vulnerabilities, err := services.GetHarborScanReport(client, repository, reference)
+	if err != nil {
+		c.JSON(harborErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	severities := map[string]bool{}
+	if severity := c.Query("severity"); severity != "" {
+		for _, s := range strings.Split(strings.ToUpper(severity), ",") {
+			severities[s] = true
+		}
+	}
+	search := c.Query("search")
+	filtered := []models.ImageVulnerability{}
+	for _, v := range vulnerabilities {
+		if len(severities) > 0 && !severities[v.Severity] {
+			continue
+		}
+		if search != "" && !containsIgnoreCase(v.Package, search) && !containsIgnoreCase(v.AdvisoryID, search) {
+			continue
+		}
+		filtered = append(filtered, v)
+	}
+
+	total := len(filtered)
+	start := (page - 1) * pageSize
+	if start > total {
+		start = total
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+
+	c.JSON(http.StatusOK, paginated(gin.H{
+		"scan":            report,
+		"vulnerabilities": filtered[start:end],
+	}, total, page, pageSize))
+}
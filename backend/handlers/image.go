@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -35,21 +38,90 @@ func GetCatalog(c *gin.Context) {
 
 	catalog, err := client.GetCatalog()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, catalog)
 }
 
+// catalogErrorStatus 获取仓库目录失败时的状态码，Registry 不提供目录时返回 409 提示配置仓库列表
+func catalogErrorStatus(err error) int {
+	if errors.Is(err, services.ErrCatalogUnavailable) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// repositoryQueryParams 仓库列表的排序和过滤参数，指定任意一个时改为基于爬取结果查询
+var repositoryQueryParams = []string{"sort", "order", "tag", "min_tags", "max_tags", "updated_since", "label"}
+
+// parseRepositoryQuery 解析仓库列表的排序和过滤参数
+func parseRepositoryQuery(c *gin.Context) (*models.RepositoryQuery, error) {
+	q := &models.RepositoryQuery{
+		Search:     c.Query("search"),
+		Sort:       c.DefaultQuery("sort", "name"),
+		Desc:       c.Query("order") == "desc",
+		TagPattern: c.Query("tag"),
+		Label:      c.Query("label"),
+	}
+	switch q.Sort {
+	case "name", "tags", "pushed", "size":
+	default:
+		return nil, fmt.Errorf("sort must be name, tags, pushed or size")
+	}
+	if order := c.Query("order"); order != "" && order != "asc" && order != "desc" {
+		return nil, fmt.Errorf("order must be asc or desc")
+	}
+	for param, target := range map[string]**int{"min_tags": &q.MinTags, "max_tags": &q.MaxTags} {
+		if v := c.Query(param); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q", param, v)
+			}
+			*target = &n
+		}
+	}
+	if v := c.Query("updated_since"); v != "" {
+		since, err := parseTimeOrAge(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid updated_since %q", v)
+		}
+		q.UpdatedSince = &since
+	}
+	return q, nil
+}
+
+// parseTimeOrAge 解析时间（RFC 3339）或距今的时长，如 7d、12h
+func parseTimeOrAge(v string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, v)
+	if err == nil {
+		return t, nil
+	}
+	age, err := services.ParseAge(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-age), nil
+}
+
 // GetRepositories 获取仓库列表（带详细信息和分页）
+// ?search=xxx&sort=name|tags|pushed|size&order=asc|desc&tag=<regex>&min_tags=1&max_tags=10&updated_since=7d&label=xxx
+// 指定排序或过滤条件时基于爬取结果查询，结果中包含仓库大小和最近推送时间
 func GetRepositories(c *gin.Context) {
-	client, _, err := getActiveRegistryClient()
+	client, registry, err := getActiveRegistryClient()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
 		return
 	}
 
+	for _, param := range repositoryQueryParams {
+		if c.Query(param) != "" {
+			listCrawledRepositories(c, client, registry.ID)
+			return
+		}
+	}
+
 	// 获取分页参数
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
@@ -64,7 +136,7 @@ func GetRepositories(c *gin.Context) {
 
 	catalog, err := client.GetCatalog()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -99,6 +171,7 @@ func GetRepositories(c *gin.Context) {
 		}
 		repos = append(repos, *info)
 	}
+	services.EnrichHarborRepositories(client, repos)
 
 	c.JSON(http.StatusOK, models.PaginatedResponse{
 		Data:       repos,
@@ -109,6 +182,51 @@ func GetRepositories(c *gin.Context) {
 	})
 }
 
+// listCrawledRepositories 基于爬取结果返回排序和过滤后的仓库列表
+func listCrawledRepositories(c *gin.Context, client *services.RegistryClient, registryID uint) {
+	q, err := parseRepositoryQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, pageSize := parsePagination(c)
+
+	repos, total, err := services.ListRepositories(registryID, q, page, pageSize)
+	if errors.Is(err, services.ErrNotCrawled) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Sorting and filtering require the registry to be crawled first"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	services.EnrichHarborRepositories(client, repos)
+	c.JSON(http.StatusOK, paginated(repos, total, page, pageSize))
+}
+
+// GetNamespaceTree 按路径层级获取仓库命名空间树 ?prefix=team/project&search=xxx
+// 返回 prefix 节点及其直接子节点，子节点可再按 prefix 展开；search 不为空时返回 prefix 下匹配的仓库
+func GetNamespaceTree(c *gin.Context) {
+	client, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+
+	catalog, err := client.GetCatalog()
+	if err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	tree, err := services.BuildNamespaceTree(registry.ID, catalog.Repositories, c.Query("prefix"), c.Query("search"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tree)
+}
+
 // containsIgnoreCase 忽略大小写的字符串包含检查
 func containsIgnoreCase(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
@@ -136,7 +254,7 @@ func containsLower(s, substr string) bool {
 	return false
 }
 
-// GetTags 获取镜像标签（带分页）
+// GetTags 获取镜像标签（带分页），detail=1 时同时返回当前页标签的详细信息
 func GetTags(c *gin.Context) {
 	repository := c.Query("repo")
 	if repository == "" {
@@ -156,7 +274,7 @@ func GetTags(c *gin.Context) {
 		pageSize = 20
 	}
 
-	client, _, err := getActiveRegistryClient()
+	client, registry, err := getActiveRegistryClient()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
 		return
@@ -191,11 +309,37 @@ func GetTags(c *gin.Context) {
 
 	pagedTags := filteredTags[start:end]
 
+	data := map[string]interface{}{
+		"name": repository,
+		"tags": pagedTags,
+	}
+
+	if c.Query("detail") == "1" {
+		items := make([]models.TagInfo, 0, len(pagedTags))
+		pushes := services.LatestPushEvents(registry.ID, repository, pagedTags)
+		for _, tag := range pagedTags {
+			info, err := client.GetTagInfo(repository, tag)
+			if err != nil {
+				info = &models.TagInfo{Name: tag}
+			}
+			reference := tag
+			if info.Digest != "" {
+				reference = info.Digest
+			}
+			signature := services.ImageSignatureStatus(client, registry.ID, repository, reference)
+			info.Signature, info.SignatureError = signature.Status, signature.Error
+			info.Vulnerabilities = services.GetTagVulnerabilitySummary(registry.ID, repository, tag)
+			if push, ok := pushes[tag]; ok {
+				info.PushedAt = push.Timestamp.Format(time.RFC3339)
+				info.PushedBy = push.Actor
+			}
+			items = append(items, *info)
+		}
+		data["items"] = items
+	}
+
 	c.JSON(http.StatusOK, models.PaginatedResponse{
-		Data: map[string]interface{}{
-			"name": repository,
-			"tags": pagedTags,
-		},
+		Data:       data,
 		Total:      total,
 		Page:       page,
 		PageSize:   pageSize,
@@ -236,7 +380,7 @@ func GetImageInfo(c *gin.Context) {
 		return
 	}
 
-	client, _, err := getActiveRegistryClient()
+	client, registry, err := getActiveRegistryClient()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
 		return
@@ -248,10 +392,45 @@ func GetImageInfo(c *gin.Context) {
 		return
 	}
 
+	// 签名校验失败不影响镜像信息的返回，状态为 error 并附带错误信息
+	signature, err := services.VerifyImageSignature(client, registry.ID, repository, tag)
+	if err != nil {
+		signature = services.SignatureErrorResult(info.Digest, err)
+	}
+	info.Signature = signature
+
 	c.JSON(http.StatusOK, info)
 }
 
+// PreviewDeleteImage 删除前的确认步骤：返回引用的 digest 以及会被一并删除的其他标签
+func PreviewDeleteImage(c *gin.Context) {
+	repository := c.Query("repo")
+	reference := c.Query("ref")
+	if repository == "" || reference == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "repo and ref parameters are required"})
+		return
+	}
+
+	client, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+	if rejectMirror(c, registry) {
+		return
+	}
+
+	preview, err := services.PreviewDelete(client, repository, reference)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
 // DeleteImage 删除镜像
+// 有其他标签指向同一 digest 时，需要传入 acknowledge=<digest> 确认一并删除，否则返回 409 和共享的标签
 func DeleteImage(c *gin.Context) {
 	repository := c.Query("repo")
 	reference := c.Query("ref")
@@ -260,28 +439,93 @@ func DeleteImage(c *gin.Context) {
 		return
 	}
 
-	client, _, err := getActiveRegistryClient()
+	client, registry, err := getActiveRegistryClient()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
 		return
 	}
+	if rejectMirror(c, registry) {
+		return
+	}
 
-	// 首先获取 digest
-	manifest, err := client.GetManifest(repository, reference)
+	// 解析顶层 digest（多架构镜像为 index），并找出共享该 digest 的标签
+	preview, err := services.PreviewDelete(client, repository, reference)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if len(preview.SharedTags) > 0 && c.Query("acknowledge") != preview.Digest {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":       "Other tags share this digest and will also be deleted, confirm with acknowledge=<digest>",
+			"digest":      preview.Digest,
+			"shared_tags": preview.SharedTags,
+		})
+		return
+	}
 
 	// 使用 digest 删除
-	if err := client.DeleteManifest(repository, manifest.Digest); err != nil {
+	if err := client.DeleteManifest(repository, preview.Digest); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if err := services.RecordImageDeletion(registry.ID, repository, preview.Tags, c.GetString("username")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Image deleted but failed to record tag history: " + err.Error()})
+		return
+	}
+
+	event := models.Event{
+		Type:       models.EventImageDeleted,
+		RegistryID: registry.ID,
+		Repository: repository,
+		Digest:     preview.Digest,
+		Actor:      c.GetString("username"),
+		Summary:    fmt.Sprintf("Image %s@%s was deleted", repository, preview.Digest),
+		Data:       map[string]interface{}{"tags": preview.Tags},
+	}
+	if reference != preview.Digest {
+		event.Tag = reference
+		event.Summary = fmt.Sprintf("Image %s:%s was deleted", repository, reference)
+	}
+	services.Emit(event)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Image deleted successfully"})
 }
 
+// RetagImage 为已有镜像添加标签或将标签移动到该镜像，直接上传原始 manifest，不重新推送镜像层
+func RetagImage(c *gin.Context) {
+	var req models.RetagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+	if rejectMirror(c, registry) {
+		return
+	}
+
+	result, err := services.RetagImage(client, req.Repo, req.Source, req.Tag, req.Force, req.ExpectedDigest)
+	var conflict *services.TagConflictError
+	if errors.As(err, &conflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "current_digest": conflict.CurrentDigest})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.RecordTagChange(client.RegistryID, req.Repo, req.Tag, result.Digest, models.TagSourceRetag, c.GetString("username"), time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Tag updated but failed to record tag history: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 // GetImageConfig 获取镜像配置
 func GetImageConfig(c *gin.Context) {
 	repository := c.Query("repo")
@@ -305,3 +549,27 @@ func GetImageConfig(c *gin.Context) {
 
 	c.JSON(http.StatusOK, configData)
 }
+
+// parsePagination 解析分页参数
+func parsePagination(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	return page, pageSize
+}
+
+// paginated 构造分页响应
+func paginated(data interface{}, total, page, pageSize int) models.PaginatedResponse {
+	return models.PaginatedResponse{
+		Data:       data,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: (total + pageSize - 1) / pageSize,
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"dgui/services"
+)
+
+// GetJobs 获取后台任务列表（带分页）?type=copy&status=running&page=1&page_size=20
+func GetJobs(c *gin.Context) {
+	page, pageSize := parsePagination(c)
+
+	jobs, total, err := services.ListJobs(c.Query("type"), c.Query("status"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, paginated(jobs, int(total), page, pageSize))
+}
+
+// GetJob 获取单个后台任务的状态和进度 ?id=xxx
+func GetJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Query("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id parameter is required"})
+		return
+	}
+
+	job, err := services.GetJob(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// GetJobLogs 获取后台任务日志 ?id=xxx&after=xxx，after 为上次获取到的最后一条日志 ID
+func GetJobLogs(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Query("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id parameter is required"})
+		return
+	}
+	after, _ := strconv.ParseUint(c.Query("after"), 10, 64)
+
+	logs, err := services.GetJobLogs(uint(id), uint(after))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, logs)
+}
+
+// CancelJob 取消排队中或运行中的后台任务 ?id=xxx
+func CancelJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Query("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id parameter is required"})
+		return
+	}
+
+	job, err := services.CancelJob(uint(id))
+	if errors.Is(err, services.ErrJobFinished) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
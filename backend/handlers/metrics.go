@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"dgui/services"
+)
+
+// Metrics 以 Prometheus 文本格式输出指标
+// 设置了 METRICS_TOKEN 时需要在 Authorization: Bearer 请求头或 token 查询参数中提供该值
+func Metrics(c *gin.Context) {
+	if token := os.Getenv("METRICS_TOKEN"); token != "" {
+		provided := c.Query("token")
+		if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			provided = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid metrics token"})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	services.WriteMetrics(c.Writer)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"dgui/models"
+	"dgui/services"
+)
+
+// rejectMirror 镜像站不接受推送和删除，对写操作返回 409 和上游地址
+func rejectMirror(c *gin.Context, registry *models.Registry) bool {
+	if err := services.CheckWritable(registry); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "upstream": registry.Upstream})
+		return true
+	}
+	return false
+}
+
+// PrefetchImages 通过当前镜像站预热镜像：在后台请求 manifest 和所有 blob，使镜像站从上游拉取并缓存，
+// 返回任务，通过 /api/jobs 查询进度
+func PrefetchImages(c *gin.Context) {
+	var req models.PrefetchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.ValidatePrefetchRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+	if !registry.Mirror {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrNotMirror.Error()})
+		return
+	}
+
+	job, err := services.EnqueueJob(models.JobTypePrefetch, registry.ID, services.PrefetchParams{
+		RegistryID: registry.ID,
+		Request:    req,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
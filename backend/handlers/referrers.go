@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetImageReferrers 获取镜像关联的制品（SBOM、签名、证明等）
+// ?repo=xxx&ref=xxx&artifact_type=xxx
+func GetImageReferrers(c *gin.Context) {
+	repository := c.Query("repo")
+	reference := c.Query("ref")
+	if repository == "" || reference == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "repo and ref parameters are required"})
+		return
+	}
+
+	client, _, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+
+	referrers, err := client.GetImageReferrers(repository, reference, c.Query("artifact_type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, referrers)
+}
@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 
 	"dgui/config"
 	"dgui/models"
+	"dgui/services"
 )
 
 // GetRegistries 获取所有 Registry
@@ -16,6 +18,15 @@ func GetRegistries(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+
+	ids := make([]uint, 0, len(registries))
+	for _, registry := range registries {
+		ids = append(ids, registry.ID)
+	}
+	health := services.GetRegistryHealth(ids)
+	for i := range registries {
+		registries[i].Health = health[registries[i].ID]
+	}
 	c.JSON(http.StatusOK, registries)
 }
 
@@ -34,6 +45,30 @@ func GetRegistry(c *gin.Context) {
 	c.JSON(http.StatusOK, registry)
 }
 
+// GetRegistryHealthHistory 获取 Registry 的健康检查记录 ?id=xxx&since=24h
+func GetRegistryHealthHistory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Query("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id parameter is required"})
+		return
+	}
+	since, err := services.ParseAge(c.DefaultQuery("since", "24h"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	checks, err := services.GetHealthHistory(uint(id), since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"health": services.GetRegistryHealth([]uint{uint(id)})[uint(id)],
+		"checks": checks,
+	})
+}
+
 // GetActiveRegistry 获取当前激活的 Registry
 func GetActiveRegistry(c *gin.Context) {
 	var registry models.Registry
@@ -57,6 +92,17 @@ func CreateRegistry(c *gin.Context) {
 		URL:      req.URL,
 		Username: req.Username,
 		Password: req.Password,
+
+		WebhookToken: req.WebhookToken,
+		Kind:         req.Kind,
+		Repositories: req.Repositories,
+		AuthURL:      req.AuthURL,
+		Mirror:       req.Mirror,
+		Upstream:     req.Upstream,
+	}
+	if err := services.NormalizeRegistry(&registry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	// 如果是第一个 registry，设为活跃
@@ -98,8 +144,35 @@ func UpdateRegistry(c *gin.Context) {
 	if req.Name != "" {
 		updates["name"] = req.Name
 	}
-	if req.URL != "" {
-		updates["url"] = req.URL
+	if req.URL != "" || req.Kind != "" || req.Repositories != nil || req.Mirror != nil || req.Upstream != nil {
+		normalized := registry
+		if req.URL != "" {
+			normalized.URL = req.URL
+		} else if req.Kind != "" && req.Kind != registry.Kind {
+			// 切换类型且未填写地址时使用新类型的默认地址
+			normalized.URL = ""
+		}
+		if req.Kind != "" {
+			normalized.Kind = req.Kind
+		}
+		if req.Repositories != nil {
+			normalized.Repositories = *req.Repositories
+		}
+		if req.Mirror != nil {
+			normalized.Mirror = *req.Mirror
+		}
+		if req.Upstream != nil {
+			normalized.Upstream = *req.Upstream
+		}
+		if err := services.NormalizeRegistry(&normalized); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["url"] = normalized.URL
+		updates["kind"] = normalized.Kind
+		updates["repositories"] = normalized.Repositories
+		updates["mirror"] = normalized.Mirror
+		updates["upstream"] = normalized.Upstream
 	}
 	if req.Username != "" {
 		updates["username"] = req.Username
@@ -107,11 +180,18 @@ func UpdateRegistry(c *gin.Context) {
 	if req.Password != "" {
 		updates["password"] = req.Password
 	}
+	if req.WebhookToken != "" {
+		updates["webhook_token"] = req.WebhookToken
+	}
+	if req.AuthURL != nil {
+		updates["auth_url"] = *req.AuthURL
+	}
 
 	if err := config.DB.Model(&registry).Updates(updates).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	services.InvalidateRegistry(registry.ID)
 
 	c.JSON(http.StatusOK, registry)
 }
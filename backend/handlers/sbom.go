@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"dgui/config"
+	"dgui/models"
+	"dgui/services"
+)
+
+// GetImagePackages 获取镜像的软件包列表（带分页和搜索），没有 SBOM 时从镜像层检测
+// ?repo=xxx&ref=xxx&source=sbom|detected&search=xxx&type=deb&page=1&page_size=20&refresh=1
+func GetImagePackages(c *gin.Context) {
+	repository := c.Query("repo")
+	reference := c.Query("ref")
+	if repository == "" || reference == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "repo and ref parameters are required"})
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+
+	client, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+
+	inventory, err := services.GetImageInventory(client, registry.ID, repository, reference, c.Query("source"), c.Query("refresh") == "1")
+	if errors.Is(err, services.ErrNoSBOM) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := config.DB.Model(&models.InventoryPackage{}).Where("inventory_id = ?", inventory.ID)
+	if search := c.Query("search"); search != "" {
+		like := "%" + services.EscapeLike(search) + "%"
+		query = query.Where(`name LIKE ? ESCAPE '\' OR purl LIKE ? ESCAPE '\'`, like, like)
+	}
+	if typ := c.Query("type"); typ != "" {
+		query = query.Where("type = ?", typ)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var packages []models.InventoryPackage
+	if err := query.Order("name, version").Offset((page - 1) * pageSize).Limit(pageSize).Find(&packages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, paginated(gin.H{
+		"inventory": inventory,
+		"packages":  packages,
+	}, int(total), page, pageSize))
+}
+
+// IndexSBOMs 在后台任务中为仓库或整个 Registry 的镜像建立 SBOM 索引，返回任务
+// ?repo=xxx&refresh=1&detect=1，repo 为空时索引整个 Registry，detect=1 时为没有 SBOM 的镜像检测软件包
+func IndexSBOMs(c *gin.Context) {
+	_, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+
+	job, err := services.EnqueueJob(models.JobTypeSBOMIndex, registry.ID, services.SBOMIndexParams{
+		RegistryID: registry.ID,
+		Repository: c.Query("repo"),
+		Refresh:    c.Query("refresh") == "1",
+		Detect:     c.Query("detect") == "1",
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// SearchPackages 搜索包含指定软件包的镜像
+// ?name=openssl&version=3.0.2&page=1&page_size=20，name 支持 * 通配符
+func SearchPackages(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name parameter is required"})
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+
+	_, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+
+	results, total, err := services.SearchPackages(registry.ID, name, c.Query("version"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, paginated(results, int(total), page, pageSize))
+}
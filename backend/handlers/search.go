@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"dgui/config"
+	"dgui/models"
+	"dgui/services"
+)
+
+// SearchImages 在所有 Registry 的搜索索引中搜索标签 ?q=xxx&page=1&page_size=20
+// 查询语法如 label:maintainer=x arch:arm64 repo:team/*，见 services.SearchCatalog
+func SearchImages(c *gin.Context) {
+	page, pageSize := parsePagination(c)
+
+	results, total, err := services.SearchCatalog(c.Query("q"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, paginated(results, int(total), page, pageSize))
+}
+
+// ReindexSearch 在后台任务中重新爬取 Registry 以更新搜索索引 ?registry_id=xxx，不指定时爬取所有 Registry
+func ReindexSearch(c *gin.Context) {
+	var registries []models.Registry
+	query := config.DB.Model(&models.Registry{})
+	if id := c.Query("registry_id"); id != "" {
+		query = query.Where("id = ?", id)
+	}
+	if err := query.Find(&registries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(registries) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Registry not found"})
+		return
+	}
+
+	jobs := []*models.Job{}
+	for _, registry := range registries {
+		job, err := services.EnqueueCrawl(registry.ID, true, "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		jobs = append(jobs, job)
+	}
+	c.JSON(http.StatusAccepted, jobs)
+}
+
+// LookupDigest 按 manifest、config 或镜像层的 digest（或至少 6 位的前缀）反查引用它的 Registry、仓库和标签 ?digest=xxx
+func LookupDigest(c *gin.Context) {
+	digest := c.Query("digest")
+	if digest == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "digest parameter is required"})
+		return
+	}
+
+	result, err := services.LookupDigest(digest)
+	if errors.Is(err, services.ErrInvalidDigest) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"dgui/config"
+	"dgui/models"
+	"dgui/services"
+)
+
+// GetSigningKeys 获取所有签名公钥
+func GetSigningKeys(c *gin.Context) {
+	var keys []models.SigningKey
+	if err := config.DB.Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateSigningKey 添加签名公钥
+func CreateSigningKey(c *gin.Context) {
+	var req models.SigningKeyCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := services.ParsePublicKey(req.PublicKey); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key := models.SigningKey{
+		Name:              req.Name,
+		RegistryID:        req.RegistryID,
+		RepositoryPattern: req.RepositoryPattern,
+		PublicKey:         req.PublicKey,
+	}
+
+	if err := config.DB.Create(&key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	services.InvalidateSignatureCache(0)
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// DeleteSigningKey 删除签名公钥
+func DeleteSigningKey(c *gin.Context) {
+	id := c.Query("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id parameter is required"})
+		return
+	}
+	var key models.SigningKey
+	if err := config.DB.First(&key, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Signing key not found"})
+		return
+	}
+
+	if err := config.DB.Delete(&key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	services.InvalidateSignatureCache(0)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Signing key deleted"})
+}
+
+// GetImageSignature 校验镜像签名
+func GetImageSignature(c *gin.Context) {
+	repository := c.Query("repo")
+	reference := c.Query("ref")
+	if repository == "" || reference == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "repo and ref parameters are required"})
+		return
+	}
+
+	client, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+
+	result, err := services.VerifyImageSignature(client, registry.ID, repository, reference)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
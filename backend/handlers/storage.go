@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"dgui/models"
+	"dgui/services"
+)
+
+// AnalyzeStorage 在后台任务中爬取当前 Registry 并计算存储用量，返回任务
+func AnalyzeStorage(c *gin.Context) {
+	_, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+
+	job, err := services.EnqueueJob(models.JobTypeStorageAnalysis, registry.ID, services.StorageAnalysisParams{RegistryID: registry.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetStorageSummary 获取当前 Registry 最新的存储快照及总量变化
+func GetStorageSummary(c *gin.Context) {
+	_, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+
+	snapshots, err := services.ListStorageSnapshots(registry.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var latest *models.StorageSnapshot
+	if len(snapshots) > 0 {
+		latest = &snapshots[len(snapshots)-1]
+	}
+	c.JSON(http.StatusOK, gin.H{"latest": latest, "history": snapshots})
+}
+
+// parseStorageKind 解析统计维度，默认为仓库
+func parseStorageKind(c *gin.Context) (string, bool) {
+	kind := c.DefaultQuery("kind", models.StorageKindRepository)
+	switch kind {
+	case models.StorageKindRepository, models.StorageKindTag, models.StorageKindNamespace:
+		return kind, true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be repository, tag or namespace"})
+	return "", false
+}
+
+// GetTopStorage 获取占用最大的仓库、标签或命名空间 ?kind=repository&sort=total|unique&limit=20&prefix=xxx
+func GetTopStorage(c *gin.Context) {
+	_, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+	kind, ok := parseStorageKind(c)
+	if !ok {
+		return
+	}
+	orderBy := c.DefaultQuery("sort", "total")
+	if orderBy != "total" && orderBy != "unique" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be total or unique"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > 500 {
+		limit = 20
+	}
+
+	usages, err := services.TopStorageUsage(registry.ID, kind, orderBy, c.Query("prefix"), limit)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No storage analysis has been run for this registry"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, usages)
+}
+
+// GetStorageHistory 获取仓库或命名空间的存储用量历史 ?kind=repository&name=xxx
+func GetStorageHistory(c *gin.Context) {
+	_, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+	kind, ok := parseStorageKind(c)
+	if !ok {
+		return
+	}
+	name := c.Query("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name parameter is required"})
+		return
+	}
+
+	points, err := services.StorageHistory(registry.ID, kind, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, points)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"dgui/models"
+	"dgui/services"
+)
+
+// GetTagHistory 获取标签指向的变化记录（带分页）?repo=xxx&tag=xxx&page=1&page_size=20
+// 指定 at（RFC 3339 或时长，如 7d）时返回该时刻标签指向的记录；check=1 时检查各 digest 的 manifest 是否仍然存在
+func GetTagHistory(c *gin.Context) {
+	repository := c.Query("repo")
+	tag := c.Query("tag")
+	if repository == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "repo parameter is required"})
+		return
+	}
+	client, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+	check := c.Query("check") == "1" || c.Query("check") == "true"
+
+	if v := c.Query("at"); v != "" {
+		if tag == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tag parameter is required with at"})
+			return
+		}
+		at, err := parseTimeOrAge(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid at parameter"})
+			return
+		}
+		entry, err := services.TagHistoryAt(registry.ID, repository, tag, at)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if entry == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No history recorded for this tag at that time"})
+			return
+		}
+		history := []models.TagHistory{*entry}
+		if check {
+			services.CheckHistoryAvailability(client, repository, history)
+		}
+		c.JSON(http.StatusOK, history[0])
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+	history, total, err := services.ListTagHistory(registry.ID, repository, tag, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if check {
+		services.CheckHistoryAvailability(client, repository, history)
+	}
+	c.JSON(http.StatusOK, paginated(history, int(total), page, pageSize))
+}
+
+// RestoreTag 将标签恢复到历史上指向过的 digest，该 manifest 必须仍然存在
+func RestoreTag(c *gin.Context) {
+	var req models.TagRestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+	if rejectMirror(c, registry) {
+		return
+	}
+
+	result, err := services.RestoreTag(client, &req, c.GetString("username"))
+	var conflict *services.TagConflictError
+	switch {
+	case errors.As(err, &conflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "current_digest": conflict.CurrentDigest})
+	case errors.Is(err, services.ErrDigestNotInHistory):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrManifestUnavailable):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"dgui/config"
+	"dgui/models"
+	"dgui/services"
+)
+
+// ImportVulnerabilityDB 创建导入 OSV 格式离线漏洞库的后台任务，导入替换已有数据并在完成后重新匹配所有清单。
+// 支持上传文件（multipart 字段 file，.json 或 .zip），或通过 ?path=xxx 指定环境变量 VULN_DB_PATH 下的目录 / 文件，
+// 都没有时使用 VULN_DB_PATH
+func ImportVulnerabilityDB(c *gin.Context) {
+	params := services.VulnDBImportParams{}
+
+	if file, err := c.FormFile("file"); err == nil {
+		// 任务导入结束后删除临时目录
+		tmpDir, err := os.MkdirTemp("", "dgui-osv-*")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		params.Source = filepath.Join(tmpDir, filepath.Base(file.Filename))
+		params.Upload = true
+		if err := c.SaveUploadedFile(file, params.Source); err != nil {
+			os.RemoveAll(tmpDir)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		source, err := services.ResolveVulnDBPath(c.Query("path"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.Source = source
+	}
+
+	job, err := services.EnqueueJob(models.JobTypeVulnImport, 0, params)
+	if err != nil {
+		if params.Upload {
+			os.RemoveAll(filepath.Dir(params.Source))
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetVulnerabilityDB 获取当前漏洞库的版本信息
+func GetVulnerabilityDB(c *gin.Context) {
+	db, err := services.GetVulnerabilityDB()
+	if errors.Is(err, services.ErrNoVulnerabilityDB) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, db)
+}
+
+// GetImageVulnerabilities 获取镜像的漏洞列表（带分页），没有清单时先建立清单，结果过期时重新匹配
+// ?repo=xxx&ref=xxx&source=sbom|detected&severity=CRITICAL,HIGH&search=xxx&page=1&page_size=20
+func GetImageVulnerabilities(c *gin.Context) {
+	repository := c.Query("repo")
+	reference := c.Query("ref")
+	if repository == "" || reference == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "repo and ref parameters are required"})
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+
+	client, registry, err := getActiveRegistryClient()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No active registry"})
+		return
+	}
+
+	inventory, err := services.GetImageInventory(client, registry.ID, repository, reference, c.Query("source"), false)
+	if errors.Is(err, services.ErrNoSBOM) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	scan, err := services.EnsureInventoryScan(inventory)
+	if errors.Is(err, services.ErrNoVulnerabilityDB) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := config.DB.Model(&models.ImageVulnerability{}).Where("inventory_id = ?", inventory.ID)
+	if severity := c.Query("severity"); severity != "" {
+		query = query.Where("severity IN ?", strings.Split(strings.ToUpper(severity), ","))
+	}
+	if search := c.Query("search"); search != "" {
+		like := "%" + services.EscapeLike(search) + "%"
+		query = query.Where(`package LIKE ? ESCAPE '\' OR advisory_id LIKE ? ESCAPE '\' OR cve LIKE ? ESCAPE '\'`, like, like, like)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var vulnerabilities []models.ImageVulnerability
+	order := "CASE severity WHEN 'CRITICAL' THEN 0 WHEN 'HIGH' THEN 1 WHEN 'MEDIUM' THEN 2 WHEN 'LOW' THEN 3 ELSE 4 END, score DESC, package"
+	if err := query.Order(order).Offset((page - 1) * pageSize).Limit(pageSize).Find(&vulnerabilities).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, paginated(gin.H{
+		"inventory":       inventory,
+		"scan":            scan,
+		"vulnerabilities": vulnerabilities,
+	}, int(total), page, pageSize))
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"dgui/config"
+	"dgui/models"
+	"dgui/services"
+)
+
+// applyWebhookRequest 将请求中设置的字段写入目标
+func applyWebhookRequest(target *models.WebhookTarget, req *models.WebhookTargetRequest) {
+	if req.Name != "" {
+		target.Name = req.Name
+	}
+	if req.URL != "" {
+		target.URL = req.URL
+	}
+	if req.Format != "" {
+		target.Format = req.Format
+	}
+	if req.Events != nil {
+		target.Events = strings.Join(req.Events, ",")
+	}
+	if req.Template != nil {
+		target.Template = *req.Template
+	}
+	if req.Secret != nil {
+		target.Secret = *req.Secret
+	}
+	if req.Enabled != nil {
+		target.Enabled = *req.Enabled
+	}
+	target.HasSecret = target.Secret != ""
+}
+
+// GetWebhooks 获取所有出站 Webhook
+func GetWebhooks(c *gin.Context) {
+	var targets []models.WebhookTarget
+	if err := config.DB.Find(&targets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range targets {
+		targets[i].HasSecret = targets[i].Secret != ""
+	}
+	c.JSON(http.StatusOK, gin.H{"targets": targets, "events": services.WebhookEventTypes})
+}
+
+// CreateWebhook 添加出站 Webhook
+func CreateWebhook(c *gin.Context) {
+	var req models.WebhookTargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == "" || req.URL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name and url are required"})
+		return
+	}
+
+	target := models.WebhookTarget{Format: models.WebhookFormatJSON, Enabled: true}
+	applyWebhookRequest(&target, &req)
+	if err := services.ValidateWebhookTarget(&target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.DB.Create(&target).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, target)
+}
+
+// UpdateWebhook 更新出站 Webhook ?id=xxx，未提供的字段保持不变
+func UpdateWebhook(c *gin.Context) {
+	id := c.Query("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id parameter is required"})
+		return
+	}
+	var target models.WebhookTarget
+	if err := config.DB.First(&target, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	var req models.WebhookTargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	applyWebhookRequest(&target, &req)
+	if err := services.ValidateWebhookTarget(&target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.DB.Save(&target).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, target)
+}
+
+// DeleteWebhook 删除出站 Webhook 及其投递记录 ?id=xxx
+func DeleteWebhook(c *gin.Context) {
+	id := c.Query("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id parameter is required"})
+		return
+	}
+	var target models.WebhookTarget
+	if err := config.DB.First(&target, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	if err := config.DB.Delete(&target).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	config.DB.Where("target_id = ?", target.ID).Delete(&models.WebhookDelivery{})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// TestWebhook 立即向出站 Webhook 发送测试事件 ?id=xxx
+func TestWebhook(c *gin.Context) {
+	id := c.Query("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id parameter is required"})
+		return
+	}
+	var target models.WebhookTarget
+	if err := config.DB.First(&target, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	delivery, err := services.SendTestWebhook(&target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
+
+// GetWebhookDeliveries 获取投递记录（带分页）?target_id=xxx&status=failed&page=1&page_size=20
+func GetWebhookDeliveries(c *gin.Context) {
+	page, pageSize := parsePagination(c)
+	targetID, _ := strconv.ParseUint(c.Query("target_id"), 10, 64)
+
+	deliveries, total, err := services.ListWebhookDeliveries(uint(targetID), c.Query("status"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, paginated(deliveries, int(total), page, pageSize))
+}
+
+// RedeliverWebhook 重新发送一次投递 ?id=xxx
+func RedeliverWebhook(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Query("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id parameter is required"})
+		return
+	}
+
+	delivery, err := services.RedeliverWebhook(uint(id))
+	if errors.Is(err, services.ErrDeliveryPending) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
@@ -7,6 +7,7 @@ import (
 
 	"dgui/config"
 	"dgui/routes"
+	"dgui/services"
 )
 
 func main() {
@@ -22,6 +23,18 @@ func main() {
 	// 初始化数据库
 	config.InitDB()
 
+	// 启动后台任务调度，恢复上次中断的任务
+	services.StartJobWorkers()
+
+	// 启动出站 Webhook 投递
+	services.StartWebhookDispatcher()
+
+	// 启动 Registry 健康检查
+	services.StartHealthMonitor()
+
+	// 启动镜像目录的定期爬取
+	services.StartCatalogCrawler()
+
 	// 设置路由
 	r := routes.SetupRouter()
 
@@ -0,0 +1,48 @@
+package models
+
+// Descriptor OCI 内容描述符
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// 制品分类
+const (
+	ArtifactCategorySBOM        = "sbom"
+	ArtifactCategorySignature   = "signature"
+	ArtifactCategoryAttestation = "attestation"
+	ArtifactCategoryOther       = "other"
+)
+
+// 制品来源
+const (
+	ReferrerSourceAPI       = "referrers-api" // OCI 1.1 referrers API
+	ReferrerSourceTagSchema = "tag-schema"    // sha256-<hex> 回退标签
+	ReferrerSourceCosignTag = "cosign-tag"    // cosign 的 .sig / .att / .sbom 标签
+	ReferrerSourceIndex     = "index"         // BuildKit 写入 index 的 attestation manifest
+)
+
+// Referrer 关联到镜像的制品（SBOM、签名、证明等）
+type Referrer struct {
+	Digest       string            `json:"digest"`
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType"`
+	Size         int64             `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Category     string            `json:"category"`
+	Format       string            `json:"format"`
+	Source       string            `json:"source"`
+	Tag          string            `json:"tag,omitempty"`
+}
+
+// ImageReferrers 镜像的关联制品列表
+type ImageReferrers struct {
+	Name      string     `json:"name"`
+	Reference string     `json:"reference"`
+	Digest    string     `json:"digest"`
+	Referrers []Referrer `json:"referrers"`
+	Warnings  []string   `json:"warnings,omitempty"` // 查询失败的来源，结果可能不完整
+}
@@ -0,0 +1,72 @@
+package models
+
+// 批量删除中单个标签的处理结果
+const (
+	BulkDeleteStatusDeleted = "deleted"
+	BulkDeleteStatusSkipped = "skipped"
+	BulkDeleteStatusFailed  = "failed"
+)
+
+// ImageRef 仓库中的一个标签
+type ImageRef struct {
+	Repo string `json:"repo" binding:"required"`
+	Tag  string `json:"tag" binding:"required"`
+}
+
+// ConfirmedTag 用户在预览中确认删除的标签及其 digest
+type ConfirmedTag struct {
+	Repo   string `json:"repo" binding:"required"`
+	Tag    string `json:"tag" binding:"required"`
+	Digest string `json:"digest" binding:"required"`
+}
+
+// BulkDeleteFilter 按条件选择要删除的标签，各条件同时满足
+type BulkDeleteFilter struct {
+	Repositories []string `json:"repositories"` // 仓库名或模式（如 team/**、app-*），为空表示所有仓库
+	TagPattern   string   `json:"tag_pattern"`  // 标签正则表达式
+	OlderThan    string   `json:"older_than"`   // 镜像创建时间早于该时长，如 720h、30d
+}
+
+// BulkDeleteRequest 批量删除请求，可以同时指定标签列表和过滤条件
+type BulkDeleteRequest struct {
+	Tags          []ImageRef        `json:"tags"`
+	Filter        *BulkDeleteFilter `json:"filter"`
+	IncludeShared bool              `json:"include_shared"` // 执行时也删除与未选中标签共享 digest 的镜像
+	Confirmed     []ConfirmedTag    `json:"confirmed"`      // 预览中确认删除的条目，设置后任务只删除其中 digest 未变的标签
+}
+
+// BulkDeleteItem 批量删除中的一个标签
+type BulkDeleteItem struct {
+	Repo       string   `json:"repo"`
+	Tag        string   `json:"tag"`
+	Digest     string   `json:"digest"`
+	Created    string   `json:"created,omitempty"`
+	SharedTags []string `json:"shared_tags,omitempty"` // 指向同一 digest 但未被选中的标签，删除时会一并消失
+	Status     string   `json:"status,omitempty"`
+	Message    string   `json:"message,omitempty"`
+}
+
+// BulkDeletePreview 批量删除预览
+type BulkDeletePreview struct {
+	Items    []BulkDeleteItem `json:"items"`
+	Digests  int              `json:"digests"` // 将被删除的 manifest 数量
+	Warnings []string         `json:"warnings"`
+}
+
+// BulkDeleteResult 批量删除的执行结果
+type BulkDeleteResult struct {
+	Deleted int              `json:"deleted"`
+	Skipped int              `json:"skipped"`
+	Failed  int              `json:"failed"`
+	Items   []BulkDeleteItem `json:"items"`
+}
+
+// DeletePreview 删除单个镜像前的确认信息
+type DeletePreview struct {
+	Repo       string   `json:"repo"`
+	Reference  string   `json:"reference"`
+	Digest     string   `json:"digest"`
+	Tags       []string `json:"tags"`        // 指向该 digest 的所有标签
+	SharedTags []string `json:"shared_tags"` // 除 reference 外会被一并删除的标签
+	Warnings   []string `json:"warnings,omitempty"`
+}
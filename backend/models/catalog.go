@@ -0,0 +1,159 @@
+package models
+
+import "time"
+
+// manifest 引用的内容类型
+const (
+	ReferenceKindConfig   = "config"
+	ReferenceKindLayer    = "layer"
+	ReferenceKindManifest = "manifest" // index 引用的子 manifest
+)
+
+// CatalogTag 爬取到的标签及其指向的顶层 manifest
+type CatalogTag struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	RegistryID uint      `gorm:"uniqueIndex:idx_catalog_tag;not null" json:"registry_id"`
+	Repository string    `gorm:"size:255;uniqueIndex:idx_catalog_tag;not null" json:"repository"`
+	Tag        string    `gorm:"size:255;uniqueIndex:idx_catalog_tag;not null" json:"tag"`
+	Digest     string    `gorm:"size:100;index;not null" json:"digest"`
+	CrawledAt  time.Time `json:"crawled_at"`
+}
+
+// CatalogRepository 爬取得到的仓库元数据，用于仓库列表的排序和过滤
+type CatalogRepository struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	RegistryID uint       `gorm:"uniqueIndex:idx_catalog_repository;not null" json:"registry_id"`
+	Name       string     `gorm:"size:255;uniqueIndex:idx_catalog_repository;not null" json:"name"`
+	TagCount   int        `json:"tag_count"`
+	TotalSize  int64      `json:"total_size"`            // 所有标签引用的 blob 去重后的大小
+	LastPushed *time.Time `json:"last_pushed,omitempty"` // Registry 通知中最近的推送时间，没有时为最新镜像的构建时间
+	Labels     string     `gorm:"type:text" json:"-"`    // 镜像 label 的键，每行一个
+	Stale      bool       `json:"stale"`                 // 收到推送或删除通知后置位，下次增量爬取时刷新该仓库
+}
+
+// CatalogManifest 爬取到的 manifest，按 digest 去重（内容不可变，只需获取一次）
+type CatalogManifest struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	RegistryID   uint      `gorm:"uniqueIndex:idx_catalog_manifest;not null" json:"registry_id"`
+	Digest       string    `gorm:"size:100;uniqueIndex:idx_catalog_manifest;not null" json:"digest"`
+	MediaType    string    `gorm:"size:255" json:"media_type"`
+	ArtifactType string    `gorm:"size:255" json:"artifact_type,omitempty"`
+	Size         int64     `json:"size"` // manifest 本身的字节数
+
+	// 以下字段来自镜像配置，index 和非镜像制品为空
+	OS           string     `gorm:"size:50" json:"os,omitempty"`
+	Architecture string     `gorm:"size:50" json:"architecture,omitempty"`
+	Variant      string     `gorm:"size:50" json:"variant,omitempty"`
+	Created      *time.Time `json:"created,omitempty"`
+	Labels       string     `gorm:"type:text" json:"-"` // JSON 对象
+	Env          string     `gorm:"type:text" json:"-"` // 每行一个 KEY=value
+	Entrypoint   string     `gorm:"type:text" json:"-"` // Entrypoint 和 Cmd
+	History      string     `gorm:"type:text" json:"-"` // 每行一条构建命令
+}
+
+// CatalogReference manifest 引用的 config、镜像层或子 manifest
+type CatalogReference struct {
+	ID             uint   `gorm:"primarykey" json:"id"`
+	RegistryID     uint   `gorm:"index:idx_catalog_reference_manifest;not null" json:"registry_id"`
+	ManifestDigest string `gorm:"size:100;index:idx_catalog_reference_manifest;not null" json:"manifest_digest"`
+	Digest         string `gorm:"size:100;index;not null" json:"digest"`
+	Kind           string `gorm:"size:20;not null" json:"kind"`
+	MediaType      string `gorm:"size:255" json:"media_type"`
+	Size           int64  `json:"size"`
+	Platform       string `gorm:"size:100" json:"platform,omitempty"` // 子 manifest 的平台，如 linux/arm64/v8
+}
+
+// 爬取方式
+const (
+	CrawlModeFull        = "full"        // 重新解析所有标签的 digest 并刷新所有仓库
+	CrawlModeIncremental = "incremental" // 重新解析所有标签的 digest，只刷新有变化或收到通知的仓库
+	CrawlModeRepository  = "repository"  // 刷新单个仓库
+)
+
+// CrawlResult 爬取结果
+type CrawlResult struct {
+	Mode         string `json:"mode"`
+	Repositories int    `json:"repositories"`
+	Tags         int    `json:"tags"`      // 解析了 digest 的标签数
+	Manifests    int    `json:"manifests"` // 新获取的 manifest 数量
+	Changed      int    `json:"changed"`   // 有变化的仓库数
+	Skipped      int    `json:"skipped"`   // 标签没有变化而跳过刷新的仓库数
+	Failed       int    `json:"failed"`
+	DurationMs   int64  `json:"duration_ms"`
+}
+
+// CrawlStatus Registry 的爬取状态
+type CrawlStatus struct {
+	ID            uint       `gorm:"primarykey" json:"-"`
+	RegistryID    uint       `gorm:"uniqueIndex;not null" json:"registry_id"`
+	Registry      string     `gorm:"-" json:"registry"`
+	Running       bool       `json:"running"`
+	JobID         uint       `json:"job_id"` // 最近一次爬取的任务
+	StartedAt     *time.Time `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+	Error         string     `gorm:"type:text" json:"error,omitempty"`
+	CrawlResult              // 最近一次爬取的结果
+	LastSuccessAt *time.Time `json:"last_success_at"`
+	LastFullAt    *time.Time `json:"last_full_at"`
+	NextRunAt     *time.Time `gorm:"-" json:"next_run_at,omitempty"`
+}
+
+// SearchResult 搜索命中的标签
+type SearchResult struct {
+	RegistryID uint              `json:"registry_id"`
+	Registry   string            `json:"registry"`
+	Repository string            `json:"repository"`
+	Tag        string            `json:"tag"`
+	Digest     string            `json:"digest"`
+	OS         []string          `json:"os"`
+	Arch       []string          `json:"arch"`
+	Created    string            `json:"created,omitempty"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// DigestMatch 按 digest 反查的结果：匹配到的 manifest、config 或镜像层及引用它的标签
+type DigestMatch struct {
+	Digest    string           `json:"digest"`
+	Kind      string           `json:"kind"` // manifest / config / layer
+	MediaType string           `json:"media_type"`
+	Size      int64            `json:"size"`
+	Tags      []DigestTagUsage `json:"tags"`
+}
+
+// DigestLookup 按 digest 或前缀反查的结果
+type DigestLookup struct {
+	Matches   []DigestMatch `json:"matches"`
+	Truncated bool          `json:"truncated"` // 前缀匹配到的 digest 超过上限，只返回了前一部分
+}
+
+// DigestTagUsage 引用某个 digest 的标签
+type DigestTagUsage struct {
+	RegistryID uint   `json:"registry_id"`
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+	Digest     string `json:"digest"`             // 标签指向的 manifest
+	Platform   string `json:"platform,omitempty"` // 经由多架构镜像中某个平台引用时的平台
+}
+
+// NamespaceNode 仓库命名空间树中的节点，统计值包含节点下所有仓库
+type NamespaceNode struct {
+	Name         string `json:"name"` // 路径的最后一段
+	Path         string `json:"path"`
+	IsRepository bool   `json:"is_repository"` // 路径本身是一个仓库
+	HasChildren  bool   `json:"has_children"`  // 路径下还有仓库，可按 prefix 展开
+	Repositories int    `json:"repositories"`
+	Tags         int    `json:"tags"`    // 已爬取仓库的标签数之和
+	Crawled      int    `json:"crawled"` // 标签数已知（已爬取）的仓库数
+	Size         *int64 `json:"size,omitempty"`
+}
+
+// NamespaceTree 命名空间树中一个前缀的展开结果
+type NamespaceTree struct {
+	Node     NamespaceNode   `json:"node"`
+	Children []NamespaceNode `json:"children"`          // 直接子节点；搜索时为匹配的仓库
+	Total    int             `json:"total"`             // 子节点总数，超过上限时 Children 被截断
+	SizeAt   *time.Time      `json:"size_at,omitempty"` // 大小来自的存储分析时间
+}
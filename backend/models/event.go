@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Registry 通知中的事件动作
+const (
+	EventActionPush   = "push"
+	EventActionPull   = "pull"
+	EventActionDelete = "delete"
+)
+
+// RegistryEvent Registry 通知回调收到的事件，记录镜像何时由谁推送或删除
+type RegistryEvent struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	RegistryID uint      `gorm:"uniqueIndex:idx_registry_event;index:idx_registry_event_repo;not null" json:"registry_id"`
+	EventID    string    `gorm:"size:100;uniqueIndex:idx_registry_event;not null" json:"event_id"` // Registry 生成的事件 ID，重试投递时不重复记录
+	Action     string    `gorm:"size:20;index;not null" json:"action"`
+	Repository string    `gorm:"size:255;index:idx_registry_event_repo" json:"repository"`
+	Tag        string    `gorm:"size:255" json:"tag"`
+	Digest     string    `gorm:"size:100;index" json:"digest"`
+	MediaType  string    `gorm:"size:255" json:"media_type"`
+	Size       int64     `json:"size"`
+	Actor      string    `gorm:"size:255" json:"actor"`       // 认证用户名，匿名访问时为空
+	SourceAddr string    `gorm:"size:255" json:"source_addr"` // 客户端地址
+	UserAgent  string    `gorm:"size:500" json:"user_agent"`
+	Timestamp  time.Time `gorm:"index" json:"timestamp"`
+}
+
+// RegistryNotification docker/distribution 通知的请求体
+type RegistryNotification struct {
+	Events []RegistryNotificationEvent `json:"events"`
+}
+
+// RegistryNotificationEvent 通知中的单个事件
+type RegistryNotificationEvent struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"`
+	Target    struct {
+		MediaType  string `json:"mediaType"`
+		Size       int64  `json:"size"`
+		Digest     string `json:"digest"`
+		Repository string `json:"repository"`
+		URL        string `json:"url"`
+		Tag        string `json:"tag"`
+	} `json:"target"`
+	Request struct {
+		ID        string `json:"id"`
+		Addr      string `json:"addr"`
+		Host      string `json:"host"`
+		Method    string `json:"method"`
+		UserAgent string `json:"useragent"`
+	} `json:"request"`
+	Actor struct {
+		Name string `json:"name"`
+	} `json:"actor"`
+}
+
+// NotificationResult 处理通知的结果
+type NotificationResult struct {
+	Received int `json:"received"`
+	Stored   int `json:"stored"`
+	Ignored  int `json:"ignored"` // 重复投递或 blob 层事件
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// HarborProject Harbor 项目及其存储配额
+type HarborProject struct {
+	ProjectID    int64      `json:"project_id"`
+	Name         string     `json:"name"`
+	Public       bool       `json:"public"`
+	OwnerName    string     `json:"owner_name"`
+	RepoCount    int        `json:"repo_count"`
+	CreationTime *time.Time `json:"creation_time"`
+	UpdateTime   *time.Time `json:"update_time"`
+	QuotaHard    *int64     `json:"quota_hard,omitempty"` // 存储配额（字节），-1 表示不限
+	QuotaUsed    *int64     `json:"quota_used,omitempty"` // 已使用的存储（字节）
+}
+
+// HarborScanReport Harbor 中镜像已有的漏洞扫描结果，漏洞数量按 dgui 的严重等级统计
+type HarborScanReport struct {
+	Digest    string     `json:"digest"`
+	Status    string     `json:"status"`   // Harbor 的扫描状态，如 Success、Running、Error，未扫描时为 Not Scanned
+	Severity  string     `json:"severity"` // 最高严重等级
+	Scanner   string     `json:"scanner"`  // 扫描器名称和版本，如 Trivy v0.50.1
+	StartTime *time.Time `json:"start_time,omitempty"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+	Fixable   int        `json:"fixable"`
+	VulnerabilitySummary
+}
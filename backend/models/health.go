@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Registry 健康状态
+const (
+	HealthStatusUp      = "up"
+	HealthStatusDown    = "down"
+	HealthStatusUnknown = "unknown" // 尚未检查
+)
+
+// RegistryHealthCheck 一次 /v2/ 探测的结果
+type RegistryHealthCheck struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	RegistryID    uint       `gorm:"index:idx_health_registry_time;not null" json:"registry_id"`
+	CheckedAt     time.Time  `gorm:"index:idx_health_registry_time;index" json:"checked_at"`
+	Up            bool       `json:"up"`
+	StatusCode    int        `json:"status_code"`
+	LatencyMs     int64      `json:"latency_ms"`
+	Error         string     `gorm:"size:500" json:"error,omitempty"`
+	CertExpiresAt *time.Time `json:"cert_expires_at,omitempty"` // HTTPS 时服务端证书的过期时间
+}
+
+// RegistryHealth Registry 的当前状态和可用率，随 Registry 列表返回
+type RegistryHealth struct {
+	Status        string     `json:"status"`
+	CheckedAt     *time.Time `json:"checked_at,omitempty"`
+	LatencyMs     int64      `json:"latency_ms"`
+	StatusCode    int        `json:"status_code,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	CertExpiresAt *time.Time `json:"cert_expires_at,omitempty"`
+	CertDaysLeft  *int       `json:"cert_days_left,omitempty"`
+	Uptime24h     *float64   `json:"uptime_24h,omitempty"` // 百分比，没有检查记录时为空
+	Uptime7d      *float64   `json:"uptime_7d,omitempty"`
+}
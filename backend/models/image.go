@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // RegistryCatalog Docker Registry 目录响应
 type RegistryCatalog struct {
 	Repositories []string `json:"repositories"`
@@ -13,12 +15,25 @@ type RegistryTags struct {
 
 // ImageManifest 镜像清单
 type ImageManifest struct {
-	SchemaVersion int             `json:"schemaVersion"`
-	MediaType     string          `json:"mediaType"`
-	Config        ManifestConfig  `json:"config"`
-	Layers        []ManifestLayer `json:"layers"`
-	Digest        string          `json:"digest"`
-	TotalSize     int64           `json:"totalSize"`
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        ManifestConfig    `json:"config"`
+	Layers        []ManifestLayer   `json:"layers"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+	Digest        string            `json:"digest"`
+	TotalSize     int64             `json:"totalSize"`
+
+	// Raw 引用对应的原始 manifest（多架构镜像为 index），用于原样重新上传
+	Raw *RawManifest `json:"-"`
+}
+
+// RawManifest 原始 manifest 内容及其媒体类型和 digest
+type RawManifest struct {
+	MediaType string
+	Digest    string
+	Body      []byte
 }
 
 // ManifestConfig 清单配置
@@ -30,9 +45,10 @@ type ManifestConfig struct {
 
 // ManifestLayer 清单层
 type ManifestLayer struct {
-	MediaType string `json:"mediaType"`
-	Size      int64  `json:"size"`
-	Digest    string `json:"digest"`
+	MediaType   string            `json:"mediaType"`
+	Size        int64             `json:"size"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // ManifestPlatform 平台信息（用于多架构镜像）
@@ -44,10 +60,12 @@ type ManifestPlatform struct {
 
 // ManifestDescriptor manifest 描述符（用于 manifest list / OCI index）
 type ManifestDescriptor struct {
-	MediaType string           `json:"mediaType"`
-	Size      int64            `json:"size"`
-	Digest    string           `json:"digest"`
-	Platform  ManifestPlatform `json:"platform"`
+	MediaType    string            `json:"mediaType"`
+	Size         int64             `json:"size"`
+	Digest       string            `json:"digest"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Platform     ManifestPlatform  `json:"platform"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
 }
 
 // ManifestList 多架构镜像清单列表
@@ -61,6 +79,7 @@ type ManifestList struct {
 type ImageConfig struct {
 	Architecture  string          `json:"architecture"`
 	OS            string          `json:"os"`
+	Variant       string          `json:"variant,omitempty"`
 	Created       string          `json:"created"`
 	Author        string          `json:"author"`
 	DockerVersion string          `json:"docker_version"`
@@ -100,20 +119,38 @@ type RootFS struct {
 
 // ImageInfo 镜像完整信息
 type ImageInfo struct {
-	Name       string        `json:"name"`
-	Tag        string        `json:"tag"`
-	Digest     string        `json:"digest"`
-	Manifest   ImageManifest `json:"manifest"`
-	Config     ImageConfig   `json:"config"`
-	TotalSize  int64         `json:"total_size"`
-	LayerCount int           `json:"layer_count"`
+	Name       string           `json:"name"`
+	Tag        string           `json:"tag"`
+	Digest     string           `json:"digest"`
+	Manifest   ImageManifest    `json:"manifest"`
+	Config     ImageConfig      `json:"config"`
+	TotalSize  int64            `json:"total_size"`
+	LayerCount int              `json:"layer_count"`
+	Signature  *SignatureResult `json:"signature,omitempty"`
 }
 
 // RepositoryInfo 仓库信息
 type RepositoryInfo struct {
-	Name     string   `json:"name"`
-	Tags     []string `json:"tags"`
-	TagCount int      `json:"tag_count"`
+	Name       string     `json:"name"`
+	Tags       []string   `json:"tags"`
+	TagCount   int        `json:"tag_count"`
+	TotalSize  *int64     `json:"total_size,omitempty"`  // 来自爬取结果，实时获取时为空
+	LastPushed *time.Time `json:"last_pushed,omitempty"` // 来自爬取结果或 Harbor，实时获取其他 Registry 时为空
+
+	PullCount   *int64 `json:"pull_count,omitempty"`  // 来自 Harbor
+	Description string `json:"description,omitempty"` // 来自 Harbor
+}
+
+// RepositoryQuery 基于爬取结果的仓库列表排序和过滤条件
+type RepositoryQuery struct {
+	Search       string
+	Sort         string // name / tags / pushed / size
+	Desc         bool
+	TagPattern   string // 至少一个标签匹配该正则
+	MinTags      *int
+	MaxTags      *int
+	UpdatedSince *time.Time
+	Label        string // 存在该 label 的键，也可以匹配带前缀的键
 }
 
 // PaginatedResponse 分页响应
@@ -127,11 +164,57 @@ type PaginatedResponse struct {
 
 // TagInfo 标签详细信息
 type TagInfo struct {
-	Name       string `json:"name"`
-	Digest     string `json:"digest"`
-	OS         string `json:"os"`
-	Arch       string `json:"arch"`
-	Size       int64  `json:"size"`
-	LayerCount int    `json:"layer_count"`
-	Created    string `json:"created"`
+	Name           string `json:"name"`
+	Digest         string `json:"digest"`
+	OS             string `json:"os"`
+	Arch           string `json:"arch"`
+	Size           int64  `json:"size"`
+	LayerCount     int    `json:"layer_count"`
+	Created        string `json:"created"`
+	Signature      string `json:"signature,omitempty"`
+	SignatureError string `json:"signature_error,omitempty"` // 签名状态为 error 时的错误信息
+	PushedAt       string `json:"pushed_at,omitempty"`       // 来自 Registry 通知，未配置通知时为空
+	PushedBy       string `json:"pushed_by,omitempty"`
+
+	Vulnerabilities *VulnerabilitySummary `json:"vulnerabilities,omitempty"`
+}
+
+// DockerfileInstruction 由构建历史还原出的一条 Dockerfile 指令
+type DockerfileInstruction struct {
+	Instruction string `json:"instruction"`
+	CreatedBy   string `json:"created_by"`
+	Created     string `json:"created"`
+	Comment     string `json:"comment,omitempty"`
+	EmptyLayer  bool   `json:"empty_layer"`
+	LayerIndex  int    `json:"layer_index"` // 对应 manifest 中的层序号，空层为 -1
+	LayerDigest string `json:"layer_digest,omitempty"`
+	LayerSize   int64  `json:"layer_size"`
+}
+
+// ReconstructedDockerfile 还原的 Dockerfile
+type ReconstructedDockerfile struct {
+	Name         string                  `json:"name"`
+	Tag          string                  `json:"tag"`
+	Digest       string                  `json:"digest"`
+	Instructions []DockerfileInstruction `json:"instructions"`
+	Aligned      bool                    `json:"aligned"` // 非空历史条目数与层数是否一致
+	Dockerfile   string                  `json:"dockerfile"`
+}
+
+// RetagRequest 为已有镜像添加或移动标签的请求
+type RetagRequest struct {
+	Repo           string `json:"repo" binding:"required"`
+	Source         string `json:"source" binding:"required"` // 源标签或 digest
+	Tag            string `json:"tag" binding:"required"`
+	Force          bool   `json:"force"`           // 标签已指向其他镜像时允许移动
+	ExpectedDigest string `json:"expected_digest"` // 移动标签时要求标签当前指向该 digest，防止覆盖并发修改
+}
+
+// RetagResult 添加或移动标签的结果
+type RetagResult struct {
+	Repo           string `json:"repo"`
+	Tag            string `json:"tag"`
+	Digest         string `json:"digest"`
+	PreviousDigest string `json:"previous_digest,omitempty"` // 移动前标签指向的 digest
+	Moved          bool   `json:"moved"`
 }
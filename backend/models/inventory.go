@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// 软件包清单来源
+const (
+	InventorySourceSBOM     = "sbom"     // 镜像附带的 SBOM 制品
+	InventorySourceDetected = "detected" // 从镜像层内容检测
+)
+
+// PackageInventory 镜像（按 digest）的软件包清单
+type PackageInventory struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Digest       string    `gorm:"size:100;uniqueIndex:idx_inventory_digest_source;not null" json:"digest"`
+	Source       string    `gorm:"size:20;uniqueIndex:idx_inventory_digest_source;not null" json:"source"`
+	Format       string    `gorm:"size:50" json:"format"`       // spdx / cyclonedx / detected
+	SBOMDigest   string    `gorm:"size:100" json:"sbom_digest"` // SBOM 制品 manifest 的 digest
+	Distro       string    `gorm:"size:100" json:"distro"`      // 发行版，如 debian:12、alpine:3.19
+	PackageCount int       `json:"package_count"`
+}
+
+// InventoryPackage 清单中的软件包
+type InventoryPackage struct {
+	ID          uint   `gorm:"primarykey" json:"id"`
+	InventoryID uint   `gorm:"index;not null" json:"inventory_id"`
+	Name        string `gorm:"size:255;index" json:"name"`
+	Version     string `gorm:"size:255" json:"version"`
+	Type        string `gorm:"size:50;index" json:"type"` // deb / apk / rpm / golang / npm / pypi ...
+	License     string `gorm:"size:500" json:"license"`
+	PURL        string `gorm:"column:purl;size:1000" json:"purl"`
+}
+
+// InventoryImage 记录哪些镜像（registry/仓库/标签）指向清单对应的 digest
+type InventoryImage struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	RegistryID uint      `gorm:"uniqueIndex:idx_inventory_image;not null" json:"registry_id"`
+	Repository string    `gorm:"size:255;uniqueIndex:idx_inventory_image;not null" json:"repository"`
+	Tag        string    `gorm:"size:255;uniqueIndex:idx_inventory_image;not null" json:"tag"`
+	Digest     string    `gorm:"size:100;uniqueIndex:idx_inventory_image;index;not null" json:"digest"`
+	TagDigest  string    `gorm:"size:100" json:"tag_digest"` // 记录时标签指向的 digest，多架构镜像为 index 的 digest
+}
+
+// PackageSearchResult 跨镜像的软件包搜索结果
+type PackageSearchResult struct {
+	RegistryID uint   `json:"registry_id"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+	Digest     string `json:"digest"`
+	Source     string `json:"source"`
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Type       string `json:"type"`
+	PURL       string `gorm:"column:purl" json:"purl"`
+}
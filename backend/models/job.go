@@ -0,0 +1,78 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 后台任务状态
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// 后台任务类型
+const (
+	JobTypeCopy            = "copy"
+	JobTypeSBOMIndex       = "sbom-index"
+	JobTypeVulnRescan      = "vulnerability-rescan"
+	JobTypeVulnImport      = "vulnerability-import"
+	JobTypeBulkDelete      = "bulk-delete"
+	JobTypeStorageAnalysis = "storage-analysis"
+	JobTypeCatalogCrawl    = "catalog-crawl"
+	JobTypePrefetch        = "prefetch"
+)
+
+// Job 持久化的后台任务，服务重启后未完成的任务会重新执行
+type Job struct {
+	ID              uint            `gorm:"primarykey" json:"id"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+	Type            string          `gorm:"size:50;index;not null" json:"type"`
+	Status          string          `gorm:"size:20;index;not null" json:"status"`
+	RegistryID      uint            `gorm:"index" json:"registry_id"` // 任务访问的 Registry，用于限制并发，0 表示不限
+	Params          json.RawMessage `gorm:"type:text" json:"params"`
+	Message         string          `gorm:"size:500" json:"message"` // 当前步骤
+	Done            int64           `json:"done"`                    // 已完成的工作量，单位由任务类型决定
+	Total           int64           `json:"total"`
+	Progress        int             `json:"progress"` // 0-100
+	Error           string          `gorm:"type:text" json:"error,omitempty"`
+	Result          json.RawMessage `gorm:"type:text" json:"result,omitempty"`
+	Attempts        int             `json:"attempts"`
+	CancelRequested bool            `json:"cancel_requested"`
+	StartedAt       *time.Time      `json:"started_at"`
+	FinishedAt      *time.Time      `json:"finished_at"`
+}
+
+// JobLog 后台任务日志
+type JobLog struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	JobID     uint      `gorm:"index;not null" json:"job_id"`
+	Level     string    `gorm:"size:10" json:"level"` // info / warn / error
+	Message   string    `gorm:"type:text" json:"message"`
+}
+
+// ImageCopyRequest 复制镜像的请求，源 Registry 为空时使用当前激活的 Registry
+type ImageCopyRequest struct {
+	SourceRegistryID uint   `json:"source_registry_id"`
+	SourceRepo       string `json:"source_repo" binding:"required"`
+	SourceRef        string `json:"source_ref" binding:"required"`
+	TargetRegistryID uint   `json:"target_registry_id" binding:"required"`
+	TargetRepo       string `json:"target_repo"` // 为空时与源仓库相同
+	TargetTag        string `json:"target_tag"`  // 为空时与源引用相同
+}
+
+// ImageCopyResult 复制镜像的结果
+type ImageCopyResult struct {
+	Digest    string `json:"digest"`
+	Manifests int    `json:"manifests"`
+	Blobs     int    `json:"blobs"`
+	Mounted   int    `json:"mounted"`  // 同一 Registry 内跨仓库挂载
+	Existing  int    `json:"existing"` // 目标仓库已存在
+	Uploaded  int    `json:"uploaded"`
+	Bytes     int64  `json:"bytes"` // 实际上传的字节数
+}
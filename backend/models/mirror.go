@@ -0,0 +1,28 @@
+package models
+
+// DockerHubURL Docker Hub 的 Registry 地址，也是镜像站默认的上游
+const DockerHubURL = "https://registry-1.docker.io"
+
+// PrefetchRequest 通过镜像站预热镜像的请求
+type PrefetchRequest struct {
+	Images    []string `json:"images" binding:"required"` // 镜像引用，如 nginx:1.25、bitnami/redis@sha256:...，省略标签时为 latest
+	Platforms []string `json:"platforms"`                 // 只预热这些平台，如 linux/amd64，为空时预热所有平台
+}
+
+// PrefetchImage 单个镜像的预热结果
+type PrefetchImage struct {
+	Image     string `json:"image"`
+	Digest    string `json:"digest,omitempty"`
+	Manifests int    `json:"manifests"`
+	Blobs     int    `json:"blobs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// PrefetchResult 预热任务的结果
+type PrefetchResult struct {
+	Images    []PrefetchImage `json:"images"`
+	Manifests int             `json:"manifests"`
+	Blobs     int             `json:"blobs"` // 去重后请求的 blob 数量
+	Bytes     int64           `json:"bytes"` // 经镜像站读取的字节数
+	Failed    int             `json:"failed"`
+}
@@ -6,6 +6,16 @@ import (
 	"gorm.io/gorm"
 )
 
+// Registry 类型，决定认证方式、默认地址和仓库目录的来源
+const (
+	RegistryKindDistribution = "distribution" // 自建的 docker/distribution
+	RegistryKindDockerHub    = "dockerhub"    // Docker Hub，单段仓库名自动补全 library/
+	RegistryKindGHCR         = "ghcr"         // GitHub Container Registry，密码为 Personal Access Token
+	RegistryKindECR          = "ecr"          // Amazon ECR，用户名和密码为 AWS Access Key
+	RegistryKindHosted       = "hosted"       // 其他托管 Registry（GitLab、Quay、ACR 等）
+	RegistryKindHarbor       = "harbor"       // Harbor，通过 Harbor API 获取项目、仓库元数据、配额和扫描结果
+)
+
 // Registry 表示一个 Docker Registry 配置
 type Registry struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
@@ -18,14 +28,38 @@ type Registry struct {
 	Password  string         `gorm:"size:500" json:"-"`
 	IsActive  bool           `gorm:"default:false" json:"is_active"`
 	IsDefault bool           `gorm:"default:false" json:"is_default"`
+
+	// WebhookToken Registry 通知回调的共享密钥，为空时拒绝该 Registry 的通知
+	WebhookToken string `gorm:"size:200" json:"-"`
+
+	// Kind Registry 类型，为空时视为 distribution
+	Kind string `gorm:"size:20;default:distribution" json:"kind"`
+	// Repositories 手动配置的仓库列表，每行一个；托管 Registry 通常不提供 _catalog，设置后代替 _catalog 列出仓库
+	Repositories string `gorm:"type:text" json:"repositories"`
+	// AuthURL 认证端点，为空时使用 Registry 在 WWW-Authenticate 中返回的 token 地址；ECR 为 API 地址
+	AuthURL string `gorm:"size:500" json:"auth_url"`
+
+	// Mirror 是否为拉取缓存（proxy.remoteurl）镜像站，镜像站不接受推送和删除
+	Mirror bool `gorm:"default:false" json:"mirror"`
+	// Upstream 镜像站代理的上游 Registry 地址，为空时视为 Docker Hub
+	Upstream string `gorm:"size:500" json:"upstream"`
+
+	Health *RegistryHealth `gorm:"-" json:"health,omitempty"`
 }
 
-// RegistryCreate 创建 Registry 的请求
+// RegistryCreate 创建 Registry 的请求，Docker Hub 和 GHCR 可以不填地址
 type RegistryCreate struct {
 	Name     string `json:"name" binding:"required"`
-	URL      string `json:"url" binding:"required"`
+	URL      string `json:"url"`
 	Username string `json:"username"`
 	Password string `json:"password"`
+
+	WebhookToken string `json:"webhook_token"`
+	Kind         string `json:"kind"`
+	Repositories string `json:"repositories"`
+	AuthURL      string `json:"auth_url"`
+	Mirror       bool   `json:"mirror"`
+	Upstream     string `json:"upstream"`
 }
 
 // RegistryUpdate 更新 Registry 的请求
@@ -34,4 +68,11 @@ type RegistryUpdate struct {
 	URL      string `json:"url"`
 	Username string `json:"username"`
 	Password string `json:"password"`
+
+	WebhookToken string  `json:"webhook_token"`
+	Kind         string  `json:"kind"`
+	Repositories *string `json:"repositories"` // 为空字符串时清除手动配置的仓库列表
+	AuthURL      *string `json:"auth_url"`
+	Mirror       *bool   `json:"mirror"`
+	Upstream     *string `json:"upstream"`
 }
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SigningKey 用于校验 cosign 签名的公钥
+type SigningKey struct {
+	ID                uint           `gorm:"primarykey" json:"id"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
+	Name              string         `gorm:"size:100;not null" json:"name"`
+	RegistryID        uint           `gorm:"index" json:"registry_id"`             // 0 表示适用于所有 Registry
+	RepositoryPattern string         `gorm:"size:255" json:"repository_pattern"`   // 仓库匹配模式，如 team/*、team/**，为空表示全部
+	PublicKey         string         `gorm:"type:text;not null" json:"public_key"` // PEM 格式公钥
+}
+
+// SigningKeyCreate 创建公钥的请求
+type SigningKeyCreate struct {
+	Name              string `json:"name" binding:"required"`
+	RegistryID        uint   `json:"registry_id"`
+	RepositoryPattern string `json:"repository_pattern"`
+	PublicKey         string `json:"public_key" binding:"required"`
+}
+
+// 签名校验状态
+const (
+	SignatureSigned     = "signed"     // 至少一个签名通过校验
+	SignatureUnsigned   = "unsigned"   // 没有找到签名
+	SignatureInvalid    = "invalid"    // 存在签名但均未通过校验
+	SignatureUnverified = "unverified" // 存在签名但没有配置可用的公钥
+	SignatureError      = "error"      // 校验过程出错（如无法访问 Registry），状态未知
+)
+
+// SignatureDetail 单个签名的校验结果
+type SignatureDetail struct {
+	Source   string `json:"source"`
+	Digest   string `json:"digest"` // 签名 manifest 的 digest
+	Layer    string `json:"layer"`  // 签名 payload 的 digest
+	KeyID    uint   `json:"key_id,omitempty"`
+	KeyName  string `json:"key_name,omitempty"`
+	Valid    bool   `json:"valid"`
+	Error    string `json:"error,omitempty"`
+	Identity string `json:"identity,omitempty"` // payload 中记录的 docker-reference
+}
+
+// SignatureResult 镜像签名校验结果
+type SignatureResult struct {
+	Status     string            `json:"status"`
+	Digest     string            `json:"digest"`
+	Error      string            `json:"error,omitempty"` // 状态为 error 时的错误信息
+	Signatures []SignatureDetail `json:"signatures"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// 存储用量的统计维度
+const (
+	StorageKindRepository = "repository"
+	StorageKindTag        = "tag"       // 名称为 仓库:标签
+	StorageKindNamespace  = "namespace" // 名称为仓库路径的前缀，如 team、team/project
+)
+
+// StorageSnapshot 一次存储分析的汇总，按时间保留用于查看增长趋势
+type StorageSnapshot struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time `gorm:"index" json:"created_at"`
+	RegistryID   uint      `gorm:"index;not null" json:"registry_id"`
+	JobID        uint      `json:"job_id"`
+	Repositories int       `json:"repositories"`
+	Tags         int       `json:"tags"`
+	Blobs        int       `json:"blobs"`
+	TotalBytes   int64     `json:"total_bytes"`   // 去重后的 blob 总大小，接近实际占用的磁盘
+	LogicalBytes int64     `json:"logical_bytes"` // 各标签镜像大小之和（不去重）
+}
+
+// StorageUsage 仓库、标签或命名空间的存储用量。
+// UniqueBytes 只被该对象引用的 blob 大小，删除后即可释放；SharedBytes 同时被其他对象引用的部分
+type StorageUsage struct {
+	ID          uint   `gorm:"primarykey" json:"id"`
+	SnapshotID  uint   `gorm:"index:idx_storage_usage_snapshot;not null" json:"snapshot_id"`
+	Kind        string `gorm:"size:20;index:idx_storage_usage_snapshot;not null" json:"kind"`
+	Name        string `gorm:"size:600;index;not null" json:"name"`
+	TotalBytes  int64  `json:"total_bytes"`
+	UniqueBytes int64  `json:"unique_bytes"`
+	SharedBytes int64  `json:"shared_bytes"`
+	Blobs       int    `json:"blobs"`
+}
+
+// StorageHistoryPoint 存储用量历史中的一个点
+type StorageHistoryPoint struct {
+	SnapshotID  uint      `json:"snapshot_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	TotalBytes  int64     `json:"total_bytes"`
+	UniqueBytes int64     `json:"unique_bytes"`
+	SharedBytes int64     `json:"shared_bytes"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// 标签变化的来源
+const (
+	TagSourceCrawler = "crawler" // 爬取时发现
+	TagSourceWebhook = "webhook" // Registry 通知
+	TagSourceRetag   = "retag"   // 通过 dgui 添加、移动或恢复标签
+	TagSourceDelete  = "delete"  // 通过 dgui 删除镜像
+)
+
+// TagHistory 观察到的一次标签指向变化，digest 为空表示标签被删除
+type TagHistory struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	RegistryID     uint      `gorm:"index:idx_tag_history;not null" json:"registry_id"`
+	Repository     string    `gorm:"size:255;index:idx_tag_history;not null" json:"repository"`
+	Tag            string    `gorm:"size:255;index:idx_tag_history;not null" json:"tag"`
+	ObservedAt     time.Time `gorm:"index:idx_tag_history" json:"observed_at"`
+	Digest         string    `gorm:"size:100;index" json:"digest"`
+	PreviousDigest string    `gorm:"size:100" json:"previous_digest"`
+	Source         string    `gorm:"size:20" json:"source"`
+	Actor          string    `gorm:"size:255" json:"actor,omitempty"`
+
+	// Available manifest 是否仍存在于 Registry 中，只有存在时才能恢复到该 digest
+	Available *bool `gorm:"-" json:"available,omitempty"`
+}
+
+// TagRestoreRequest 将标签恢复到历史 digest 的请求
+type TagRestoreRequest struct {
+	Repo           string `json:"repo" binding:"required"`
+	Tag            string `json:"tag" binding:"required"`
+	Digest         string `json:"digest" binding:"required"`
+	ExpectedDigest string `json:"expected_digest"` // 要求标签当前指向该 digest，防止覆盖并发修改
+}
@@ -0,0 +1,100 @@
+package models
+
+import "time"
+
+// 漏洞严重等级
+const (
+	SeverityCritical = "CRITICAL"
+	SeverityHigh     = "HIGH"
+	SeverityMedium   = "MEDIUM"
+	SeverityLow      = "LOW"
+	SeverityUnknown  = "UNKNOWN"
+)
+
+// Advisory 从 OSV 数据导入的漏洞公告
+type Advisory struct {
+	ID         uint    `gorm:"primarykey" json:"id"`
+	AdvisoryID string  `gorm:"size:100;uniqueIndex;not null" json:"advisory_id"` // OSV id，如 DSA-5532-1、GHSA-xxxx
+	CVE        string  `gorm:"size:100;index" json:"cve"`                        // 首个 CVE 编号，没有时为空
+	Aliases    string  `gorm:"type:text" json:"aliases"`                         // 逗号分隔的别名
+	Summary    string  `gorm:"type:text" json:"summary"`
+	Severity   string  `gorm:"size:20" json:"severity"`
+	Score      float64 `json:"score"`
+	Published  string  `gorm:"size:50" json:"published"`
+	Modified   string  `gorm:"size:50" json:"modified"`
+}
+
+// AdvisoryAffected 公告影响的软件包及版本范围
+type AdvisoryAffected struct {
+	ID         uint   `gorm:"primarykey" json:"id"`
+	AdvisoryID uint   `gorm:"index;not null" json:"advisory_id"`
+	Ecosystem  string `gorm:"size:100;index:idx_affected_package;not null" json:"ecosystem"` // 小写的生态系统名称，如 debian、go、npm
+	Release    string `gorm:"size:50" json:"release"`                                        // 发行版版本，如 12、v3.19
+	Package    string `gorm:"size:255;index:idx_affected_package;not null" json:"package"`   // 小写的软件包名称
+	Ranges     string `gorm:"type:text" json:"ranges"`                                       // JSON 格式的 OSV ranges
+	Versions   string `gorm:"type:text" json:"versions"`                                     // JSON 格式的受影响版本列表
+	Severity   string `gorm:"size:20" json:"severity"`                                       // 生态系统给出的严重等级，优先于公告的等级
+}
+
+// VulnerabilityDB 漏洞库导入记录，每次导入生成新的版本
+type VulnerabilityDB struct {
+	ID            uint      `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	Source        string    `gorm:"size:500" json:"source"`
+	AdvisoryCount int       `json:"advisory_count"`
+	AffectedCount int       `json:"affected_count"`
+	SkippedFiles  int       `json:"skipped_files"`
+}
+
+// VulnerabilityScan 软件包清单的漏洞匹配结果汇总
+type VulnerabilityScan struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	InventoryID uint      `gorm:"uniqueIndex;not null" json:"inventory_id"`
+	Digest      string    `gorm:"size:100;index" json:"digest"`
+	DBVersion   uint      `json:"db_version"` // 匹配时使用的漏洞库版本
+	ScannedAt   time.Time `json:"scanned_at"`
+	VulnerabilitySummary
+}
+
+// VulnerabilitySummary 各严重等级的漏洞数量
+type VulnerabilitySummary struct {
+	Critical int `json:"critical"`
+	High     int `json:"high"`
+	Medium   int `json:"medium"`
+	Low      int `json:"low"`
+	Unknown  int `json:"unknown"`
+	Total    int `json:"total"`
+}
+
+// Add 按严重等级计数
+func (s *VulnerabilitySummary) Add(severity string) {
+	switch severity {
+	case SeverityCritical:
+		s.Critical++
+	case SeverityHigh:
+		s.High++
+	case SeverityMedium:
+		s.Medium++
+	case SeverityLow:
+		s.Low++
+	default:
+		s.Unknown++
+	}
+	s.Total++
+}
+
+// ImageVulnerability 镜像中匹配到的漏洞
+type ImageVulnerability struct {
+	ID           uint    `gorm:"primarykey" json:"id"`
+	InventoryID  uint    `gorm:"index;not null" json:"inventory_id"`
+	Digest       string  `gorm:"size:100;index" json:"digest"`
+	AdvisoryID   string  `gorm:"size:100" json:"advisory_id"`
+	CVE          string  `gorm:"size:100" json:"cve"`
+	Summary      string  `gorm:"type:text" json:"summary"`
+	Severity     string  `gorm:"size:20;index" json:"severity"`
+	Score        float64 `json:"score"`
+	Package      string  `gorm:"size:255" json:"package"`
+	PackageType  string  `gorm:"size:50" json:"package_type"`
+	Version      string  `gorm:"size:255" json:"version"`
+	FixedVersion string  `gorm:"size:255" json:"fixed_version"`
+}
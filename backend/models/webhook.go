@@ -0,0 +1,89 @@
+package models
+
+import "time"
+
+// dgui 产生的事件类型
+const (
+	EventImageDeleted        = "image.deleted"          // 通过 dgui 删除镜像
+	EventRetentionFinished   = "retention.finished"     // 批量清理任务结束
+	EventBulkDeleteFinished  = "bulk_delete.finished"   // 批量删除任务结束
+	EventVulnerabilityFound  = "vulnerability.detected" // 镜像匹配到新的漏洞
+	EventRegistryUnreachable = "registry.unreachable"   // 健康检查连续失败
+	EventRegistryRecovered   = "registry.recovered"     // 健康检查恢复正常
+	EventCertificateExpiring = "certificate.expiring"   // Registry 的 TLS 证书即将过期
+	EventWebhookTest         = "webhook.test"           // 手动发送的测试事件
+)
+
+// 出站 Webhook 的请求体格式
+const (
+	WebhookFormatJSON     = "json"     // 通用 JSON，包含完整事件
+	WebhookFormatSlack    = "slack"    // Slack / Mattermost incoming webhook
+	WebhookFormatDingTalk = "dingtalk" // 钉钉自定义机器人
+	WebhookFormatFeishu   = "feishu"   // 飞书自定义机器人
+)
+
+// Webhook 投递状态
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+)
+
+// Event dgui 产生的事件
+type Event struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Timestamp  time.Time              `json:"timestamp"`
+	RegistryID uint                   `json:"registry_id,omitempty"`
+	Registry   string                 `json:"registry,omitempty"` // Registry 名称
+	Repository string                 `json:"repository,omitempty"`
+	Tag        string                 `json:"tag,omitempty"`
+	Digest     string                 `json:"digest,omitempty"`
+	Actor      string                 `json:"actor,omitempty"` // 触发事件的 dgui 用户
+	Summary    string                 `json:"summary"`         // 一行说明，用于聊天工具的消息
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// WebhookTarget 出站 Webhook 配置
+type WebhookTarget struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	URL       string    `gorm:"size:1000;not null" json:"url"`
+	Format    string    `gorm:"size:20;not null" json:"format"`
+	Events    string    `gorm:"size:500" json:"events"`    // 逗号分隔的事件类型，为空表示全部
+	Template  string    `gorm:"type:text" json:"template"` // Go text/template，json 格式时渲染整个请求体，其余格式渲染消息文本
+	Secret    string    `gorm:"size:200" json:"-"`         // 签名密钥
+	HasSecret bool      `gorm:"-" json:"has_secret"`
+	Enabled   bool      `json:"enabled"`
+}
+
+// WebhookTargetRequest 创建或更新出站 Webhook 的请求
+type WebhookTargetRequest struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	Format   string   `json:"format"`
+	Events   []string `json:"events"`
+	Template *string  `json:"template"`
+	Secret   *string  `json:"secret"` // 空字符串表示清除
+	Enabled  *bool    `json:"enabled"`
+}
+
+// WebhookDelivery 一次事件投递及其重试记录
+type WebhookDelivery struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	TargetID      uint       `gorm:"index;not null" json:"target_id"`
+	EventID       string     `gorm:"size:100;index" json:"event_id"`
+	EventType     string     `gorm:"size:50;index" json:"event_type"`
+	Payload       string     `gorm:"type:text" json:"payload"` // 事件的 JSON，每次投递时按当前配置渲染
+	Status        string     `gorm:"size:20;index;not null" json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `gorm:"index" json:"next_attempt_at"`
+	ResponseCode  int        `json:"response_code"`
+	ResponseBody  string     `gorm:"type:text" json:"response_body"` // 截断到 2 KB
+	Error         string     `gorm:"type:text" json:"error,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+}
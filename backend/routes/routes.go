@@ -13,6 +13,7 @@ import (
 // SetupRouter 设置路由
 func SetupRouter() *gin.Engine {
 	r := gin.Default()
+	r.Use(middleware.Metrics())
 
 	// CORS 配置 - 仅在开发模式下需要
 	r.Use(cors.New(cors.Config{
@@ -29,6 +30,9 @@ func SetupRouter() *gin.Engine {
 		// 公开路由 - 登录
 		api.POST("/login", handlers.Login)
 
+		// Registry 通知回调，使用 Registry 的 webhook_token 校验
+		api.POST("/webhooks/registry", handlers.ReceiveRegistryNotification) // ?registry_id=xxx
+
 		// 需要认证的路由
 		authorized := api.Group("")
 		authorized.Use(middleware.AuthRequired())
@@ -44,10 +48,97 @@ func SetupRouter() *gin.Engine {
 				registries.GET("/active", handlers.GetActiveRegistry)
 				registries.GET("/detail", handlers.GetRegistry) // ?id=xxx
 				registries.POST("", handlers.CreateRegistry)
-				registries.PUT("", handlers.UpdateRegistry)              // ?id=xxx
-				registries.DELETE("", handlers.DeleteRegistry)           // ?id=xxx
-				registries.POST("/activate", handlers.SetActiveRegistry) // ?id=xxx
-				registries.GET("/test", handlers.TestRegistryConnection) // ?id=xxx
+				registries.PUT("", handlers.UpdateRegistry)                  // ?id=xxx
+				registries.DELETE("", handlers.DeleteRegistry)               // ?id=xxx
+				registries.POST("/activate", handlers.SetActiveRegistry)     // ?id=xxx
+				registries.GET("/test", handlers.TestRegistryConnection)     // ?id=xxx
+				registries.GET("/health", handlers.GetRegistryHealthHistory) // ?id=xxx&since=24h
+			}
+
+			// 最近活动
+			authorized.GET("/activity", handlers.GetActivity) // ?repo=xxx&action=push&page=1&page_size=20
+
+			// 签名公钥管理
+			signingKeys := authorized.Group("/signing-keys")
+			{
+				signingKeys.GET("", handlers.GetSigningKeys)
+				signingKeys.POST("", handlers.CreateSigningKey)
+				signingKeys.DELETE("", handlers.DeleteSigningKey) // ?id=xxx
+			}
+
+			// SBOM 与软件包清单
+			sbom := authorized.Group("/sbom")
+			{
+				sbom.GET("/packages", handlers.GetImagePackages) // ?repo=xxx&ref=xxx&source=sbom|detected&search=xxx&type=xxx
+				sbom.POST("/index", handlers.IndexSBOMs)         // ?repo=xxx&refresh=1&detect=1
+				sbom.GET("/search", handlers.SearchPackages)     // ?name=xxx&version=xxx
+			}
+
+			// 出站 Webhook
+			webhooks := authorized.Group("/webhooks")
+			{
+				webhooks.GET("", handlers.GetWebhooks)
+				webhooks.POST("", handlers.CreateWebhook)
+				webhooks.PUT("", handlers.UpdateWebhook)                   // ?id=xxx
+				webhooks.DELETE("", handlers.DeleteWebhook)                // ?id=xxx
+				webhooks.POST("/test", handlers.TestWebhook)               // ?id=xxx
+				webhooks.GET("/deliveries", handlers.GetWebhookDeliveries) // ?target_id=xxx&status=failed
+				webhooks.POST("/redeliver", handlers.RedeliverWebhook)     // ?id=xxx
+			}
+
+			// 后台任务
+			jobs := authorized.Group("/jobs")
+			{
+				jobs.GET("", handlers.GetJobs)
+				jobs.GET("/detail", handlers.GetJob)     // ?id=xxx
+				jobs.GET("/logs", handlers.GetJobLogs)   // ?id=xxx&after=xxx
+				jobs.POST("/cancel", handlers.CancelJob) // ?id=xxx
+			}
+
+			// 漏洞匹配
+			vulnerabilities := authorized.Group("/vulnerabilities")
+			{
+				vulnerabilities.POST("/import", handlers.ImportVulnerabilityDB) // ?path=xxx（VULN_DB_PATH 下）或上传 file，返回任务
+				vulnerabilities.GET("/db", handlers.GetVulnerabilityDB)
+				vulnerabilities.GET("/image", handlers.GetImageVulnerabilities) // ?repo=xxx&ref=xxx&severity=xxx
+			}
+
+			// 镜像搜索
+			search := authorized.Group("/search")
+			{
+				search.GET("", handlers.SearchImages)           // ?q=label:maintainer=x arch:arm64 repo:team/*&page=1&page_size=20
+				search.GET("/digest", handlers.LookupDigest)    // ?digest=sha256:xxx 或前缀
+				search.POST("/reindex", handlers.ReindexSearch) // ?registry_id=xxx
+			}
+
+			// 存储分析
+			storage := authorized.Group("/storage")
+			{
+				storage.POST("/analyze", handlers.AnalyzeStorage)
+				storage.GET("/summary", handlers.GetStorageSummary)
+				storage.GET("/top", handlers.GetTopStorage)         // ?kind=repository|tag|namespace&sort=total|unique&limit=20&prefix=xxx
+				storage.GET("/history", handlers.GetStorageHistory) // ?kind=repository|namespace&name=xxx
+			}
+
+			// 镜像目录爬取
+			crawl := authorized.Group("/crawl")
+			{
+				crawl.GET("/status", handlers.GetCrawlStatus)
+				crawl.POST("", handlers.StartCrawl)                 // ?full=1
+				crawl.POST("/repository", handlers.CrawlRepository) // ?repo=xxx
+			}
+
+			// Harbor 项目、配额与扫描结果
+			harbor := authorized.Group("/harbor")
+			{
+				harbor.GET("/projects", handlers.GetHarborProjects)
+				harbor.GET("/scan", handlers.GetHarborScanReport) // ?repo=xxx&ref=xxx&severity=xxx
+			}
+
+			// 拉取缓存镜像站
+			mirror := authorized.Group("/mirror")
+			{
+				mirror.POST("/prefetch", handlers.PrefetchImages)
 			}
 
 			// Docker Registry 镜像操作
@@ -55,11 +146,22 @@ func SetupRouter() *gin.Engine {
 			{
 				images.GET("/catalog", handlers.GetCatalog)
 				images.GET("/repositories", handlers.GetRepositories)
-				images.GET("/tags", handlers.GetTags)              // ?repo=xxx&page=1&page_size=20
-				images.GET("/manifest", handlers.GetImageManifest) // ?repo=xxx&ref=xxx
-				images.GET("/info", handlers.GetImageInfo)         // ?repo=xxx&tag=xxx
-				images.GET("/config", handlers.GetImageConfig)     // ?repo=xxx&digest=xxx
-				images.DELETE("/delete", handlers.DeleteImage)     // ?repo=xxx&ref=xxx
+				images.GET("/tree", handlers.GetNamespaceTree)             // ?prefix=team/project&search=xxx
+				images.GET("/tags", handlers.GetTags)                      // ?repo=xxx&page=1&page_size=20&detail=1
+				images.GET("/manifest", handlers.GetImageManifest)         // ?repo=xxx&ref=xxx
+				images.GET("/info", handlers.GetImageInfo)                 // ?repo=xxx&tag=xxx
+				images.GET("/config", handlers.GetImageConfig)             // ?repo=xxx&digest=xxx
+				images.GET("/dockerfile", handlers.GetImageDockerfile)     // ?repo=xxx&tag=xxx&empty=skip&download=1
+				images.GET("/referrers", handlers.GetImageReferrers)       // ?repo=xxx&ref=xxx&artifact_type=xxx
+				images.GET("/signature", handlers.GetImageSignature)       // ?repo=xxx&ref=xxx
+				images.GET("/delete/preview", handlers.PreviewDeleteImage) // ?repo=xxx&ref=xxx
+				images.DELETE("/delete", handlers.DeleteImage)             // ?repo=xxx&ref=xxx&acknowledge=<digest>
+				images.POST("/bulk-delete/preview", handlers.PreviewBulkDelete)
+				images.POST("/bulk-delete", handlers.BulkDelete)
+				images.POST("/retag", handlers.RetagImage)
+				images.GET("/tag-history", handlers.GetTagHistory) // ?repo=xxx&tag=xxx&at=2024-01-02T00:00:00Z&check=1
+				images.POST("/tag-history/restore", handlers.RestoreTag)
+				images.POST("/copy", handlers.CopyImage)
 			}
 		}
 	}
@@ -69,6 +171,9 @@ func SetupRouter() *gin.Engine {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	// Prometheus 指标，设置 METRICS_TOKEN 后需要携带 token
+	r.GET("/metrics", handlers.Metrics)
+
 	// 静态文件服务 - 用于生产环境
 	staticDir := "./static"
 
@@ -0,0 +1,473 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dgui/models"
+)
+
+// BulkDeleteParams 批量删除任务的参数，任务开始时按 Request 解析要删除的标签
+type BulkDeleteParams struct {
+	RegistryID uint                     `json:"registry_id"`
+	Request    models.BulkDeleteRequest `json:"request"`
+	Actor      string                   `json:"actor"` // 创建任务的用户
+}
+
+func init() {
+	RegisterJobHandler(models.JobTypeBulkDelete, runBulkDeleteJob)
+}
+
+// ParseAge 解析时长，除 time.ParseDuration 支持的格式外还支持以 d 结尾的天数，如 30d
+func ParseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// ValidateBulkDeleteRequest 检查请求至少指定了标签或过滤条件，且过滤条件有效
+func ValidateBulkDeleteRequest(req *models.BulkDeleteRequest) error {
+	if len(req.Tags) == 0 && req.Filter == nil {
+		return errors.New("tags or filter is required")
+	}
+	if f := req.Filter; f != nil {
+		if f.TagPattern == "" && f.OlderThan == "" && len(f.Repositories) == 0 {
+			return errors.New("filter must set repositories, tag_pattern or older_than")
+		}
+		if _, err := regexp.Compile(f.TagPattern); err != nil {
+			return fmt.Errorf("invalid tag_pattern: %v", err)
+		}
+		if f.OlderThan != "" {
+			if _, err := ParseAge(f.OlderThan); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// TagDigests 解析仓库中所有标签指向的 digest。单个标签解析失败不影响其他标签，
+// 失败的标签及原因记录在 unresolved 中；只有获取标签列表失败时返回 error
+func TagDigests(client *RegistryClient, repository string) (digests map[string]string, unresolved map[string]error, err error) {
+	tags, err := client.GetTags(repository)
+	if err != nil {
+		return nil, nil, err
+	}
+	digests = make(map[string]string, len(tags.Tags))
+	unresolved = map[string]error{}
+	for _, tag := range tags.Tags {
+		digest, err := client.ResolveDigest(repository, tag)
+		if err != nil {
+			unresolved[tag] = err
+			continue
+		}
+		digests[tag] = digest
+	}
+	return digests, unresolved, nil
+}
+
+// verifyBulkDeleteItems 重新解析待删除条目所在仓库的标签。标签已指向其他 digest 时跳过该条目；
+// digest 被预览中未出现的标签引用时，跳过该 digest 的所有条目，避免一并删除这些标签
+func verifyBulkDeleteItems(ctx *JobContext, client *RegistryClient, items []models.BulkDeleteItem) error {
+	var repos []string
+	known := map[string]map[string]bool{} // repo@digest -> 预览中指向该 digest 的标签
+	for _, item := range items {
+		if item.Status != "" {
+			continue
+		}
+		key := item.Repo + "@" + item.Digest
+		if known[key] == nil {
+			known[key] = map[string]bool{}
+		}
+		known[key][item.Tag] = true
+		for _, tag := range item.SharedTags {
+			known[key][tag] = true
+		}
+		if len(repos) == 0 || repos[len(repos)-1] != item.Repo {
+			repos = append(repos, item.Repo)
+		}
+	}
+
+	current := map[string]map[string]string{}
+	unresolved := map[string]map[string]error{}
+	for i, repo := range repos {
+		if err := ctx.Check(); err != nil {
+			return err
+		}
+		ctx.SetProgress(int64(i), int64(len(repos)), "Verifying tags in "+repo)
+		// 标签列表可能已缓存，需要看到预览之后新增的标签
+		InvalidateRepository(client.RegistryID, repo)
+		digests, failed, err := TagDigests(client, repo)
+		if err != nil {
+			ctx.Logf("error", "Failed to list tags of %s: %v", repo, err)
+		}
+		current[repo], unresolved[repo] = digests, failed
+	}
+
+	changed := map[string]string{} // repo@digest -> 跳过原因
+	for i := range items {
+		item := &items[i]
+		if item.Status != "" {
+			continue
+		}
+		if current[item.Repo] == nil {
+			item.Status = models.BulkDeleteStatusFailed
+			item.Message = "failed to list tags"
+			continue
+		}
+		if err, ok := unresolved[item.Repo][item.Tag]; ok {
+			item.Status = models.BulkDeleteStatusFailed
+			item.Message = fmt.Sprintf("failed to resolve digest: %v", err)
+			continue
+		}
+		if digest := current[item.Repo][item.Tag]; digest != item.Digest {
+			item.Status = models.BulkDeleteStatusSkipped
+			item.Message = "digest changed"
+			ctx.Logf("warn", "Skipped %s:%s: digest changed since the preview", item.Repo, item.Tag)
+			continue
+		}
+		key := item.Repo + "@" + item.Digest
+		if _, ok := changed[key]; ok {
+			continue
+		}
+		var added []string
+		for tag, digest := range current[item.Repo] {
+			if digest == item.Digest && !known[key][tag] {
+				added = append(added, tag)
+			}
+		}
+		if len(added) > 0 {
+			sort.Strings(added)
+			changed[key] = "digest is now also tagged as " + strings.Join(added, ", ")
+			ctx.Logf("warn", "Skipped %s: %s", key, changed[key])
+		}
+	}
+	for i := range items {
+		item := &items[i]
+		if reason, ok := changed[item.Repo+"@"+item.Digest]; ok && item.Status == "" {
+			item.Status = models.BulkDeleteStatusSkipped
+			item.Message = reason
+		}
+	}
+	return nil
+}
+
+// unresolvedWarning 提示无法解析的标签，这些标签可能与待删除的镜像共享 digest
+func unresolvedWarning(repository string, unresolved map[string]error) string {
+	tags := make([]string, 0, len(unresolved))
+	for tag := range unresolved {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return fmt.Sprintf("%s: failed to resolve %s (%v); shared tags may be incomplete",
+		repository, strings.Join(tags, ", "), unresolved[tags[0]])
+}
+
+// SharedTags 返回与 tag 指向同一 digest 的其他标签
+func SharedTags(digests map[string]string, tag string) []string {
+	var shared []string
+	for other, digest := range digests {
+		if other != tag && digest == digests[tag] {
+			shared = append(shared, other)
+		}
+	}
+	sort.Strings(shared)
+	return shared
+}
+
+// selectBulkDeleteTags 按请求选出要删除的标签，返回 仓库 -> 标签 -> 创建时间
+func selectBulkDeleteTags(client *RegistryClient, req *models.BulkDeleteRequest) (map[string]map[string]string, error) {
+	selected := map[string]map[string]string{}
+	add := func(repo, tag, created string) {
+		if selected[repo] == nil {
+			selected[repo] = map[string]string{}
+		}
+		selected[repo][tag] = created
+	}
+
+	for _, ref := range req.Tags {
+		add(ref.Repo, ref.Tag, "")
+	}
+
+	f := req.Filter
+	if f == nil {
+		return selected, nil
+	}
+
+	pattern := regexp.MustCompile(f.TagPattern)
+	var cutoff time.Time
+	if f.OlderThan != "" {
+		age, _ := ParseAge(f.OlderThan)
+		cutoff = time.Now().Add(-age)
+	}
+
+	catalog, err := client.GetCatalog()
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range catalog.Repositories {
+		if len(f.Repositories) > 0 {
+			matched := false
+			for _, p := range f.Repositories {
+				if MatchRepository(p, repo) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		tags, err := client.GetTags(repo)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags.Tags {
+			if IsArtifactTag(tag) || !pattern.MatchString(tag) {
+				continue
+			}
+			created := ""
+			if !cutoff.IsZero() {
+				info, err := client.GetTagInfo(repo, tag)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%s: %v", repo, tag, err)
+				}
+				createdAt, err := time.Parse(time.RFC3339Nano, info.Created)
+				// 没有创建时间的镜像不按时长删除
+				if err != nil || !createdAt.Before(cutoff) {
+					continue
+				}
+				created = info.Created
+			}
+			add(repo, tag, created)
+		}
+	}
+	return selected, nil
+}
+
+// PreviewBulkDelete 将选中的标签解析为 digest，并找出共享 digest 但未被选中的标签。
+// 未设置 IncludeShared 时这些 digest 对应的条目标记为 skipped
+func PreviewBulkDelete(client *RegistryClient, req *models.BulkDeleteRequest) (*models.BulkDeletePreview, error) {
+	selected, err := selectBulkDeleteTags(client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make([]string, 0, len(selected))
+	for repo := range selected {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+
+	preview := &models.BulkDeletePreview{Items: []models.BulkDeleteItem{}, Warnings: []string{}}
+	for _, repo := range repos {
+		digests, unresolved, err := TagDigests(client, repo)
+		if err != nil {
+			return nil, err
+		}
+		if len(unresolved) > 0 {
+			preview.Warnings = append(preview.Warnings, unresolvedWarning(repo, unresolved))
+		}
+
+		tags := make([]string, 0, len(selected[repo]))
+		for tag := range selected[repo] {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+
+		warned := map[string]bool{}
+		planned := map[string]bool{}
+		for _, tag := range tags {
+			item := models.BulkDeleteItem{Repo: repo, Tag: tag, Digest: digests[tag], Created: selected[repo][tag]}
+			if err, ok := unresolved[tag]; ok {
+				item.Status = models.BulkDeleteStatusSkipped
+				item.Message = fmt.Sprintf("failed to resolve digest: %v", err)
+				preview.Items = append(preview.Items, item)
+				continue
+			}
+			if item.Digest == "" {
+				item.Status = models.BulkDeleteStatusSkipped
+				item.Message = "tag not found"
+				preview.Items = append(preview.Items, item)
+				continue
+			}
+
+			for _, other := range SharedTags(digests, tag) {
+				if _, ok := selected[repo][other]; !ok {
+					item.SharedTags = append(item.SharedTags, other)
+				}
+			}
+			if len(item.SharedTags) > 0 {
+				if !warned[item.Digest] {
+					warned[item.Digest] = true
+					preview.Warnings = append(preview.Warnings, fmt.Sprintf("%s@%s is also tagged as %s, which is not selected",
+						repo, shortDigest(item.Digest), strings.Join(item.SharedTags, ", ")))
+				}
+				if !req.IncludeShared {
+					item.Status = models.BulkDeleteStatusSkipped
+					item.Message = "digest is shared with tags that are not selected"
+				}
+			}
+			if item.Status == "" && !planned[item.Digest] {
+				planned[item.Digest] = true
+				preview.Digests++
+			}
+			preview.Items = append(preview.Items, item)
+		}
+	}
+	return preview, nil
+}
+
+// applyConfirmedTags 跳过不在用户确认的预览中、或 digest 与确认时不同的条目
+func applyConfirmedTags(ctx *JobContext, items []models.BulkDeleteItem, confirmed []models.ConfirmedTag) {
+	digests := make(map[string]string, len(confirmed)) // repo:tag -> 确认时的 digest
+	for _, tag := range confirmed {
+		digests[tag.Repo+":"+tag.Tag] = tag.Digest
+	}
+	for i := range items {
+		item := &items[i]
+		if item.Status != "" {
+			continue
+		}
+		digest, ok := digests[item.Repo+":"+item.Tag]
+		if !ok {
+			item.Status = models.BulkDeleteStatusSkipped
+			item.Message = "not in the confirmed preview"
+		} else if digest != item.Digest {
+			item.Status = models.BulkDeleteStatusSkipped
+			item.Message = "digest changed"
+			ctx.Logf("warn", "Skipped %s:%s: digest changed since the preview", item.Repo, item.Tag)
+		}
+	}
+}
+
+// runBulkDeleteJob 解析要删除的标签并删除 manifest，记录每个标签的结果。
+// 请求带有确认的预览时只删除其中 digest 未变的标签；删除前再次解析标签：已指向其他 digest 的标签跳过，
+// digest 被计划之外的标签引用时也跳过，不会删除计划之外的镜像
+func runBulkDeleteJob(ctx *JobContext, params json.RawMessage) (interface{}, error) {
+	var p BulkDeleteParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	client, _, err := GetRegistryClient(p.RegistryID)
+	if err != nil {
+		return nil, err
+	}
+	client = client.WithContext(ctx)
+
+	ctx.SetProgress(0, 0, "Resolving tags")
+	preview, err := PreviewBulkDelete(client, &p.Request)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range preview.Warnings {
+		ctx.Logf("warn", "%s", warning)
+	}
+	if len(p.Request.Confirmed) > 0 {
+		applyConfirmedTags(ctx, preview.Items, p.Request.Confirmed)
+	}
+
+	result := &models.BulkDeleteResult{Items: preview.Items}
+	if err := verifyBulkDeleteItems(ctx, client, result.Items); err != nil {
+		return result, err
+	}
+
+	digests := map[string]bool{}
+	for _, item := range result.Items {
+		if item.Status == "" {
+			digests[item.Repo+"@"+item.Digest] = true
+		}
+	}
+
+	deleted := map[string]error{} // repo@digest -> 删除结果
+	var done int64
+	for i := range result.Items {
+		item := &result.Items[i]
+		if item.Status == models.BulkDeleteStatusSkipped {
+			result.Skipped++
+			continue
+		}
+		if item.Status == models.BulkDeleteStatusFailed {
+			result.Failed++
+			continue
+		}
+		if err := ctx.Check(); err != nil {
+			return result, err
+		}
+
+		key := item.Repo + "@" + item.Digest
+		err, ok := deleted[key]
+		if !ok {
+			ctx.SetProgress(done, int64(len(digests)), fmt.Sprintf("Deleting %s@%s", item.Repo, shortDigest(item.Digest)))
+			err = client.DeleteManifest(item.Repo, item.Digest)
+			deleted[key] = err
+			done++
+			if err != nil {
+				ctx.Logf("error", "Failed to delete %s: %v", key, err)
+			} else {
+				ctx.Logf("info", "Deleted %s", key)
+			}
+		}
+
+		if err != nil {
+			item.Status = models.BulkDeleteStatusFailed
+			item.Message = err.Error()
+			result.Failed++
+		} else {
+			item.Status = models.BulkDeleteStatusDeleted
+			result.Deleted++
+		}
+	}
+	ctx.SetProgress(done, int64(len(digests)), "")
+
+	// 删除 manifest 时指向它的标签（包括未选中的共享标签）都已消失
+	removed := map[string]map[string]bool{} // 仓库 -> 标签
+	for _, item := range result.Items {
+		if item.Status != models.BulkDeleteStatusDeleted {
+			continue
+		}
+		if removed[item.Repo] == nil {
+			removed[item.Repo] = map[string]bool{}
+		}
+		for _, tag := range append([]string{item.Tag}, item.SharedTags...) {
+			removed[item.Repo][tag] = true
+		}
+	}
+	for repo, set := range removed {
+		tags := make([]string, 0, len(set))
+		for tag := range set {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		if err := RecordImageDeletion(p.RegistryID, repo, tags, p.Actor); err != nil {
+			ctx.Logf("error", "Failed to record deleted tags of %s: %v", repo, err)
+		}
+	}
+
+	Emit(models.Event{
+		Type:       models.EventBulkDeleteFinished,
+		RegistryID: p.RegistryID,
+		Actor:      p.Actor,
+		Summary: fmt.Sprintf("Bulk delete job #%d finished: %d deleted, %d skipped, %d failed",
+			ctx.JobID(), result.Deleted, result.Skipped, result.Failed),
+		Data: map[string]interface{}{
+			"job_id":  ctx.JobID(),
+			"deleted": result.Deleted,
+			"skipped": result.Skipped,
+			"failed":  result.Failed,
+		},
+	})
+	return result, nil
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+func TestRunBulkDeleteJob(t *testing.T) {
+	tests := []struct {
+		name      string
+		confirmed bool
+		want      map[string]string // 标签 -> 状态
+		remaining []string
+	}{
+		{
+			name:      "confirmed preview",
+			confirmed: true,
+			want: map[string]string{
+				"v1": models.BulkDeleteStatusDeleted,
+				"v2": models.BulkDeleteStatusSkipped, // 预览之后被改指
+				"v3": models.BulkDeleteStatusDeleted,
+				"v4": models.BulkDeleteStatusSkipped, // 预览之后推送
+			},
+			remaining: []string{"old", "v2", "v4"},
+		},
+		{
+			name: "resolved in the job",
+			want: map[string]string{
+				"v1": models.BulkDeleteStatusDeleted,
+				"v2": models.BulkDeleteStatusSkipped, // 与未选中的 old 共享 digest
+				"v3": models.BulkDeleteStatusDeleted,
+				"v4": models.BulkDeleteStatusDeleted,
+			},
+			remaining: []string{"old", "v2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t, &models.Registry{}, &models.Job{}, &models.JobLog{}, &models.WebhookTarget{}, &models.WebhookDelivery{},
+				&models.TagHistory{}, &models.CatalogTag{}, &models.CatalogManifest{}, &models.CatalogReference{},
+				&models.CatalogRepository{}, &models.RegistryEvent{})
+			createSearchIndex(t)
+			config.DB.Create(&models.WebhookTarget{Name: "hook", URL: "http://127.0.0.1:1", Format: models.WebhookFormatJSON,
+				Events: models.EventBulkDeleteFinished, Enabled: true})
+			r := newTestRegistry(t)
+			_, registry := newTestClient(t, r)
+
+			confirmed := []models.ConfirmedTag{
+				{Repo: "app", Tag: "v1", Digest: r.pushImage("app", "v1", "linux/amd64", []byte("1"))},
+				{Repo: "app", Tag: "v2", Digest: r.pushImage("app", "v2", "linux/amd64", []byte("2"))},
+				{Repo: "app", Tag: "v3", Digest: r.pushImage("app", "v3", "linux/amd64", []byte("3"))},
+			}
+			old := r.pushImage("app", "old", "linux/amd64", []byte("old"))
+			r.setTag("app", "v2", old)
+			r.pushImage("app", "v4", "linux/amd64", []byte("4"))
+			// 标签历史中已有爬取到的指向，删除时记录为变化
+			for tag, digest := range r.tags["app"] {
+				if err := RecordTagChange(registry.ID, "app", tag, digest, models.TagSourceCrawler, "", time.Now().Add(-time.Hour)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			req := models.BulkDeleteRequest{Filter: &models.BulkDeleteFilter{TagPattern: "^v"}}
+			if tt.confirmed {
+				req.Confirmed = confirmed
+			}
+			params, _ := json.Marshal(BulkDeleteParams{RegistryID: registry.ID, Request: req, Actor: "admin"})
+			out, err := runBulkDeleteJob(testJobContext(), params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := out.(*models.BulkDeleteResult)
+			if len(result.Items) != len(tt.want) {
+				t.Fatalf("items = %+v", result.Items)
+			}
+			for _, item := range result.Items {
+				if item.Status != tt.want[item.Tag] {
+					t.Errorf("%s: status = %s (%s), want %s", item.Tag, item.Status, item.Message, tt.want[item.Tag])
+				}
+			}
+
+			var remaining []string
+			for tag := range r.tags["app"] {
+				remaining = append(remaining, tag)
+			}
+			sort.Strings(remaining)
+			if len(remaining) != len(tt.remaining) {
+				t.Fatalf("remaining tags = %v, want %v", remaining, tt.remaining)
+			}
+			for i := range remaining {
+				if remaining[i] != tt.remaining[i] {
+					t.Fatalf("remaining tags = %v, want %v", remaining, tt.remaining)
+				}
+			}
+
+			var deleted []string
+			config.DB.Model(&models.TagHistory{}).Where("digest = '' AND source = ?", models.TagSourceDelete).
+				Order("tag").Pluck("tag", &deleted)
+			var want []string
+			for tag, status := range tt.want {
+				if status == models.BulkDeleteStatusDeleted {
+					want = append(want, tag)
+				}
+			}
+			sort.Strings(want)
+			if strings.Join(deleted, ",") != strings.Join(want, ",") {
+				t.Errorf("deleted tags in history = %v, want %v", deleted, want)
+			}
+
+			var deliveries int64
+			config.DB.Model(&models.WebhookDelivery{}).Where("event_type = ?", models.EventBulkDeleteFinished).Count(&deliveries)
+			if deliveries != 1 {
+				t.Errorf("%s deliveries = %d, want 1", models.EventBulkDeleteFinished, deliveries)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultCacheTTL 仓库目录和标签列表的默认缓存时长
+const defaultCacheTTL = 30 * time.Second
+
+// cacheEntry 缓存项
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// responseCache 按 Registry 缓存仓库目录和标签列表。收到 Registry 通知或通过 dgui 修改镜像时失效，
+// 没有配置通知的 Registry 依靠过期时间（REGISTRY_CACHE_TTL，默认 30s，0 表示不缓存）保证新鲜度
+type responseCache struct {
+	sync.Mutex
+	entries map[string]cacheEntry
+	ttl     time.Duration
+	once    sync.Once
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+var registryCache = &responseCache{entries: map[string]cacheEntry{}}
+
+// cacheKey 生成缓存键，仓库为空时表示 Registry 级别的数据
+func cacheKey(registryID uint, kind, repository string) string {
+	return fmt.Sprintf("%d|%s|%s", registryID, kind, repository)
+}
+
+// getTTL 读取缓存时长配置
+func (c *responseCache) getTTL() time.Duration {
+	c.once.Do(func() {
+		c.ttl = defaultCacheTTL
+		if v := os.Getenv("REGISTRY_CACHE_TTL"); v != "" {
+			if ttl, err := time.ParseDuration(v); err == nil {
+				c.ttl = ttl
+			}
+		}
+	})
+	return c.ttl
+}
+
+// get 读取未过期的缓存项
+func (c *responseCache) get(key string) (interface{}, bool) {
+	if c.getTTL() <= 0 {
+		return nil, false
+	}
+	c.Lock()
+	entry, ok := c.entries[key]
+	c.Unlock()
+	if !ok || time.Now().After(entry.expires) {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	return entry.value, true
+}
+
+// set 写入缓存项
+func (c *responseCache) set(key string, value interface{}) {
+	ttl := c.getTTL()
+	if ttl <= 0 {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.entries[key] = cacheEntry{value: value, expires: time.Now().Add(ttl)}
+
+	// 顺便清理过期项，避免长期运行后无限增长
+	if len(c.entries)%256 == 0 {
+		now := time.Now()
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+}
+
+// InvalidateRepository 清除仓库的标签列表以及所属 Registry 的目录缓存
+func InvalidateRepository(registryID uint, repository string) {
+	registryCache.Lock()
+	defer registryCache.Unlock()
+	delete(registryCache.entries, cacheKey(registryID, "catalog", ""))
+	delete(registryCache.entries, cacheKey(registryID, "tags", repository))
+}
+
+// InvalidateRegistry 清除 Registry 的全部缓存
+func InvalidateRegistry(registryID uint) {
+	registryCache.Lock()
+	defer registryCache.Unlock()
+	prefix := fmt.Sprintf("%d|", registryID)
+	for key := range registryCache.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(registryCache.entries, key)
+		}
+	}
+}
+
+// CacheStats 返回缓存命中和未命中次数
+func CacheStats() (hits, misses uint64) {
+	return registryCache.hits.Load(), registryCache.misses.Load()
+}
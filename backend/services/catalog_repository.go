@@ -0,0 +1,307 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// repositoryCatalog 一个仓库的爬取结果：标签、相关的 manifest 及其引用的 blob
+type repositoryCatalog struct {
+	registryID uint
+	repository string
+	tags       []models.CatalogTag
+	manifests  map[string]*models.CatalogManifest
+	children   map[string][]models.CatalogReference // index digest -> 子 manifest
+	blobs      map[string]int64                     // 所有标签引用的 config 和镜像层，digest -> 大小
+}
+
+// loadRepositoryCatalog 从数据库加载仓库的爬取结果
+func loadRepositoryCatalog(registryID uint, repository string) (*repositoryCatalog, error) {
+	rc := &repositoryCatalog{
+		registryID: registryID,
+		repository: repository,
+		manifests:  map[string]*models.CatalogManifest{},
+		children:   map[string][]models.CatalogReference{},
+		blobs:      map[string]int64{},
+	}
+	if err := config.DB.Where("registry_id = ? AND repository = ?", registryID, repository).Find(&rc.tags).Error; err != nil {
+		return nil, err
+	}
+
+	var digests []string
+	for _, tag := range rc.tags {
+		digests = appendUnique(digests, tag.Digest)
+	}
+	if len(digests) == 0 {
+		return rc, nil
+	}
+
+	var children []models.CatalogReference
+	if err := config.DB.Where("registry_id = ? AND kind = ? AND manifest_digest IN ?", registryID, models.ReferenceKindManifest, digests).
+		Find(&children).Error; err != nil {
+		return nil, err
+	}
+	all := append([]string{}, digests...)
+	for _, ref := range children {
+		rc.children[ref.ManifestDigest] = append(rc.children[ref.ManifestDigest], ref)
+		all = appendUnique(all, ref.Digest)
+	}
+
+	var manifests []models.CatalogManifest
+	if err := config.DB.Where("registry_id = ? AND digest IN ?", registryID, all).Find(&manifests).Error; err != nil {
+		return nil, err
+	}
+	for i := range manifests {
+		rc.manifests[manifests[i].Digest] = &manifests[i]
+	}
+
+	var blobs []models.CatalogReference
+	if err := config.DB.Select("digest", "size").
+		Where("registry_id = ? AND kind <> ? AND manifest_digest IN ?", registryID, models.ReferenceKindManifest, all).
+		Find(&blobs).Error; err != nil {
+		return nil, err
+	}
+	for _, ref := range blobs {
+		rc.blobs[ref.Digest] = ref.Size
+	}
+	return rc, nil
+}
+
+// images 返回标签指向的镜像，多架构镜像为各平台的镜像
+func (rc *repositoryCatalog) images(digest string) []*models.CatalogManifest {
+	images := []*models.CatalogManifest{}
+	children, ok := rc.children[digest]
+	if !ok {
+		if m := rc.manifests[digest]; m != nil {
+			images = append(images, m)
+		}
+		return images
+	}
+	for _, child := range children {
+		m := rc.manifests[child.Digest]
+		if m == nil {
+			continue
+		}
+		// 镜像配置中通常没有 variant，使用 index 中记录的平台
+		if parts := strings.Split(child.Platform, "/"); m.Variant == "" && len(parts) == 3 {
+			image := *m
+			image.Variant = parts[2]
+			m = &image
+		}
+		images = append(images, m)
+	}
+	return images
+}
+
+// refreshRepository 仓库爬取完成后更新搜索索引和仓库元数据
+func refreshRepository(registryID uint, repository string) error {
+	rc, err := loadRepositoryCatalog(registryID, repository)
+	if err != nil {
+		return err
+	}
+	if err := indexRepository(rc); err != nil {
+		return err
+	}
+	return saveRepositoryMetadata(rc)
+}
+
+// saveRepositoryMetadata 保存仓库的标签数、去重后的大小、最近推送时间和镜像 label，仓库已不存在时删除
+func saveRepositoryMetadata(rc *repositoryCatalog) error {
+	if len(rc.tags) == 0 {
+		return config.DB.Where("registry_id = ? AND name = ?", rc.registryID, rc.repository).Delete(&models.CatalogRepository{}).Error
+	}
+
+	repo := models.CatalogRepository{RegistryID: rc.registryID, Name: rc.repository, TagCount: len(rc.tags), UpdatedAt: time.Now()}
+	for _, size := range rc.blobs {
+		repo.TotalSize += size
+	}
+
+	labels := []string{}
+	for _, tag := range rc.tags {
+		for _, image := range rc.images(tag.Digest) {
+			if image.Created != nil && (repo.LastPushed == nil || image.Created.After(*repo.LastPushed)) {
+				created := *image.Created
+				repo.LastPushed = &created
+			}
+			var values map[string]string
+			if image.Labels != "" && json.Unmarshal([]byte(image.Labels), &values) == nil {
+				for key := range values {
+					labels = appendUnique(labels, key)
+				}
+			}
+		}
+	}
+	sort.Strings(labels)
+	repo.Labels = strings.Join(labels, "\n")
+
+	// Registry 通知记录了实际推送时间，比镜像的构建时间更准确
+	var pushes []models.RegistryEvent
+	if err := config.DB.Select("timestamp").
+		Where("registry_id = ? AND repository = ? AND action = ?", rc.registryID, rc.repository, models.EventActionPush).
+		Order("timestamp DESC").Limit(1).Find(&pushes).Error; err != nil {
+		return err
+	}
+	if len(pushes) > 0 && (repo.LastPushed == nil || pushes[0].Timestamp.After(*repo.LastPushed)) {
+		repo.LastPushed = &pushes[0].Timestamp
+	}
+
+	return config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "registry_id"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"tag_count", "total_size", "last_pushed", "labels", "stale", "updated_at"}),
+	}).Create(&repo).Error
+}
+
+// ErrNotCrawled Registry 还没有爬取结果
+var ErrNotCrawled = errors.New("registry has not been crawled yet")
+
+// hasLabelKey 判断 label 键列表中是否有 key，key 也可以匹配带前缀的键，如 version 匹配 org.opencontainers.image.version
+func hasLabelKey(labels, key string) bool {
+	key = strings.ToLower(key)
+	for _, label := range strings.Split(strings.ToLower(labels), "\n") {
+		if label == key || strings.HasSuffix(label, "."+key) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListRepositories 基于爬取结果过滤、排序并分页返回仓库列表
+func ListRepositories(registryID uint, q *models.RepositoryQuery, page, pageSize int) ([]models.RepositoryInfo, int, error) {
+	var tagPattern *regexp.Regexp
+	if q.TagPattern != "" {
+		re, err := regexp.Compile(q.TagPattern)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid tag pattern: %v", err)
+		}
+		tagPattern = re
+	}
+
+	var repos []models.CatalogRepository
+	if err := config.DB.Where("registry_id = ?", registryID).Find(&repos).Error; err != nil {
+		return nil, 0, err
+	}
+	if len(repos) == 0 {
+		return nil, 0, ErrNotCrawled
+	}
+
+	// 需要按标签名过滤时一次加载所有标签
+	var tagsByRepo map[string][]string
+	if tagPattern != nil {
+		var tags []models.CatalogTag
+		if err := config.DB.Select("repository", "tag").Where("registry_id = ?", registryID).Find(&tags).Error; err != nil {
+			return nil, 0, err
+		}
+		tagsByRepo = map[string][]string{}
+		for _, tag := range tags {
+			tagsByRepo[tag.Repository] = append(tagsByRepo[tag.Repository], tag.Tag)
+		}
+	}
+
+	search := strings.ToLower(q.Search)
+	filtered := repos[:0]
+	for _, repo := range repos {
+		switch {
+		case search != "" && !strings.Contains(strings.ToLower(repo.Name), search),
+			q.MinTags != nil && repo.TagCount < *q.MinTags,
+			q.MaxTags != nil && repo.TagCount > *q.MaxTags,
+			q.UpdatedSince != nil && (repo.LastPushed == nil || repo.LastPushed.Before(*q.UpdatedSince)),
+			q.Label != "" && !hasLabelKey(repo.Labels, q.Label):
+			continue
+		}
+		if tagPattern != nil {
+			matched := false
+			for _, tag := range tagsByRepo[repo.Name] {
+				if tagPattern.MatchString(tag) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+		filtered = append(filtered, repo)
+	}
+
+	less := func(a, b *models.CatalogRepository) bool { return a.Name < b.Name }
+	switch q.Sort {
+	case "tags":
+		less = func(a, b *models.CatalogRepository) bool { return a.TagCount < b.TagCount }
+	case "size":
+		less = func(a, b *models.CatalogRepository) bool { return a.TotalSize < b.TotalSize }
+	case "pushed":
+		less = func(a, b *models.CatalogRepository) bool {
+			if a.LastPushed == nil || b.LastPushed == nil {
+				return a.LastPushed == nil && b.LastPushed != nil
+			}
+			return a.LastPushed.Before(*b.LastPushed)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		a, b := &filtered[i], &filtered[j]
+		if q.Desc {
+			a, b = b, a
+		}
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		return filtered[i].Name < filtered[j].Name
+	})
+
+	total := len(filtered)
+	start := (page - 1) * pageSize
+	if start > total {
+		start = total
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	pageRepos := filtered[start:end]
+
+	names := make([]string, 0, len(pageRepos))
+	for _, repo := range pageRepos {
+		names = append(names, repo.Name)
+	}
+	tagsByName := map[string][]string{}
+	if len(names) > 0 {
+		var tags []models.CatalogTag
+		if err := config.DB.Select("repository", "tag").Where("registry_id = ? AND repository IN ?", registryID, names).
+			Order("tag").Find(&tags).Error; err != nil {
+			return nil, 0, err
+		}
+		for _, tag := range tags {
+			tagsByName[tag.Repository] = append(tagsByName[tag.Repository], tag.Tag)
+		}
+	}
+
+	infos := make([]models.RepositoryInfo, 0, len(pageRepos))
+	for _, repo := range pageRepos {
+		size := repo.TotalSize
+		tags := tagsByName[repo.Name]
+		if tags == nil {
+			tags = []string{}
+		}
+		infos = append(infos, models.RepositoryInfo{
+			Name:       repo.Name,
+			Tags:       tags,
+			TagCount:   repo.TagCount,
+			TotalSize:  &size,
+			LastPushed: repo.LastPushed,
+		})
+	}
+	return infos, total, nil
+}
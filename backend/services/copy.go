@@ -0,0 +1,215 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"dgui/models"
+)
+
+// copyManifest 待复制的 manifest
+type copyManifest struct {
+	digest    string
+	mediaType string
+	body      []byte
+}
+
+// imageCopier 在两个 Registry（或同一 Registry 的两个仓库）之间复制镜像
+type imageCopier struct {
+	ctx          *JobContext
+	source       *RegistryClient
+	sourceRepo   string
+	target       *RegistryClient
+	targetRepo   string
+	sameRegistry bool
+
+	manifests []copyManifest // 子 manifest 在前，顶层 manifest 在最后
+	blobs     []models.ManifestLayer
+	seenBlobs map[string]bool
+	result    models.ImageCopyResult
+}
+
+func init() {
+	RegisterJobHandler(models.JobTypeCopy, runCopyJob)
+}
+
+// SameRegistry 判断两个 Registry 配置是否指向同一个 Registry
+func SameRegistry(a, b *models.Registry) bool {
+	return a.ID == b.ID || strings.TrimSuffix(a.URL, "/") == strings.TrimSuffix(b.URL, "/")
+}
+
+// runCopyJob 执行复制任务，参数为已补全目标仓库和标签的 ImageCopyRequest
+func runCopyJob(ctx *JobContext, params json.RawMessage) (interface{}, error) {
+	var req models.ImageCopyRequest
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, err
+	}
+	source, sourceRegistry, err := GetRegistryClient(req.SourceRegistryID)
+	if err != nil {
+		return nil, err
+	}
+	target, targetRegistry, err := GetRegistryClient(req.TargetRegistryID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.Logf("info", "Copying %s/%s:%s to %s/%s:%s", sourceRegistry.Name, req.SourceRepo, req.SourceRef,
+		targetRegistry.Name, req.TargetRepo, req.TargetTag)
+	return CopyImage(ctx, source, req.SourceRepo, req.SourceRef, target, req.TargetRepo, req.TargetTag,
+		SameRegistry(sourceRegistry, targetRegistry))
+}
+
+// CopyImage 将镜像（多架构镜像包括所有平台）复制到目标仓库并打上 targetTag。
+// sameRegistry 为 true 时通过跨仓库挂载复用 blob，否则分块上传
+func CopyImage(ctx *JobContext, source *RegistryClient, sourceRepo, sourceRef string, target *RegistryClient, targetRepo, targetTag string, sameRegistry bool) (*models.ImageCopyResult, error) {
+	c := &imageCopier{
+		ctx:          ctx,
+		source:       source.WithoutTimeout().WithContext(ctx),
+		sourceRepo:   sourceRepo,
+		target:       target.WithoutTimeout().WithContext(ctx),
+		targetRepo:   targetRepo,
+		sameRegistry: sameRegistry,
+		seenBlobs:    map[string]bool{},
+	}
+
+	ctx.SetProgress(0, 0, "Resolving manifests")
+	if err := c.collect(sourceRef); err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, blob := range c.blobs {
+		total += blob.Size
+	}
+	c.result.Manifests = len(c.manifests)
+	c.result.Blobs = len(c.blobs)
+
+	var done int64
+	for i, blob := range c.blobs {
+		if err := ctx.Check(); err != nil {
+			return &c.result, err
+		}
+		message := fmt.Sprintf("Copying blob %d/%d %s", i+1, len(c.blobs), shortDigest(blob.Digest))
+		ctx.SetProgress(done, total, message)
+		base := done
+		if err := c.copyBlob(blob, func(uploaded int64) {
+			ctx.SetProgress(base+uploaded, total, "")
+		}); err != nil {
+			if ctx.Check() != nil {
+				return &c.result, ErrJobCancelled
+			}
+			return &c.result, fmt.Errorf("failed to copy blob %s: %v", blob.Digest, err)
+		}
+		done += blob.Size
+		ctx.SetProgress(done, total, message)
+	}
+
+	// 先按 digest 上传子 manifest，最后上传顶层 manifest 并打标签
+	for i, m := range c.manifests {
+		if err := ctx.Check(); err != nil {
+			return &c.result, err
+		}
+		reference := m.digest
+		if i == len(c.manifests)-1 {
+			reference = targetTag
+		}
+		ctx.SetProgress(done, total, fmt.Sprintf("Pushing manifest %d/%d", i+1, len(c.manifests)))
+		digest, err := c.target.PutManifest(c.targetRepo, reference, m.mediaType, m.body)
+		if err != nil {
+			return &c.result, err
+		}
+		c.result.Digest = digest
+	}
+	ctx.Logf("info", "Copied %d blobs (%d uploaded, %d mounted, %d already present), digest %s",
+		c.result.Blobs, c.result.Uploaded, c.result.Mounted, c.result.Existing, c.result.Digest)
+
+	return &c.result, nil
+}
+
+// collect 递归收集 manifest 及其引用的 blob
+func (c *imageCopier) collect(reference string) error {
+	raw, err := c.source.GetRawManifest(c.sourceRepo, reference)
+	if err != nil {
+		return err
+	}
+	body, mediaType, digest := raw.Body, raw.MediaType, raw.Digest
+
+	if IsManifestList(mediaType) {
+		var list models.ManifestList
+		if err := json.Unmarshal(body, &list); err != nil {
+			return err
+		}
+		for _, m := range list.Manifests {
+			if err := c.collect(m.Digest); err != nil {
+				return err
+			}
+		}
+	} else {
+		var manifest models.ImageManifest
+		if err := json.Unmarshal(body, &manifest); err != nil {
+			return err
+		}
+		if manifest.SchemaVersion == 1 {
+			return fmt.Errorf("schema 1 manifests are not supported")
+		}
+		c.addBlob(models.ManifestLayer{MediaType: manifest.Config.MediaType, Size: manifest.Config.Size, Digest: manifest.Config.Digest})
+		for _, layer := range manifest.Layers {
+			// 外部层（如 Windows 基础镜像）不在 Registry 中存储
+			if strings.Contains(layer.MediaType, "foreign") || strings.Contains(layer.MediaType, "nondistributable") {
+				continue
+			}
+			c.addBlob(layer)
+		}
+	}
+
+	c.manifests = append(c.manifests, copyManifest{digest: digest, mediaType: mediaType, body: body})
+	return nil
+}
+
+// addBlob 记录需要复制的 blob，跳过重复项
+func (c *imageCopier) addBlob(blob models.ManifestLayer) {
+	if blob.Digest == "" || c.seenBlobs[blob.Digest] {
+		return
+	}
+	c.seenBlobs[blob.Digest] = true
+	c.blobs = append(c.blobs, blob)
+}
+
+// copyBlob 复制单个 blob：目标已存在时跳过，同一 Registry 时尝试挂载，否则从源读取后分块上传
+func (c *imageCopier) copyBlob(blob models.ManifestLayer, progress func(int64)) error {
+	exists, err := c.target.BlobExists(c.targetRepo, blob.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		c.result.Existing++
+		return nil
+	}
+
+	location := ""
+	if c.sameRegistry {
+		mounted, loc, err := c.target.MountBlob(c.targetRepo, blob.Digest, c.sourceRepo)
+		if err != nil {
+			return err
+		}
+		if mounted {
+			c.result.Mounted++
+			return nil
+		}
+		location = loc
+	}
+
+	reader, _, err := c.source.OpenBlob(c.sourceRepo, blob.Digest)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := c.target.UploadBlob(c.targetRepo, blob.Digest, location, reader, progress); err != nil {
+		return err
+	}
+	c.result.Uploaded++
+	c.result.Bytes += blob.Size
+	return nil
+}
@@ -0,0 +1,333 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// cosign 在签名层上记录签名值的注解
+const cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+// cosign simple signing payload 的类型标识
+const cosignPayloadType = "cosign container image signature"
+
+// 签名 payload 的最大读取大小
+const maxSignaturePayloadSize = 1 << 20
+
+// simpleSigningPayload cosign 签名的 payload
+type simpleSigningPayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// ParsePublicKey 解析 PEM 格式的公钥，支持 ECDSA、RSA 和 Ed25519
+func ParsePublicKey(pemData string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(pemData)))
+	if block == nil {
+		return nil, errors.New("invalid PEM public key")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+
+	switch pub.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// MatchRepository 判断仓库是否匹配模式：空模式匹配全部，以 /** 结尾匹配该前缀下所有仓库，其余按 glob 匹配
+func MatchRepository(pattern, repository string) bool {
+	if pattern == "" || pattern == "**" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return repository == prefix || strings.HasPrefix(repository, prefix+"/")
+	}
+	matched, err := path.Match(pattern, repository)
+	return err == nil && matched
+}
+
+// FindSigningKeys 查找适用于指定 Registry 和仓库的公钥
+func FindSigningKeys(registryID uint, repository string) ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	if err := config.DB.Where("registry_id IN ?", []uint{0, registryID}).Find(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	matched := keys[:0]
+	for _, key := range keys {
+		if MatchRepository(key.RepositoryPattern, repository) {
+			matched = append(matched, key)
+		}
+	}
+	return matched, nil
+}
+
+// verifySignature 使用公钥校验 payload 的签名
+func verifySignature(pub crypto.PublicKey, payload, signature []byte) error {
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		hash := sha256.Sum256(payload)
+		if !ecdsa.VerifyASN1(key, hash[:], signature) {
+			return errors.New("ecdsa signature mismatch")
+		}
+	case *rsa.PublicKey:
+		hash := sha256.Sum256(payload)
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) != nil &&
+			rsa.VerifyPSS(key, crypto.SHA256, hash[:], signature, nil) != nil {
+			return errors.New("rsa signature mismatch")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, payload, signature) {
+			return errors.New("ed25519 signature mismatch")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return nil
+}
+
+// signatureManifest 待校验的签名 manifest
+type signatureManifest struct {
+	source   string
+	manifest *models.ImageManifest
+}
+
+// findSignatureManifests 通过 .sig 标签和 referrers API 查找 cosign 签名 manifest
+func (c *RegistryClient) findSignatureManifests(repository, digest string) ([]signatureManifest, error) {
+	var result []signatureManifest
+	seen := map[string]bool{}
+
+	tag := ReferrersTag(digest) + ".sig"
+	if _, _, found, err := c.HeadManifest(repository, tag); err != nil {
+		return nil, err
+	} else if found {
+		manifest, err := c.getArtifactManifest(repository, tag)
+		if err != nil {
+			return nil, err
+		}
+		seen[manifest.Digest] = true
+		result = append(result, signatureManifest{source: models.ReferrerSourceCosignTag, manifest: manifest})
+	}
+
+	referrers, err := c.GetReferrers(repository, digest, ArtifactTypeCosignSignature)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range referrers {
+		if ref.Category != models.ArtifactCategorySignature || ref.Format != "cosign" || seen[ref.Digest] {
+			continue
+		}
+		manifest, err := c.getArtifactManifest(repository, ref.Digest)
+		if err != nil {
+			return nil, err
+		}
+		seen[manifest.Digest] = true
+		result = append(result, signatureManifest{source: ref.Source, manifest: manifest})
+	}
+
+	return result, nil
+}
+
+// signatureCacheTTL 签名校验结果的缓存时长，推送镜像或修改公钥时提前失效
+const signatureCacheTTL = 10 * time.Minute
+
+// signatureCache 按 Registry、仓库和 digest 缓存签名校验结果，避免标签列表每次刷新都重新校验
+var signatureCache = struct {
+	sync.Mutex
+	entries map[string]cacheEntry
+}{entries: map[string]cacheEntry{}}
+
+// InvalidateSignatureCache 清除 Registry 的签名校验缓存，registryID 为 0 时清除全部
+func InvalidateSignatureCache(registryID uint) {
+	signatureCache.Lock()
+	defer signatureCache.Unlock()
+	prefix := fmt.Sprintf("%d|", registryID)
+	for key := range signatureCache.entries {
+		if registryID == 0 || strings.HasPrefix(key, prefix) {
+			delete(signatureCache.entries, key)
+		}
+	}
+}
+
+// ImageSignatureStatus 返回镜像的签名校验结果，成功的结果按 digest 缓存 signatureCacheTTL。
+// 校验出错时返回 error 状态并附带错误信息，不缓存
+func ImageSignatureStatus(client *RegistryClient, registryID uint, repository, reference string) *models.SignatureResult {
+	digest := reference
+	if !strings.HasPrefix(reference, "sha256:") {
+		var err error
+		if digest, err = client.ResolveDigest(repository, reference); err != nil {
+			return SignatureErrorResult("", err)
+		}
+	}
+
+	key := cacheKey(registryID, "signature", repository+"@"+digest)
+	signatureCache.Lock()
+	entry, ok := signatureCache.entries[key]
+	signatureCache.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.value.(*models.SignatureResult)
+	}
+
+	result, err := VerifyImageSignature(client, registryID, repository, digest)
+	if err != nil {
+		return SignatureErrorResult(digest, err)
+	}
+	signatureCache.Lock()
+	now := time.Now()
+	for k, e := range signatureCache.entries {
+		if now.After(e.expires) {
+			delete(signatureCache.entries, k)
+		}
+	}
+	signatureCache.entries[key] = cacheEntry{value: result, expires: now.Add(signatureCacheTTL)}
+	signatureCache.Unlock()
+	return result
+}
+
+// SignatureErrorResult 校验出错时的签名状态
+func SignatureErrorResult(digest string, err error) *models.SignatureResult {
+	return &models.SignatureResult{
+		Status:     models.SignatureError,
+		Digest:     digest,
+		Error:      err.Error(),
+		Signatures: []models.SignatureDetail{},
+	}
+}
+
+// VerifyImageSignature 校验镜像的 cosign 签名，只使用配置的公钥，不访问透明日志等外部服务
+func VerifyImageSignature(client *RegistryClient, registryID uint, repository, reference string) (*models.SignatureResult, error) {
+	digest, err := client.ResolveDigest(repository, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.SignatureResult{
+		Status:     models.SignatureUnsigned,
+		Digest:     digest,
+		Signatures: []models.SignatureDetail{},
+	}
+
+	manifests, err := client.findSignatureManifests(repository, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := FindSigningKeys(registryID, repository)
+	if err != nil {
+		return nil, err
+	}
+	publicKeys := make([]crypto.PublicKey, len(keys))
+	for i, key := range keys {
+		publicKeys[i], _ = ParsePublicKey(key.PublicKey)
+	}
+
+	for _, sm := range manifests {
+		for _, layer := range sm.manifest.Layers {
+			if layer.MediaType != MediaTypeCosignSimpleSigning {
+				continue
+			}
+			detail := models.SignatureDetail{
+				Source: sm.source,
+				Digest: sm.manifest.Digest,
+				Layer:  layer.Digest,
+			}
+			verifyLayer(client, repository, digest, layer, keys, publicKeys, &detail)
+			result.Signatures = append(result.Signatures, detail)
+		}
+	}
+
+	if len(result.Signatures) == 0 {
+		return result, nil
+	}
+
+	result.Status = models.SignatureInvalid
+	if len(keys) == 0 {
+		result.Status = models.SignatureUnverified
+	}
+	for _, detail := range result.Signatures {
+		if detail.Valid {
+			result.Status = models.SignatureSigned
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// verifyLayer 校验单个签名层，结果写入 detail
+func verifyLayer(client *RegistryClient, repository, digest string, layer models.ManifestLayer,
+	keys []models.SigningKey, publicKeys []crypto.PublicKey, detail *models.SignatureDetail) {
+	signature, err := base64.StdEncoding.DecodeString(layer.Annotations[cosignSignatureAnnotation])
+	if err != nil || len(signature) == 0 {
+		detail.Error = "missing or malformed signature annotation"
+		return
+	}
+
+	payload, err := client.GetBlob(repository, layer.Digest, maxSignaturePayloadSize)
+	if err != nil {
+		detail.Error = err.Error()
+		return
+	}
+
+	var sp simpleSigningPayload
+	if err := json.Unmarshal(payload, &sp); err != nil {
+		detail.Error = "malformed signature payload"
+		return
+	}
+	detail.Identity = sp.Critical.Identity.DockerReference
+	if sp.Critical.Type != cosignPayloadType {
+		detail.Error = fmt.Sprintf("unexpected payload type %q", sp.Critical.Type)
+		return
+	}
+	if sp.Critical.Image.DockerManifestDigest != digest {
+		detail.Error = fmt.Sprintf("payload is for %s, not %s", sp.Critical.Image.DockerManifestDigest, digest)
+		return
+	}
+
+	if len(keys) == 0 {
+		detail.Error = "no signing key configured"
+		return
+	}
+
+	for i, pub := range publicKeys {
+		if pub == nil {
+			continue
+		}
+		if verifySignature(pub, payload, signature) == nil {
+			detail.Valid = true
+			detail.KeyID = keys[i].ID
+			detail.KeyName = keys[i].Name
+			return
+		}
+	}
+	detail.Error = "signature does not match any configured key"
+}
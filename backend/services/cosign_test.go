@@ -0,0 +1,44 @@
+package services
+
+import (
+	"testing"
+
+	"dgui/models"
+)
+
+func TestImageSignatureStatus(t *testing.T) {
+	setupTestDB(t, &models.Registry{}, &models.SigningKey{})
+	r := newTestRegistry(t)
+	client, registry := newTestClient(t, r)
+	t.Cleanup(func() { InvalidateSignatureCache(0) })
+
+	digest := r.pushImage("app", "v1", "linux/amd64", []byte("layer"))
+
+	result := ImageSignatureStatus(client, registry.ID, "app", "v1")
+	if result.Status != models.SignatureUnsigned || result.Digest != digest {
+		t.Fatalf("result = %+v", result)
+	}
+
+	// 同一 digest 的结果来自缓存，不再查找签名
+	requests := r.total()
+	if result := ImageSignatureStatus(client, registry.ID, "app", digest); result.Status != models.SignatureUnsigned {
+		t.Fatalf("cached result = %+v", result)
+	}
+	if r.total() != requests {
+		t.Errorf("cached lookup sent %d requests", r.total()-requests)
+	}
+
+	// 推送签名后缓存失效
+	InvalidateSignatureCache(registry.ID)
+	ImageSignatureStatus(client, registry.ID, "app", digest)
+	if r.total() == requests {
+		t.Error("signatures were not looked up again after invalidation")
+	}
+
+	// 无法解析的引用返回 error 状态和错误信息
+	r.breakReference("app", "v2")
+	result = ImageSignatureStatus(client, registry.ID, "app", "v2")
+	if result.Status != models.SignatureError || result.Error == "" {
+		t.Errorf("result = %+v, want error status", result)
+	}
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+const (
+	defaultCrawlInterval     = 15 * time.Minute
+	defaultFullCrawlInterval = 24 * time.Hour
+)
+
+// crawlIntervals 读取增量爬取间隔 CRAWL_INTERVAL（默认 15m，0 表示关闭）和完整爬取间隔 CRAWL_FULL_INTERVAL（默认 24h）
+func crawlIntervals() (time.Duration, time.Duration) {
+	interval, full := defaultCrawlInterval, defaultFullCrawlInterval
+	if v := os.Getenv("CRAWL_INTERVAL"); v != "" {
+		d, err := ParseAge(v)
+		if err != nil {
+			log.Printf("Invalid CRAWL_INTERVAL %q: %v", v, err)
+		} else {
+			interval = d
+		}
+	}
+	if v := os.Getenv("CRAWL_FULL_INTERVAL"); v != "" {
+		d, err := ParseAge(v)
+		if err != nil {
+			log.Printf("Invalid CRAWL_FULL_INTERVAL %q: %v", v, err)
+		} else {
+			full = d
+		}
+	}
+	return interval, full
+}
+
+// StartCatalogCrawler 定期为所有 Registry 排队爬取任务：距上次爬取超过 CRAWL_INTERVAL 时增量爬取，
+// 距上次完整爬取超过 CRAWL_FULL_INTERVAL 时完整爬取
+func StartCatalogCrawler() {
+	// 服务重启时中断的爬取会随任务恢复重新开始
+	config.DB.Model(&models.CrawlStatus{}).Where("running = ?", true).Update("running", false)
+
+	interval, fullInterval := crawlIntervals()
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			scheduleCrawls(interval, fullInterval)
+			<-ticker.C
+		}
+	}()
+}
+
+// scheduleCrawls 为到期的 Registry 排队爬取任务
+func scheduleCrawls(interval, fullInterval time.Duration) {
+	var registries []models.Registry
+	if err := config.DB.Find(&registries).Error; err != nil {
+		log.Printf("Failed to load registries for crawling: %v", err)
+		return
+	}
+	statuses, err := crawlStatusMap()
+	if err != nil {
+		log.Printf("Failed to load crawl status: %v", err)
+		return
+	}
+	for _, registry := range registries {
+		status, ok := statuses[registry.ID]
+		if ok && (status.Running || status.FinishedAt != nil && time.Since(*status.FinishedAt) < interval) {
+			continue
+		}
+		full := !ok || status.LastFullAt == nil || time.Since(*status.LastFullAt) >= fullInterval
+		if _, err := EnqueueCrawl(registry.ID, full, ""); err != nil {
+			log.Printf("Failed to schedule crawl for registry %s: %v", registry.Name, err)
+		}
+	}
+}
+
+// EnqueueCrawl 排队爬取任务，repository 非空时只刷新该仓库。
+// 已有相同范围的任务在等待或执行时直接返回该任务，等待中的增量爬取会升级为完整爬取
+func EnqueueCrawl(registryID uint, full bool, repository string) (*models.Job, error) {
+	var jobs []models.Job
+	if err := config.DB.Where("type = ? AND registry_id = ? AND status IN ?", models.JobTypeCatalogCrawl, registryID,
+		[]string{models.JobStatusPending, models.JobStatusRunning}).Order("id").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	for i := range jobs {
+		var p CatalogCrawlParams
+		if json.Unmarshal(jobs[i].Params, &p) != nil || p.Repository != repository {
+			continue
+		}
+		if repository != "" || p.Full || !full {
+			return &jobs[i], nil
+		}
+		if jobs[i].Status == models.JobStatusPending {
+			p.Full = true
+			data, err := json.Marshal(p)
+			if err != nil {
+				return nil, err
+			}
+			res := config.DB.Model(&models.Job{}).Where("id = ? AND status = ?", jobs[i].ID, models.JobStatusPending).Update("params", json.RawMessage(data))
+			if res.Error != nil {
+				return nil, res.Error
+			}
+			if res.RowsAffected > 0 {
+				jobs[i].Params = data
+				return &jobs[i], nil
+			}
+		}
+	}
+	return EnqueueJob(models.JobTypeCatalogCrawl, registryID, CatalogCrawlParams{RegistryID: registryID, Full: full, Repository: repository})
+}
+
+// beginCrawl 记录 Registry 开始爬取
+func beginCrawl(registryID, jobID uint) {
+	now := time.Now()
+	status := models.CrawlStatus{RegistryID: registryID, Running: true, JobID: jobID, StartedAt: &now}
+	err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "registry_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"running", "job_id", "started_at"}),
+	}).Create(&status).Error
+	if err != nil {
+		log.Printf("Failed to save crawl status: %v", err)
+	}
+}
+
+// finishCrawl 记录爬取结果，失败时保留上次成功的时间
+func finishCrawl(registryID uint, mode string, result *models.CrawlResult, crawlErr error) {
+	now := time.Now()
+	updates := map[string]interface{}{"running": false, "finished_at": now, "error": ""}
+	if result != nil {
+		updates["mode"] = result.Mode
+		updates["repositories"] = result.Repositories
+		updates["tags"] = result.Tags
+		updates["manifests"] = result.Manifests
+		updates["changed"] = result.Changed
+		updates["skipped"] = result.Skipped
+		updates["failed"] = result.Failed
+		updates["duration_ms"] = result.DurationMs
+	}
+	if crawlErr != nil {
+		updates["error"] = crawlErr.Error()
+	} else {
+		updates["last_success_at"] = now
+		if mode == models.CrawlModeFull {
+			updates["last_full_at"] = now
+		}
+	}
+	if err := config.DB.Model(&models.CrawlStatus{}).Where("registry_id = ?", registryID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to save crawl status: %v", err)
+	}
+}
+
+// crawlStatusMap 返回各 Registry 的爬取状态，registry_id -> 状态
+func crawlStatusMap() (map[uint]models.CrawlStatus, error) {
+	var statuses []models.CrawlStatus
+	if err := config.DB.Find(&statuses).Error; err != nil {
+		return nil, err
+	}
+	byRegistry := make(map[uint]models.CrawlStatus, len(statuses))
+	for _, status := range statuses {
+		byRegistry[status.RegistryID] = status
+	}
+	return byRegistry, nil
+}
+
+// ListCrawlStatus 返回所有 Registry 的爬取状态，从未爬取过的 Registry 也会列出
+func ListCrawlStatus() ([]models.CrawlStatus, error) {
+	var registries []models.Registry
+	if err := config.DB.Order("id").Find(&registries).Error; err != nil {
+		return nil, err
+	}
+	statuses, err := crawlStatusMap()
+	if err != nil {
+		return nil, err
+	}
+	interval, _ := crawlIntervals()
+	list := make([]models.CrawlStatus, 0, len(registries))
+	for _, registry := range registries {
+		status, ok := statuses[registry.ID]
+		if !ok {
+			status = models.CrawlStatus{RegistryID: registry.ID}
+		}
+		status.Registry = registry.Name
+		if interval > 0 && !status.Running {
+			next := time.Now()
+			if status.FinishedAt != nil && status.FinishedAt.Add(interval).After(next) {
+				next = status.FinishedAt.Add(interval)
+			}
+			status.NextRunAt = &next
+		}
+		list = append(list, status)
+	}
+	return list, nil
+}
@@ -0,0 +1,460 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// CatalogCrawlParams 爬取任务的参数
+type CatalogCrawlParams struct {
+	RegistryID uint   `json:"registry_id"`
+	Full       bool   `json:"full,omitempty"`
+	Repository string `json:"repository,omitempty"` // 只刷新该仓库
+}
+
+func init() {
+	RegisterJobHandler(models.JobTypeCatalogCrawl, runCatalogCrawlJob)
+}
+
+// runCatalogCrawlJob 爬取 Registry 或单个仓库，更新标签、manifest、搜索索引和仓库元数据
+func runCatalogCrawlJob(ctx *JobContext, params json.RawMessage) (interface{}, error) {
+	var p CatalogCrawlParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	client, _, err := GetRegistryClient(p.RegistryID)
+	if err != nil {
+		return nil, err
+	}
+	client = client.WithContext(ctx)
+	if p.Repository != "" {
+		return CrawlRepository(ctx, client, p.RegistryID, p.Repository)
+	}
+	return CrawlRegistry(ctx, client, p.RegistryID, p.Full)
+}
+
+// crawler 遍历 Registry 的仓库和标签，将标签指向的 digest 和 manifest 结构保存到数据库。
+// manifest 按 digest 保存，已保存过的不再重复获取
+type crawler struct {
+	ctx        *JobContext
+	client     *RegistryClient
+	registryID uint
+	known      map[string]bool // 已保存的 manifest digest
+	stale      map[string]bool // 已爬取过的仓库，值为是否需要重新检查所有标签
+	result     models.CrawlResult
+}
+
+// newCrawler 创建爬取器并加载已保存的 manifest 和仓库
+func newCrawler(ctx *JobContext, client *RegistryClient, registryID uint) (*crawler, error) {
+	c := &crawler{ctx: ctx, client: client, registryID: registryID, known: map[string]bool{}, stale: map[string]bool{}}
+	var digests []string
+	if err := config.DB.Model(&models.CatalogManifest{}).Where("registry_id = ?", registryID).Pluck("digest", &digests).Error; err != nil {
+		return nil, err
+	}
+	for _, digest := range digests {
+		c.known[digest] = true
+	}
+	var repos []models.CatalogRepository
+	if err := config.DB.Select("name", "stale").Where("registry_id = ?", registryID).Find(&repos).Error; err != nil {
+		return nil, err
+	}
+	for _, repo := range repos {
+		c.stale[repo.Name] = repo.Stale
+	}
+	return c, nil
+}
+
+// CrawlRegistry 爬取 Registry 的全部仓库，删除已不存在的仓库和标签，并清理不再被引用的 manifest。
+// 两种方式都会重新解析所有标签的 digest（标签可能被覆盖推送），只获取 digest 有变化的 manifest；
+// 增量爬取时没有变化的仓库不刷新搜索索引和元数据，新仓库和收到推送 / 删除通知的仓库总是刷新
+func CrawlRegistry(ctx *JobContext, client *RegistryClient, registryID uint, full bool) (result *models.CrawlResult, err error) {
+	start := time.Now()
+	mode := models.CrawlModeIncremental
+	if full {
+		mode = models.CrawlModeFull
+	}
+	beginCrawl(registryID, ctx.JobID())
+	defer func() {
+		if result != nil {
+			result.DurationMs = time.Since(start).Milliseconds()
+		}
+		finishCrawl(registryID, mode, result, err)
+	}()
+
+	c, err := newCrawler(ctx, client, registryID)
+	if err != nil {
+		return nil, err
+	}
+	c.result.Mode = mode
+
+	ctx.SetProgress(0, 0, "Listing repositories")
+	catalog, err := client.GetCatalog()
+	if err != nil {
+		return &c.result, err
+	}
+
+	for i, repo := range catalog.Repositories {
+		if err := ctx.Check(); err != nil {
+			return &c.result, err
+		}
+		ctx.SetProgress(int64(i), int64(len(catalog.Repositories)), "Crawling "+repo)
+		stale, crawled := c.stale[repo]
+		if err := c.crawlRepository(repo, full || stale || !crawled); err != nil {
+			c.result.Failed++
+			ctx.Logf("warn", "Failed to crawl %s: %v", repo, err)
+		}
+	}
+	ctx.SetProgress(int64(len(catalog.Repositories)), int64(len(catalog.Repositories)), "")
+
+	if err := deleteMissingRepositories(registryID, catalog.Repositories); err != nil {
+		return &c.result, err
+	}
+	if err := pruneCatalogManifests(registryID); err != nil {
+		return &c.result, err
+	}
+	return &c.result, nil
+}
+
+// CrawlRepository 刷新单个仓库，重新解析所有标签的 digest
+func CrawlRepository(ctx *JobContext, client *RegistryClient, registryID uint, repository string) (*models.CrawlResult, error) {
+	start := time.Now()
+	c, err := newCrawler(ctx, client, registryID)
+	if err != nil {
+		return nil, err
+	}
+	c.result.Mode = models.CrawlModeRepository
+	if err := c.crawlRepository(repository, true); err != nil {
+		return &c.result, err
+	}
+	c.result.DurationMs = time.Since(start).Milliseconds()
+	return &c.result, nil
+}
+
+// crawlRepository 解析所有标签的 digest 并与已保存的标签对比，保存新的 manifest，删除已不存在的标签；
+// 有变化或 refresh 时更新搜索索引和仓库元数据
+func (c *crawler) crawlRepository(repository string, refresh bool) error {
+	tags, err := c.client.GetTags(repository)
+	if err != nil {
+		return err
+	}
+	c.result.Repositories++
+
+	var stored []models.CatalogTag
+	if err := config.DB.Select("tag", "digest").Where("registry_id = ? AND repository = ?", c.registryID, repository).
+		Find(&stored).Error; err != nil {
+		return err
+	}
+	existing := make(map[string]string, len(stored))
+	for _, tag := range stored {
+		existing[tag.Tag] = tag.Digest
+	}
+
+	now := time.Now()
+	changed := false
+	present := make(map[string]bool, len(tags.Tags))
+	var unchanged []string
+	for _, tag := range tags.Tags {
+		if err := c.ctx.Check(); err != nil {
+			return err
+		}
+		old, known := existing[tag]
+		digest, err := c.client.ResolveDigest(repository, tag)
+		if err != nil {
+			c.ctx.Logf("warn", "Failed to resolve %s:%s: %v", repository, tag, err)
+			if known {
+				present[tag] = true
+			}
+			continue
+		}
+		c.result.Tags++
+		if known && digest == old {
+			present[tag] = true
+			unchanged = append(unchanged, tag)
+			continue
+		}
+		if err := c.saveManifest(repository, digest); err != nil {
+			c.ctx.Logf("warn", "Failed to fetch manifest %s@%s: %v", repository, shortDigest(digest), err)
+			if known {
+				present[tag] = true
+			}
+			continue
+		}
+
+		row := models.CatalogTag{RegistryID: c.registryID, Repository: repository, Tag: tag, Digest: digest, CrawledAt: now}
+		err = config.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "registry_id"}, {Name: "repository"}, {Name: "tag"}},
+			DoUpdates: clause.AssignmentColumns([]string{"digest", "crawled_at"}),
+		}).Create(&row).Error
+		if err != nil {
+			return err
+		}
+		if err := RecordTagChange(c.registryID, repository, tag, digest, models.TagSourceCrawler, "", now); err != nil {
+			return err
+		}
+		present[tag] = true
+		changed = true
+	}
+
+	for start := 0; start < len(unchanged); start += 500 {
+		end := min(start+500, len(unchanged))
+		if err := config.DB.Model(&models.CatalogTag{}).Where("registry_id = ? AND repository = ? AND tag IN ?", c.registryID, repository, unchanged[start:end]).
+			Update("crawled_at", now).Error; err != nil {
+			return err
+		}
+	}
+
+	removed := []string{}
+	for tag := range existing {
+		if !present[tag] {
+			removed = append(removed, tag)
+		}
+	}
+	if err := deleteCatalogTags(c.registryID, repository, removed, models.TagSourceCrawler, "", now); err != nil {
+		return err
+	}
+	if changed || len(removed) > 0 {
+		c.result.Changed++
+	} else if !refresh {
+		c.result.Skipped++
+		return nil
+	}
+	return refreshRepository(c.registryID, repository)
+}
+
+// saveManifest 获取并保存 manifest 及其引用，index 会递归保存子 manifest
+func (c *crawler) saveManifest(repository, digest string) error {
+	if c.known[digest] {
+		return nil
+	}
+	raw, err := c.client.GetRawManifest(repository, digest)
+	if err != nil {
+		return err
+	}
+
+	var doc struct {
+		MediaType    string                      `json:"mediaType"`
+		ArtifactType string                      `json:"artifactType"`
+		Config       models.ManifestConfig       `json:"config"`
+		Layers       []models.ManifestLayer      `json:"layers"`
+		Manifests    []models.ManifestDescriptor `json:"manifests"`
+	}
+	if err := json.Unmarshal(raw.Body, &doc); err != nil {
+		return fmt.Errorf("invalid manifest: %v", err)
+	}
+
+	manifest := models.CatalogManifest{
+		RegistryID:   c.registryID,
+		Digest:       digest,
+		MediaType:    raw.MediaType,
+		ArtifactType: doc.ArtifactType,
+		Size:         int64(len(raw.Body)),
+	}
+	var refs []models.CatalogReference
+	if IsManifestList(raw.MediaType) {
+		for _, m := range doc.Manifests {
+			if err := c.saveManifest(repository, m.Digest); err != nil {
+				return err
+			}
+			refs = append(refs, models.CatalogReference{
+				Kind: models.ReferenceKindManifest, Digest: m.Digest, MediaType: m.MediaType, Size: m.Size,
+				Platform: platformString(m.Platform),
+			})
+		}
+	} else {
+		if manifest.ArtifactType == "" {
+			manifest.ArtifactType = doc.Config.MediaType
+		}
+		if isImageConfig(doc.Config.MediaType) && doc.Config.Digest != "" {
+			data, err := c.client.GetBlob(repository, doc.Config.Digest, maxConfigSize)
+			if err != nil {
+				return fmt.Errorf("failed to fetch config: %v", err)
+			}
+			var cfg models.ImageConfig
+			if err := json.Unmarshal(data, &cfg); err != nil {
+				return fmt.Errorf("invalid config: %v", err)
+			}
+			applyImageConfig(&manifest, &cfg)
+		}
+		if doc.Config.Digest != "" {
+			refs = append(refs, models.CatalogReference{
+				Kind: models.ReferenceKindConfig, Digest: doc.Config.Digest, MediaType: doc.Config.MediaType, Size: doc.Config.Size,
+			})
+		}
+		for _, layer := range doc.Layers {
+			refs = append(refs, models.CatalogReference{
+				Kind: models.ReferenceKindLayer, Digest: layer.Digest, MediaType: layer.MediaType, Size: layer.Size,
+			})
+		}
+	}
+	for i := range refs {
+		refs[i].RegistryID = c.registryID
+		refs[i].ManifestDigest = digest
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("registry_id = ? AND manifest_digest = ?", c.registryID, digest).Delete(&models.CatalogReference{}).Error; err != nil {
+			return err
+		}
+		if len(refs) > 0 {
+			if err := tx.CreateInBatches(refs, 500).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&manifest).Error
+	})
+	if err != nil {
+		return err
+	}
+	c.known[digest] = true
+	c.result.Manifests++
+	return nil
+}
+
+// maxConfigSize 镜像配置的最大字节数
+const maxConfigSize = 8 << 20
+
+// isImageConfig 判断是否为镜像配置（而非其他制品的配置）
+func isImageConfig(mediaType string) bool {
+	return mediaType == "application/vnd.oci.image.config.v1+json" ||
+		mediaType == "application/vnd.docker.container.image.v1+json"
+}
+
+// applyImageConfig 保存镜像配置中用于搜索的平台、标签、环境变量、启动命令和构建历史
+func applyImageConfig(manifest *models.CatalogManifest, cfg *models.ImageConfig) {
+	manifest.OS = cfg.OS
+	manifest.Architecture = cfg.Architecture
+	manifest.Variant = cfg.Variant
+	if created, err := time.Parse(time.RFC3339Nano, cfg.Created); err == nil {
+		manifest.Created = &created
+	}
+	if len(cfg.Config.Labels) > 0 {
+		labels, _ := json.Marshal(cfg.Config.Labels)
+		manifest.Labels = string(labels)
+	}
+	manifest.Env = strings.Join(cfg.Config.Env, "\n")
+	manifest.Entrypoint = strings.TrimSpace(strings.Join(append(append([]string{}, cfg.Config.Entrypoint...), cfg.Config.Cmd...), " "))
+	history := make([]string, 0, len(cfg.History))
+	for _, h := range cfg.History {
+		if h.CreatedBy != "" {
+			history = append(history, h.CreatedBy)
+		}
+	}
+	manifest.History = strings.Join(history, "\n")
+}
+
+// deleteMissingRepositories 删除目录中已不存在的仓库的标签
+func deleteMissingRepositories(registryID uint, repositories []string) error {
+	var stored []string
+	if err := config.DB.Model(&models.CatalogTag{}).Where("registry_id = ?", registryID).Distinct().Pluck("repository", &stored).Error; err != nil {
+		return err
+	}
+	present := make(map[string]bool, len(repositories))
+	for _, repo := range repositories {
+		present[repo] = true
+	}
+	for _, repo := range stored {
+		if !present[repo] {
+			var tags []string
+			if err := config.DB.Model(&models.CatalogTag{}).Where("registry_id = ? AND repository = ?", registryID, repo).Pluck("tag", &tags).Error; err != nil {
+				return err
+			}
+			if err := deleteCatalogTags(registryID, repo, tags, models.TagSourceCrawler, "", time.Now()); err != nil {
+				return err
+			}
+			if err := refreshRepository(registryID, repo); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteCatalogTags 删除已不存在的标签，并在标签历史中记录删除
+func deleteCatalogTags(registryID uint, repository string, tags []string, source, actor string, at time.Time) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	for _, tag := range tags {
+		if err := RecordTagChange(registryID, repository, tag, "", source, actor, at); err != nil {
+			return err
+		}
+	}
+	return config.DB.Where("registry_id = ? AND repository = ? AND tag IN ?", registryID, repository, tags).Delete(&models.CatalogTag{}).Error
+}
+
+// platformString 格式化平台，如 linux/arm64/v8
+func platformString(p models.ManifestPlatform) string {
+	if p.OS == "" && p.Architecture == "" {
+		return ""
+	}
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// pruneCatalogManifests 删除不再被任何标签（直接或经由 index）引用的 manifest
+func pruneCatalogManifests(registryID uint) error {
+	var tagDigests []string
+	if err := config.DB.Model(&models.CatalogTag{}).Where("registry_id = ?", registryID).Distinct().Pluck("digest", &tagDigests).Error; err != nil {
+		return err
+	}
+	var children []models.CatalogReference
+	if err := config.DB.Select("manifest_digest", "digest").
+		Where("registry_id = ? AND kind = ?", registryID, models.ReferenceKindManifest).Find(&children).Error; err != nil {
+		return err
+	}
+	childrenOf := map[string][]string{}
+	for _, ref := range children {
+		childrenOf[ref.ManifestDigest] = append(childrenOf[ref.ManifestDigest], ref.Digest)
+	}
+
+	reachable := map[string]bool{}
+	var visit func(string)
+	visit = func(digest string) {
+		if reachable[digest] {
+			return
+		}
+		reachable[digest] = true
+		for _, child := range childrenOf[digest] {
+			visit(child)
+		}
+	}
+	for _, digest := range tagDigests {
+		visit(digest)
+	}
+
+	var all []string
+	if err := config.DB.Model(&models.CatalogManifest{}).Where("registry_id = ?", registryID).Pluck("digest", &all).Error; err != nil {
+		return err
+	}
+	var stale []string
+	for _, digest := range all {
+		if !reachable[digest] {
+			stale = append(stale, digest)
+		}
+	}
+	for start := 0; start < len(stale); start += 500 {
+		end := start + 500
+		if end > len(stale) {
+			end = len(stale)
+		}
+		batch := stale[start:end]
+		if err := config.DB.Where("registry_id = ? AND manifest_digest IN ?", registryID, batch).Delete(&models.CatalogReference{}).Error; err != nil {
+			return err
+		}
+		if err := config.DB.Where("registry_id = ? AND digest IN ?", registryID, batch).Delete(&models.CatalogManifest{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// setupCatalogDB 创建爬取、搜索索引和存储分析需要的表
+func setupCatalogDB(t *testing.T) {
+	t.Helper()
+	setupTestDB(t, &models.Registry{}, &models.Job{}, &models.JobLog{}, &models.CrawlStatus{},
+		&models.CatalogTag{}, &models.CatalogManifest{}, &models.CatalogReference{}, &models.CatalogRepository{},
+		&models.RegistryEvent{}, &models.TagHistory{}, &models.StorageSnapshot{}, &models.StorageUsage{})
+	createSearchIndex(t)
+}
+
+// catalogTags 按 仓库:标签=digest 格式化已保存的标签，digest 用 names 中的名称代替
+func catalogTags(t *testing.T, registryID uint, names map[string]string) string {
+	t.Helper()
+	var tags []models.CatalogTag
+	if err := config.DB.Where("registry_id = ?", registryID).Order("repository, tag").Find(&tags).Error; err != nil {
+		t.Fatal(err)
+	}
+	parts := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		parts = append(parts, fmt.Sprintf("%s:%s=%s", tag.Repository, tag.Tag, names[tag.Digest]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// catalogNames 返回表中某一列的所有值，排序后以空格连接
+func catalogNames(t *testing.T, model interface{}, column string, registryID uint) string {
+	t.Helper()
+	var values []string
+	if err := config.DB.Model(model).Where("registry_id = ?", registryID).Pluck(column, &values).Error; err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(values)
+	return strings.Join(values, " ")
+}
+
+func TestCrawlRegistry(t *testing.T) {
+	setupCatalogDB(t)
+	r := newTestRegistry(t)
+	client, registry := newTestClient(t, r)
+
+	d1 := r.pushImage("team/app", "v1", "linux/amd64", []byte("base"), []byte("app v1"))
+	r.setTag("team/app", "latest", d1)
+	d3 := r.pushImage("tools", "stable", "linux/amd64", []byte("tools"))
+	names := map[string]string{d1: "d1", d3: "d3"}
+	history := func(tag string) string {
+		chain := tagHistoryChain(t, tag)
+		for digest, name := range names {
+			chain = strings.ReplaceAll(chain, digest, name)
+		}
+		return chain
+	}
+
+	result, err := CrawlRegistry(testJobContext(), client, registry.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Repositories != 2 || result.Tags != 3 || result.Manifests != 2 || result.Changed != 2 {
+		t.Errorf("first crawl result = %+v", result)
+	}
+	if got, want := catalogTags(t, registry.ID, names), "team/app:latest=d1 team/app:v1=d1 tools:stable=d3"; got != want {
+		t.Errorf("tags after first crawl = %s, want %s", got, want)
+	}
+
+	// latest 被覆盖推送，v1 被删除，新增 v2 指向原镜像，tools 仓库被整个删除
+	d2 := r.pushImage("team/app", "latest", "linux/amd64", []byte("base"), []byte("app v2"))
+	names[d2] = "d2"
+	r.removeTag("team/app", "v1")
+	r.setTag("team/app", "v2", d1)
+	r.removeRepository("tools")
+	InvalidateRegistry(registry.ID)
+
+	result, err = CrawlRegistry(testJobContext(), client, registry.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Repositories != 1 || result.Tags != 2 || result.Manifests != 1 || result.Changed != 1 {
+		t.Errorf("second crawl result = %+v", result)
+	}
+	if got, want := catalogTags(t, registry.ID, names), "team/app:latest=d2 team/app:v2=d1"; got != want {
+		t.Errorf("tags after second crawl = %s, want %s", got, want)
+	}
+	for tag, want := range map[string]string{"latest": "d1<-,d2<-d1", "v1": "d1<-,<-d1", "v2": "d1<-", "stable": "d3<-,<-d3"} {
+		if got := history(tag); got != want {
+			t.Errorf("history of %s = %s, want %s", tag, got, want)
+		}
+	}
+	if got, want := catalogNames(t, &models.CatalogManifest{}, "digest", registry.ID), strings.Join(sortedStrings(d1, d2), " "); got != want {
+		t.Errorf("manifests = %s, want %s", got, want)
+	}
+	if got := catalogNames(t, &models.CatalogRepository{}, "name", registry.ID); got != "team/app" {
+		t.Errorf("repositories = %s, want team/app", got)
+	}
+
+	// 没有变化时不获取 manifest，也不刷新仓库
+	manifests := r.count("GET", "/v2/team/app/manifests/")
+	InvalidateRegistry(registry.ID)
+	result, err = CrawlRegistry(testJobContext(), client, registry.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Changed != 0 || result.Skipped != 1 || result.Manifests != 0 {
+		t.Errorf("unchanged crawl result = %+v", result)
+	}
+	if got := r.count("GET", "/v2/team/app/manifests/"); got != manifests {
+		t.Errorf("unchanged crawl fetched %d manifests", got-manifests)
+	}
+
+	var status models.CrawlStatus
+	config.DB.Where("registry_id = ?", registry.ID).First(&status)
+	if status.Running || status.LastSuccessAt == nil || status.Error != "" {
+		t.Errorf("crawl status = %+v", status)
+	}
+}
+
+func TestCrawlRepositoryKeepsUnresolvedTags(t *testing.T) {
+	setupCatalogDB(t)
+	r := newTestRegistry(t)
+	client, registry := newTestClient(t, r)
+
+	d1 := r.pushImage("app", "v1", "linux/amd64", []byte("v1"))
+	d2 := r.pushImage("app", "v2", "linux/amd64", []byte("v2"))
+	names := map[string]string{d1: "d1", d2: "d2"}
+	if _, err := CrawlRepository(testJobContext(), client, registry.ID, "app"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 解析失败的标签保留上次的结果，不记为删除
+	r.breakReference("app", "v1")
+	r.removeTag("app", "v2")
+	InvalidateRegistry(registry.ID)
+	result, err := CrawlRepository(testJobContext(), client, registry.ID, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Mode != models.CrawlModeRepository || result.Tags != 0 || result.Changed != 1 {
+		t.Errorf("result = %+v", result)
+	}
+	if got, want := catalogTags(t, registry.ID, names), "app:v1=d1"; got != want {
+		t.Errorf("tags = %s, want %s", got, want)
+	}
+	var repo models.CatalogRepository
+	config.DB.Where("registry_id = ? AND name = ?", registry.ID, "app").First(&repo)
+	if repo.TagCount != 1 {
+		t.Errorf("tag count = %d, want 1", repo.TagCount)
+	}
+}
+
+// sortedStrings 排序并返回参数
+func sortedStrings(values ...string) []string {
+	sort.Strings(values)
+	return values
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// PreviewDelete 解析引用的 digest 并找出指向同一 digest 的所有标签。
+// 删除 manifest 会同时移除这些标签，引用本身是 digest 时所有标签都算作共享。
+// 标签总是实时解析，只有解析失败的标签才使用爬取结果中的 digest
+func PreviewDelete(client *RegistryClient, repository, reference string) (*models.DeletePreview, error) {
+	digest, err := client.ResolveDigest(repository, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	// 标签列表可能已缓存，需要看到最近推送的标签
+	InvalidateRepository(client.RegistryID, repository)
+	digests, unresolved, err := TagDigests(client, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &models.DeletePreview{
+		Repo:       repository,
+		Reference:  reference,
+		Digest:     digest,
+		Tags:       []string{},
+		SharedTags: []string{},
+	}
+	if len(unresolved) > 0 {
+		tags := make([]string, 0, len(unresolved))
+		for tag := range unresolved {
+			tags = append(tags, tag)
+		}
+		var crawled []models.CatalogTag
+		if err := config.DB.Where("registry_id = ? AND repository = ? AND tag IN ?", client.RegistryID, repository, tags).
+			Find(&crawled).Error; err != nil {
+			return nil, err
+		}
+		for _, tag := range crawled {
+			digests[tag.Tag] = tag.Digest
+			delete(unresolved, tag.Tag)
+			preview.Warnings = append(preview.Warnings, fmt.Sprintf("%s: failed to resolve, using the digest from the last crawl", tag.Tag))
+		}
+		if len(unresolved) > 0 {
+			preview.Warnings = append(preview.Warnings, unresolvedWarning(repository, unresolved))
+		}
+		sort.Strings(preview.Warnings)
+	}
+
+	for tag, d := range digests {
+		if d != digest {
+			continue
+		}
+		preview.Tags = append(preview.Tags, tag)
+		if tag != reference {
+			preview.SharedTags = append(preview.SharedTags, tag)
+		}
+	}
+	sort.Strings(preview.Tags)
+	sort.Strings(preview.SharedTags)
+	return preview, nil
+}
+
+// RecordImageDeletion 通过 dgui 删除 manifest 后，在标签历史中记录被一并删除的标签，
+// 并从爬取结果中移除这些标签、更新仓库的元数据和搜索索引
+func RecordImageDeletion(registryID uint, repository string, tags []string, actor string) error {
+	if err := deleteCatalogTags(registryID, repository, tags, models.TagSourceDelete, actor, time.Now()); err != nil {
+		return err
+	}
+	return refreshRepository(registryID, repository)
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+func TestPreviewDelete(t *testing.T) {
+	setupTestDB(t, &models.Registry{}, &models.CatalogTag{})
+	r := newTestRegistry(t)
+	client, registry := newTestClient(t, r)
+
+	v1 := r.pushImage("app", "v1", "linux/amd64", []byte("layer-1"))
+	v2 := r.pushImage("app", "v2", "linux/amd64", []byte("layer-2"))
+	r.setTag("app", "stable", v1)
+	// 上次爬取时 latest 指向 v2，之后被移到 v1；hotfix 是爬取之后推送的
+	now := time.Now()
+	config.DB.Create(&[]models.CatalogTag{
+		{RegistryID: registry.ID, Repository: "app", Tag: "v1", Digest: v1, CrawledAt: now},
+		{RegistryID: registry.ID, Repository: "app", Tag: "v2", Digest: v2, CrawledAt: now},
+		{RegistryID: registry.ID, Repository: "app", Tag: "stable", Digest: v1, CrawledAt: now},
+		{RegistryID: registry.ID, Repository: "app", Tag: "latest", Digest: v2, CrawledAt: now},
+	})
+	// 先填充标签列表缓存，预览时必须看到之后推送的标签
+	if _, err := client.GetTags("app"); err != nil {
+		t.Fatal(err)
+	}
+	r.setTag("app", "latest", v1)
+	r.setTag("app", "hotfix", v1)
+
+	tests := []struct {
+		name      string
+		reference string
+		broken    string
+		digest    string
+		tags      string
+		shared    string
+		warning   string
+	}{
+		{name: "tags moved or pushed after the crawl", reference: "v1", digest: v1, tags: "hotfix,latest,stable,v1", shared: "hotfix,latest,stable"},
+		{name: "by digest", reference: v1, digest: v1, tags: "hotfix,latest,stable,v1", shared: "hotfix,latest,stable,v1"},
+		{name: "unshared", reference: "v2", digest: v2, tags: "v2", shared: ""},
+		{name: "crawled digest for unresolvable tag", reference: "v1", digest: v1, broken: "stable", tags: "hotfix,latest,stable,v1", shared: "hotfix,latest,stable", warning: "stable: failed to resolve"},
+		{name: "uncrawled unresolvable tag", reference: "v1", digest: v1, broken: "hotfix", tags: "latest,stable,v1", shared: "latest,stable", warning: "failed to resolve hotfix"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r.mu.Lock()
+			r.broken = map[string]bool{}
+			r.mu.Unlock()
+			if tt.broken != "" {
+				r.breakReference("app", tt.broken)
+			}
+			preview, err := PreviewDelete(client, "app", tt.reference)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if preview.Digest != tt.digest {
+				t.Errorf("digest = %s, want %s", preview.Digest, tt.digest)
+			}
+			if got := strings.Join(preview.Tags, ","); got != tt.tags {
+				t.Errorf("tags = %s, want %s", got, tt.tags)
+			}
+			if got := strings.Join(preview.SharedTags, ","); got != tt.shared {
+				t.Errorf("shared tags = %s, want %s", got, tt.shared)
+			}
+			if got := strings.Join(preview.Warnings, "\n"); !strings.Contains(got, tt.warning) || (tt.warning == "" && got != "") {
+				t.Errorf("warnings = %q, want %q", got, tt.warning)
+			}
+		})
+	}
+}
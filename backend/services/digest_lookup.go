@@ -0,0 +1,210 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+const (
+	minDigestPrefix  = 6  // 按前缀反查时至少需要的十六进制字符数
+	maxDigestMatches = 50 // 前缀匹配到多个 digest 时最多返回的数量
+)
+
+// ErrInvalidDigest digest 或前缀格式错误
+var ErrInvalidDigest = errors.New("invalid digest")
+
+// normalizeDigestQuery 规范化 digest 或其前缀，省略算法时视为 sha256
+func normalizeDigestQuery(query string) (string, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	algorithm, hex, ok := strings.Cut(query, ":")
+	if !ok {
+		algorithm, hex = "sha256", query
+	}
+	if algorithm != "sha256" && algorithm != "sha512" {
+		return "", fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidDigest, algorithm)
+	}
+	if len(hex) < minDigestPrefix {
+		return "", fmt.Errorf("%w: at least %d hex characters are required", ErrInvalidDigest, minDigestPrefix)
+	}
+	for _, r := range hex {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return "", fmt.Errorf("%w: %q is not hexadecimal", ErrInvalidDigest, hex)
+		}
+	}
+	return algorithm + ":" + hex, nil
+}
+
+// LookupDigest 在所有 Registry 的爬取结果中按 manifest、config 或镜像层的 digest（或前缀）反查引用它的仓库和标签。
+// 前缀匹配到的 digest 数量有上限，每个返回的 digest 都包含所有引用它的标签
+func LookupDigest(query string) (*models.DigestLookup, error) {
+	prefix, err := normalizeDigestQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	// 十六进制字符都小于 '~'，用范围查询以便使用索引
+	inRange := "digest >= ? AND digest < ?"
+	upper := prefix + "~"
+
+	var registries []models.Registry
+	if err := config.DB.Find(&registries).Error; err != nil {
+		return nil, err
+	}
+	names := map[uint]string{}
+	ids := []uint{}
+	for _, registry := range registries {
+		names[registry.ID] = registry.Name
+		ids = append(ids, registry.ID)
+	}
+	result := &models.DigestLookup{Matches: []models.DigestMatch{}}
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	// 先按不同的 digest 限制数量，再查出这些 digest 的全部记录，避免同一 digest 的记录被截断
+	var manifestDigests, blobDigests []string
+	if err := config.DB.Model(&models.CatalogManifest{}).Where("registry_id IN ? AND "+inRange, ids, prefix, upper).
+		Distinct().Order("digest").Limit(maxDigestMatches+1).Pluck("digest", &manifestDigests).Error; err != nil {
+		return nil, err
+	}
+	if err := config.DB.Model(&models.CatalogReference{}).Where("registry_id IN ? AND kind <> ? AND "+inRange, ids, models.ReferenceKindManifest, prefix, upper).
+		Distinct().Order("digest").Limit(maxDigestMatches+1).Pluck("digest", &blobDigests).Error; err != nil {
+		return nil, err
+	}
+	digests := append(manifestDigests, blobDigests...)
+	sort.Strings(digests)
+	digests = uniqueSorted(digests)
+	if len(digests) > maxDigestMatches {
+		digests = digests[:maxDigestMatches]
+		result.Truncated = true
+	}
+	if len(digests) == 0 {
+		return result, nil
+	}
+
+	var manifests []models.CatalogManifest
+	if err := config.DB.Where("registry_id IN ? AND digest IN ?", ids, digests).Find(&manifests).Error; err != nil {
+		return nil, err
+	}
+	var blobs []models.CatalogReference
+	if err := config.DB.Where("registry_id IN ? AND kind <> ? AND digest IN ?", ids, models.ReferenceKindManifest, digests).
+		Find(&blobs).Error; err != nil {
+		return nil, err
+	}
+
+	byDigest := map[string]*models.DigestMatch{}
+	// 各 Registry 中直接包含该 digest 的 manifest
+	containers := map[string]map[uint][]string{}
+	add := func(registryID uint, digest, kind, mediaType string, size int64, container string) {
+		match := byDigest[digest]
+		if match == nil {
+			match = &models.DigestMatch{Digest: digest, Kind: kind, MediaType: mediaType, Size: size, Tags: []models.DigestTagUsage{}}
+			byDigest[digest] = match
+			containers[digest] = map[uint][]string{}
+		}
+		containers[digest][registryID] = appendUnique(containers[digest][registryID], container)
+	}
+	for _, m := range manifests {
+		add(m.RegistryID, m.Digest, models.ReferenceKindManifest, m.MediaType, m.Size, m.Digest)
+	}
+	for _, ref := range blobs {
+		add(ref.RegistryID, ref.Digest, ref.Kind, ref.MediaType, ref.Size, ref.ManifestDigest)
+	}
+
+	for digest, match := range byDigest {
+		for registryID, direct := range containers[digest] {
+			usages, err := tagsReferencing(registryID, direct)
+			if err != nil {
+				return nil, err
+			}
+			for i := range usages {
+				usages[i].Registry = names[registryID]
+			}
+			match.Tags = append(match.Tags, usages...)
+		}
+		sort.Slice(match.Tags, func(i, j int) bool {
+			a, b := match.Tags[i], match.Tags[j]
+			if a.Registry != b.Registry {
+				return a.Registry < b.Registry
+			}
+			if a.Repository != b.Repository {
+				return a.Repository < b.Repository
+			}
+			return a.Tag < b.Tag
+		})
+		result.Matches = append(result.Matches, *match)
+	}
+	sort.Slice(result.Matches, func(i, j int) bool { return result.Matches[i].Digest < result.Matches[j].Digest })
+	return result, nil
+}
+
+// uniqueSorted 去掉已排序切片中的重复项
+func uniqueSorted(values []string) []string {
+	out := values[:0]
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// tagsReferencing 返回直接或经由多架构镜像引用这些 manifest 的标签
+func tagsReferencing(registryID uint, digests []string) ([]models.DigestTagUsage, error) {
+	// platform 记录 manifest 作为 index 中某个平台被引用时的平台
+	platform := map[string]string{}
+	all := append([]string{}, digests...)
+	visited := map[string]bool{}
+	for _, digest := range digests {
+		visited[digest] = true
+	}
+	pending := digests
+	for len(pending) > 0 {
+		var parents []models.CatalogReference
+		if err := config.DB.Where("registry_id = ? AND kind = ? AND digest IN ?", registryID, models.ReferenceKindManifest, pending).
+			Find(&parents).Error; err != nil {
+			return nil, err
+		}
+		pending = nil
+		for _, ref := range parents {
+			p := ref.Platform
+			if inherited := platform[ref.Digest]; inherited != "" {
+				p = inherited
+			}
+			if existing, seen := platform[ref.ManifestDigest]; seen {
+				// 多个平台都引用时不显示平台
+				if existing != p {
+					platform[ref.ManifestDigest] = ""
+				}
+				continue
+			}
+			if visited[ref.ManifestDigest] {
+				continue
+			}
+			visited[ref.ManifestDigest] = true
+			platform[ref.ManifestDigest] = p
+			all = append(all, ref.ManifestDigest)
+			pending = append(pending, ref.ManifestDigest)
+		}
+	}
+
+	var tags []models.CatalogTag
+	if err := config.DB.Where("registry_id = ? AND digest IN ?", registryID, all).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	usages := make([]models.DigestTagUsage, 0, len(tags))
+	for _, tag := range tags {
+		usages = append(usages, models.DigestTagUsage{
+			RegistryID: registryID,
+			Repository: tag.Repository,
+			Tag:        tag.Tag,
+			Digest:     tag.Digest,
+			Platform:   platform[tag.Digest],
+		})
+	}
+	return usages, nil
+}
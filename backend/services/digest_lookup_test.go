@@ -0,0 +1,117 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+func TestNormalizeDigestQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+		err   bool
+	}{
+		{" ABCDEF01 ", "sha256:abcdef01", false},
+		{"sha256:abcdef", "sha256:abcdef", false},
+		{"sha512:0123456789", "sha512:0123456789", false},
+		{"abcde", "", true},
+		{"sha1:abcdef01", "", true},
+		{"sha256:abcdefgh", "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeDigestQuery(tt.query)
+		if tt.err {
+			if !errors.Is(err, ErrInvalidDigest) {
+				t.Errorf("normalizeDigestQuery(%q) error = %v, want ErrInvalidDigest", tt.query, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeDigestQuery(%q) = %q, %v, want %q", tt.query, got, err, tt.want)
+		}
+	}
+}
+
+func TestLookupDigest(t *testing.T) {
+	setupCatalogDB(t)
+	r := newTestRegistry(t)
+	client, registry := newTestClient(t, r)
+
+	base, amdLayer := []byte("base"), []byte("amd64 layer")
+	amd := r.pushImage("app", "", "linux/amd64", base, amdLayer)
+	arm := r.pushImage("app", "", "linux/arm64", base, []byte("arm64 layer"))
+	index := r.pushIndex("app", "v1", map[string]string{"linux/amd64": amd, "linux/arm64": arm})
+	r.setTag("app", "latest", index)
+	r.pushImage("other", "stable", "linux/amd64", base)
+	if _, err := CrawlRegistry(testJobContext(), client, registry.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		kind  string
+		tags  string
+	}{
+		{"layer shared by all platforms", testDigest(base), models.ReferenceKindLayer, "app:latest@ app:v1@ other:stable@"},
+		{"platform layer by prefix", strings.TrimPrefix(testDigest(amdLayer), "sha256:")[:12], models.ReferenceKindLayer, "app:latest@linux/amd64 app:v1@linux/amd64"},
+		{"platform manifest", amd, models.ReferenceKindManifest, "app:latest@linux/amd64 app:v1@linux/amd64"},
+		{"index", strings.ToUpper(index[:20]), models.ReferenceKindManifest, "app:latest@ app:v1@"},
+	}
+	for _, tt := range tests {
+		result, err := LookupDigest(tt.query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(result.Matches) != 1 || result.Truncated {
+			t.Errorf("%s: %d matches, truncated %v", tt.name, len(result.Matches), result.Truncated)
+			continue
+		}
+		match := result.Matches[0]
+		var tags []string
+		for _, usage := range match.Tags {
+			tags = append(tags, usage.Repository+":"+usage.Tag+"@"+usage.Platform)
+			if usage.Registry != "test" {
+				t.Errorf("%s: registry = %q", tt.name, usage.Registry)
+			}
+		}
+		if match.Kind != tt.kind || strings.Join(tags, " ") != tt.tags {
+			t.Errorf("%s: kind %s, tags %v; want kind %s, tags %s", tt.name, match.Kind, tags, tt.kind, tt.tags)
+		}
+	}
+	if _, err := LookupDigest("abc"); !errors.Is(err, ErrInvalidDigest) {
+		t.Errorf("short prefix error = %v, want ErrInvalidDigest", err)
+	}
+
+	// 匹配到的 digest 超过上限时截断，但每个 digest 的引用都完整返回
+	var refs []models.CatalogReference
+	for i := 0; i <= maxDigestMatches; i++ {
+		digest := fmt.Sprintf("sha256:fedcba%058x", i)
+		refs = append(refs,
+			models.CatalogReference{RegistryID: registry.ID, ManifestDigest: "sha256:m1", Kind: models.ReferenceKindLayer, Digest: digest},
+			models.CatalogReference{RegistryID: registry.ID, ManifestDigest: "sha256:m2", Kind: models.ReferenceKindLayer, Digest: digest})
+	}
+	config.DB.Create(&refs)
+	config.DB.Create(&[]models.CatalogTag{
+		{RegistryID: registry.ID, Repository: "many", Tag: "a", Digest: "sha256:m1"},
+		{RegistryID: registry.ID, Repository: "many", Tag: "b", Digest: "sha256:m2"},
+	})
+	result, err := LookupDigest("fedcba")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Truncated || len(result.Matches) != maxDigestMatches {
+		t.Fatalf("%d matches, truncated %v", len(result.Matches), result.Truncated)
+	}
+	for _, match := range result.Matches {
+		if len(match.Tags) != 2 {
+			t.Errorf("%s has %d tags, want 2", match.Digest, len(match.Tags))
+		}
+	}
+}
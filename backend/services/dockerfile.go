@@ -0,0 +1,269 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"dgui/models"
+)
+
+var (
+	// 旧版 docker build 的元数据指令前缀
+	nopPrefixRe = regexp.MustCompile(`^/bin/(ba)?sh -c #\(nop\)\s*`)
+	// 旧版 docker build 的 RUN 指令前缀
+	shellPrefixRe = regexp.MustCompile(`^/bin/(ba)?sh -c\s+`)
+	// BuildKit 的 RUN |N ARG=... 形式
+	buildkitArgsRe = regexp.MustCompile(`^RUN \|(\d+) `)
+	// 旧版 EXPOSE map[80/tcp:{}] 形式
+	exposeMapRe = regexp.MustCompile(`^EXPOSE map\[(.*)\]$`)
+	// 旧版 ["a" "b"] 形式的 exec 数组
+	legacyExecRe = regexp.MustCompile(`^(CMD|ENTRYPOINT|SHELL|VOLUME) \[(".*")\]$`)
+	// 已经是 Dockerfile 指令的 created_by
+	instructionRe = regexp.MustCompile(`^(FROM|RUN|CMD|LABEL|MAINTAINER|EXPOSE|ENV|ADD|COPY|ENTRYPOINT|VOLUME|USER|WORKDIR|ARG|ONBUILD|STOPSIGNAL|HEALTHCHECK|SHELL)\b`)
+)
+
+// ReconstructDockerfile 根据镜像配置中的构建历史还原近似的 Dockerfile
+// skipEmpty 为 true 时忽略不产生文件层的历史条目（ENV、LABEL 等）
+func ReconstructDockerfile(info *models.ImageInfo, skipEmpty bool) *models.ReconstructedDockerfile {
+	result := &models.ReconstructedDockerfile{
+		Name:   info.Name,
+		Tag:    info.Tag,
+		Digest: info.Digest,
+	}
+
+	layers := info.Manifest.Layers
+	layerIndex := 0
+	declaredArgs := map[string]string{}
+
+	for _, entry := range info.Config.History {
+		ins := models.DockerfileInstruction{
+			CreatedBy:  entry.CreatedBy,
+			Created:    entry.Created,
+			Comment:    entry.Comment,
+			EmptyLayer: entry.EmptyLayer,
+			LayerIndex: -1,
+		}
+
+		if !entry.EmptyLayer {
+			ins.LayerIndex = layerIndex
+			if layerIndex < len(layers) {
+				ins.LayerDigest = layers[layerIndex].Digest
+				ins.LayerSize = layers[layerIndex].Size
+			}
+			layerIndex++
+		}
+
+		if entry.EmptyLayer && skipEmpty {
+			continue
+		}
+
+		var args []string
+		ins.Instruction, args = normalizeCreatedBy(entry.CreatedBy)
+
+		// BuildKit 的构建参数转换为 ARG 指令，同值的参数只声明一次
+		for _, arg := range args {
+			name, value, _ := strings.Cut(arg, "=")
+			if v, ok := declaredArgs[name]; ok && v == value {
+				continue
+			}
+			declaredArgs[name] = value
+			result.Instructions = append(result.Instructions, models.DockerfileInstruction{
+				Instruction: "ARG " + arg,
+				CreatedBy:   entry.CreatedBy,
+				Created:     entry.Created,
+				EmptyLayer:  true,
+				LayerIndex:  -1,
+			})
+		}
+
+		result.Instructions = append(result.Instructions, ins)
+	}
+
+	result.Aligned = layerIndex == len(layers)
+	result.Dockerfile = renderDockerfile(result)
+
+	return result
+}
+
+// normalizeCreatedBy 将 created_by 转换为 Dockerfile 指令，同时返回 BuildKit RUN 的构建参数
+func normalizeCreatedBy(createdBy string) (string, []string) {
+	s := strings.TrimSpace(createdBy)
+	s = strings.TrimSpace(strings.TrimSuffix(s, "# buildkit"))
+	if s == "" {
+		return "", nil
+	}
+
+	// 旧版 builder：#(nop) 表示元数据指令
+	if nopPrefixRe.MatchString(s) {
+		s = nopPrefixRe.ReplaceAllString(s, "")
+		return normalizeMetadataInstruction(s), nil
+	}
+
+	// 旧版 builder：直接以 shell 执行的为 RUN
+	if shellPrefixRe.MatchString(s) {
+		return "RUN " + shellPrefixRe.ReplaceAllString(s, ""), nil
+	}
+
+	// BuildKit：RUN |2 A=1 B=2 /bin/sh -c cmd
+	if m := buildkitArgsRe.FindStringSubmatch(s); m != nil {
+		var count int
+		fmt.Sscanf(m[1], "%d", &count)
+		rest := s[len(m[0]):]
+		args := make([]string, 0, count)
+		for i := 0; i < count; i++ {
+			var token string
+			token, rest = nextArgToken(rest)
+			if token == "" {
+				break
+			}
+			args = append(args, token)
+		}
+		rest = shellPrefixRe.ReplaceAllString(strings.TrimSpace(rest), "")
+		return "RUN " + rest, args
+	}
+
+	if instructionRe.MatchString(s) {
+		if strings.HasPrefix(s, "RUN ") {
+			return "RUN " + shellPrefixRe.ReplaceAllString(strings.TrimPrefix(s, "RUN "), ""), nil
+		}
+		return normalizeMetadataInstruction(s), nil
+	}
+
+	// 无法识别的命令按 RUN 处理
+	return "RUN " + s, nil
+}
+
+// nextArgToken 取出下一个 KEY=VALUE 形式的参数，支持带引号的值
+func nextArgToken(s string) (string, string) {
+	s = strings.TrimLeft(s, " ")
+	if s == "" {
+		return "", ""
+	}
+	var b strings.Builder
+	var quote byte
+	i := 0
+	for ; i < len(s); i++ {
+		ch := s[i]
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			}
+			b.WriteByte(ch)
+			continue
+		}
+		if ch == '"' || ch == '\'' {
+			quote = ch
+			b.WriteByte(ch)
+			continue
+		}
+		if ch == ' ' {
+			break
+		}
+		b.WriteByte(ch)
+	}
+	return b.String(), s[i:]
+}
+
+// normalizeMetadataInstruction 修正旧版 builder 元数据指令的格式
+func normalizeMetadataInstruction(s string) string {
+	s = strings.TrimSpace(s)
+
+	// ADD file:xxx in /  ->  ADD file:xxx /
+	if strings.HasPrefix(s, "ADD ") || strings.HasPrefix(s, "COPY ") {
+		if idx := strings.LastIndex(s, " in "); idx > 0 {
+			s = s[:idx] + " " + strings.TrimSpace(s[idx+len(" in "):])
+		}
+		return s
+	}
+
+	// EXPOSE map[80/tcp:{} 443/tcp:{}]  ->  EXPOSE 80/tcp 443/tcp
+	if m := exposeMapRe.FindStringSubmatch(s); m != nil {
+		ports := strings.Fields(strings.ReplaceAll(m[1], ":{}", ""))
+		return "EXPOSE " + strings.Join(ports, " ")
+	}
+
+	// CMD ["a" "b"]  ->  CMD ["a","b"]
+	if m := legacyExecRe.FindStringSubmatch(s); m != nil && !strings.Contains(m[2], "\",") {
+		return m[1] + " [" + strings.ReplaceAll(m[2], "\" \"", "\",\"") + "]"
+	}
+
+	return s
+}
+
+// renderDockerfile 生成 Dockerfile 文本
+func renderDockerfile(d *models.ReconstructedDockerfile) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Reconstructed from image history of %s:%s\n", d.Name, d.Tag)
+	if d.Digest != "" {
+		fmt.Fprintf(&b, "# Digest: %s\n", d.Digest)
+	}
+	b.WriteString("# This is an approximation: base image, build context and multi-stage builds cannot be recovered.\n")
+	if !d.Aligned {
+		b.WriteString("# Warning: history entries do not match manifest layers, layer sizes may be inaccurate.\n")
+	}
+	b.WriteString("\nFROM scratch\n")
+
+	for _, ins := range d.Instructions {
+		b.WriteString("\n")
+		if ins.LayerIndex >= 0 {
+			if ins.LayerDigest != "" {
+				fmt.Fprintf(&b, "# layer %d: %s (%s)\n", ins.LayerIndex+1, shortDigest(ins.LayerDigest), formatSize(ins.LayerSize))
+			} else {
+				fmt.Fprintf(&b, "# layer %d: missing in manifest\n", ins.LayerIndex+1)
+			}
+		} else if ins.Instruction != "" && !strings.HasPrefix(ins.Instruction, "ARG ") {
+			b.WriteString("# empty layer\n")
+		}
+		if ins.Comment != "" {
+			fmt.Fprintf(&b, "# %s\n", strings.ReplaceAll(ins.Comment, "\n", " "))
+		}
+		if ins.Instruction == "" {
+			b.WriteString("# (unknown instruction)\n")
+			continue
+		}
+		b.WriteString(formatInstruction(ins.Instruction))
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// formatInstruction 将较长的 RUN 指令按 && 拆分为多行
+func formatInstruction(ins string) string {
+	if !strings.HasPrefix(ins, "RUN ") || strings.Contains(ins, "\n") {
+		return ins
+	}
+	parts := strings.Split(ins, " && ")
+	if len(parts) == 1 {
+		return ins
+	}
+	return strings.Join(parts, " \\\n    && ")
+}
+
+// shortDigest 截取 digest 的前 12 位
+func shortDigest(digest string) string {
+	_, hex, found := strings.Cut(digest, ":")
+	if !found {
+		hex = digest
+	}
+	if len(hex) > 12 {
+		hex = hex[:12]
+	}
+	return hex
+}
+
+// formatSize 格式化字节大小
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
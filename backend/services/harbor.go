@@ -0,0 +1,412 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dgui/models"
+)
+
+const (
+	harborAPIPrefix = "/api/v2.0"
+	harborPageSize  = 100
+)
+
+// harborReportMimeTypes 请求扫描结果时接受的报告格式
+var harborReportMimeTypes = []string{
+	"application/vnd.security.vulnerability.report; version=1.1",
+	"application/vnd.scanner.adapter.vuln.report.harbor+json; version=1.0",
+}
+
+// ErrNotHarbor Registry 不是 Harbor
+var ErrNotHarbor = errors.New("registry is not a Harbor registry")
+
+// IsHarbor 是否通过 Harbor API 获取元数据
+func (c *RegistryClient) IsHarbor() bool {
+	return c.Kind == models.RegistryKindHarbor
+}
+
+// harborGet 请求 Harbor API 并解码 JSON，返回 X-Total-Count。
+// Harbor API 不接受 Registry 的 Bearer token，总是使用基本认证（支持机器人账户）
+func (c *RegistryClient) harborGet(path string, query url.Values, headers map[string]string, out interface{}) (int, error) {
+	u := c.BaseURL + harborAPIPrefix + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(c.context(), "GET", u, nil)
+	if err != nil {
+		return 0, err
+	}
+	if c.Username != "" && c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	start := time.Now()
+	resp, err := c.HTTPClient.Do(req)
+	statusCode := 0
+	if err == nil {
+		statusCode = resp.StatusCode
+	}
+	observeRegistryRequest(c.metricsLabel(), "GET", u, statusCode, time.Since(start))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, &registryStatusError{What: "harbor " + path, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	total, _ := strconv.Atoi(resp.Header.Get("X-Total-Count"))
+	return total, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// harborList 逐页请求 Harbor 列表接口，每页调用 decode，返回本页的条数
+func (c *RegistryClient) harborList(path string, query url.Values, decode func(*json.Decoder) (int, error)) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	fetched := 0
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		query.Set("page_size", strconv.Itoa(harborPageSize))
+		var raw json.RawMessage
+		total, err := c.harborGet(path, query, nil, &raw)
+		if err != nil {
+			return err
+		}
+		n, err := decode(json.NewDecoder(strings.NewReader(string(raw))))
+		if err != nil {
+			return err
+		}
+		fetched += n
+		if n < harborPageSize || (total > 0 && fetched >= total) {
+			return nil
+		}
+	}
+}
+
+// harborProject Harbor API 返回的项目
+type harborProject struct {
+	ProjectID    int64             `json:"project_id"`
+	Name         string            `json:"name"`
+	OwnerName    string            `json:"owner_name"`
+	RepoCount    int               `json:"repo_count"`
+	CreationTime *time.Time        `json:"creation_time"`
+	UpdateTime   *time.Time        `json:"update_time"`
+	Metadata     map[string]string `json:"metadata"`
+}
+
+// harborRepository Harbor API 返回的仓库
+type harborRepository struct {
+	Name          string     `json:"name"` // 包含项目名，如 library/nginx
+	Description   string     `json:"description"`
+	ArtifactCount int64      `json:"artifact_count"`
+	PullCount     int64      `json:"pull_count"`
+	CreationTime  *time.Time `json:"creation_time"`
+	UpdateTime    *time.Time `json:"update_time"`
+}
+
+// harborProjects 列出当前用户可见的所有项目
+func (c *RegistryClient) harborProjects() ([]harborProject, error) {
+	projects := []harborProject{}
+	err := c.harborList("/projects", nil, func(d *json.Decoder) (int, error) {
+		var page []harborProject
+		if err := d.Decode(&page); err != nil {
+			return 0, err
+		}
+		projects = append(projects, page...)
+		return len(page), nil
+	})
+	return projects, err
+}
+
+// harborRepositories 列出项目中的所有仓库
+func (c *RegistryClient) harborRepositories(project string) ([]harborRepository, error) {
+	repos := []harborRepository{}
+	err := c.harborList("/projects/"+url.PathEscape(project)+"/repositories", nil, func(d *json.Decoder) (int, error) {
+		var page []harborRepository
+		if err := d.Decode(&page); err != nil {
+			return 0, err
+		}
+		repos = append(repos, page...)
+		return len(page), nil
+	})
+	return repos, err
+}
+
+// harborRepositoryPath Harbor API 中仓库的路径，项目之后的部分需要两次转义（a/b -> a%252Fb）
+func harborRepositoryPath(repository string) (string, error) {
+	project, name, ok := strings.Cut(repository, "/")
+	if !ok || name == "" {
+		return "", fmt.Errorf("repository %q has no Harbor project", repository)
+	}
+	return "/projects/" + url.PathEscape(project) + "/repositories/" + url.PathEscape(url.PathEscape(name)), nil
+}
+
+// harborCatalog 通过 Harbor API 列出所有项目中的仓库，不需要管理员权限
+func (c *RegistryClient) harborCatalog() ([]string, error) {
+	projects, err := c.harborProjects()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, project := range projects {
+		if project.RepoCount == 0 {
+			continue
+		}
+		repos, err := c.harborRepositories(project.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range repos {
+			names = append(names, repo.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ListHarborProjects 列出 Harbor 项目及其存储配额
+func ListHarborProjects(client *RegistryClient) ([]models.HarborProject, error) {
+	if !client.IsHarbor() {
+		return nil, ErrNotHarbor
+	}
+	projects, err := client.harborProjects()
+	if err != nil {
+		return nil, err
+	}
+
+	type quotaResources struct {
+		Storage *int64 `json:"storage"`
+	}
+	quotas := map[string]struct{ hard, used *int64 }{}
+	err = client.harborList("/quotas", url.Values{"reference": {"project"}}, func(d *json.Decoder) (int, error) {
+		var page []struct {
+			Ref struct {
+				ID   int64  `json:"id"`
+				Name string `json:"name"`
+			} `json:"ref"`
+			Hard quotaResources `json:"hard"`
+			Used quotaResources `json:"used"`
+		}
+		if err := d.Decode(&page); err != nil {
+			return 0, err
+		}
+		for _, q := range page {
+			quotas[q.Ref.Name] = struct{ hard, used *int64 }{q.Hard.Storage, q.Used.Storage}
+		}
+		return len(page), nil
+	})
+	// 配额接口需要系统管理员权限，没有权限时只返回项目
+	var status *registryStatusError
+	if err != nil && !(errors.As(err, &status) && (status.StatusCode == http.StatusUnauthorized || status.StatusCode == http.StatusForbidden)) {
+		return nil, err
+	}
+
+	result := make([]models.HarborProject, 0, len(projects))
+	for _, p := range projects {
+		quota := quotas[p.Name]
+		result = append(result, models.HarborProject{
+			ProjectID:    p.ProjectID,
+			Name:         p.Name,
+			Public:       p.Metadata["public"] == "true",
+			OwnerName:    p.OwnerName,
+			RepoCount:    p.RepoCount,
+			CreationTime: p.CreationTime,
+			UpdateTime:   p.UpdateTime,
+			QuotaHard:    quota.hard,
+			QuotaUsed:    quota.used,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// EnrichHarborRepositories 用 Harbor 的仓库元数据补充仓库列表：拉取次数、最近推送时间和描述。
+// 按项目列出仓库后在内存中匹配，每个项目只需分页请求一次；单个项目失败时跳过该项目
+func EnrichHarborRepositories(client *RegistryClient, repos []models.RepositoryInfo) {
+	if !client.IsHarbor() {
+		return
+	}
+	byProject := map[string][]int{}
+	for i := range repos {
+		project, name, ok := strings.Cut(repos[i].Name, "/")
+		if !ok || name == "" {
+			continue
+		}
+		byProject[project] = append(byProject[project], i)
+	}
+	for project, indexes := range byProject {
+		list, err := client.harborRepositories(project)
+		if err != nil {
+			continue
+		}
+		metadata := make(map[string]harborRepository, len(list))
+		for _, repo := range list {
+			metadata[repo.Name] = repo
+		}
+		for _, i := range indexes {
+			repo, ok := metadata[repos[i].Name]
+			if !ok {
+				continue
+			}
+			pulls := repo.PullCount
+			repos[i].PullCount = &pulls
+			repos[i].Description = repo.Description
+			if repos[i].LastPushed == nil && repo.UpdateTime != nil {
+				repos[i].LastPushed = repo.UpdateTime
+			}
+		}
+	}
+}
+
+// harborSeverity 将 Harbor 的严重等级转换为 dgui 的等级
+func harborSeverity(severity string) string {
+	switch strings.ToLower(severity) {
+	case "critical":
+		return models.SeverityCritical
+	case "high":
+		return models.SeverityHigh
+	case "medium":
+		return models.SeverityMedium
+	case "low", "negligible":
+		return models.SeverityLow
+	}
+	return models.SeverityUnknown
+}
+
+// harborScanOverview Harbor 制品的扫描概要
+type harborScanOverview struct {
+	ScanStatus string     `json:"scan_status"`
+	Severity   string     `json:"severity"`
+	StartTime  *time.Time `json:"start_time"`
+	EndTime    *time.Time `json:"end_time"`
+	Scanner    *struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"scanner"`
+	Summary *struct {
+		Fixable int `json:"fixable"`
+	} `json:"summary"`
+}
+
+// harborVulnerability Harbor 扫描报告中的漏洞
+type harborVulnerability struct {
+	ID            string `json:"id"`
+	Package       string `json:"package"`
+	Version       string `json:"version"`
+	FixVersion    string `json:"fix_version"`
+	Severity      string `json:"severity"`
+	Description   string `json:"description"`
+	PreferredCVSS *struct {
+		ScoreV3 *float64 `json:"score_v3"`
+		ScoreV2 *float64 `json:"score_v2"`
+	} `json:"preferred_cvss"`
+}
+
+// GetHarborScanReport 获取 Harbor 中镜像已有的扫描结果，漏洞映射为 dgui 的漏洞记录，按严重等级和分数排序
+func GetHarborScanReport(client *RegistryClient, repository, reference string) (*models.HarborScanReport, []models.ImageVulnerability, error) {
+	if !client.IsHarbor() {
+		return nil, nil, ErrNotHarbor
+	}
+	path, err := harborRepositoryPath(repository)
+	if err != nil {
+		return nil, nil, err
+	}
+	path += "/artifacts/" + url.PathEscape(reference)
+	headers := map[string]string{"X-Accept-Vulnerabilities": strings.Join(harborReportMimeTypes, ", ")}
+
+	var artifact struct {
+		Digest       string                        `json:"digest"`
+		ScanOverview map[string]harborScanOverview `json:"scan_overview"`
+	}
+	if _, err := client.harborGet(path, url.Values{"with_scan_overview": {"true"}}, headers, &artifact); err != nil {
+		return nil, nil, err
+	}
+	report := &models.HarborScanReport{Digest: artifact.Digest, Status: "Not Scanned"}
+	vulnerabilities := []models.ImageVulnerability{}
+	var overview *harborScanOverview
+	for _, mime := range harborReportMimeTypes {
+		if o, ok := artifact.ScanOverview[mime]; ok {
+			overview = &o
+			break
+		}
+	}
+	if overview == nil {
+		return report, vulnerabilities, nil
+	}
+	report.Status = overview.ScanStatus
+	report.Severity = harborSeverity(overview.Severity)
+	report.StartTime = overview.StartTime
+	report.EndTime = overview.EndTime
+	if overview.Scanner != nil {
+		report.Scanner = strings.TrimSpace(overview.Scanner.Name + " " + overview.Scanner.Version)
+	}
+	if overview.Summary != nil {
+		report.Fixable = overview.Summary.Fixable
+	}
+	if overview.ScanStatus != "Success" {
+		return report, vulnerabilities, nil
+	}
+
+	var additions map[string]struct {
+		Vulnerabilities []harborVulnerability `json:"vulnerabilities"`
+	}
+	if _, err := client.harborGet(path+"/additions/vulnerabilities", nil, headers, &additions); err != nil {
+		return nil, nil, err
+	}
+	for _, mime := range harborReportMimeTypes {
+		addition, ok := additions[mime]
+		if !ok {
+			continue
+		}
+		for _, v := range addition.Vulnerabilities {
+			vuln := models.ImageVulnerability{
+				Digest:       artifact.Digest,
+				AdvisoryID:   v.ID,
+				Summary:      v.Description,
+				Severity:     harborSeverity(v.Severity),
+				Package:      v.Package,
+				Version:      v.Version,
+				FixedVersion: v.FixVersion,
+			}
+			if strings.HasPrefix(v.ID, "CVE-") {
+				vuln.CVE = v.ID
+			}
+			if cvss := v.PreferredCVSS; cvss != nil {
+				if cvss.ScoreV3 != nil {
+					vuln.Score = *cvss.ScoreV3
+				} else if cvss.ScoreV2 != nil {
+					vuln.Score = *cvss.ScoreV2
+				}
+			}
+			report.Add(vuln.Severity)
+			vulnerabilities = append(vulnerabilities, vuln)
+		}
+		break
+	}
+	sort.SliceStable(vulnerabilities, func(i, j int) bool {
+		a, b := vulnerabilities[i], vulnerabilities[j]
+		if severityRank[a.Severity] != severityRank[b.Severity] {
+			return severityRank[a.Severity] < severityRank[b.Severity]
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Package < b.Package
+	})
+	return report, vulnerabilities, nil
+}
@@ -0,0 +1,309 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"dgui/models"
+)
+
+// fakeHarbor 按路径返回预设响应的 Harbor API，记录收到的请求 URI
+type fakeHarbor struct {
+	mu       sync.Mutex
+	handlers map[string]http.HandlerFunc // 键为转义后的路径（不含 /api/v2.0）
+	requests []string
+}
+
+func newFakeHarbor(t *testing.T) (*fakeHarbor, *RegistryClient) {
+	h := &fakeHarbor{handlers: map[string]http.HandlerFunc{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.mu.Lock()
+		h.requests = append(h.requests, r.RequestURI)
+		handler := h.handlers[strings.TrimPrefix(r.URL.EscapedPath(), harborAPIPrefix)]
+		h.mu.Unlock()
+		if user, pass, ok := r.BasicAuth(); !ok || user != "robot$dgui" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if handler == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	client := NewRegistryClient(&models.Registry{Kind: models.RegistryKindHarbor, URL: server.URL, Username: "robot$dgui", Password: "secret"})
+	return h, client
+}
+
+// requestsTo 返回请求路径为 path 的请求 URI
+func (h *fakeHarbor) requestsTo(path string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []string
+	for _, uri := range h.requests {
+		if p, _, _ := strings.Cut(uri, "?"); p == harborAPIPrefix+path {
+			out = append(out, uri)
+		}
+	}
+	return out
+}
+
+// pagedHandler 按 page / page_size 分页返回 items，withTotal 时设置 X-Total-Count
+func pagedHandler(items []interface{}, withTotal bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+		start := min((page-1)*size, len(items))
+		end := min(start+size, len(items))
+		if withTotal {
+			w.Header().Set("X-Total-Count", strconv.Itoa(len(items)))
+		}
+		json.NewEncoder(w).Encode(items[start:end])
+	}
+}
+
+func TestHarborListPaging(t *testing.T) {
+	tests := []struct {
+		name      string
+		count     int
+		withTotal bool
+		pages     int
+	}{
+		{"partial last page", 250, true, 3},
+		{"full last page with total", 200, true, 2},
+		{"full last page without total", 200, false, 3},
+		{"empty", 0, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, client := newFakeHarbor(t)
+			items := make([]interface{}, tt.count)
+			for i := range items {
+				items[i] = map[string]interface{}{"project_id": i + 1, "name": fmt.Sprintf("p%03d", i)}
+			}
+			h.handlers["/projects"] = pagedHandler(items, tt.withTotal)
+
+			projects, err := client.harborProjects()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(projects) != tt.count {
+				t.Errorf("got %d projects, want %d", len(projects), tt.count)
+			}
+			for i, p := range projects {
+				if p.ProjectID != int64(i+1) {
+					t.Fatalf("project %d has id %d, pages were not concatenated in order", i, p.ProjectID)
+				}
+			}
+			if requests := h.requestsTo("/projects"); len(requests) != tt.pages {
+				t.Errorf("requests = %v, want %d pages", requests, tt.pages)
+			}
+		})
+	}
+}
+
+func TestHarborRepositoryPath(t *testing.T) {
+	tests := []struct {
+		repository string
+		want       string
+		wantErr    bool
+	}{
+		{"library/nginx", "/projects/library/repositories/nginx", false},
+		{"team/app/api", "/projects/team/repositories/app%252Fapi", false},
+		{"team/a/b/c", "/projects/team/repositories/a%252Fb%252Fc", false},
+		{"nginx", "", true},
+		{"team/", "", true},
+	}
+	for _, tt := range tests {
+		got, err := harborRepositoryPath(tt.repository)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("harborRepositoryPath(%q) = %q, %v, want %q", tt.repository, got, err, tt.want)
+		}
+	}
+}
+
+func TestListHarborProjectsQuota(t *testing.T) {
+	projects := []interface{}{
+		map[string]interface{}{"project_id": 1, "name": "library", "metadata": map[string]string{"public": "true"}},
+		map[string]interface{}{"project_id": 2, "name": "team"},
+	}
+	tests := []struct {
+		name       string
+		quotaCode  int
+		wantErr    bool
+		wantQuotas bool
+	}{
+		{"admin", http.StatusOK, false, true},
+		{"unauthorized", http.StatusUnauthorized, false, false},
+		{"forbidden", http.StatusForbidden, false, false},
+		{"server error", http.StatusInternalServerError, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, client := newFakeHarbor(t)
+			h.handlers["/projects"] = pagedHandler(projects, true)
+			h.handlers["/quotas"] = func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("reference") != "project" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.WriteHeader(tt.quotaCode)
+				if tt.quotaCode == http.StatusOK {
+					fmt.Fprint(w, `[{"ref":{"id":2,"name":"team"},"hard":{"storage":1000},"used":{"storage":250}}]`)
+				}
+			}
+
+			result, err := ListHarborProjects(client)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ListHarborProjects succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result) != 2 || result[0].Name != "library" || !result[0].Public || result[1].Name != "team" || result[1].Public {
+				t.Fatalf("projects = %+v", result)
+			}
+			team := result[1]
+			if tt.wantQuotas {
+				if team.QuotaHard == nil || *team.QuotaHard != 1000 || team.QuotaUsed == nil || *team.QuotaUsed != 250 {
+					t.Errorf("team quota = %v / %v, want 250 / 1000", team.QuotaUsed, team.QuotaHard)
+				}
+			} else if team.QuotaHard != nil || team.QuotaUsed != nil {
+				t.Errorf("team quota = %v / %v, want none", team.QuotaUsed, team.QuotaHard)
+			}
+		})
+	}
+}
+
+func TestGetHarborScanReport(t *testing.T) {
+	const (
+		mime11 = "application/vnd.security.vulnerability.report; version=1.1"
+		mime10 = "application/vnd.scanner.adapter.vuln.report.harbor+json; version=1.0"
+	)
+	overview := func(status, severity string) map[string]interface{} {
+		return map[string]interface{}{
+			"scan_status": status,
+			"severity":    severity,
+			"scanner":     map[string]string{"name": "Trivy", "version": "v0.50.1"},
+			"summary":     map[string]int{"fixable": 1},
+		}
+	}
+	vulns := func(ids ...string) map[string]interface{} {
+		var list []map[string]interface{}
+		for _, id := range ids {
+			list = append(list, map[string]interface{}{"id": id, "package": "openssl", "version": "3.0.1", "severity": "High"})
+		}
+		return map[string]interface{}{"vulnerabilities": list}
+	}
+
+	tests := []struct {
+		name      string
+		overview  map[string]interface{}
+		additions map[string]interface{}
+		status    string
+		severity  string
+		ids       []string
+	}{
+		{
+			name:      "prefers the newer report format",
+			overview:  map[string]interface{}{mime10: overview("Success", "Low"), mime11: overview("Success", "Critical")},
+			additions: map[string]interface{}{mime10: vulns("CVE-2000-0001"), mime11: vulns("CVE-2024-0001", "GHSA-xxxx")},
+			status:    "Success", severity: models.SeverityCritical, ids: []string{"CVE-2024-0001", "GHSA-xxxx"},
+		},
+		{
+			name:      "falls back to the harbor format",
+			overview:  map[string]interface{}{mime10: overview("Success", "High")},
+			additions: map[string]interface{}{mime10: vulns("CVE-2000-0001")},
+			status:    "Success", severity: models.SeverityHigh, ids: []string{"CVE-2000-0001"},
+		},
+		{
+			name:     "ignores unknown formats",
+			overview: map[string]interface{}{"application/vnd.other": overview("Success", "High")},
+			status:   "Not Scanned",
+		},
+		{
+			name:     "scan still running",
+			overview: map[string]interface{}{mime11: overview("Running", "")},
+			status:   "Running", severity: models.SeverityUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, client := newFakeHarbor(t)
+			artifact := "/projects/team/repositories/app%252Fapi/artifacts/v1"
+			h.handlers[artifact] = func(w http.ResponseWriter, r *http.Request) {
+				if !strings.Contains(r.Header.Get("X-Accept-Vulnerabilities"), mime11) {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"digest": "sha256:abc", "scan_overview": tt.overview})
+			}
+			h.handlers[artifact+"/additions/vulnerabilities"] = func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(tt.additions)
+			}
+
+			report, vulnerabilities, err := GetHarborScanReport(client, "team/app/api", "v1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Digest != "sha256:abc" || report.Status != tt.status || report.Severity != tt.severity {
+				t.Errorf("report = %+v, want status %q severity %q", report, tt.status, tt.severity)
+			}
+			var ids []string
+			for _, v := range vulnerabilities {
+				ids = append(ids, v.AdvisoryID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.ids, ",") {
+				t.Errorf("vulnerabilities = %v, want %v", ids, tt.ids)
+			}
+			if len(h.requestsTo(artifact)) != 1 {
+				t.Errorf("requests = %v, want the repository path escaped twice", h.requests)
+			}
+		})
+	}
+}
+
+func TestEnrichHarborRepositories(t *testing.T) {
+	h, client := newFakeHarbor(t)
+	repos := make([]interface{}, 150)
+	for i := range repos {
+		repos[i] = map[string]interface{}{"name": fmt.Sprintf("team/app%03d", i), "pull_count": i, "description": "app", "update_time": "2026-01-02T03:04:05Z"}
+	}
+	h.handlers["/projects/team/repositories"] = pagedHandler(repos, true)
+	h.handlers["/projects/library/repositories"] = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}
+
+	infos := []models.RepositoryInfo{{Name: "team/app001"}, {Name: "team/app120"}, {Name: "team/missing"}, {Name: "library/nginx"}, {Name: "standalone"}}
+	EnrichHarborRepositories(client, infos)
+
+	if p := infos[0].PullCount; p == nil || *p != 1 || infos[0].Description != "app" || infos[0].LastPushed == nil {
+		t.Errorf("team/app001 = %+v", infos[0])
+	}
+	if p := infos[1].PullCount; p == nil || *p != 120 {
+		t.Errorf("team/app120 = %+v, want it found on the second page", infos[1])
+	}
+	for _, info := range infos[2:] {
+		if info.PullCount != nil {
+			t.Errorf("%s = %+v, want no metadata", info.Name, info)
+		}
+	}
+	if n := len(h.requestsTo("/projects/team/repositories")); n != 2 {
+		t.Errorf("team repository list requests = %d, want 2 pages", n)
+	}
+	for _, uri := range h.requests {
+		if path, _, _ := strings.Cut(uri, "?"); strings.Contains(path, "/repositories/") {
+			t.Errorf("unexpected per-repository request %s", uri)
+		}
+	}
+}
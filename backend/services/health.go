@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+const (
+	defaultHealthInterval  = time.Minute
+	defaultHealthRetention = 30 * 24 * time.Hour
+	defaultCertWarnDays    = 14
+	healthProbeTimeout     = 10 * time.Second
+	healthFailureThreshold = 2 // 连续失败次数达到后才认为 Registry 不可用，避免偶发超时误报
+)
+
+// registryHealthState 监控过程中各 Registry 的状态
+type registryHealthState struct {
+	down         bool
+	failures     int
+	certWarnedAt time.Time
+}
+
+var healthStates = struct {
+	sync.Mutex
+	m map[uint]*registryHealthState
+}{m: map[uint]*registryHealthState{}}
+
+// StartHealthMonitor 按 HEALTH_CHECK_INTERVAL（默认 1m，0 表示关闭）定期探测所有 Registry 的 /v2/，
+// 记录状态、延迟和证书过期时间，Registry 不可用、恢复或证书即将过期时发出事件
+func StartHealthMonitor() {
+	interval := defaultHealthInterval
+	if v := os.Getenv("HEALTH_CHECK_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Printf("Invalid HEALTH_CHECK_INTERVAL %q: %v", v, err)
+		} else {
+			interval = d
+		}
+	}
+	if interval <= 0 {
+		return
+	}
+
+	retention := defaultHealthRetention
+	if v := os.Getenv("HEALTH_HISTORY_RETENTION"); v != "" {
+		if d, err := ParseAge(v); err == nil {
+			retention = d
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		lastPrune := time.Time{}
+		for {
+			CheckAllRegistries()
+			if time.Since(lastPrune) > time.Hour {
+				lastPrune = time.Now()
+				config.DB.Where("checked_at < ?", time.Now().Add(-retention)).Delete(&models.RegistryHealthCheck{})
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// CheckAllRegistries 并发探测所有 Registry 并保存结果
+func CheckAllRegistries() {
+	var registries []models.Registry
+	if err := config.DB.Find(&registries).Error; err != nil {
+		log.Printf("Failed to load registries for health check: %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := range registries {
+		wg.Add(1)
+		go func(registry *models.Registry) {
+			defer wg.Done()
+			check := ProbeRegistry(registry)
+			if err := config.DB.Create(check).Error; err != nil {
+				log.Printf("Failed to save health check for %s: %v", registry.Name, err)
+			}
+			updateHealthState(registry, check)
+		}(&registries[i])
+	}
+	wg.Wait()
+}
+
+// ProbeRegistry 不带认证直接请求一次 /v2/，200 或 401 视为可用。
+// 不获取 token，避免认证服务的延迟和故障影响探测结果
+func ProbeRegistry(registry *models.Registry) *models.RegistryHealthCheck {
+	ctx, cancel := context.WithTimeout(context.Background(), healthProbeTimeout)
+	defer cancel()
+	client := NewRegistryClient(registry)
+
+	check := &models.RegistryHealthCheck{RegistryID: registry.ID, CheckedAt: time.Now()}
+	req, err := http.NewRequestWithContext(ctx, "GET", client.BaseURL+"/v2/", nil)
+	if err != nil {
+		check.Error = truncateString(err.Error(), 500)
+		return check
+	}
+	start := time.Now()
+	resp, err := client.HTTPClient.Do(req)
+	check.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		check.Error = truncateString(err.Error(), 500)
+		return check
+	}
+	defer resp.Body.Close()
+
+	check.StatusCode = resp.StatusCode
+	check.Up = resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusUnauthorized
+	if !check.Up {
+		check.Error = fmt.Sprintf("unexpected status code: %d", resp.StatusCode)
+	}
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		expires := resp.TLS.PeerCertificates[0].NotAfter
+		check.CertExpiresAt = &expires
+	}
+	return check
+}
+
+// truncateString 截断过长的文本
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// updateHealthState 根据探测结果更新状态，状态变化和证书即将过期时发出事件
+func updateHealthState(registry *models.Registry, check *models.RegistryHealthCheck) {
+	healthStates.Lock()
+	state, ok := healthStates.m[registry.ID]
+	if !ok {
+		state = &registryHealthState{}
+		healthStates.m[registry.ID] = state
+	}
+
+	var events []models.Event
+	if check.Up {
+		if state.down {
+			events = append(events, models.Event{
+				Type:       models.EventRegistryRecovered,
+				RegistryID: registry.ID,
+				Summary:    fmt.Sprintf("Registry %s is reachable again", registry.Name),
+				Data:       map[string]interface{}{"latency_ms": check.LatencyMs},
+			})
+		}
+		state.down = false
+		state.failures = 0
+	} else {
+		state.failures++
+		if !state.down && state.failures >= healthFailureThreshold {
+			state.down = true
+			events = append(events, models.Event{
+				Type:       models.EventRegistryUnreachable,
+				RegistryID: registry.ID,
+				Summary:    fmt.Sprintf("Registry %s is unreachable: %s", registry.Name, check.Error),
+				Data:       map[string]interface{}{"error": check.Error, "status_code": check.StatusCode},
+			})
+		}
+	}
+
+	if check.CertExpiresAt != nil {
+		warnDays := envInt("HEALTH_CERT_WARN_DAYS", defaultCertWarnDays)
+		daysLeft := int(time.Until(*check.CertExpiresAt).Hours() / 24)
+		// 证书即将过期时每天最多提醒一次
+		if daysLeft <= warnDays && time.Since(state.certWarnedAt) > 24*time.Hour {
+			state.certWarnedAt = time.Now()
+			events = append(events, models.Event{
+				Type:       models.EventCertificateExpiring,
+				RegistryID: registry.ID,
+				Summary: fmt.Sprintf("TLS certificate of registry %s expires in %d days (%s)",
+					registry.Name, daysLeft, check.CertExpiresAt.Format("2006-01-02")),
+				Data: map[string]interface{}{"expires_at": check.CertExpiresAt, "days_left": daysLeft},
+			})
+		}
+	}
+	healthStates.Unlock()
+
+	for _, event := range events {
+		Emit(event)
+	}
+}
+
+// GetRegistryHealth 返回各 Registry 最近一次检查结果和 24 小时、7 天的可用率
+func GetRegistryHealth(ids []uint) map[uint]*models.RegistryHealth {
+	result := make(map[uint]*models.RegistryHealth, len(ids))
+	for _, id := range ids {
+		result[id] = &models.RegistryHealth{Status: models.HealthStatusUnknown}
+	}
+	if len(ids) == 0 {
+		return result
+	}
+
+	var latest []models.RegistryHealthCheck
+	config.DB.Where("id IN (?)", config.DB.Model(&models.RegistryHealthCheck{}).
+		Select("MAX(id)").Where("registry_id IN ?", ids).Group("registry_id")).
+		Find(&latest)
+	for _, check := range latest {
+		health := result[check.RegistryID]
+		if health == nil {
+			continue
+		}
+		checkedAt := check.CheckedAt
+		health.Status = models.HealthStatusDown
+		if check.Up {
+			health.Status = models.HealthStatusUp
+		}
+		health.CheckedAt = &checkedAt
+		health.LatencyMs = check.LatencyMs
+		health.StatusCode = check.StatusCode
+		health.Error = check.Error
+		health.CertExpiresAt = check.CertExpiresAt
+		if check.CertExpiresAt != nil {
+			days := int(time.Until(*check.CertExpiresAt).Hours() / 24)
+			health.CertDaysLeft = &days
+		}
+	}
+
+	uptime := func(since time.Duration, set func(*models.RegistryHealth, *float64)) {
+		var rows []struct {
+			RegistryID uint
+			Up         int64
+			Total      int64
+		}
+		config.DB.Model(&models.RegistryHealthCheck{}).
+			Select("registry_id, SUM(CASE WHEN up THEN 1 ELSE 0 END) AS up, COUNT(*) AS total").
+			Where("registry_id IN ? AND checked_at >= ?", ids, time.Now().Add(-since)).
+			Group("registry_id").Scan(&rows)
+		for _, row := range rows {
+			if health := result[row.RegistryID]; health != nil && row.Total > 0 {
+				percent := float64(row.Up) * 100 / float64(row.Total)
+				set(health, &percent)
+			}
+		}
+	}
+	uptime(24*time.Hour, func(h *models.RegistryHealth, v *float64) { h.Uptime24h = v })
+	uptime(7*24*time.Hour, func(h *models.RegistryHealth, v *float64) { h.Uptime7d = v })
+	return result
+}
+
+// GetHealthHistory 返回 Registry 在 since 之后的检查记录，按时间升序
+func GetHealthHistory(registryID uint, since time.Duration) ([]models.RegistryHealthCheck, error) {
+	checks := []models.RegistryHealthCheck{}
+	err := config.DB.Where("registry_id = ? AND checked_at >= ?", registryID, time.Now().Add(-since)).
+		Order("checked_at").Find(&checks).Error
+	return checks, err
+}
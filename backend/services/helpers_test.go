@@ -0,0 +1,313 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// setupTestDB 为测试创建独立的内存数据库并迁移给定的表，测试结束后恢复 config.DB
+func setupTestDB(t *testing.T, tables ...interface{}) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))),
+		&gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	previous := config.DB
+	config.DB = db
+	t.Cleanup(func() {
+		config.DB = previous
+		sqlDB.Close()
+	})
+}
+
+// createSearchIndex 创建与 config.InitDB 相同的全文索引表
+func createSearchIndex(t *testing.T) {
+	t.Helper()
+	err := config.DB.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS catalog_search USING fts5(
+		registry_id UNINDEXED, repository, tag, digest UNINDEXED, os, arch,
+		labels, env, entrypoint, history, created UNINDEXED
+	)`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testJobContext 不属于任何队列的任务上下文
+func testJobContext() *JobContext {
+	return &JobContext{Context: context.Background(), job: &models.Job{ID: 1}}
+}
+
+// testManifest 测试 Registry 中保存的 manifest
+type testManifest struct {
+	body      []byte
+	mediaType string
+}
+
+// testRegistry 内存中的 Distribution API 实现，支持目录、标签、manifest 和 blob 的读取以及 manifest 删除
+type testRegistry struct {
+	mu        sync.Mutex
+	server    *httptest.Server
+	manifests map[string]map[string]testManifest // 仓库 -> digest -> manifest
+	tags      map[string]map[string]string       // 仓库 -> 标签 -> digest
+	blobs     map[string][]byte                  // digest -> 内容，所有仓库共用
+	broken    map[string]bool                    // 请求时返回 500 的 仓库:引用
+	requests  []string
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	r := &testRegistry{
+		manifests: map[string]map[string]testManifest{},
+		tags:      map[string]map[string]string{},
+		blobs:     map[string][]byte{},
+		broken:    map[string]bool{},
+	}
+	r.server = httptest.NewServer(r)
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func testDigest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// addBlob 保存 blob 并返回 digest
+func (r *testRegistry) addBlob(data []byte) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	digest := testDigest(data)
+	r.blobs[digest] = data
+	return digest
+}
+
+// pushImage 推送一个包含配置和镜像层的单平台镜像，tag 为空时不打标签，返回 manifest digest
+func (r *testRegistry) pushImage(repository, tag, platform string, layers ...[]byte) string {
+	os, arch, _ := strings.Cut(platform, "/")
+	config := r.addBlob([]byte(fmt.Sprintf(`{"os":%q,"architecture":%q,"created":"2026-01-02T03:04:05Z","config":{"Labels":{"app":%q}}}`,
+		os, arch, repository)))
+	var manifest models.ImageManifest
+	manifest.SchemaVersion = 2
+	manifest.MediaType = MediaTypeOCIManifest
+	manifest.Config = models.ManifestConfig{MediaType: "application/vnd.oci.image.config.v1+json", Digest: config, Size: int64(len(r.blobs[config]))}
+	for _, layer := range layers {
+		manifest.Layers = append(manifest.Layers, models.ManifestLayer{
+			MediaType: "application/vnd.oci.image.layer.v1.tar+gzip",
+			Digest:    r.addBlob(layer),
+			Size:      int64(len(layer)),
+		})
+	}
+	body, _ := json.Marshal(manifest)
+	return r.putManifest(repository, tag, body, MediaTypeOCIManifest)
+}
+
+// putManifest 保存 manifest，tag 不为空时将标签指向它
+func (r *testRegistry) putManifest(repository, tag string, body []byte, mediaType string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.manifests[repository] == nil {
+		r.manifests[repository] = map[string]testManifest{}
+		r.tags[repository] = map[string]string{}
+	}
+	digest := testDigest(body)
+	r.manifests[repository][digest] = testManifest{body: body, mediaType: mediaType}
+	if tag != "" {
+		r.tags[repository][tag] = digest
+	}
+	return digest
+}
+
+// pushIndex 推送引用各平台 manifest 的 OCI index，children 为 平台 -> manifest digest，返回 index digest
+func (r *testRegistry) pushIndex(repository, tag string, children map[string]string) string {
+	platforms := make([]string, 0, len(children))
+	for platform := range children {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+	index := models.ManifestList{SchemaVersion: 2, MediaType: MediaTypeOCIIndex}
+	r.mu.Lock()
+	for _, platform := range platforms {
+		os, arch, _ := strings.Cut(platform, "/")
+		digest := children[platform]
+		index.Manifests = append(index.Manifests, models.ManifestDescriptor{
+			MediaType: MediaTypeOCIManifest,
+			Digest:    digest,
+			Size:      int64(len(r.manifests[repository][digest].body)),
+			Platform:  models.ManifestPlatform{OS: os, Architecture: arch},
+		})
+	}
+	r.mu.Unlock()
+	body, _ := json.Marshal(index)
+	return r.putManifest(repository, tag, body, MediaTypeOCIIndex)
+}
+
+// removeRepository 删除仓库的全部标签和 manifest，仓库不再出现在目录中
+func (r *testRegistry) removeRepository(repository string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tags, repository)
+	delete(r.manifests, repository)
+}
+
+// setTag 将标签指向已有的 manifest
+func (r *testRegistry) setTag(repository, tag, digest string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tags[repository][tag] = digest
+}
+
+// removeTag 删除标签，manifest 保留
+func (r *testRegistry) removeTag(repository, tag string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tags[repository], tag)
+}
+
+// breakReference 使仓库中某个引用的 manifest 请求返回 500
+func (r *testRegistry) breakReference(repository, reference string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.broken[repository+":"+reference] = true
+}
+
+// count 返回匹配 method 和路径前缀的请求数
+func (r *testRegistry) count(method, pathPrefix string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, req := range r.requests {
+		if strings.HasPrefix(req, method+" "+pathPrefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// total 返回收到的请求总数
+func (r *testRegistry) total() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case req.URL.Path == "/v2/":
+		w.WriteHeader(http.StatusOK)
+		return
+	case path == "_catalog":
+		repos := make([]string, 0, len(r.tags))
+		for repo := range r.tags {
+			repos = append(repos, repo)
+		}
+		sort.Strings(repos)
+		json.NewEncoder(w).Encode(map[string][]string{"repositories": repos})
+		return
+	case strings.HasSuffix(path, "/tags/list"):
+		repo := strings.TrimSuffix(path, "/tags/list")
+		if r.tags[repo] == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		tags := []string{}
+		for tag := range r.tags[repo] {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		json.NewEncoder(w).Encode(models.RegistryTags{Name: repo, Tags: tags})
+		return
+	}
+
+	if i := strings.Index(path, "/blobs/"); i > 0 {
+		data, ok := r.blobs[path[i+len("/blobs/"):]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		if req.Method != http.MethodHead {
+			w.Write(data)
+		}
+		return
+	}
+
+	i := strings.Index(path, "/manifests/")
+	if i < 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	repo, reference := path[:i], path[i+len("/manifests/"):]
+	if r.broken[repo+":"+reference] {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	digest := reference
+	if !strings.HasPrefix(reference, "sha256:") {
+		digest = r.tags[repo][reference]
+	}
+	manifest, ok := r.manifests[repo][digest]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch req.Method {
+	case http.MethodDelete:
+		delete(r.manifests[repo], digest)
+		for tag, d := range r.tags[repo] {
+			if d == digest {
+				delete(r.tags[repo], tag)
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodGet, http.MethodHead:
+		w.Header().Set("Content-Type", manifest.mediaType)
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.Header().Set("Content-Length", fmt.Sprint(len(manifest.body)))
+		if req.Method == http.MethodGet {
+			io.Copy(w, strings.NewReader(string(manifest.body)))
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// newTestClient 在数据库中登记测试 Registry 并返回其客户端
+func newTestClient(t *testing.T, r *testRegistry) (*RegistryClient, *models.Registry) {
+	t.Helper()
+	registry := &models.Registry{Name: "test", URL: r.server.URL}
+	if err := config.DB.Create(registry).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库的 ID 会重复，清除前一个测试留下的缓存
+	InvalidateRegistry(registry.ID)
+	t.Cleanup(func() { InvalidateRegistry(registry.ID) })
+	return NewRegistryClient(registry), registry
+}
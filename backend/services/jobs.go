@@ -0,0 +1,363 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// ErrJobCancelled 任务已被取消
+var ErrJobCancelled = errors.New("job cancelled")
+
+// ErrJobFinished 任务已经结束，无法取消
+var ErrJobFinished = errors.New("job has already finished")
+
+// JobHandler 执行某一类任务，params 为入队时保存的参数，返回值作为任务结果保存。
+// 服务重启后未完成的任务会重新执行，处理函数应当可以安全地重复执行
+type JobHandler func(ctx *JobContext, params json.RawMessage) (interface{}, error)
+
+var jobHandlers = map[string]JobHandler{}
+
+// RegisterJobHandler 注册任务类型的处理函数，在 init 中调用
+func RegisterJobHandler(jobType string, handler JobHandler) {
+	jobHandlers[jobType] = handler
+}
+
+// jobProgressInterval 进度写入数据库的最小间隔
+const jobProgressInterval = time.Second
+
+// JobContext 任务执行期间的上下文，用于上报进度、写日志和检查取消
+type JobContext struct {
+	context.Context
+	job *models.Job
+
+	mu       sync.Mutex
+	lastSave time.Time
+}
+
+// JobID 返回任务 ID
+func (ctx *JobContext) JobID() uint {
+	return ctx.job.ID
+}
+
+// SetProgress 更新任务进度，message 为空时保留当前步骤；写入数据库时按间隔节流
+func (ctx *JobContext) SetProgress(done, total int64, message string) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	changed := message != "" && message != ctx.job.Message
+	ctx.job.Done = done
+	ctx.job.Total = total
+	if message != "" {
+		ctx.job.Message = message
+	}
+	if total > 0 {
+		ctx.job.Progress = int(done * 100 / total)
+	}
+	if !changed && time.Since(ctx.lastSave) < jobProgressInterval {
+		return
+	}
+	ctx.lastSave = time.Now()
+	config.DB.Model(&models.Job{}).Where("id = ?", ctx.job.ID).Updates(map[string]interface{}{
+		"done":     ctx.job.Done,
+		"total":    ctx.job.Total,
+		"progress": ctx.job.Progress,
+		"message":  ctx.job.Message,
+	})
+}
+
+// Logf 写入任务日志
+func (ctx *JobContext) Logf(level, format string, args ...interface{}) {
+	config.DB.Create(&models.JobLog{
+		JobID:   ctx.job.ID,
+		Level:   level,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Check 任务被取消时返回 ErrJobCancelled
+func (ctx *JobContext) Check() error {
+	if ctx.Err() != nil {
+		return ErrJobCancelled
+	}
+	return nil
+}
+
+// jobQueue 任务调度：限制总并发和每个 Registry 的并发
+type jobQueue struct {
+	sync.Mutex
+	running       map[uint]context.CancelFunc
+	perRegistry   map[uint]int
+	workers       int
+	registryLimit int
+	wake          chan struct{}
+}
+
+var queue = &jobQueue{
+	running:     map[uint]context.CancelFunc{},
+	perRegistry: map[uint]int{},
+	wake:        make(chan struct{}, 1),
+}
+
+// envInt 读取正整数环境变量
+func envInt(name string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
+
+// StartJobWorkers 启动任务调度，将上次运行中断的任务重新放回队列。
+// 并发数由 JOB_WORKERS（默认 4）和 JOB_REGISTRY_CONCURRENCY（每个 Registry，默认 2）控制
+func StartJobWorkers() {
+	queue.workers = envInt("JOB_WORKERS", 4)
+	queue.registryLimit = envInt("JOB_REGISTRY_CONCURRENCY", 2)
+
+	var interrupted []models.Job
+	config.DB.Where("status = ?", models.JobStatusRunning).Find(&interrupted)
+	for _, job := range interrupted {
+		status := models.JobStatusPending
+		if job.CancelRequested {
+			status = models.JobStatusCancelled
+		}
+		config.DB.Model(&job).Updates(map[string]interface{}{"status": status})
+		config.DB.Create(&models.JobLog{JobID: job.ID, Level: "warn", Message: "Interrupted by server restart, " + status})
+	}
+	if len(interrupted) > 0 {
+		log.Printf("Requeued %d interrupted jobs", len(interrupted))
+	}
+
+	go queue.loop()
+}
+
+// loop 有新任务或任务结束时调度，另外定期检查以防遗漏
+func (q *jobQueue) loop() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		q.schedule()
+		select {
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// notify 唤醒调度
+func (q *jobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// schedule 按入队顺序启动可以运行的任务
+func (q *jobQueue) schedule() {
+	q.Lock()
+	defer q.Unlock()
+
+	if len(q.running) >= q.workers {
+		return
+	}
+	var pending []models.Job
+	if err := config.DB.Where("status = ?", models.JobStatusPending).Order("id").Limit(100).Find(&pending).Error; err != nil {
+		log.Printf("Failed to load pending jobs: %v", err)
+		return
+	}
+
+	for i := range pending {
+		if len(q.running) >= q.workers {
+			return
+		}
+		job := &pending[i]
+		if job.RegistryID != 0 && q.perRegistry[job.RegistryID] >= q.registryLimit {
+			continue
+		}
+
+		now := time.Now()
+		claim := config.DB.Model(&models.Job{}).Where("id = ? AND status = ?", job.ID, models.JobStatusPending).
+			Updates(map[string]interface{}{
+				"status":      models.JobStatusRunning,
+				"started_at":  now,
+				"finished_at": nil,
+				"attempts":    gorm.Expr("attempts + 1"),
+			})
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			continue
+		}
+		job.Status = models.JobStatusRunning
+		job.StartedAt = &now
+
+		ctx, cancel := context.WithCancel(context.Background())
+		q.running[job.ID] = cancel
+		q.perRegistry[job.RegistryID]++
+		go q.run(ctx, job)
+	}
+}
+
+// run 执行任务并保存结果
+func (q *jobQueue) run(ctx context.Context, job *models.Job) {
+	jobCtx := &JobContext{Context: ctx, job: job}
+
+	result, err := func() (result interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		handler, ok := jobHandlers[job.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown job type %q", job.Type)
+		}
+		return handler(jobCtx, job.Params)
+	}()
+
+	q.Lock()
+	cancelled := ctx.Err() != nil
+	q.running[job.ID]()
+	delete(q.running, job.ID)
+	q.perRegistry[job.RegistryID]--
+	q.Unlock()
+
+	jobCtx.mu.Lock()
+	updates := map[string]interface{}{
+		"done":        job.Done,
+		"total":       job.Total,
+		"progress":    job.Progress,
+		"message":     job.Message,
+		"finished_at": time.Now(),
+		"error":       "",
+	}
+	jobCtx.mu.Unlock()
+
+	if result != nil {
+		if data, err := json.Marshal(result); err == nil && string(data) != "null" {
+			updates["result"] = json.RawMessage(data)
+		}
+	}
+	switch {
+	case cancelled:
+		updates["status"] = models.JobStatusCancelled
+		jobCtx.Logf("warn", "Job cancelled")
+	case err != nil:
+		updates["status"] = models.JobStatusFailed
+		updates["error"] = err.Error()
+		jobCtx.Logf("error", "%v", err)
+	default:
+		updates["status"] = models.JobStatusSucceeded
+		updates["progress"] = 100
+	}
+	if err := config.DB.Model(&models.Job{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to save job %d: %v", job.ID, err)
+	}
+
+	q.notify()
+}
+
+// EnqueueJob 创建任务并放入队列，registryID 为任务访问的 Registry（没有时为 0）
+func EnqueueJob(jobType string, registryID uint, params interface{}) (*models.Job, error) {
+	if _, ok := jobHandlers[jobType]; !ok {
+		return nil, fmt.Errorf("unknown job type %q", jobType)
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.Job{
+		Type:       jobType,
+		Status:     models.JobStatusPending,
+		RegistryID: registryID,
+		Params:     data,
+	}
+	if err := config.DB.Create(job).Error; err != nil {
+		return nil, err
+	}
+
+	queue.notify()
+	return job, nil
+}
+
+// CancelJob 取消任务：排队中的任务直接标记为已取消，运行中的任务通知处理函数停止
+func CancelJob(id uint) (*models.Job, error) {
+	job, err := GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch job.Status {
+	case models.JobStatusPending:
+		now := time.Now()
+		res := config.DB.Model(&models.Job{}).Where("id = ? AND status = ?", id, models.JobStatusPending).
+			Updates(map[string]interface{}{"status": models.JobStatusCancelled, "cancel_requested": true, "finished_at": now})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			// 已被调度，按运行中的任务处理
+			return CancelJob(id)
+		}
+		config.DB.Create(&models.JobLog{JobID: id, Level: "warn", Message: "Job cancelled"})
+	case models.JobStatusRunning:
+		if err := config.DB.Model(&models.Job{}).Where("id = ?", id).Update("cancel_requested", true).Error; err != nil {
+			return nil, err
+		}
+		queue.Lock()
+		if cancel, ok := queue.running[id]; ok {
+			cancel()
+		}
+		queue.Unlock()
+	default:
+		return nil, ErrJobFinished
+	}
+
+	return GetJob(id)
+}
+
+// GetJob 获取任务
+func GetJob(id uint) (*models.Job, error) {
+	var job models.Job
+	if err := config.DB.First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListJobs 按创建时间倒序分页列出任务，jobType 和 status 不为空时按其过滤
+func ListJobs(jobType, status string, page, pageSize int) ([]models.Job, int64, error) {
+	query := config.DB.Model(&models.Job{})
+	if jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var jobs []models.Job
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&jobs).Error; err != nil {
+		return nil, 0, err
+	}
+	return jobs, total, nil
+}
+
+// GetJobLogs 获取任务日志，afterID 大于 0 时只返回之后的日志，便于轮询
+func GetJobLogs(jobID, afterID uint) ([]models.JobLog, error) {
+	var logs []models.JobLog
+	err := config.DB.Where("job_id = ? AND id > ?", jobID, afterID).Order("id").Limit(1000).Find(&logs).Error
+	return logs, err
+}
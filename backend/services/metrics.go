@@ -0,0 +1,299 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// 依赖中没有 Prometheus 客户端库，这里实现 /metrics 所需的计数器和直方图，按文本格式输出
+
+// defaultBuckets 请求耗时直方图的分桶（秒）
+var defaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metricSeries 一组标签值对应的数据
+type metricSeries struct {
+	labels  []string
+	value   float64  // 计数器的值
+	buckets []uint64 // 直方图各分桶的计数（非累计）
+	sum     float64  // 直方图的总和
+	count   uint64   // 直方图的样本数
+}
+
+// metricVec 带标签的计数器或直方图
+type metricVec struct {
+	sync.Mutex
+	name    string
+	help    string
+	kind    string // counter / histogram
+	labels  []string
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+func newCounterVec(name, help string, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "counter", labels: labels, series: map[string]*metricSeries{}}
+}
+
+func newHistogramVec(name, help string, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "histogram", labels: labels, buckets: defaultBuckets, series: map[string]*metricSeries{}}
+}
+
+// get 返回标签值对应的数据，调用方需持有锁
+func (m *metricVec) get(values []string) *metricSeries {
+	key := strings.Join(values, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &metricSeries{labels: append([]string(nil), values...)}
+		if m.kind == "histogram" {
+			s.buckets = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Inc 计数器加一
+func (m *metricVec) Inc(values ...string) {
+	m.Lock()
+	m.get(values).value++
+	m.Unlock()
+}
+
+// Observe 记录一个直方图样本
+func (m *metricVec) Observe(v float64, values ...string) {
+	m.Lock()
+	s := m.get(values)
+	for i, le := range m.buckets {
+		if v <= le {
+			s.buckets[i]++
+			break
+		}
+	}
+	s.sum += v
+	s.count++
+	m.Unlock()
+}
+
+// write 按 Prometheus 文本格式输出
+func (m *metricVec) write(w io.Writer) {
+	m.Lock()
+	defer m.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := m.series[key]
+		labels := formatLabels(m.labels, s.labels)
+		if m.kind == "counter" {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, labels, formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, le := range m.buckets {
+			cumulative += s.buckets[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name,
+				formatLabels(append(m.labels, "le"), append(s.labels, formatFloat(le))), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, formatLabels(append(m.labels, "le"), append(s.labels, "+Inf")), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, labels, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, labels, s.count)
+	}
+}
+
+// formatLabels 输出 {name="value",...}，没有标签时为空
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	parts := make([]string, len(names))
+	for i, name := range names {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(values[i])
+		parts[i] = fmt.Sprintf(`%s="%s"`, name, value)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writeValues 输出在采集时计算的指标
+func writeValues(w io.Writer, name, help, kind string, labels []string, rows [][]string, values []float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	for i, row := range rows {
+		fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(labels, row), formatFloat(values[i]))
+	}
+}
+
+var (
+	httpRequests        = newCounterVec("dgui_http_requests_total", "HTTP requests handled by dgui.", "method", "route", "status")
+	httpRequestDuration = newHistogramVec("dgui_http_request_duration_seconds", "HTTP request latency.", "method", "route")
+
+	registryRequests        = newCounterVec("dgui_registry_requests_total", "Requests sent to registries.", "registry", "operation", "code")
+	registryRequestErrors   = newCounterVec("dgui_registry_request_errors_total", "Registry requests that failed with a transport error or a 5xx response.", "registry", "operation")
+	registryRequestDuration = newHistogramVec("dgui_registry_request_duration_seconds", "Registry request latency.", "registry", "operation")
+)
+
+// ObserveHTTPRequest 记录 dgui 处理的 HTTP 请求
+func ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	httpRequests.Inc(method, route, strconv.Itoa(status))
+	httpRequestDuration.Observe(duration.Seconds(), method, route)
+}
+
+// registryOperation 根据请求路径归类 Registry 操作
+func registryOperation(method, rawURL string) string {
+	path := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		path = u.Path
+	}
+	switch {
+	case strings.Contains(path, harborAPIPrefix+"/"):
+		return "harbor"
+	case strings.HasSuffix(path, "/_catalog"):
+		return "catalog"
+	case strings.HasSuffix(path, "/tags/list"):
+		return "tags"
+	case strings.Contains(path, "/manifests/"):
+		if method == "DELETE" {
+			return "delete"
+		}
+		return "manifest"
+	case strings.Contains(path, "/blobs/uploads"):
+		return "upload"
+	case strings.Contains(path, "/blobs/"):
+		return "blob"
+	case strings.Contains(path, "/referrers/"):
+		return "referrers"
+	case strings.HasSuffix(path, "/v2/"):
+		return "ping"
+	}
+	return "other"
+}
+
+// observeRegistryRequest 记录发往 Registry 的请求，statusCode 为 0 表示请求未完成
+func observeRegistryRequest(registry, method, rawURL string, statusCode int, duration time.Duration) {
+	operation := registryOperation(method, rawURL)
+	code := "error"
+	if statusCode > 0 {
+		code = strconv.Itoa(statusCode)
+	}
+	registryRequests.Inc(registry, operation, code)
+	registryRequestDuration.Observe(duration.Seconds(), registry, operation)
+	if statusCode == 0 || statusCode >= 500 {
+		registryRequestErrors.Inc(registry, operation)
+	}
+}
+
+// WriteMetrics 输出所有指标
+func WriteMetrics(w io.Writer) {
+	httpRequests.write(w)
+	httpRequestDuration.write(w)
+	registryRequests.write(w)
+	registryRequestErrors.write(w)
+	registryRequestDuration.write(w)
+
+	hits, misses := CacheStats()
+	writeValues(w, "dgui_cache_requests_total", "Registry catalog and tag list cache lookups.", "counter",
+		[]string{"result"}, [][]string{{"hit"}, {"miss"}}, []float64{float64(hits), float64(misses)})
+	ratio := 0.0
+	if hits+misses > 0 {
+		ratio = float64(hits) / float64(hits+misses)
+	}
+	writeValues(w, "dgui_cache_hit_ratio", "Ratio of cache lookups served from the cache.", "gauge", nil, [][]string{nil}, []float64{ratio})
+
+	// 任务队列深度
+	var jobRows []struct {
+		Type   string
+		Status string
+		Count  int64
+	}
+	config.DB.Model(&models.Job{}).Select("type, status, COUNT(*) AS count").
+		Where("status IN ?", []string{models.JobStatusPending, models.JobStatusRunning}).
+		Group("type, status").Scan(&jobRows)
+	rows := [][]string{}
+	values := []float64{}
+	for _, row := range jobRows {
+		rows = append(rows, []string{row.Type, row.Status})
+		values = append(values, float64(row.Count))
+	}
+	writeValues(w, "dgui_jobs", "Background jobs that are pending or running.", "gauge", []string{"type", "status"}, rows, values)
+
+	var pendingDeliveries int64
+	config.DB.Model(&models.WebhookDelivery{}).Where("status = ?", models.DeliveryStatusPending).Count(&pendingDeliveries)
+	writeValues(w, "dgui_webhook_deliveries_pending", "Outbound webhook deliveries waiting to be sent or retried.", "gauge",
+		nil, [][]string{nil}, []float64{float64(pendingDeliveries)})
+
+	// Registry 级别的指标
+	var registries []models.Registry
+	config.DB.Find(&registries)
+	ids := make([]uint, 0, len(registries))
+	for _, registry := range registries {
+		ids = append(ids, registry.ID)
+	}
+	health := GetRegistryHealth(ids)
+
+	// 仓库和标签数量来自最近一次成功的爬取
+	var crawls []models.CrawlStatus
+	config.DB.Where("registry_id IN ? AND last_success_at IS NOT NULL", ids).Find(&crawls)
+	crawled := make(map[uint]*models.CrawlStatus, len(crawls))
+	for i := range crawls {
+		crawled[crawls[i].RegistryID] = &crawls[i]
+	}
+	var catalogRows []struct {
+		RegistryID   uint
+		Repositories int64
+		Tags         int64
+	}
+	config.DB.Model(&models.CatalogRepository{}).Select("registry_id, COUNT(*) AS repositories, SUM(tag_count) AS tags").
+		Where("registry_id IN ?", ids).Group("registry_id").Scan(&catalogRows)
+	repositoryCounts := make(map[uint]int64, len(catalogRows))
+	tagCounts := make(map[uint]int64, len(catalogRows))
+	for _, row := range catalogRows {
+		repositoryCounts[row.RegistryID], tagCounts[row.RegistryID] = row.Repositories, row.Tags
+	}
+
+	var upRows, certRows, repoRows [][]string
+	var upValues, latencyValues, certValues, repoValues, tagValues, crawlValues []float64
+	for _, registry := range registries {
+		label := []string{registry.Name}
+		if h := health[registry.ID]; h != nil && h.Status != models.HealthStatusUnknown {
+			up := 0.0
+			if h.Status == models.HealthStatusUp {
+				up = 1
+			}
+			upRows = append(upRows, label)
+			upValues = append(upValues, up)
+			latencyValues = append(latencyValues, float64(h.LatencyMs)/1000)
+			if h.CertExpiresAt != nil {
+				certRows = append(certRows, label)
+				certValues = append(certValues, float64(h.CertExpiresAt.Unix()))
+			}
+		}
+		if crawl := crawled[registry.ID]; crawl != nil {
+			repoRows = append(repoRows, label)
+			repoValues = append(repoValues, float64(repositoryCounts[registry.ID]))
+			tagValues = append(tagValues, float64(tagCounts[registry.ID]))
+			crawlValues = append(crawlValues, float64(crawl.LastSuccessAt.Unix()))
+		}
+	}
+
+	writeValues(w, "dgui_registry_up", "Whether the last health check succeeded.", "gauge", []string{"registry"}, upRows, upValues)
+	writeValues(w, "dgui_registry_probe_latency_seconds", "Latency of the last health check.", "gauge", []string{"registry"}, upRows, latencyValues)
+	writeValues(w, "dgui_registry_cert_expiry_timestamp_seconds", "Expiry time of the registry TLS certificate.", "gauge", []string{"registry"}, certRows, certValues)
+	writeValues(w, "dgui_registry_repositories", "Repositories found by the catalog crawler.", "gauge", []string{"registry"}, repoRows, repoValues)
+	writeValues(w, "dgui_registry_tags", "Tags found by the catalog crawler.", "gauge", []string{"registry"}, repoRows, tagValues)
+	writeValues(w, "dgui_registry_last_crawl_timestamp_seconds", "Time of the last successful catalog crawl.", "gauge", []string{"registry"}, repoRows, crawlValues)
+}
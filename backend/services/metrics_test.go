@@ -0,0 +1,45 @@
+package services
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+func TestWriteMetricsCatalogGauges(t *testing.T) {
+	setupTestDB(t, &models.Registry{}, &models.Job{}, &models.WebhookDelivery{}, &models.RegistryHealthCheck{},
+		&models.CrawlStatus{}, &models.CatalogRepository{})
+
+	crawled := &models.Registry{Name: "crawled", URL: "http://crawled"}
+	pending := &models.Registry{Name: "pending", URL: "http://pending"}
+	config.DB.Create(crawled)
+	config.DB.Create(pending)
+	lastSuccess := time.Unix(1700000000, 0)
+	config.DB.Create(&models.CrawlStatus{RegistryID: crawled.ID, LastSuccessAt: &lastSuccess})
+	// 尚未成功爬取的 Registry 不输出数量，避免报告为 0
+	config.DB.Create(&models.CrawlStatus{RegistryID: pending.ID, Running: true})
+	config.DB.Create(&[]models.CatalogRepository{
+		{RegistryID: crawled.ID, Name: "app", TagCount: 3},
+		{RegistryID: crawled.ID, Name: "team/web", TagCount: 2},
+	})
+
+	var buf bytes.Buffer
+	WriteMetrics(&buf)
+	out := buf.String()
+	for _, line := range []string{
+		`dgui_registry_repositories{registry="crawled"} 2`,
+		`dgui_registry_tags{registry="crawled"} 5`,
+		`dgui_registry_last_crawl_timestamp_seconds{registry="crawled"} 1.7e+09`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, out)
+		}
+	}
+	if strings.Contains(out, `registry="pending"`) {
+		t.Errorf("metrics reported a registry that was never crawled:\n%s", out)
+	}
+}
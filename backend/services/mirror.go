@@ -0,0 +1,291 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"dgui/models"
+)
+
+// ErrMirrorReadOnly 镜像站不接受推送、删除等写操作
+var ErrMirrorReadOnly = errors.New("registry is a pull-through cache mirror and does not accept pushes or deletes")
+
+// ErrNotMirror Registry 不是镜像站
+var ErrNotMirror = errors.New("registry is not a pull-through cache mirror")
+
+// PrefetchParams 预热任务的参数
+type PrefetchParams struct {
+	RegistryID uint                   `json:"registry_id"`
+	Request    models.PrefetchRequest `json:"request"`
+}
+
+func init() {
+	RegisterJobHandler(models.JobTypePrefetch, runPrefetchJob)
+}
+
+// CheckWritable 镜像站返回 ErrMirrorReadOnly
+func CheckWritable(registry *models.Registry) error {
+	if registry.Mirror {
+		return fmt.Errorf("%w: %s mirrors %s", ErrMirrorReadOnly, registry.Name, registry.Upstream)
+	}
+	return nil
+}
+
+// mirrorsDockerHub 是否为 Docker Hub 的镜像站
+func (c *RegistryClient) mirrorsDockerHub() bool {
+	if !c.Mirror {
+		return false
+	}
+	u, err := url.Parse(c.Upstream)
+	if err != nil {
+		return false
+	}
+	switch u.Hostname() {
+	case "", "registry-1.docker.io", "index.docker.io", "docker.io":
+		return true
+	}
+	return false
+}
+
+// dockerHubHosts 镜像引用中可以省略的 Docker Hub 地址
+var dockerHubHosts = []string{"docker.io/", "index.docker.io/", "registry-1.docker.io/"}
+
+// ParseImageReference 解析 nginx:1.25、bitnami/redis@sha256:... 形式的镜像引用，省略标签时为 latest，
+// 去掉 Docker Hub 的地址前缀
+func ParseImageReference(image string) (repository, reference string, err error) {
+	s := strings.TrimSpace(image)
+	for _, host := range dockerHubHosts {
+		s = strings.TrimPrefix(s, host)
+	}
+	if name, digest, ok := strings.Cut(s, "@"); ok {
+		repository, reference = name, digest
+		// 同时带标签和 digest 时以 digest 为准
+		if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+			repository = repository[:i]
+		}
+	} else if i := strings.LastIndex(s, ":"); i > strings.LastIndex(s, "/") {
+		repository, reference = s[:i], s[i+1:]
+	} else {
+		repository, reference = s, "latest"
+	}
+	if repository == "" || reference == "" || strings.ContainsAny(repository, " \t") {
+		return "", "", fmt.Errorf("invalid image reference %q", image)
+	}
+	return repository, reference, nil
+}
+
+// ValidatePrefetchRequest 检查镜像引用和平台格式
+func ValidatePrefetchRequest(req *models.PrefetchRequest) error {
+	if len(req.Images) == 0 {
+		return errors.New("images is required")
+	}
+	for _, image := range req.Images {
+		if _, _, err := ParseImageReference(image); err != nil {
+			return err
+		}
+	}
+	for _, platform := range req.Platforms {
+		if parts := strings.Split(platform, "/"); len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid platform %q, expected os/arch[/variant]", platform)
+		}
+	}
+	return nil
+}
+
+// prefetchBlob 待预热的 blob
+type prefetchBlob struct {
+	image      int // 首个引用该 blob 的镜像在结果中的位置
+	repository string
+	models.ManifestLayer
+}
+
+// prefetcher 通过镜像站请求 manifest 和 blob，使镜像站从上游拉取并缓存
+type prefetcher struct {
+	ctx       *JobContext
+	client    *RegistryClient
+	platforms map[string]bool
+
+	blobs     []prefetchBlob
+	seenBlobs map[string]bool
+	result    models.PrefetchResult
+}
+
+// runPrefetchJob 执行预热任务：先请求所有镜像的 manifest（这会让镜像站缓存 manifest），
+// 再逐个读取去重后的 blob。单个镜像失败不影响其他镜像
+func runPrefetchJob(ctx *JobContext, params json.RawMessage) (interface{}, error) {
+	var p PrefetchParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	client, registry, err := GetRegistryClient(p.RegistryID)
+	if err != nil {
+		return nil, err
+	}
+	if !registry.Mirror {
+		return nil, ErrNotMirror
+	}
+
+	f := &prefetcher{
+		ctx:       ctx,
+		client:    client.WithoutTimeout().WithContext(ctx),
+		platforms: map[string]bool{},
+		seenBlobs: map[string]bool{},
+		result:    models.PrefetchResult{Images: []models.PrefetchImage{}},
+	}
+	for _, platform := range p.Request.Platforms {
+		f.platforms[platform] = true
+	}
+
+	for i, image := range p.Request.Images {
+		if err := ctx.Check(); err != nil {
+			return &f.result, err
+		}
+		ctx.SetProgress(0, 0, fmt.Sprintf("Fetching manifests %d/%d %s", i+1, len(p.Request.Images), image))
+		item := f.fetchImage(image)
+		if item.Error != "" {
+			f.result.Failed++
+			ctx.Logf("warn", "Failed to prefetch %s: %s", image, item.Error)
+		}
+		f.result.Manifests += item.Manifests
+		f.result.Images = append(f.result.Images, item)
+	}
+
+	var total int64
+	for _, blob := range f.blobs {
+		total += blob.Size
+	}
+	f.result.Blobs = len(f.blobs)
+
+	var done int64
+	for i, blob := range f.blobs {
+		if err := ctx.Check(); err != nil {
+			return &f.result, err
+		}
+		message := fmt.Sprintf("Fetching blob %d/%d %s", i+1, len(f.blobs), shortDigest(blob.Digest))
+		ctx.SetProgress(done, total, message)
+		n, err := f.fetchBlob(blob, done, total)
+		f.result.Bytes += n
+		if err != nil {
+			if ctx.Check() != nil {
+				return &f.result, ErrJobCancelled
+			}
+			ctx.Logf("warn", "Failed to fetch blob %s from %s: %v", blob.Digest, blob.repository, err)
+			if item := &f.result.Images[blob.image]; item.Error == "" {
+				item.Error = fmt.Sprintf("blob %s: %v", shortDigest(blob.Digest), err)
+				f.result.Failed++
+			}
+		}
+		done += blob.Size
+		ctx.SetProgress(done, total, message)
+	}
+	InvalidateRegistry(registry.ID)
+
+	ctx.Logf("info", "Prefetched %d images (%d failed): %d manifests, %d blobs, %d bytes through %s",
+		len(f.result.Images)-f.result.Failed, f.result.Failed, f.result.Manifests, f.result.Blobs, f.result.Bytes, registry.Name)
+	if f.result.Failed == len(f.result.Images) {
+		return &f.result, errors.New("all images failed to prefetch")
+	}
+	return &f.result, nil
+}
+
+// fetchImage 请求镜像的 manifest，多架构镜像按平台过滤子 manifest，并记录需要读取的 blob
+func (f *prefetcher) fetchImage(image string) models.PrefetchImage {
+	item := models.PrefetchImage{Image: image}
+	repository, reference, err := ParseImageReference(image)
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+
+	raw, err := f.client.GetRawManifest(repository, reference)
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+	item.Digest = raw.Digest
+	item.Manifests++
+
+	if !IsManifestList(raw.MediaType) {
+		if err := f.addManifestBlobs(repository, raw.Body, &item); err != nil {
+			item.Error = err.Error()
+		}
+		return item
+	}
+
+	var list models.ManifestList
+	if err := json.Unmarshal(raw.Body, &list); err != nil {
+		item.Error = err.Error()
+		return item
+	}
+	for _, m := range list.Manifests {
+		if len(f.platforms) > 0 && !f.platforms[platformString(m.Platform)] &&
+			!f.platforms[m.Platform.OS+"/"+m.Platform.Architecture] {
+			continue
+		}
+		child, err := f.client.GetRawManifest(repository, m.Digest)
+		if err != nil {
+			item.Error = err.Error()
+			return item
+		}
+		item.Manifests++
+		if err := f.addManifestBlobs(repository, child.Body, &item); err != nil {
+			item.Error = err.Error()
+			return item
+		}
+	}
+	return item
+}
+
+// addManifestBlobs 记录镜像 manifest 引用的配置和镜像层
+func (f *prefetcher) addManifestBlobs(repository string, body []byte, item *models.PrefetchImage) error {
+	var manifest models.ImageManifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return err
+	}
+	if manifest.SchemaVersion == 1 {
+		return fmt.Errorf("schema 1 manifests are not supported")
+	}
+	blobs := append([]models.ManifestLayer{{MediaType: manifest.Config.MediaType, Size: manifest.Config.Size, Digest: manifest.Config.Digest}}, manifest.Layers...)
+	for _, blob := range blobs {
+		// 外部层（如 Windows 基础镜像）不经过 Registry
+		if blob.Digest == "" || strings.Contains(blob.MediaType, "foreign") || strings.Contains(blob.MediaType, "nondistributable") {
+			continue
+		}
+		item.Blobs++
+		if f.seenBlobs[blob.Digest] {
+			continue
+		}
+		f.seenBlobs[blob.Digest] = true
+		f.blobs = append(f.blobs, prefetchBlob{image: len(f.result.Images), repository: repository, ManifestLayer: blob})
+	}
+	return nil
+}
+
+// fetchBlob 读取完整的 blob 并丢弃内容，镜像站在读取完成后缓存该 blob
+func (f *prefetcher) fetchBlob(blob prefetchBlob, base, total int64) (int64, error) {
+	reader, _, err := f.client.OpenBlob(blob.repository, blob.Digest)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	var read int64
+	buf := make([]byte, 256*1024)
+	for {
+		n, err := reader.Read(buf)
+		read += int64(n)
+		if n > 0 {
+			f.ctx.SetProgress(base+read, total, "")
+		}
+		if err == io.EOF {
+			return read, nil
+		}
+		if err != nil {
+			return read, err
+		}
+	}
+}
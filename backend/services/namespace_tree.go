@@ -0,0 +1,168 @@
+package services
+
+import (
+	"sort"
+	"strings"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// maxTreeNodes 一次展开或搜索最多返回的节点数
+const maxTreeNodes = 1000
+
+// namespaceStats 命名空间树的统计数据：爬取到的各仓库标签数和最新存储快照中的大小
+type namespaceStats struct {
+	tags     map[string]int
+	repoSize map[string]int64
+	nsSize   map[string]int64
+	snapshot *models.StorageSnapshot
+}
+
+// loadNamespaceStats 加载 Registry 的标签数和最新存储快照
+func loadNamespaceStats(registryID uint) (*namespaceStats, error) {
+	stats := &namespaceStats{tags: map[string]int{}, repoSize: map[string]int64{}, nsSize: map[string]int64{}}
+
+	var counts []struct {
+		Repository string
+		Count      int
+	}
+	if err := config.DB.Model(&models.CatalogTag{}).Select("repository, COUNT(*) AS count").
+		Where("registry_id = ?", registryID).Group("repository").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range counts {
+		stats.tags[row.Repository] = row.Count
+	}
+
+	var snapshots []models.StorageSnapshot
+	if err := config.DB.Where("registry_id = ?", registryID).Order("id DESC").Limit(1).Find(&snapshots).Error; err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		// 还没有进行过存储分析
+		return stats, nil
+	}
+	snapshot := &snapshots[0]
+	stats.snapshot = snapshot
+	var usages []models.StorageUsage
+	if err := config.DB.Select("kind, name, total_bytes").
+		Where("snapshot_id = ? AND kind IN ?", snapshot.ID, []string{models.StorageKindRepository, models.StorageKindNamespace}).
+		Find(&usages).Error; err != nil {
+		return nil, err
+	}
+	for _, usage := range usages {
+		if usage.Kind == models.StorageKindRepository {
+			stats.repoSize[usage.Name] = usage.TotalBytes
+		} else {
+			stats.nsSize[usage.Name] = usage.TotalBytes
+		}
+	}
+	return stats, nil
+}
+
+// size 返回节点的大小：有子仓库时为命名空间（包括路径本身的仓库）去重后的大小，否则为仓库大小
+func (s *namespaceStats) size(node *models.NamespaceNode) *int64 {
+	if s.snapshot == nil {
+		return nil
+	}
+	if node.Path == "" {
+		return &s.snapshot.TotalBytes
+	}
+	sizes := s.repoSize
+	if node.HasChildren {
+		sizes = s.nsSize
+	}
+	if size, ok := sizes[node.Path]; ok {
+		return &size
+	}
+	return nil
+}
+
+// addRepository 将仓库计入节点的统计
+func (s *namespaceStats) addRepository(node *models.NamespaceNode, repository string) {
+	node.Repositories++
+	if count, ok := s.tags[repository]; ok {
+		node.Tags += count
+		node.Crawled++
+	}
+}
+
+// BuildNamespaceTree 将仓库目录按路径组织为树，返回 prefix 节点及其直接子节点。
+// search 不为空时改为返回 prefix 下路径包含 search（忽略大小写）的仓库
+func BuildNamespaceTree(registryID uint, repositories []string, prefix, search string) (*models.NamespaceTree, error) {
+	prefix = strings.Trim(prefix, "/")
+	stats, err := loadNamespaceStats(registryID)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &models.NamespaceTree{Node: models.NamespaceNode{Path: prefix}, Children: []models.NamespaceNode{}}
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		tree.Node.Name = prefix[i+1:]
+	} else {
+		tree.Node.Name = prefix
+	}
+	if stats.snapshot != nil {
+		tree.SizeAt = &stats.snapshot.CreatedAt
+	}
+
+	search = strings.ToLower(search)
+	children := map[string]*models.NamespaceNode{}
+	for _, repo := range repositories {
+		var rest string
+		switch {
+		case prefix == "":
+			rest = repo
+		case repo == prefix:
+			tree.Node.IsRepository = true
+		case strings.HasPrefix(repo, prefix+"/"):
+			rest = repo[len(prefix)+1:]
+		default:
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(repo), search) {
+			continue
+		}
+		stats.addRepository(&tree.Node, repo)
+		if rest == "" {
+			continue
+		}
+		tree.Node.HasChildren = true
+
+		if search != "" {
+			node := &models.NamespaceNode{Name: rest, Path: repo, IsRepository: true}
+			stats.addRepository(node, repo)
+			children[repo] = node
+			continue
+		}
+		name, _, nested := strings.Cut(rest, "/")
+		path := name
+		if prefix != "" {
+			path = prefix + "/" + name
+		}
+		node := children[path]
+		if node == nil {
+			node = &models.NamespaceNode{Name: name, Path: path}
+			children[path] = node
+		}
+		if nested {
+			node.HasChildren = true
+		} else {
+			node.IsRepository = true
+		}
+		stats.addRepository(node, repo)
+	}
+
+	tree.Node.Size = stats.size(&tree.Node)
+	for _, node := range children {
+		node.Size = stats.size(node)
+		tree.Children = append(tree.Children, *node)
+	}
+	sort.Slice(tree.Children, func(i, j int) bool { return tree.Children[i].Path < tree.Children[j].Path })
+	tree.Total = len(tree.Children)
+	if len(tree.Children) > maxTreeNodes {
+		tree.Children = tree.Children[:maxTreeNodes]
+	}
+	return tree, nil
+}
@@ -0,0 +1,656 @@
+package services
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"debug/buildinfo"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// 读取的文件大小上限
+const (
+	maxMetadataFileSize = 64 << 20  // 包数据库、锁文件等
+	maxBinarySize       = 256 << 20 // 用于读取 Go 构建信息的可执行文件
+)
+
+// 包数据库在镜像中的路径
+const (
+	dpkgStatusPath    = "var/lib/dpkg/status"
+	dpkgStatusDir     = "var/lib/dpkg/status.d/"
+	apkInstalledPath  = "lib/apk/db/installed"
+	rpmSQLitePath     = "var/lib/rpm/rpmdb.sqlite"
+	rpmSQLiteSysPath  = "usr/lib/sysimage/rpm/rpmdb.sqlite"
+	rpmBerkeleyDBPath = "var/lib/rpm/Packages"
+	osReleasePath     = "etc/os-release"
+	osReleaseLibPath  = "usr/lib/os-release"
+)
+
+// lockfileParsers 支持的语言锁文件，按文件名匹配
+var lockfileParsers = map[string]func([]byte) []models.InventoryPackage{
+	"package-lock.json":  parseNpmLock,
+	".package-lock.json": parseNpmLock,
+	"Cargo.lock":         parseCargoLock,
+	"poetry.lock":        parsePoetryLock,
+	"Pipfile.lock":       parsePipfileLock,
+	"composer.lock":      parseComposerLock,
+	"Gemfile.lock":       parseGemfileLock,
+}
+
+// layerFile 合并文件系统中保留的文件：元数据文件保存原始内容，可执行文件只保存解析出的软件包
+type layerFile struct {
+	data     []byte
+	packages []models.InventoryPackage
+}
+
+// mergedFS 只包含包检测所需文件的合并文件系统视图
+type mergedFS map[string]*layerFile
+
+// remove 删除路径及其下的所有文件（处理 whiteout）
+func (fs mergedFS) remove(p string) {
+	delete(fs, p)
+	prefix := p + "/"
+	for k := range fs {
+		if strings.HasPrefix(k, prefix) {
+			delete(fs, k)
+		}
+	}
+}
+
+// isMetadataFile 判断是否为需要保留内容的元数据文件
+func isMetadataFile(p string) bool {
+	switch p {
+	case dpkgStatusPath, apkInstalledPath, rpmSQLitePath, rpmSQLiteSysPath, rpmBerkeleyDBPath, osReleasePath, osReleaseLibPath:
+		return true
+	}
+	if strings.HasPrefix(p, dpkgStatusDir) {
+		return true
+	}
+	_, ok := lockfileParsers[path.Base(p)]
+	return ok
+}
+
+// DetectImagePackages 下载镜像各层并从合并后的文件系统中检测软件包，结果按平台 manifest 的 digest 保存
+func DetectImagePackages(client *RegistryClient, registryID uint, repository, reference string, refresh bool) (*models.PackageInventory, error) {
+	manifest, err := client.GetManifest(repository, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	if !refresh {
+		var existing models.PackageInventory
+		err := config.DB.Where("digest = ? AND source = ?", manifest.Digest, models.InventorySourceDetected).First(&existing).Error
+		if err == nil {
+			return &existing, LinkInventoryImage(registryID, repository, reference, manifest.Raw.Digest, manifest.Digest)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	fs := mergedFS{}
+	for _, layer := range manifest.Layers {
+		if err := client.applyLayer(repository, layer, fs); err != nil {
+			return nil, fmt.Errorf("failed to read layer %s: %v", layer.Digest, err)
+		}
+	}
+
+	distro, packages := detectPackages(fs)
+
+	inventory := &models.PackageInventory{
+		Digest: manifest.Digest,
+		Source: models.InventorySourceDetected,
+		Format: models.InventorySourceDetected,
+		Distro: distro,
+	}
+	if err := SaveInventory(inventory, packages); err != nil {
+		return nil, err
+	}
+
+	return inventory, LinkInventoryImage(registryID, repository, reference, manifest.Raw.Digest, manifest.Digest)
+}
+
+// applyLayer 将一层的变更应用到合并文件系统。本层的 whiteout 只作用于下层，
+// 因此先收集本层的文件和 whiteout，读完后先删除 whiteout 的路径再写入本层的文件
+func (c *RegistryClient) applyLayer(repository string, layer models.ManifestLayer, fs mergedFS) error {
+	body, _, err := c.OpenBlob(repository, layer.Digest)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	reader, err := decompressLayer(body)
+	if err != nil {
+		return err
+	}
+
+	var whiteouts []string
+	upper := mergedFS{} // 本层的文件，nil 表示本层用不需要的内容覆盖了该路径
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		dir, base := path.Split(name)
+
+		// whiteout 文件表示删除下层的文件或目录，opaque whiteout 表示隐藏下层目录的全部内容
+		if base == ".wh..wh..opq" {
+			whiteouts = append(whiteouts, strings.TrimSuffix(dir, "/"))
+			continue
+		}
+		if target, ok := strings.CutPrefix(base, ".wh."); ok {
+			whiteouts = append(whiteouts, dir+target)
+			continue
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg:
+		default:
+			// 链接等其他类型覆盖了原路径上的文件
+			upper[name] = nil
+			continue
+		}
+
+		switch {
+		case isMetadataFile(name):
+			if hdr.Size > maxMetadataFileSize {
+				upper[name] = nil
+				continue
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			upper[name] = &layerFile{data: data}
+		case hdr.Mode&0111 != 0 && hdr.Size > 4 && hdr.Size <= maxBinarySize:
+			packages, err := readGoBuildInfo(tr, hdr.Size)
+			if err != nil {
+				return err
+			}
+			if packages != nil {
+				upper[name] = &layerFile{packages: packages}
+			} else {
+				upper[name] = nil
+			}
+		default:
+			upper[name] = nil
+		}
+	}
+
+	for _, p := range whiteouts {
+		fs.remove(p)
+	}
+	for name, f := range upper {
+		fs.remove(name)
+		if f != nil {
+			fs[name] = f
+		}
+	}
+	return nil
+}
+
+// decompressLayer 根据内容判断层是否经过 gzip 压缩
+func decompressLayer(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		return gzip.NewReader(br)
+	case len(magic) == 4 && bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return nil, errors.New("zstd compressed layers are not supported")
+	}
+	return br, nil
+}
+
+// goBinaryMemoryLimit 不超过该大小的可执行文件在内存中解析，更大的先写入临时文件
+const goBinaryMemoryLimit = 8 << 20
+
+// spoolExecutable 将可执行文件读入内存或临时文件，返回可随机读取的内容和清理函数
+func spoolExecutable(r io.Reader, size int64) (io.ReaderAt, func(), error) {
+	if size <= goBinaryMemoryLimit {
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, nil, err
+		}
+		return bytes.NewReader(data), func() {}, nil
+	}
+
+	f, err := os.CreateTemp("", "dgui-binary-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	if _, err := io.CopyN(f, r, size); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return f, cleanup, nil
+}
+
+// readGoBuildInfo 读取可执行文件中嵌入的 Go 构建信息，非 Go 程序返回 nil
+func readGoBuildInfo(r io.Reader, size int64) ([]models.InventoryPackage, error) {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	// 只处理 ELF 文件
+	if !bytes.Equal(magic, []byte("\x7fELF")) {
+		return nil, nil
+	}
+
+	file, cleanup, err := spoolExecutable(io.MultiReader(bytes.NewReader(magic), r), size)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	info, err := buildinfo.Read(file)
+	if err != nil {
+		return nil, nil
+	}
+
+	packages := []models.InventoryPackage{{
+		Name:    "stdlib",
+		Version: info.GoVersion,
+		Type:    "golang",
+		PURL:    fmt.Sprintf("pkg:golang/stdlib@%s", info.GoVersion),
+	}}
+	if info.Main.Path != "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		packages = append(packages, goModulePackage(info.Main.Path, info.Main.Version))
+	}
+	for _, dep := range info.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		packages = append(packages, goModulePackage(dep.Path, dep.Version))
+	}
+	return packages, nil
+}
+
+// goModulePackage 构造 Go 模块软件包
+func goModulePackage(modulePath, version string) models.InventoryPackage {
+	return models.InventoryPackage{
+		Name:    modulePath,
+		Version: version,
+		Type:    "golang",
+		PURL:    fmt.Sprintf("pkg:golang/%s@%s", modulePath, version),
+	}
+}
+
+// osRelease 解析 os-release 文件
+func osRelease(data []byte) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if !found || strings.HasPrefix(key, "#") {
+			continue
+		}
+		values[key] = strings.Trim(value, `"'`)
+	}
+	return values
+}
+
+// detectPackages 从合并文件系统中提取发行版和软件包
+func detectPackages(fs mergedFS) (string, []models.InventoryPackage) {
+	var distroID, distroVersion string
+	for _, p := range []string{osReleasePath, osReleaseLibPath} {
+		if f, ok := fs[p]; ok {
+			values := osRelease(f.data)
+			distroID, distroVersion = strings.ToLower(values["ID"]), values["VERSION_ID"]
+			break
+		}
+	}
+	distro := ""
+	if distroID != "" {
+		distro = distroID + ":" + distroVersion
+	}
+	distroQualifier := ""
+	if distroID != "" {
+		distroQualifier = distroID + "-" + distroVersion
+	}
+
+	paths := make([]string, 0, len(fs))
+	for p := range fs {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var packages []models.InventoryPackage
+	for _, p := range paths {
+		f := fs[p]
+		switch {
+		case f.packages != nil:
+			packages = append(packages, f.packages...)
+		case p == dpkgStatusPath || strings.HasPrefix(p, dpkgStatusDir):
+			packages = append(packages, parseDpkgStatus(f.data, distroID, distroQualifier)...)
+		case p == apkInstalledPath:
+			packages = append(packages, parseApkInstalled(f.data, distroQualifier)...)
+		case p == rpmSQLitePath || p == rpmSQLiteSysPath:
+			rpms, err := parseRpmSQLite(f.data, distroID, distroQualifier)
+			if err != nil {
+				log.Printf("Failed to read rpm database %s: %v", p, err)
+			}
+			packages = append(packages, rpms...)
+		case p == rpmBerkeleyDBPath:
+			log.Printf("Berkeley DB rpm database %s is not supported", p)
+		default:
+			if parse, ok := lockfileParsers[path.Base(p)]; ok {
+				packages = append(packages, parse(f.data)...)
+			}
+		}
+	}
+
+	return distro, packages
+}
+
+// withQualifiers 为 purl 添加限定符
+func withQualifiers(purl string, qualifiers ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(qualifiers); i += 2 {
+		if qualifiers[i+1] != "" {
+			parts = append(parts, qualifiers[i]+"="+qualifiers[i+1])
+		}
+	}
+	if len(parts) == 0 {
+		return purl
+	}
+	return purl + "?" + strings.Join(parts, "&")
+}
+
+// parseDpkgStatus 解析 dpkg 的 status 文件，只保留已安装的软件包
+func parseDpkgStatus(data []byte, distroID, distroQualifier string) []models.InventoryPackage {
+	if distroID == "" {
+		distroID = "debian"
+	}
+	var packages []models.InventoryPackage
+	for _, paragraph := range strings.Split(string(data), "\n\n") {
+		fields := map[string]string{}
+		for _, line := range strings.Split(paragraph, "\n") {
+			if line == "" || line[0] == ' ' || line[0] == '\t' {
+				continue
+			}
+			key, value, found := strings.Cut(line, ":")
+			if found {
+				fields[key] = strings.TrimSpace(value)
+			}
+		}
+		name, version := fields["Package"], fields["Version"]
+		if name == "" || version == "" {
+			continue
+		}
+		if status := fields["Status"]; status != "" && !strings.HasSuffix(status, " installed") {
+			continue
+		}
+		// Source 字段可能带有版本号，如 "openssl (3.0.11-1)"
+		source, _, _ := strings.Cut(fields["Source"], " ")
+		if source == name {
+			source = ""
+		}
+		packages = append(packages, models.InventoryPackage{
+			Name:    name,
+			Version: version,
+			Type:    "deb",
+			PURL: withQualifiers(fmt.Sprintf("pkg:deb/%s/%s@%s", distroID, name, version),
+				"arch", fields["Architecture"], "upstream", source, "distro", distroQualifier),
+		})
+	}
+	return packages
+}
+
+// parseApkInstalled 解析 apk 的 installed 数据库
+func parseApkInstalled(data []byte, distroQualifier string) []models.InventoryPackage {
+	var packages []models.InventoryPackage
+	for _, block := range strings.Split(string(data), "\n\n") {
+		fields := map[string]string{}
+		for _, line := range strings.Split(block, "\n") {
+			if len(line) > 2 && line[1] == ':' {
+				fields[line[:1]] = line[2:]
+			}
+		}
+		name, version := fields["P"], fields["V"]
+		if name == "" || version == "" {
+			continue
+		}
+		origin := fields["o"]
+		if origin == name {
+			origin = ""
+		}
+		packages = append(packages, models.InventoryPackage{
+			Name:    name,
+			Version: version,
+			Type:    "apk",
+			License: fields["L"],
+			PURL: withQualifiers(fmt.Sprintf("pkg:apk/alpine/%s@%s", name, version),
+				"arch", fields["A"], "upstream", origin, "distro", distroQualifier),
+		})
+	}
+	return packages
+}
+
+// parseNpmLock 解析 package-lock.json（v1 使用 dependencies，v2/v3 使用 packages）
+func parseNpmLock(data []byte) []models.InventoryPackage {
+	type npmDependency struct {
+		Version      string                     `json:"version"`
+		License      string                     `json:"license"`
+		Dependencies map[string]json.RawMessage `json:"dependencies"`
+	}
+	var lock struct {
+		Packages     map[string]npmDependency   `json:"packages"`
+		Dependencies map[string]json.RawMessage `json:"dependencies"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil
+	}
+
+	var packages []models.InventoryPackage
+	add := func(name, version, license string) {
+		if name == "" || version == "" {
+			return
+		}
+		packages = append(packages, models.InventoryPackage{
+			Name:    name,
+			Version: version,
+			Type:    "npm",
+			License: license,
+			PURL:    fmt.Sprintf("pkg:npm/%s@%s", strings.ReplaceAll(name, "@", "%40"), version),
+		})
+	}
+
+	if len(lock.Packages) > 0 {
+		for p, dep := range lock.Packages {
+			idx := strings.LastIndex(p, "node_modules/")
+			if idx < 0 {
+				continue
+			}
+			add(p[idx+len("node_modules/"):], dep.Version, dep.License)
+		}
+		return packages
+	}
+
+	var walk func(deps map[string]json.RawMessage)
+	walk = func(deps map[string]json.RawMessage) {
+		for name, raw := range deps {
+			var dep npmDependency
+			if json.Unmarshal(raw, &dep) != nil {
+				continue
+			}
+			add(name, dep.Version, "")
+			walk(dep.Dependencies)
+		}
+	}
+	walk(lock.Dependencies)
+	return packages
+}
+
+// parseTOMLPackages 解析 Cargo.lock / poetry.lock 中的 [[package]] 表
+func parseTOMLPackages(data []byte, typ string) []models.InventoryPackage {
+	var packages []models.InventoryPackage
+	var name, version string
+	flush := func() {
+		if name != "" && version != "" {
+			packages = append(packages, models.InventoryPackage{
+				Name:    name,
+				Version: version,
+				Type:    typ,
+				PURL:    fmt.Sprintf("pkg:%s/%s@%s", typ, name, version),
+			})
+		}
+		name, version = "", ""
+	}
+	inPackage := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			flush()
+			inPackage = line == "[[package]]"
+			continue
+		}
+		if !inPackage {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		switch strings.TrimSpace(key) {
+		case "name":
+			name = value
+		case "version":
+			version = value
+		}
+	}
+	flush()
+	return packages
+}
+
+// parseCargoLock 解析 Cargo.lock
+func parseCargoLock(data []byte) []models.InventoryPackage {
+	return parseTOMLPackages(data, "cargo")
+}
+
+// parsePoetryLock 解析 poetry.lock
+func parsePoetryLock(data []byte) []models.InventoryPackage {
+	return parseTOMLPackages(data, "pypi")
+}
+
+// parsePipfileLock 解析 Pipfile.lock
+func parsePipfileLock(data []byte) []models.InventoryPackage {
+	var lock map[string]json.RawMessage
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil
+	}
+	var packages []models.InventoryPackage
+	for _, section := range []string{"default", "develop"} {
+		var deps map[string]struct {
+			Version string `json:"version"`
+		}
+		if json.Unmarshal(lock[section], &deps) != nil {
+			continue
+		}
+		for name, dep := range deps {
+			version := strings.TrimPrefix(dep.Version, "==")
+			if version == "" {
+				continue
+			}
+			packages = append(packages, models.InventoryPackage{
+				Name:    name,
+				Version: version,
+				Type:    "pypi",
+				PURL:    fmt.Sprintf("pkg:pypi/%s@%s", name, version),
+			})
+		}
+	}
+	return packages
+}
+
+// parseComposerLock 解析 composer.lock
+func parseComposerLock(data []byte) []models.InventoryPackage {
+	type composerPackage struct {
+		Name    string   `json:"name"`
+		Version string   `json:"version"`
+		License []string `json:"license"`
+	}
+	var lock struct {
+		Packages    []composerPackage `json:"packages"`
+		PackagesDev []composerPackage `json:"packages-dev"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil
+	}
+	var packages []models.InventoryPackage
+	for _, p := range append(lock.Packages, lock.PackagesDev...) {
+		if p.Name == "" || p.Version == "" {
+			continue
+		}
+		packages = append(packages, models.InventoryPackage{
+			Name:    p.Name,
+			Version: p.Version,
+			Type:    "composer",
+			License: strings.Join(p.License, ", "),
+			PURL:    fmt.Sprintf("pkg:composer/%s@%s", p.Name, p.Version),
+		})
+	}
+	return packages
+}
+
+// parseGemfileLock 解析 Gemfile.lock 中 GEM specs 下的依赖
+func parseGemfileLock(data []byte) []models.InventoryPackage {
+	var packages []models.InventoryPackage
+	inSpecs := false
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(line, " ") {
+			inSpecs = false
+			continue
+		}
+		if trimmed == "specs:" {
+			inSpecs = true
+			continue
+		}
+		// specs 下缩进 4 个空格的为 gem 本身，更深的为其依赖约束
+		if !inSpecs || !strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "     ") {
+			continue
+		}
+		name, version, found := strings.Cut(trimmed, " ")
+		if !found {
+			continue
+		}
+		version = strings.Trim(version, "()")
+		packages = append(packages, models.InventoryPackage{
+			Name:    name,
+			Version: version,
+			Type:    "gem",
+			PURL:    fmt.Sprintf("pkg:gem/%s@%s", name, version),
+		})
+	}
+	return packages
+}
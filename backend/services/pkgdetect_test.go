@@ -0,0 +1,311 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"sort"
+	"strings"
+	"testing"
+
+	"dgui/models"
+)
+
+// sortPackages 按名称排序，lockfile 解析时 map 的遍历顺序不固定
+func sortPackages(packages []models.InventoryPackage) []models.InventoryPackage {
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Name < packages[j].Name })
+	return packages
+}
+
+func checkPackages(t *testing.T, got, want []models.InventoryPackage) {
+	t.Helper()
+	got = sortPackages(got)
+	if len(got) != len(want) {
+		t.Fatalf("got %d packages %+v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("package %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseDpkgStatus(t *testing.T) {
+	status := `Package: libssl3
+Status: install ok installed
+Architecture: amd64
+Source: openssl (3.0.11-1~deb12u2)
+Version: 3.0.11-1~deb12u2
+Description: Secure Sockets Layer toolkit
+ This package is part of the OpenSSL project.
+ Package: not-a-package
+
+Package: removed
+Status: deinstall ok config-files
+Version: 1.0-1
+
+Package: bash
+Status: install ok installed
+Architecture: amd64
+Source: bash
+Version: 5.2.15-2+b2
+`
+	tests := []struct {
+		name     string
+		distroID string
+		want     []models.InventoryPackage
+	}{
+		{"debian", "debian", []models.InventoryPackage{
+			{Name: "bash", Version: "5.2.15-2+b2", Type: "deb", PURL: "pkg:deb/debian/bash@5.2.15-2+b2?arch=amd64&distro=debian-12"},
+			{Name: "libssl3", Version: "3.0.11-1~deb12u2", Type: "deb", PURL: "pkg:deb/debian/libssl3@3.0.11-1~deb12u2?arch=amd64&upstream=openssl&distro=debian-12"},
+		}},
+		{"default distro", "", []models.InventoryPackage{
+			{Name: "bash", Version: "5.2.15-2+b2", Type: "deb", PURL: "pkg:deb/debian/bash@5.2.15-2+b2?arch=amd64&distro=debian-12"},
+			{Name: "libssl3", Version: "3.0.11-1~deb12u2", Type: "deb", PURL: "pkg:deb/debian/libssl3@3.0.11-1~deb12u2?arch=amd64&upstream=openssl&distro=debian-12"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkPackages(t, parseDpkgStatus([]byte(status), tt.distroID, "debian-12"), tt.want)
+		})
+	}
+}
+
+func TestParseApkInstalled(t *testing.T) {
+	installed := `C:Q1abc=
+P:musl
+V:1.2.4-r2
+A:x86_64
+L:MIT
+o:musl
+
+C:Q1def=
+P:libcrypto3
+V:3.1.4-r1
+A:x86_64
+L:Apache-2.0
+o:openssl
+
+P:broken
+`
+	checkPackages(t, parseApkInstalled([]byte(installed), "alpine-3.18.4"), []models.InventoryPackage{
+		{Name: "libcrypto3", Version: "3.1.4-r1", Type: "apk", License: "Apache-2.0", PURL: "pkg:apk/alpine/libcrypto3@3.1.4-r1?arch=x86_64&upstream=openssl&distro=alpine-3.18.4"},
+		{Name: "musl", Version: "1.2.4-r2", Type: "apk", License: "MIT", PURL: "pkg:apk/alpine/musl@1.2.4-r2?arch=x86_64&distro=alpine-3.18.4"},
+	})
+}
+
+func TestParseLockfiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func([]byte) []models.InventoryPackage
+		data  string
+		want  []models.InventoryPackage
+	}{
+		{
+			name:  "npm v3",
+			parse: parseNpmLock,
+			data: `{"lockfileVersion": 3, "packages": {
+				"": {"name": "app", "version": "1.0.0"},
+				"node_modules/@types/node": {"version": "20.1.0", "license": "MIT"},
+				"node_modules/a/node_modules/lodash": {"version": "4.17.21", "license": "MIT"}
+			}}`,
+			want: []models.InventoryPackage{
+				{Name: "@types/node", Version: "20.1.0", Type: "npm", License: "MIT", PURL: "pkg:npm/%40types/node@20.1.0"},
+				{Name: "lodash", Version: "4.17.21", Type: "npm", License: "MIT", PURL: "pkg:npm/lodash@4.17.21"},
+			},
+		},
+		{
+			name:  "npm v1",
+			parse: parseNpmLock,
+			data: `{"lockfileVersion": 1, "dependencies": {
+				"express": {"version": "4.18.2", "dependencies": {"qs": {"version": "6.11.0"}}}
+			}}`,
+			want: []models.InventoryPackage{
+				{Name: "express", Version: "4.18.2", Type: "npm", PURL: "pkg:npm/express@4.18.2"},
+				{Name: "qs", Version: "6.11.0", Type: "npm", PURL: "pkg:npm/qs@6.11.0"},
+			},
+		},
+		{
+			name:  "cargo",
+			parse: parseCargoLock,
+			data: `version = 3
+
+[[package]]
+name = "serde"
+version = "1.0.193"
+dependencies = [
+ "serde_derive",
+]
+
+[metadata]
+name = "ignored"
+version = "0.0.0"
+
+[[package]]
+name = "tokio"
+version = "1.35.0"
+`,
+			want: []models.InventoryPackage{
+				{Name: "serde", Version: "1.0.193", Type: "cargo", PURL: "pkg:cargo/serde@1.0.193"},
+				{Name: "tokio", Version: "1.35.0", Type: "cargo", PURL: "pkg:cargo/tokio@1.35.0"},
+			},
+		},
+		{
+			name:  "poetry",
+			parse: parsePoetryLock,
+			data: `[[package]]
+name = "requests"
+version = "2.31.0"
+
+[package.extras]
+socks = ["PySocks (>=1.5.6,!=1.5.7)"]
+`,
+			want: []models.InventoryPackage{
+				{Name: "requests", Version: "2.31.0", Type: "pypi", PURL: "pkg:pypi/requests@2.31.0"},
+			},
+		},
+		{
+			name:  "pipfile",
+			parse: parsePipfileLock,
+			data:  `{"_meta": {}, "default": {"flask": {"version": "==3.0.0"}}, "develop": {"pytest": {"version": "==7.4.3"}, "editable": {"path": "."}}}`,
+			want: []models.InventoryPackage{
+				{Name: "flask", Version: "3.0.0", Type: "pypi", PURL: "pkg:pypi/flask@3.0.0"},
+				{Name: "pytest", Version: "7.4.3", Type: "pypi", PURL: "pkg:pypi/pytest@7.4.3"},
+			},
+		},
+		{
+			name:  "composer",
+			parse: parseComposerLock,
+			data:  `{"packages": [{"name": "monolog/monolog", "version": "3.5.0", "license": ["MIT"]}], "packages-dev": [{"name": "phpunit/phpunit", "version": "10.5.2", "license": ["BSD-3-Clause"]}]}`,
+			want: []models.InventoryPackage{
+				{Name: "monolog/monolog", Version: "3.5.0", Type: "composer", License: "MIT", PURL: "pkg:composer/monolog/monolog@3.5.0"},
+				{Name: "phpunit/phpunit", Version: "10.5.2", Type: "composer", License: "BSD-3-Clause", PURL: "pkg:composer/phpunit/phpunit@10.5.2"},
+			},
+		},
+		{
+			name:  "gemfile",
+			parse: parseGemfileLock,
+			data: `GEM
+  remote: https://rubygems.org/
+  specs:
+    actionpack (7.1.2)
+      rack (>= 2.2.4)
+    rack (3.0.8)
+
+PLATFORMS
+  x86_64-linux
+
+DEPENDENCIES
+  rails
+`,
+			want: []models.InventoryPackage{
+				{Name: "actionpack", Version: "7.1.2", Type: "gem", PURL: "pkg:gem/actionpack@7.1.2"},
+				{Name: "rack", Version: "3.0.8", Type: "gem", PURL: "pkg:gem/rack@3.0.8"},
+			},
+		},
+		{
+			name:  "invalid json",
+			parse: parseNpmLock,
+			data:  `{`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkPackages(t, tt.parse([]byte(tt.data)), tt.want)
+		})
+	}
+}
+
+// tarEntry 测试镜像层中的一个条目，data 为空且 size 不为 0 时写入 size 个零字节
+type tarEntry struct {
+	name string
+	data string
+	size int64
+}
+
+// buildLayer 生成 gzip 压缩的 tar 镜像层
+func buildLayer(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		size := int64(len(e.data))
+		if e.size > 0 {
+			size = e.size
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: e.name, Typeflag: tar.TypeReg, Mode: 0644, Size: size}); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if e.size > 0 {
+			_, err = tw.Write(make([]byte, size))
+		} else {
+			_, err = tw.Write([]byte(e.data))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestApplyLayer(t *testing.T) {
+	setupTestDB(t, &models.Registry{})
+	r := newTestRegistry(t)
+	client, _ := newTestClient(t, r)
+
+	layers := [][]byte{
+		buildLayer(t,
+			tarEntry{name: "etc/os-release", data: "ID=debian\n"},
+			tarEntry{name: "var/lib/dpkg/status", data: "old status"},
+			tarEntry{name: "app/package-lock.json", data: "old app lock"},
+			tarEntry{name: "app/web/package-lock.json", data: "old web lock"},
+			tarEntry{name: "srv/Cargo.lock", data: "cargo lock"},
+			tarEntry{name: "opt/tool/Gemfile.lock", data: "old gem lock"},
+		),
+		buildLayer(t,
+			// 本层的文件出现在 whiteout 之前，whiteout 只能删除下层的内容
+			tarEntry{name: "app/package-lock.json", data: "new app lock"},
+			tarEntry{name: "app/.wh..wh..opq"},
+			tarEntry{name: "opt/tool/Gemfile.lock", data: "new gem lock"},
+			tarEntry{name: "opt/.wh.tool"},
+			tarEntry{name: "srv/.wh.Cargo.lock"},
+			// 超过大小限制的元数据文件仍然覆盖下层的版本
+			tarEntry{name: "var/lib/dpkg/status", size: maxMetadataFileSize + 1},
+		),
+	}
+
+	fs := mergedFS{}
+	for _, data := range layers {
+		layer := models.ManifestLayer{Digest: r.addBlob(data), Size: int64(len(data))}
+		if err := client.applyLayer("app", layer, fs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{
+		"etc/os-release":        "ID=debian\n",
+		"app/package-lock.json": "new app lock",
+		"opt/tool/Gemfile.lock": "new gem lock",
+	}
+	var got []string
+	for name := range fs {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	if len(fs) != len(want) {
+		t.Fatalf("files = %s, want %d files", strings.Join(got, ", "), len(want))
+	}
+	for name, data := range want {
+		if f, ok := fs[name]; !ok || string(f.data) != data {
+			t.Errorf("%s = %+v, want %q", name, f, data)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"dgui/models"
+)
+
+// 常见制品的媒体类型
+const (
+	ArtifactTypeCosignSignature   = "application/vnd.dev.cosign.artifact.sig.v1+json"
+	ArtifactTypeCosignSBOM        = "application/vnd.dev.cosign.artifact.sbom.v1+json"
+	ArtifactTypeCosignAttestation = "application/vnd.dev.cosign.artifact.att.v1+json"
+	MediaTypeCosignSimpleSigning  = "application/vnd.dev.cosign.simplesigning.v1+json"
+	MediaTypeNotarySignature      = "application/vnd.cncf.notary.signature"
+	MediaTypeSigstoreBundlePrefix = "application/vnd.dev.sigstore.bundle"
+	MediaTypeInTotoPrefix         = "application/vnd.in-toto"
+	MediaTypeDSSEEnvelope         = "application/vnd.dsse.envelope.v1+json"
+	MediaTypeSPDXJSON             = "application/spdx+json"
+	MediaTypeCycloneDXJSON        = "application/vnd.cyclonedx+json"
+)
+
+// 多架构 index 中 BuildKit attestation manifest 的注解
+const (
+	annotationDockerReferenceType = "vnd.docker.reference.type"
+)
+
+// ReferrersTag 返回 referrers 回退标签（sha256-<hex>）
+func ReferrersTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1)
+}
+
+// GetReferrers 通过 OCI 1.1 referrers API 获取引用指定 digest 的制品，
+// Registry 不支持该 API 时回退到 sha256-<hex> 标签
+func (c *RegistryClient) GetReferrers(repository, digest, artifactType string) ([]models.Referrer, error) {
+	path := fmt.Sprintf("/v2/%s/referrers/%s", repository, digest)
+	if artifactType != "" {
+		path += "?artifactType=" + url.QueryEscape(artifactType)
+	}
+
+	resp, err := c.doRequest("GET", path, map[string]string{"Accept": MediaTypeOCIIndex})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK && strings.HasPrefix(resp.Header.Get("Content-Type"), MediaTypeOCIIndex):
+		var index models.ManifestList
+		if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+			return nil, err
+		}
+		return c.referrersFromIndex(repository, &index, models.ReferrerSourceAPI, ""), nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to get referrers: %d - %s", resp.StatusCode, string(body))
+	}
+
+	// 回退到标签方案
+	tag := ReferrersTag(digest)
+	if _, _, found, err := c.HeadManifest(repository, tag); err != nil || !found {
+		return nil, err
+	}
+	index, err := c.GetManifestList(repository, tag)
+	if err != nil || index == nil {
+		return nil, err
+	}
+	return c.referrersFromIndex(repository, index, models.ReferrerSourceTagSchema, tag), nil
+}
+
+// referrersFromIndex 将 referrers index 转换为制品列表，缺少 artifactType 时读取 manifest 补全
+func (c *RegistryClient) referrersFromIndex(repository string, index *models.ManifestList, source, tag string) []models.Referrer {
+	referrers := make([]models.Referrer, 0, len(index.Manifests))
+	for _, m := range index.Manifests {
+		ref := models.Referrer{
+			Digest:       m.Digest,
+			MediaType:    m.MediaType,
+			ArtifactType: m.ArtifactType,
+			Size:         m.Size,
+			Annotations:  m.Annotations,
+			Source:       source,
+			Tag:          tag,
+		}
+		var layerTypes []string
+		if manifest, err := c.getArtifactManifest(repository, m.Digest); err == nil {
+			if ref.ArtifactType == "" {
+				ref.ArtifactType = manifest.ArtifactType
+			}
+			if ref.ArtifactType == "" {
+				ref.ArtifactType = manifest.Config.MediaType
+			}
+			for _, l := range manifest.Layers {
+				layerTypes = append(layerTypes, l.MediaType)
+			}
+		}
+		ref.Category, ref.Format = ClassifyArtifact(ref.ArtifactType, layerTypes)
+		referrers = append(referrers, ref)
+	}
+	return referrers
+}
+
+// getArtifactManifest 获取单个 manifest（不解析 manifest list）
+func (c *RegistryClient) getArtifactManifest(repository, digest string) (*models.ImageManifest, error) {
+	body, contentType, manifestDigest, err := c.fetchManifest(repository, digest)
+	if err != nil {
+		return nil, err
+	}
+	var manifest models.ImageManifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, err
+	}
+	manifest.Digest = manifestDigest
+	if manifest.MediaType == "" {
+		manifest.MediaType = contentType
+	}
+	return &manifest, nil
+}
+
+// GetImageReferrers 汇总镜像的所有关联制品：referrers API / 回退标签、cosign 标签和 index 内的 attestation。
+// 单个来源出错时记入 Warnings 并返回其余结果
+func (c *RegistryClient) GetImageReferrers(repository, reference, artifactType string) (*models.ImageReferrers, error) {
+	digest, err := c.ResolveDigest(repository, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.ImageReferrers{
+		Name:      repository,
+		Reference: reference,
+		Digest:    digest,
+	}
+
+	referrers, err := c.GetReferrers(repository, digest, artifactType)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("referrers: %v", err))
+	}
+	result.Referrers = append(result.Referrers, referrers...)
+
+	// cosign 默认使用 sha256-<hex>.sig / .att / .sbom 标签，三个标签并发查询
+	suffixes := []string{".sig", ".att", ".sbom"}
+	cosignRefs := make([]*models.Referrer, len(suffixes))
+	cosignErrs := make([]error, len(suffixes))
+	var wg sync.WaitGroup
+	for i, suffix := range suffixes {
+		wg.Add(1)
+		go func(i int, suffix string) {
+			defer wg.Done()
+			cosignRefs[i], cosignErrs[i] = c.cosignTagReferrer(repository, ReferrersTag(digest)+suffix, suffix)
+		}(i, suffix)
+	}
+	wg.Wait()
+	for i := range suffixes {
+		if cosignErrs[i] != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s%s: %v", ReferrersTag(digest), suffixes[i], cosignErrs[i]))
+		}
+		if cosignRefs[i] != nil {
+			result.Referrers = append(result.Referrers, *cosignRefs[i])
+		}
+	}
+
+	// BuildKit 将 SBOM / provenance 以 attestation manifest 的形式写入 index
+	index, err := c.GetManifestList(repository, digest)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("index: %v", err))
+	} else if index != nil {
+		for _, m := range index.Manifests {
+			if m.Annotations[annotationDockerReferenceType] != "attestation-manifest" {
+				continue
+			}
+			result.Referrers = append(result.Referrers, models.Referrer{
+				Digest:       m.Digest,
+				MediaType:    m.MediaType,
+				ArtifactType: MediaTypeInTotoPrefix + "+json",
+				Size:         m.Size,
+				Annotations:  m.Annotations,
+				Category:     models.ArtifactCategoryAttestation,
+				Format:       "in-toto",
+				Source:       models.ReferrerSourceIndex,
+			})
+		}
+	}
+
+	if artifactType != "" {
+		filtered := result.Referrers[:0]
+		for _, ref := range result.Referrers {
+			if ref.ArtifactType == artifactType {
+				filtered = append(filtered, ref)
+			}
+		}
+		result.Referrers = filtered
+	}
+
+	if result.Referrers == nil {
+		result.Referrers = []models.Referrer{}
+	}
+
+	return result, nil
+}
+
+// cosignTagReferrer 查询 cosign 标签，不存在时返回 nil
+func (c *RegistryClient) cosignTagReferrer(repository, tag, suffix string) (*models.Referrer, error) {
+	tagDigest, mediaType, found, err := c.HeadManifest(repository, tag)
+	if err != nil || !found {
+		return nil, err
+	}
+	ref := models.Referrer{
+		Digest:    tagDigest,
+		MediaType: mediaType,
+		Source:    models.ReferrerSourceCosignTag,
+		Tag:       tag,
+	}
+	switch suffix {
+	case ".sig":
+		ref.ArtifactType = ArtifactTypeCosignSignature
+	case ".att":
+		ref.ArtifactType = ArtifactTypeCosignAttestation
+	case ".sbom":
+		ref.ArtifactType = ArtifactTypeCosignSBOM
+	}
+	var layerTypes []string
+	if manifest, err := c.getArtifactManifest(repository, tag); err == nil {
+		ref.Digest = manifest.Digest
+		ref.Size = manifest.Config.Size
+		for _, l := range manifest.Layers {
+			layerTypes = append(layerTypes, l.MediaType)
+			ref.Size += l.Size
+		}
+	}
+	ref.Category, ref.Format = ClassifyArtifact(ref.ArtifactType, layerTypes)
+	return &ref, nil
+}
+
+// ClassifyArtifact 根据 artifactType 和层媒体类型识别制品类别与格式
+func ClassifyArtifact(artifactType string, layerMediaTypes []string) (category, format string) {
+	types := append([]string{artifactType}, layerMediaTypes...)
+	for i := range types {
+		types[i] = strings.ToLower(types[i])
+	}
+
+	// SBOM 格式优先按内容识别（cosign 的 .sbom 标签层即为 SPDX / CycloneDX 文档）
+	for _, t := range types {
+		switch {
+		case strings.Contains(t, "spdx"):
+			return models.ArtifactCategorySBOM, "spdx"
+		case strings.Contains(t, "cyclonedx"):
+			return models.ArtifactCategorySBOM, "cyclonedx"
+		}
+	}
+
+	for _, t := range types {
+		switch {
+		case t == "":
+			continue
+		case t == ArtifactTypeCosignSBOM:
+			return models.ArtifactCategorySBOM, "cosign"
+		case t == ArtifactTypeCosignSignature || t == MediaTypeCosignSimpleSigning:
+			return models.ArtifactCategorySignature, "cosign"
+		case strings.HasPrefix(t, MediaTypeNotarySignature):
+			return models.ArtifactCategorySignature, "notation"
+		case strings.HasPrefix(t, MediaTypeSigstoreBundlePrefix):
+			return models.ArtifactCategorySignature, "sigstore-bundle"
+		case t == ArtifactTypeCosignAttestation || t == MediaTypeDSSEEnvelope || strings.HasPrefix(t, MediaTypeInTotoPrefix):
+			return models.ArtifactCategoryAttestation, "in-toto"
+		}
+	}
+	return models.ArtifactCategoryOther, ""
+}
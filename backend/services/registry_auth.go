@@ -0,0 +1,296 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dgui/models"
+)
+
+// cachedToken 缓存的访问令牌
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+// registryTokens 缓存 Bearer token 和 ECR 授权令牌，键包含 Registry 地址、凭据和权限范围，
+// 凭据修改后自动使用新的键
+var registryTokens = struct {
+	sync.Mutex
+	m map[string]cachedToken
+}{m: map[string]cachedToken{}}
+
+// tokenKey 令牌缓存的键
+func (c *RegistryClient) tokenKey(scope string) string {
+	secret := sha256.Sum256([]byte(c.Password))
+	return fmt.Sprintf("%s|%s|%x|%s", c.BaseURL, c.Username, secret[:8], scope)
+}
+
+func (c *RegistryClient) cachedToken(scope string) string {
+	registryTokens.Lock()
+	defer registryTokens.Unlock()
+	t, ok := registryTokens.m[c.tokenKey(scope)]
+	if !ok || time.Now().After(t.expires) {
+		return ""
+	}
+	return t.token
+}
+
+func (c *RegistryClient) storeToken(scope, token string, ttl time.Duration) {
+	registryTokens.Lock()
+	defer registryTokens.Unlock()
+	registryTokens.m[c.tokenKey(scope)] = cachedToken{token: token, expires: time.Now().Add(ttl)}
+}
+
+// usesECRAPI 是否通过 ECR API 换取令牌；用户名为 AWS 时密码已经是 get-login-password 得到的令牌
+func (c *RegistryClient) usesECRAPI() bool {
+	return c.Kind == models.RegistryKindECR && c.Username != "" && c.Username != "AWS" && c.Password != ""
+}
+
+// authorize 为请求设置认证：ECR 使用换取的令牌，其余优先使用缓存的 Bearer token，否则使用基本认证
+func (c *RegistryClient) authorize(req *http.Request, scope string) error {
+	if c.usesECRAPI() {
+		token := c.cachedToken("ecr")
+		if token == "" {
+			var err error
+			if token, err = c.refreshECRToken(); err != nil {
+				return err
+			}
+		}
+		req.SetBasicAuth("AWS", token)
+		return nil
+	}
+	if token := c.cachedToken(scope); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+	if c.Username != "" && c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	return nil
+}
+
+// reauthorize 收到 401 后按质询重新获取令牌，返回是否可以重试
+func (c *RegistryClient) reauthorize(challenge, scope string) bool {
+	if c.usesECRAPI() {
+		_, err := c.refreshECRToken()
+		return err == nil
+	}
+	scheme, params := parseAuthChallenge(challenge)
+	if !strings.EqualFold(scheme, "bearer") {
+		return false
+	}
+	realm := params["realm"]
+	if c.AuthURL != "" {
+		realm = c.AuthURL
+	}
+	if realm == "" {
+		return false
+	}
+	scopes := strings.Fields(params["scope"])
+	if len(scopes) == 0 && scope != "" {
+		scopes = []string{scope}
+	}
+	token, ttl, err := c.fetchBearerToken(realm, params["service"], scopes)
+	if err != nil {
+		return false
+	}
+	c.storeToken(scope, token, ttl)
+	return true
+}
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// parseAuthChallenge 解析 WWW-Authenticate，如 Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseAuthChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := map[string]string{}
+	for _, m := range challengeParam.FindAllStringSubmatch(rest, -1) {
+		params[strings.ToLower(m[1])] = m[2]
+	}
+	return scheme, params
+}
+
+// fetchBearerToken 向 token 服务换取 Bearer token（Docker Hub、GHCR、GitLab 等使用的 Docker token 认证），
+// 配置了凭据时使用基本认证，否则匿名获取
+func (c *RegistryClient) fetchBearerToken(realm, service string, scopes []string) (string, time.Duration, error) {
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", 0, err
+	}
+	q := u.Query()
+	if service != "" {
+		q.Set("service", service)
+	}
+	for _, scope := range scopes {
+		q.Add("scope", scope)
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(c.context(), "GET", u.String(), nil)
+	if err != nil {
+		return "", 0, err
+	}
+	if c.Username != "" && c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", 0, fmt.Errorf("failed to get token: %d - %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", 0, err
+	}
+	token := result.Token
+	if token == "" {
+		token = result.AccessToken
+	}
+	if token == "" {
+		return "", 0, fmt.Errorf("token response has no token")
+	}
+	// 未返回有效期时按规范默认 60 秒，提前 10 秒过期以免请求途中失效
+	expiresIn := result.ExpiresIn
+	if expiresIn < 60 {
+		expiresIn = 60
+	}
+	return token, time.Duration(expiresIn-10) * time.Second, nil
+}
+
+// ecrRegion 从 <account>.dkr.ecr.<region>.amazonaws.com 形式的地址中取出区域
+func (c *RegistryClient) ecrRegion() string {
+	u, err := url.Parse(c.BaseURL)
+	if err == nil {
+		parts := strings.Split(u.Hostname(), ".")
+		for i := 0; i+2 < len(parts); i++ {
+			if parts[i] == "dkr" && parts[i+1] == "ecr" {
+				return parts[i+2]
+			}
+		}
+	}
+	return "us-east-1"
+}
+
+// refreshECRToken 调用 ECR GetAuthorizationToken 换取 Registry 令牌（有效期 12 小时）并缓存
+func (c *RegistryClient) refreshECRToken() (string, error) {
+	region := c.ecrRegion()
+	endpoint := c.AuthURL
+	if endpoint == "" {
+		endpoint = "https://api.ecr." + region + ".amazonaws.com/"
+	}
+	body := []byte("{}")
+	req, err := http.NewRequestWithContext(c.context(), "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken")
+	signAWSRequest(req, body, c.Username, c.Password, region, "ecr", time.Now().UTC())
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("failed to get ECR authorization token: %d - %s", resp.StatusCode, string(data))
+	}
+
+	var result struct {
+		AuthorizationData []struct {
+			AuthorizationToken string  `json:"authorizationToken"`
+			ExpiresAt          float64 `json:"expiresAt"`
+		} `json:"authorizationData"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if len(result.AuthorizationData) == 0 {
+		return "", fmt.Errorf("ECR returned no authorization data")
+	}
+	data := result.AuthorizationData[0]
+	decoded, err := base64.StdEncoding.DecodeString(data.AuthorizationToken)
+	if err != nil {
+		return "", err
+	}
+	_, token, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", fmt.Errorf("invalid ECR authorization token")
+	}
+	ttl := 11 * time.Hour
+	if data.ExpiresAt > 0 {
+		ttl = time.Until(time.Unix(int64(data.ExpiresAt), 0)) - 5*time.Minute
+	}
+	c.storeToken("ecr", token, ttl)
+	return token, nil
+}
+
+// signAWSRequest 使用 AWS Signature Version 4 签名请求
+func signAWSRequest(req *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("Host", req.URL.Host)
+
+	names := []string{}
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, req.URL.Query().Encode(), canonicalHeaders.String(), signedHeaders, hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	credentialScope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + credentialScope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, credentialScope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
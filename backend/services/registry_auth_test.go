@@ -0,0 +1,218 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dgui/models"
+)
+
+// tokenRegistry 使用 Docker token 认证的测试 Registry，记录收到的请求
+type tokenRegistry struct {
+	mu       sync.Mutex
+	server   *httptest.Server
+	token    string
+	requests []string
+	bodies   []string
+}
+
+func newTokenRegistry(t *testing.T) *tokenRegistry {
+	r := &tokenRegistry{token: "registry-token"}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+
+		if req.URL.Path == "/token" {
+			user, pass, _ := req.BasicAuth()
+			q := req.URL.Query()
+			if user != "alice" || pass != "secret" || q.Get("service") != "test-registry" || q.Get("scope") != "repository:team/app:pull,push" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, `{"token":%q,"expires_in":300}`, r.token)
+			return
+		}
+
+		if req.Header.Get("Authorization") != "Bearer "+r.token {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry",scope="repository:team/app:pull,push"`, r.server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		r.bodies = append(r.bodies, string(body))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *tokenRegistry) count(request string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, req := range r.requests {
+		if req == request {
+			n++
+		}
+	}
+	return n
+}
+
+func TestBearerTokenFlow(t *testing.T) {
+	r := newTokenRegistry(t)
+	client := NewRegistryClient(&models.Registry{URL: r.server.URL, Username: "alice", Password: "secret"})
+	url := r.server.URL + "/v2/team/app/manifests/v1"
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.doRequestURL("PUT", url, nil, bytes.NewReader([]byte("manifest")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("request %d: status %d, want %d", i, resp.StatusCode, http.StatusCreated)
+		}
+	}
+	// 第一次请求收到 401 后换取 token 并重试，第二次直接使用缓存的 token
+	if n := r.count("GET /token"); n != 1 {
+		t.Errorf("token requests = %d, want 1", n)
+	}
+	if n := r.count("PUT /v2/team/app/manifests/v1"); n != 3 {
+		t.Errorf("registry requests = %d, want 3", n)
+	}
+	if len(r.bodies) != 2 || r.bodies[0] != "manifest" || r.bodies[1] != "manifest" {
+		t.Errorf("bodies = %q, want the body replayed on retry", r.bodies)
+	}
+}
+
+func TestRetryRequiresRewindableBody(t *testing.T) {
+	r := newTokenRegistry(t)
+	client := NewRegistryClient(&models.Registry{URL: r.server.URL, Username: "alice", Password: "secret"})
+
+	body := io.MultiReader(strings.NewReader("manifest"))
+	resp, err := client.doRequestURL("PUT", r.server.URL+"/v2/team/app/manifests/v1", nil, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+	if n := r.count("GET /token"); n != 0 {
+		t.Errorf("token requests = %d, want 0", n)
+	}
+}
+
+func TestRetryWithWrongCredentials(t *testing.T) {
+	r := newTokenRegistry(t)
+	client := NewRegistryClient(&models.Registry{URL: r.server.URL, Username: "alice", Password: "wrong"})
+
+	resp, err := client.doRequestURL("GET", r.server.URL+"/v2/team/app/manifests/v1", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+	if n := r.count("GET /v2/team/app/manifests/v1"); n != 1 {
+		t.Errorf("registry requests = %d, want 1 (no retry without a token)", n)
+	}
+}
+
+func TestParseAuthChallenge(t *testing.T) {
+	scheme, params := parseAuthChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull"`)
+	if scheme != "Bearer" || params["realm"] != "https://auth.docker.io/token" ||
+		params["service"] != "registry.docker.io" || params["scope"] != "repository:library/nginx:pull" {
+		t.Errorf("parseAuthChallenge = %q, %v", scheme, params)
+	}
+}
+
+func TestSignAWSRequest(t *testing.T) {
+	// AWS Signature Version 4 测试套件中的 get-vanilla
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	signAWSRequest(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service",
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q, want %q", got, want)
+	}
+	if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+		t.Errorf("X-Amz-Date = %q", got)
+	}
+}
+
+func TestECRAuthorizationToken(t *testing.T) {
+	var tokenRequests atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		tokenRequests.Add(1)
+		if req.Method != "POST" || req.Header.Get("X-Amz-Target") != "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if auth := req.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") ||
+			!strings.Contains(auth, "/us-east-1/ecr/aws4_request") || !strings.Contains(auth, "x-amz-target") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		token := base64.StdEncoding.EncodeToString([]byte("AWS:ecr-password"))
+		fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":%q,"expiresAt":%d}]}`, token, time.Now().Add(12*time.Hour).Unix())
+	}))
+	defer api.Close()
+
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if user, pass, ok := req.BasicAuth(); !ok || user != "AWS" || pass != "ecr-password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer registry.Close()
+
+	client := NewRegistryClient(&models.Registry{
+		Kind:     models.RegistryKindECR,
+		URL:      registry.URL,
+		Username: "AKIDEXAMPLE",
+		Password: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		AuthURL:  api.URL,
+	})
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.doRequest("GET", "/v2/app/manifests/latest", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+	}
+	if n := tokenRequests.Load(); n != 1 {
+		t.Errorf("token requests = %d, want 1", n)
+	}
+}
+
+func TestECRRegion(t *testing.T) {
+	tests := map[string]string{
+		"https://123456789012.dkr.ecr.eu-west-1.amazonaws.com":     "eu-west-1",
+		"https://123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn": "cn-north-1",
+		"http://127.0.0.1:5000":                                    "us-east-1",
+	}
+	for url, want := range tests {
+		if got := NewRegistryClient(&models.Registry{URL: url}).ecrRegion(); got != want {
+			t.Errorf("ecrRegion(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
@@ -1,23 +1,38 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"time"
 
+	"dgui/config"
 	"dgui/models"
 )
 
 // RegistryClient Docker Registry API 客户端
 type RegistryClient struct {
+	RegistryID uint   // 用于缓存和统计，未保存的 Registry 为 0
+	Name       string // 用于指标标签
 	BaseURL    string
 	Username   string
 	Password   string
 	HTTPClient *http.Client
+
+	Kind         string   // Registry 类型，见 models.RegistryKind*
+	Repositories []string // 手动配置的仓库列表，不为空时代替 _catalog
+	AuthURL      string   // 认证端点，为空时使用 WWW-Authenticate 返回的地址
+	Mirror       bool     // 拉取缓存镜像站，只允许 GET 和 HEAD 请求
+	Upstream     string   // 镜像站的上游地址
+
+	ctx context.Context // 不为空时请求随其取消
 }
 
 // NewRegistryClient 创建新的 Registry 客户端
@@ -32,24 +47,87 @@ func NewRegistryClient(registry *models.Registry) *RegistryClient {
 	}
 
 	return &RegistryClient{
+		RegistryID: registry.ID,
+		Name:       registry.Name,
 		BaseURL:    strings.TrimSuffix(registry.URL, "/"),
 		Username:   registry.Username,
 		Password:   registry.Password,
 		HTTPClient: client,
+
+		Kind:         registry.Kind,
+		Repositories: ParseRepositoryList(registry.Repositories),
+		AuthURL:      registry.AuthURL,
+		Mirror:       registry.Mirror,
+		Upstream:     registry.Upstream,
+	}
+}
+
+// GetRegistryClient 按 ID 加载 Registry 并创建客户端
+func GetRegistryClient(id uint) (*RegistryClient, *models.Registry, error) {
+	var registry models.Registry
+	if err := config.DB.First(&registry, id).Error; err != nil {
+		return nil, nil, fmt.Errorf("registry %d not found: %w", id, err)
 	}
+	return NewRegistryClient(&registry), &registry, nil
+}
+
+// WithContext 返回绑定 ctx 的客户端副本，ctx 取消时进行中的请求随之中断
+func (c *RegistryClient) WithContext(ctx context.Context) *RegistryClient {
+	clone := *c
+	clone.ctx = ctx
+	return &clone
 }
 
 // doRequest 执行 HTTP 请求
 func (c *RegistryClient) doRequest(method, path string, headers map[string]string) (*http.Response, error) {
-	url := fmt.Sprintf("%s%s", c.BaseURL, path)
-	req, err := http.NewRequest(method, url, nil)
+	return c.doRequestURL(method, fmt.Sprintf("%s%s", c.BaseURL, path), headers, nil)
+}
+
+// context 请求使用的 ctx，未绑定时为 Background
+func (c *RegistryClient) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// doRequestURL 向完整 URL 发送带请求体的 HTTP 请求（上传会话的 Location 可能是绝对地址），镜像站拒绝写请求。
+// 返回 401 时按 WWW-Authenticate 获取令牌后重试一次，请求体需要支持 Seek 才能重试
+func (c *RegistryClient) doRequestURL(method, url string, headers map[string]string, body io.Reader) (*http.Response, error) {
+	if c.Mirror && method != "GET" && method != "HEAD" {
+		return nil, ErrMirrorReadOnly
+	}
+	url = c.normalizeURL(url)
+	scope := requestScope(method, url)
+	resp, err := c.send(method, url, headers, body, scope)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	seeker, rewindable := body.(io.Seeker)
+	if body != nil && !rewindable {
+		return resp, nil
+	}
+	if !c.reauthorize(resp.Header.Get("WWW-Authenticate"), scope) {
+		return resp, nil
+	}
+	if rewindable {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return resp, nil
+		}
+	}
+	resp.Body.Close()
+	return c.send(method, url, headers, body, scope)
+}
+
+// send 发送一次请求并记录指标
+func (c *RegistryClient) send(method, url string, headers map[string]string, body io.Reader, scope string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.context(), method, url, body)
 	if err != nil {
 		return nil, err
 	}
-
-	// 添加基本认证
-	if c.Username != "" && c.Password != "" {
-		req.SetBasicAuth(c.Username, c.Password)
+	if err := c.authorize(req, scope); err != nil {
+		return nil, err
 	}
 
 	// 添加自定义头
@@ -57,7 +135,22 @@ func (c *RegistryClient) doRequest(method, path string, headers map[string]strin
 		req.Header.Set(k, v)
 	}
 
-	return c.HTTPClient.Do(req)
+	start := time.Now()
+	resp, err := c.HTTPClient.Do(req)
+	statusCode := 0
+	if err == nil {
+		statusCode = resp.StatusCode
+	}
+	observeRegistryRequest(c.metricsLabel(), method, url, statusCode, time.Since(start))
+	return resp, err
+}
+
+// metricsLabel 指标中的 Registry 名称，未命名时使用地址
+func (c *RegistryClient) metricsLabel() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(c.BaseURL, "https://"), "http://")
 }
 
 // CheckConnection 检查连接
@@ -75,83 +168,254 @@ func (c *RegistryClient) CheckConnection() error {
 	return nil
 }
 
-// GetCatalog 获取仓库目录
+// getPaged 按 Link 响应头逐页请求列表接口，每页调用 decode
+func (c *RegistryClient) getPaged(path, what string, decode func(io.Reader) error) error {
+	url := c.BaseURL + path + "?n=1000"
+	for url != "" {
+		resp, err := c.doRequestURL("GET", url, nil, nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return &registryStatusError{What: what, StatusCode: resp.StatusCode, Body: string(body)}
+		}
+		err = decode(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		// Link: </v2/_catalog?last=xxx&n=1000>; rel="next"
+		url = ""
+		if link := resp.Header.Get("Link"); strings.Contains(link, `rel="next"`) {
+			if start, end := strings.Index(link, "<"), strings.Index(link, ">"); start >= 0 && end > start {
+				url = c.resolveLocation(link[start+1 : end])
+			}
+		}
+	}
+	return nil
+}
+
+// registryStatusError 列表接口返回的非 200 状态
+type registryStatusError struct {
+	What       string
+	StatusCode int
+	Body       string
+}
+
+func (e *registryStatusError) Error() string {
+	return fmt.Sprintf("failed to get %s: %d - %s", e.What, e.StatusCode, e.Body)
+}
+
+// GetCatalog 获取仓库目录，配置了仓库列表时直接返回该列表，否则请求 _catalog（Harbor 使用项目接口）并短暂缓存
 func (c *RegistryClient) GetCatalog() (*models.RegistryCatalog, error) {
-	resp, err := c.doRequest("GET", "/v2/_catalog", nil)
-	if err != nil {
-		return nil, err
+	if len(c.Repositories) > 0 {
+		return &models.RegistryCatalog{Repositories: append([]string(nil), c.Repositories...)}, nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to get catalog: %d - %s", resp.StatusCode, string(body))
+	key := cacheKey(c.RegistryID, "catalog", "")
+	if v, ok := registryCache.get(key); ok {
+		cached := v.(models.RegistryCatalog)
+		cached.Repositories = append([]string(nil), cached.Repositories...)
+		return &cached, nil
 	}
 
 	var catalog models.RegistryCatalog
-	if err := json.NewDecoder(resp.Body).Decode(&catalog); err != nil {
+	var err error
+	if c.IsHarbor() {
+		// Harbor 的 _catalog 需要系统管理员权限，改为按项目列出仓库
+		catalog.Repositories, err = c.harborCatalog()
+	} else {
+		err = c.getPaged("/v2/_catalog", "catalog", func(body io.Reader) error {
+			var page models.RegistryCatalog
+			if err := json.NewDecoder(body).Decode(&page); err != nil {
+				return err
+			}
+			catalog.Repositories = append(catalog.Repositories, page.Repositories...)
+			return nil
+		})
+	}
+	var status *registryStatusError
+	if errors.As(err, &status) && (status.StatusCode == http.StatusUnauthorized ||
+		status.StatusCode == http.StatusForbidden || status.StatusCode == http.StatusNotFound) {
+		return nil, fmt.Errorf("%w: %v", ErrCatalogUnavailable, err)
+	}
+	if err != nil {
 		return nil, err
 	}
 
+	registryCache.set(key, catalog)
+	catalog.Repositories = append([]string(nil), catalog.Repositories...)
 	return &catalog, nil
 }
 
-// GetTags 获取镜像标签
+// GetTags 获取镜像标签，结果会短暂缓存
 func (c *RegistryClient) GetTags(repository string) (*models.RegistryTags, error) {
-	path := fmt.Sprintf("/v2/%s/tags/list", repository)
-	resp, err := c.doRequest("GET", path, nil)
+	key := cacheKey(c.RegistryID, "tags", repository)
+	if v, ok := registryCache.get(key); ok {
+		cached := v.(models.RegistryTags)
+		cached.Tags = append([]string(nil), cached.Tags...)
+		return &cached, nil
+	}
+
+	tags := models.RegistryTags{Name: repository}
+	err := c.getPaged(fmt.Sprintf("/v2/%s/tags/list", repository), "tags", func(body io.Reader) error {
+		var page models.RegistryTags
+		if err := json.NewDecoder(body).Decode(&page); err != nil {
+			return err
+		}
+		tags.Tags = append(tags.Tags, page.Tags...)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+
+	registryCache.set(key, tags)
+	tags.Tags = append([]string(nil), tags.Tags...)
+	return &tags, nil
+}
+
+// Manifest 媒体类型
+const (
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+// manifestAccept 支持多种 manifest 格式，包括 OCI 索引和 Docker manifest list
+var manifestAccept = strings.Join([]string{
+	MediaTypeDockerManifest,
+	MediaTypeOCIManifest,
+	MediaTypeOCIIndex,
+	MediaTypeDockerManifestList,
+}, ", ")
+
+// IsManifestList 判断媒体类型是否为 manifest list / OCI index
+func IsManifestList(mediaType string) bool {
+	return mediaType == MediaTypeDockerManifestList || mediaType == MediaTypeOCIIndex
+}
+
+// fetchManifest 获取 manifest 原始内容、媒体类型和 digest
+func (c *RegistryClient) fetchManifest(repository, reference string) ([]byte, string, string, error) {
+	path := fmt.Sprintf("/v2/%s/manifests/%s", repository, reference)
+	headers := map[string]string{"Accept": manifestAccept}
+
+	resp, err := c.doRequest("GET", path, headers)
+	if err != nil {
+		return nil, "", "", err
+	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to get tags: %d - %s", resp.StatusCode, string(body))
+		return nil, "", "", fmt.Errorf("failed to get manifest: %d - %s", resp.StatusCode, string(body))
 	}
 
-	var tags models.RegistryTags
-	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
-		return nil, err
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", "", err
 	}
 
-	return &tags, nil
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	}
+
+	return body, resp.Header.Get("Content-Type"), digest, nil
 }
 
-// GetManifest 获取镜像清单
-func (c *RegistryClient) GetManifest(repository, reference string) (*models.ImageManifest, error) {
+// HeadManifest 通过 HEAD 请求获取 manifest 的 digest 和媒体类型，manifest 不存在时返回 found=false
+func (c *RegistryClient) HeadManifest(repository, reference string) (digest, mediaType string, found bool, err error) {
 	path := fmt.Sprintf("/v2/%s/manifests/%s", repository, reference)
-	// 支持多种 manifest 格式，包括 OCI 索引和 Docker manifest list
-	headers := map[string]string{
-		"Accept": "application/vnd.docker.distribution.manifest.v2+json, " +
-			"application/vnd.oci.image.manifest.v1+json, " +
-			"application/vnd.oci.image.index.v1+json, " +
-			"application/vnd.docker.distribution.manifest.list.v2+json",
+	resp, err := c.doRequest("HEAD", path, map[string]string{"Accept": manifestAccept})
+	if err != nil {
+		return "", "", false, err
 	}
+	defer resp.Body.Close()
 
-	resp, err := c.doRequest("GET", path, headers)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Header.Get("Docker-Content-Digest"), resp.Header.Get("Content-Type"), true, nil
+	case http.StatusNotFound:
+		return "", "", false, nil
+	default:
+		return "", "", false, fmt.Errorf("failed to head manifest: %d", resp.StatusCode)
+	}
+}
+
+// ResolveDigest 将 tag 解析为顶层 manifest 的 digest（多架构镜像返回 index 的 digest）
+func (c *RegistryClient) ResolveDigest(repository, reference string) (string, error) {
+	if strings.HasPrefix(reference, "sha256:") {
+		return reference, nil
+	}
+	digest, _, found, err := c.HeadManifest(repository, reference)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	defer resp.Body.Close()
+	if !found {
+		return "", fmt.Errorf("manifest %s:%s not found", repository, reference)
+	}
+	if digest == "" {
+		// 部分 Registry 的 HEAD 响应不带 digest，回退为 GET
+		_, _, digest, err = c.fetchManifest(repository, reference)
+		if err != nil {
+			return "", err
+		}
+	}
+	return digest, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to get manifest: %d - %s", resp.StatusCode, string(body))
+// GetManifestList 获取 manifest list / OCI index，引用的不是多架构镜像时返回 nil
+func (c *RegistryClient) GetManifestList(repository, reference string) (*models.ManifestList, error) {
+	body, contentType, _, err := c.fetchManifest(repository, reference)
+	if err != nil {
+		return nil, err
+	}
+	if !IsManifestList(contentType) {
+		return nil, nil
+	}
+	var manifestList models.ManifestList
+	if err := json.Unmarshal(body, &manifestList); err != nil {
+		return nil, err
 	}
+	return &manifestList, nil
+}
 
-	// 读取响应体
-	body, err := io.ReadAll(resp.Body)
+// GetRawManifest 获取原始 manifest，响应没有 Content-Type 时从内容中的 mediaType 推断
+func (c *RegistryClient) GetRawManifest(repository, reference string) (*models.RawManifest, error) {
+	body, contentType, digest, err := c.fetchManifest(repository, reference)
 	if err != nil {
 		return nil, err
 	}
 
-	contentType := resp.Header.Get("Content-Type")
-	digest := resp.Header.Get("Docker-Content-Digest")
+	contentType, _, _ = strings.Cut(contentType, ";")
+	contentType = strings.TrimSpace(contentType)
+	if contentType == "" || contentType == "application/json" || contentType == "text/plain" {
+		var probe struct {
+			MediaType string `json:"mediaType"`
+		}
+		if json.Unmarshal(body, &probe) == nil && probe.MediaType != "" {
+			contentType = probe.MediaType
+		}
+	}
+
+	return &models.RawManifest{MediaType: contentType, Digest: digest, Body: body}, nil
+}
+
+// GetManifest 获取镜像清单
+func (c *RegistryClient) GetManifest(repository, reference string) (*models.ImageManifest, error) {
+	raw, err := c.GetRawManifest(repository, reference)
+	if err != nil {
+		return nil, err
+	}
+	body, contentType, digest := raw.Body, raw.MediaType, raw.Digest
 
 	// 检查是否为 manifest list / OCI index（多架构镜像）
-	if contentType == "application/vnd.docker.distribution.manifest.list.v2+json" ||
-		contentType == "application/vnd.oci.image.index.v1+json" {
+	if IsManifestList(contentType) {
 		// 解析 manifest list
 		var manifestList models.ManifestList
 		if err := json.Unmarshal(body, &manifestList); err != nil {
@@ -175,8 +439,13 @@ func (c *RegistryClient) GetManifest(repository, reference string) (*models.Imag
 			return nil, fmt.Errorf("no suitable manifest found in manifest list")
 		}
 
-		// 递归获取具体平台的 manifest
-		return c.GetManifest(repository, selectedDigest)
+		// 递归获取具体平台的 manifest，保留 index 的原始内容
+		manifest, err := c.GetManifest(repository, selectedDigest)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Raw = raw
+		return manifest, nil
 	}
 
 	// 普通 manifest
@@ -187,6 +456,7 @@ func (c *RegistryClient) GetManifest(repository, reference string) (*models.Imag
 
 	manifest.Digest = digest
 	manifest.MediaType = contentType
+	manifest.Raw = raw
 
 	// 计算总大小
 	manifest.TotalSize = manifest.Config.Size
@@ -219,6 +489,50 @@ func (c *RegistryClient) GetImageConfig(repository string, configDigest string)
 	return &config, nil
 }
 
+// OpenBlob 打开 blob 数据流，调用方负责关闭
+func (c *RegistryClient) OpenBlob(repository, digest string) (io.ReadCloser, int64, error) {
+	path := fmt.Sprintf("/v2/%s/blobs/%s", repository, digest)
+	resp, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("failed to get blob: %d - %s", resp.StatusCode, string(body))
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
+
+// GetBlob 读取 blob 内容并校验 digest，maxSize 大于 0 时限制读取大小
+func (c *RegistryClient) GetBlob(repository, digest string, maxSize int64) ([]byte, error) {
+	body, _, err := c.OpenBlob(repository, digest)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var reader io.Reader = body
+	if maxSize > 0 {
+		reader = io.LimitReader(body, maxSize+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("blob %s exceeds size limit of %d bytes", digest, maxSize)
+	}
+
+	if strings.HasPrefix(digest, "sha256:") && fmt.Sprintf("sha256:%x", sha256.Sum256(data)) != digest {
+		return nil, fmt.Errorf("blob %s digest mismatch", digest)
+	}
+
+	return data, nil
+}
+
 // GetImageInfo 获取镜像完整信息
 func (c *RegistryClient) GetImageInfo(repository, tag string) (*models.ImageInfo, error) {
 	// 获取清单
@@ -244,6 +558,24 @@ func (c *RegistryClient) GetImageInfo(repository, tag string) (*models.ImageInfo
 	}, nil
 }
 
+// GetTagInfo 获取标签详细信息
+func (c *RegistryClient) GetTagInfo(repository, tag string) (*models.TagInfo, error) {
+	info, err := c.GetImageInfo(repository, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TagInfo{
+		Name:       tag,
+		Digest:     info.Digest,
+		OS:         info.Config.OS,
+		Arch:       info.Config.Architecture,
+		Size:       info.TotalSize,
+		LayerCount: info.LayerCount,
+		Created:    info.Config.Created,
+	}, nil
+}
+
 // DeleteManifest 删除镜像清单
 func (c *RegistryClient) DeleteManifest(repository, digest string) error {
 	path := fmt.Sprintf("/v2/%s/manifests/%s", repository, digest)
@@ -258,9 +590,34 @@ func (c *RegistryClient) DeleteManifest(repository, digest string) error {
 		return fmt.Errorf("failed to delete manifest: %d - %s", resp.StatusCode, string(body))
 	}
 
+	InvalidateRepository(c.RegistryID, repository)
+	InvalidateSignatureCache(c.RegistryID)
 	return nil
 }
 
+// PutManifest 上传 manifest 原始内容，reference 可以是 tag 或 digest，返回 Registry 计算的 digest
+func (c *RegistryClient) PutManifest(repository, reference, mediaType string, body []byte) (string, error) {
+	url := fmt.Sprintf("%s/v2/%s/manifests/%s", c.BaseURL, repository, reference)
+	resp, err := c.doRequestURL("PUT", url, map[string]string{"Content-Type": mediaType}, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to put manifest: %d - %s", resp.StatusCode, string(respBody))
+	}
+	InvalidateRepository(c.RegistryID, repository)
+	InvalidateSignatureCache(c.RegistryID)
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	}
+	return digest, nil
+}
+
 // GetRepositoryInfo 获取仓库信息
 func (c *RegistryClient) GetRepositoryInfo(repository string) (*models.RepositoryInfo, error) {
 	tags, err := c.GetTags(repository)
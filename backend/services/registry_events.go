@@ -0,0 +1,134 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// isManifestMediaType 判断通知目标是否为 manifest 或索引，blob 层的推送和拉取不记录
+func isManifestMediaType(mediaType string) bool {
+	return strings.Contains(mediaType, "manifest") || strings.Contains(mediaType, "index")
+}
+
+// HandleRegistryNotification 记录 Registry 通知中的 manifest 事件，推送和删除时清除缓存，
+// 并更新软件包清单与镜像的关联（标签指向新的 digest，或 digest 已被删除）
+func HandleRegistryNotification(registryID uint, notification *models.RegistryNotification) (*models.NotificationResult, error) {
+	result := &models.NotificationResult{Received: len(notification.Events)}
+	for _, e := range notification.Events {
+		target := e.Target
+		// 删除事件没有媒体类型，其余动作只保留 manifest 事件
+		if e.ID == "" || target.Repository == "" ||
+			(e.Action != models.EventActionDelete && !isManifestMediaType(target.MediaType)) {
+			result.Ignored++
+			continue
+		}
+
+		timestamp := e.Timestamp
+		if timestamp.IsZero() {
+			timestamp = time.Now()
+		}
+		event := models.RegistryEvent{
+			RegistryID: registryID,
+			EventID:    e.ID,
+			Action:     e.Action,
+			Repository: target.Repository,
+			Tag:        target.Tag,
+			Digest:     target.Digest,
+			MediaType:  target.MediaType,
+			Size:       target.Size,
+			Actor:      e.Actor.Name,
+			SourceAddr: e.Request.Addr,
+			UserAgent:  e.Request.UserAgent,
+			Timestamp:  timestamp,
+		}
+		tx := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&event)
+		if tx.Error != nil {
+			return result, tx.Error
+		}
+		if tx.RowsAffected == 0 {
+			result.Ignored++
+			continue
+		}
+		result.Stored++
+
+		switch e.Action {
+		case models.EventActionPush:
+			InvalidateRepository(registryID, target.Repository)
+			// 推送的可能是签名
+			InvalidateSignatureCache(registryID)
+			if target.Tag != "" {
+				config.DB.Where("registry_id = ? AND repository = ? AND tag = ? AND tag_digest <> ?",
+					registryID, target.Repository, target.Tag, target.Digest).Delete(&models.InventoryImage{})
+				if err := RecordTagChange(registryID, target.Repository, target.Tag, target.Digest, models.TagSourceWebhook, e.Actor.Name, timestamp); err != nil {
+					return result, err
+				}
+			}
+			config.DB.Model(&models.CatalogRepository{}).
+				Where("registry_id = ? AND name = ? AND (last_pushed IS NULL OR last_pushed < ?)", registryID, target.Repository, timestamp).
+				Update("last_pushed", timestamp)
+			markRepositoryStale(registryID, target.Repository)
+		case models.EventActionDelete:
+			InvalidateRepository(registryID, target.Repository)
+			unlink := config.DB.Where("registry_id = ? AND repository = ?", registryID, target.Repository)
+			if target.Tag != "" {
+				unlink = unlink.Where("tag = ?", target.Tag)
+				if err := RecordTagChange(registryID, target.Repository, target.Tag, "", models.TagSourceWebhook, e.Actor.Name, timestamp); err != nil {
+					return result, err
+				}
+			} else {
+				unlink = unlink.Where("digest = ?", target.Digest)
+			}
+			unlink.Delete(&models.InventoryImage{})
+			markRepositoryStale(registryID, target.Repository)
+		}
+	}
+	return result, nil
+}
+
+// ListRegistryEvents 按时间倒序列出 Registry 的事件，repository 和 action 为空时不过滤
+func ListRegistryEvents(registryID uint, repository, action string, page, pageSize int) ([]models.RegistryEvent, int64, error) {
+	query := config.DB.Model(&models.RegistryEvent{}).Where("registry_id = ?", registryID)
+	if repository != "" {
+		query = query.Where("repository = ?", repository)
+	}
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	events := []models.RegistryEvent{}
+	err := query.Order("timestamp DESC, id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&events).Error
+	return events, total, err
+}
+
+// LatestPushEvents 返回仓库中各标签最近一次推送事件，tag -> 事件
+func LatestPushEvents(registryID uint, repository string, tags []string) map[string]models.RegistryEvent {
+	pushes := map[string]models.RegistryEvent{}
+	if len(tags) == 0 {
+		return pushes
+	}
+	var events []models.RegistryEvent
+	err := config.DB.Where("registry_id = ? AND repository = ? AND action = ? AND tag IN ?",
+		registryID, repository, models.EventActionPush, tags).
+		Order("timestamp ASC").Find(&events).Error
+	if err != nil {
+		return pushes
+	}
+	for _, event := range events {
+		pushes[event.Tag] = event
+	}
+	return pushes
+}
+
+// markRepositoryStale 标记仓库在下次增量爬取时刷新搜索索引和元数据
+func markRepositoryStale(registryID uint, repository string) {
+	config.DB.Model(&models.CatalogRepository{}).Where("registry_id = ? AND name = ?", registryID, repository).Update("stale", true)
+}
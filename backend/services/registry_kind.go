@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"dgui/models"
+)
+
+// ErrCatalogUnavailable Registry 不提供 _catalog 且没有手动配置仓库列表
+var ErrCatalogUnavailable = errors.New("registry does not provide a catalog, configure its repository list")
+
+// registryDefaultURLs 托管 Registry 的默认地址
+var registryDefaultURLs = map[string]string{
+	models.RegistryKindDistribution: "",
+	models.RegistryKindDockerHub:    models.DockerHubURL,
+	models.RegistryKindGHCR:         "https://ghcr.io",
+	models.RegistryKindECR:          "",
+	models.RegistryKindHosted:       "",
+	models.RegistryKindHarbor:       "",
+}
+
+// NormalizeRegistry 校验 Registry 类型，补全默认地址和镜像站的上游，并整理手动配置的仓库列表
+func NormalizeRegistry(registry *models.Registry) error {
+	if registry.Kind == "" {
+		registry.Kind = models.RegistryKindDistribution
+	}
+	defaultURL, ok := registryDefaultURLs[registry.Kind]
+	if !ok {
+		return fmt.Errorf("unknown registry kind %q", registry.Kind)
+	}
+	if registry.URL == "" {
+		registry.URL = defaultURL
+	}
+	if registry.URL == "" {
+		return errors.New("url is required")
+	}
+	registry.Repositories = strings.Join(ParseRepositoryList(registry.Repositories), "\n")
+	registry.Upstream = strings.TrimSuffix(strings.TrimSpace(registry.Upstream), "/")
+	if !registry.Mirror {
+		registry.Upstream = ""
+	} else if registry.Upstream == "" {
+		registry.Upstream = models.DockerHubURL
+	}
+	return nil
+}
+
+// ParseRepositoryList 解析按行、逗号或空白分隔的仓库列表，去重并排序
+func ParseRepositoryList(s string) []string {
+	seen := map[string]bool{}
+	repos := []string{}
+	for _, repo := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	}) {
+		repo = strings.Trim(repo, "/")
+		if repo != "" && !seen[repo] {
+			seen[repo] = true
+			repos = append(repos, repo)
+		}
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+// repositoryPathKinds 仓库名之后的 API 路径
+var repositoryPathKinds = []string{"/manifests/", "/blobs/", "/tags/list", "/referrers/"}
+
+// splitRepositoryPath 从 /v2/<name>/manifests/... 形式的路径中取出仓库名，
+// 返回 /v2/ 之前的前缀、仓库名和之后的部分；不是仓库接口时 ok 为 false
+func splitRepositoryPath(path string) (prefix, name, rest string, ok bool) {
+	i := strings.Index(path, "/v2/")
+	if i < 0 {
+		return "", "", "", false
+	}
+	prefix, tail := path[:i+len("/v2/")], path[i+len("/v2/"):]
+	best := -1
+	for _, kind := range repositoryPathKinds {
+		if j := strings.Index(tail, kind); j > 0 && (best < 0 || j < best) {
+			best = j
+		}
+	}
+	if best < 0 {
+		return "", "", "", false
+	}
+	return prefix, tail[:best], tail[best:], true
+}
+
+// normalizeURL 按 Registry 类型改写请求地址：Docker Hub 及其镜像站中的官方镜像需要 library/ 前缀
+func (c *RegistryClient) normalizeURL(rawURL string) string {
+	if c.Kind != models.RegistryKindDockerHub && !c.mirrorsDockerHub() {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	prefix, name, rest, ok := splitRepositoryPath(u.Path)
+	if !ok || strings.Contains(name, "/") {
+		return rawURL
+	}
+	u.Path = prefix + "library/" + name + rest
+	return u.String()
+}
+
+// requestScope 请求需要的 token 权限范围，如 repository:team/app:pull
+func requestScope(method, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	if strings.HasSuffix(u.Path, "/v2/_catalog") {
+		return "registry:catalog:*"
+	}
+	_, name, _, ok := splitRepositoryPath(u.Path)
+	if !ok {
+		return ""
+	}
+	switch method {
+	case "GET", "HEAD":
+		return "repository:" + name + ":pull"
+	case "DELETE":
+		return "repository:" + name + ":delete"
+	default:
+		return "repository:" + name + ":pull,push"
+	}
+}
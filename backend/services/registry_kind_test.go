@@ -0,0 +1,58 @@
+package services
+
+import (
+	"testing"
+
+	"dgui/models"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	dockerHub := NewRegistryClient(&models.Registry{Kind: models.RegistryKindDockerHub, URL: models.DockerHubURL})
+	mirror := NewRegistryClient(&models.Registry{URL: "https://mirror.example.com", Mirror: true, Upstream: "https://registry-1.docker.io"})
+	otherMirror := NewRegistryClient(&models.Registry{URL: "https://mirror.example.com", Mirror: true, Upstream: "https://ghcr.io"})
+	distribution := NewRegistryClient(&models.Registry{URL: "https://registry.example.com"})
+
+	tests := []struct {
+		name   string
+		client *RegistryClient
+		url    string
+		want   string
+	}{
+		{"official image", dockerHub, "https://registry-1.docker.io/v2/nginx/manifests/latest", "https://registry-1.docker.io/v2/library/nginx/manifests/latest"},
+		{"official image tags", dockerHub, "https://registry-1.docker.io/v2/redis/tags/list?n=1000", "https://registry-1.docker.io/v2/library/redis/tags/list?n=1000"},
+		{"official image blob", dockerHub, "https://registry-1.docker.io/v2/nginx/blobs/sha256:abc", "https://registry-1.docker.io/v2/library/nginx/blobs/sha256:abc"},
+		{"namespaced image", dockerHub, "https://registry-1.docker.io/v2/bitnami/redis/manifests/7", "https://registry-1.docker.io/v2/bitnami/redis/manifests/7"},
+		{"already prefixed", dockerHub, "https://registry-1.docker.io/v2/library/nginx/manifests/latest", "https://registry-1.docker.io/v2/library/nginx/manifests/latest"},
+		{"catalog", dockerHub, "https://registry-1.docker.io/v2/_catalog", "https://registry-1.docker.io/v2/_catalog"},
+		{"ping", dockerHub, "https://registry-1.docker.io/v2/", "https://registry-1.docker.io/v2/"},
+		{"docker hub mirror", mirror, "https://mirror.example.com/v2/alpine/manifests/3", "https://mirror.example.com/v2/library/alpine/manifests/3"},
+		{"other mirror", otherMirror, "https://mirror.example.com/v2/alpine/manifests/3", "https://mirror.example.com/v2/alpine/manifests/3"},
+		{"distribution", distribution, "https://registry.example.com/v2/app/manifests/v1", "https://registry.example.com/v2/app/manifests/v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.client.normalizeURL(tt.url); got != tt.want {
+				t.Errorf("normalizeURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestScope(t *testing.T) {
+	tests := []struct {
+		method, url, want string
+	}{
+		{"GET", "https://r.example.com/v2/team/app/manifests/v1", "repository:team/app:pull"},
+		{"HEAD", "https://r.example.com/v2/app/blobs/sha256:abc", "repository:app:pull"},
+		{"DELETE", "https://r.example.com/v2/app/manifests/sha256:abc", "repository:app:delete"},
+		{"PUT", "https://r.example.com/v2/app/manifests/v1", "repository:app:pull,push"},
+		{"POST", "https://r.example.com/v2/app/blobs/uploads/", "repository:app:pull,push"},
+		{"GET", "https://r.example.com/v2/_catalog?n=1000", "registry:catalog:*"},
+		{"GET", "https://r.example.com/v2/", ""},
+	}
+	for _, tt := range tests {
+		if got := requestScope(tt.method, tt.url); got != tt.want {
+			t.Errorf("requestScope(%s %s) = %q, want %q", tt.method, tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"fmt"
+
+	"dgui/models"
+)
+
+// TagConflictError 标签已指向其他镜像，或与期望的 digest 不一致
+type TagConflictError struct {
+	Tag           string
+	CurrentDigest string
+}
+
+func (e *TagConflictError) Error() string {
+	return fmt.Sprintf("tag %s already points to %s", e.Tag, e.CurrentDigest)
+}
+
+// RetagImage 将源镜像的原始 manifest 以新标签重新上传，不需要重新推送镜像层。
+// 标签已指向其他镜像时需要 force；expectedDigest 不为空时要求标签当前指向该 digest（"none" 表示标签不存在）
+func RetagImage(client *RegistryClient, repository, source, tag string, force bool, expectedDigest string) (*models.RetagResult, error) {
+	manifest, err := client.GetManifest(repository, source)
+	if err != nil {
+		return nil, err
+	}
+	raw := manifest.Raw
+
+	current, _, found, err := client.HeadManifest(repository, tag)
+	if err != nil {
+		return nil, err
+	}
+	if found && current == "" {
+		if current, err = client.ResolveDigest(repository, tag); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case expectedDigest == "none" && found:
+		return nil, &TagConflictError{Tag: tag, CurrentDigest: current}
+	case expectedDigest != "" && expectedDigest != "none" && current != expectedDigest:
+		return nil, &TagConflictError{Tag: tag, CurrentDigest: current}
+	case found && current != raw.Digest && !force && expectedDigest == "":
+		return nil, &TagConflictError{Tag: tag, CurrentDigest: current}
+	}
+
+	result := &models.RetagResult{Repo: repository, Tag: tag, Digest: raw.Digest}
+	if found && current != raw.Digest {
+		result.PreviousDigest = current
+		result.Moved = true
+	}
+	if found && current == raw.Digest {
+		return result, nil
+	}
+
+	digest, err := client.PutManifest(repository, tag, raw.MediaType, raw.Body)
+	if err != nil {
+		return nil, err
+	}
+	if digest != raw.Digest {
+		return nil, fmt.Errorf("registry stored manifest as %s, expected %s", digest, raw.Digest)
+	}
+	return result, nil
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"dgui/models"
+)
+
+// RPM header 中使用的标签
+const (
+	rpmTagName    = 1000
+	rpmTagVersion = 1001
+	rpmTagRelease = 1002
+	rpmTagEpoch   = 1003
+	rpmTagLicense = 1014
+	rpmTagArch    = 1022
+	rpmTagSource  = 1044
+)
+
+// RPM header 中的数据类型
+const (
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// rpmHeader 解析后的 RPM header
+type rpmHeader struct {
+	strings map[int32]string
+	ints    map[int32]int32
+}
+
+// parseRpmHeader 解析 rpmdb 中存储的 header blob（不含 magic 前缀）
+func parseRpmHeader(blob []byte) (*rpmHeader, error) {
+	if len(blob) < 8 {
+		return nil, errors.New("rpm header too short")
+	}
+	indexCount := int(binary.BigEndian.Uint32(blob[0:4]))
+	dataLength := int(binary.BigEndian.Uint32(blob[4:8]))
+	dataStart := 8 + indexCount*16
+	if indexCount <= 0 || dataLength < 0 || dataStart+dataLength > len(blob) {
+		return nil, errors.New("invalid rpm header")
+	}
+	data := blob[dataStart : dataStart+dataLength]
+
+	h := &rpmHeader{strings: map[int32]string{}, ints: map[int32]int32{}}
+	for i := 0; i < indexCount; i++ {
+		entry := blob[8+i*16 : 8+(i+1)*16]
+		tag := int32(binary.BigEndian.Uint32(entry[0:4]))
+		typ := binary.BigEndian.Uint32(entry[4:8])
+		offset := int(int32(binary.BigEndian.Uint32(entry[8:12])))
+		if offset < 0 || offset >= len(data) {
+			continue
+		}
+		switch typ {
+		case rpmTypeString, rpmTypeI18NString, rpmTypeStringArray:
+			// 数组类型只取第一个值
+			end := bytes.IndexByte(data[offset:], 0)
+			if end < 0 {
+				continue
+			}
+			h.strings[tag] = string(data[offset : offset+end])
+		case rpmTypeInt32:
+			if offset+4 <= len(data) {
+				h.ints[tag] = int32(binary.BigEndian.Uint32(data[offset : offset+4]))
+			}
+		}
+	}
+	return h, nil
+}
+
+// parseRpmSQLite 解析 sqlite 格式的 rpmdb（RHEL 9、Fedora 33+ 等）
+func parseRpmSQLite(data []byte, distroID, distroQualifier string) ([]models.InventoryPackage, error) {
+	tmp, err := os.CreateTemp("", "dgui-rpmdb-*.sqlite")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	tmp.Close()
+
+	db, err := gorm.Open(sqlite.Open(tmp.Name()), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	defer sqlDB.Close()
+
+	rows, err := db.Raw("SELECT blob FROM Packages").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blobs [][]byte
+	for rows.Next() {
+		var blob []byte
+		if err := rows.Scan(&blob); err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, blob)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if distroID == "" {
+		distroID = "redhat"
+	}
+
+	var packages []models.InventoryPackage
+	for _, blob := range blobs {
+		h, err := parseRpmHeader(blob)
+		if err != nil {
+			continue
+		}
+		name := h.strings[rpmTagName]
+		// gpg-pubkey 是导入的公钥，不是软件包
+		if name == "" || name == "gpg-pubkey" {
+			continue
+		}
+		version := h.strings[rpmTagVersion]
+		if release := h.strings[rpmTagRelease]; release != "" {
+			version += "-" + release
+		}
+		epoch := ""
+		if e, ok := h.ints[rpmTagEpoch]; ok && e > 0 {
+			epoch = fmt.Sprint(e)
+		}
+		fullVersion := version
+		if epoch != "" {
+			fullVersion = epoch + ":" + version
+		}
+		packages = append(packages, models.InventoryPackage{
+			Name:    name,
+			Version: fullVersion,
+			Type:    "rpm",
+			License: h.strings[rpmTagLicense],
+			PURL: withQualifiers(fmt.Sprintf("pkg:rpm/%s/%s@%s", distroID, name, version),
+				"arch", h.strings[rpmTagArch], "epoch", epoch, "upstream", rpmSourceName(h.strings[rpmTagSource], name), "distro", distroQualifier),
+		})
+	}
+	return packages, nil
+}
+
+// rpmSourceName 从源码包文件名（如 bash-5.1.8-6.el9.src.rpm）中提取源码包名称，与包名相同时返回空
+func rpmSourceName(srpm, name string) string {
+	srpm = strings.TrimSuffix(srpm, ".src.rpm")
+	for i := 0; i < 2; i++ {
+		idx := strings.LastIndex(srpm, "-")
+		if idx <= 0 {
+			return ""
+		}
+		srpm = srpm[:idx]
+	}
+	if srpm == name {
+		return ""
+	}
+	return srpm
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"dgui/models"
+)
+
+// buildRpmHeader 构造 rpmdb 中存储的 header blob，值为 string 或 int32
+func buildRpmHeader(tags map[int32]interface{}) []byte {
+	var index, data bytes.Buffer
+	for tag, value := range tags {
+		var typ uint32
+		offset := data.Len()
+		switch v := value.(type) {
+		case string:
+			typ = rpmTypeString
+			data.WriteString(v)
+			data.WriteByte(0)
+		case int32:
+			// int32 需要 4 字节对齐
+			for data.Len()%4 != 0 {
+				data.WriteByte(0)
+			}
+			offset = data.Len()
+			typ = rpmTypeInt32
+			binary.Write(&data, binary.BigEndian, v)
+		}
+		binary.Write(&index, binary.BigEndian, []uint32{uint32(tag), typ, uint32(offset), 1})
+	}
+	var blob bytes.Buffer
+	binary.Write(&blob, binary.BigEndian, []uint32{uint32(len(tags)), uint32(data.Len())})
+	blob.Write(index.Bytes())
+	blob.Write(data.Bytes())
+	return blob.Bytes()
+}
+
+func TestParseRpmHeader(t *testing.T) {
+	h, err := parseRpmHeader(buildRpmHeader(map[int32]interface{}{
+		rpmTagName:  "bash",
+		rpmTagEpoch: int32(1),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.strings[rpmTagName] != "bash" || h.ints[rpmTagEpoch] != 1 {
+		t.Errorf("parseRpmHeader = %+v", h)
+	}
+
+	for _, blob := range [][]byte{nil, {0, 0, 0, 1}, {0, 0, 0, 9, 0, 0, 0, 0}} {
+		if _, err := parseRpmHeader(blob); err == nil {
+			t.Errorf("parseRpmHeader(%v) succeeded, want error", blob)
+		}
+	}
+}
+
+func TestParseRpmSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rpmdb.sqlite")
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqlDB.Exec("CREATE TABLE Packages (hnum INTEGER PRIMARY KEY AUTOINCREMENT, blob BLOB NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	headers := []map[int32]interface{}{
+		{
+			rpmTagName: "bash", rpmTagVersion: "5.1.8", rpmTagRelease: "6.el9", rpmTagArch: "x86_64",
+			rpmTagLicense: "GPLv3+", rpmTagSource: "bash-5.1.8-6.el9.src.rpm",
+		},
+		{
+			rpmTagName: "openssl-libs", rpmTagVersion: "3.0.7", rpmTagRelease: "24.el9", rpmTagEpoch: int32(1),
+			rpmTagArch: "x86_64", rpmTagLicense: "ASL 2.0", rpmTagSource: "openssl-3.0.7-24.el9.src.rpm",
+		},
+		{rpmTagName: "gpg-pubkey", rpmTagVersion: "fd431d51", rpmTagRelease: "4ae0493b"},
+	}
+	for _, h := range headers {
+		if _, err := sqlDB.Exec("INSERT INTO Packages (blob) VALUES (?)", buildRpmHeader(h)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 损坏的 header 会被跳过
+	if _, err := sqlDB.Exec("INSERT INTO Packages (blob) VALUES (?)", []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packages, err := parseRpmSQLite(data, "rocky", "rocky-9.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPackages(t, packages, []models.InventoryPackage{
+		{Name: "bash", Version: "5.1.8-6.el9", Type: "rpm", License: "GPLv3+", PURL: "pkg:rpm/rocky/bash@5.1.8-6.el9?arch=x86_64&distro=rocky-9.3"},
+		{Name: "openssl-libs", Version: "1:3.0.7-24.el9", Type: "rpm", License: "ASL 2.0", PURL: "pkg:rpm/rocky/openssl-libs@3.0.7-24.el9?arch=x86_64&epoch=1&upstream=openssl&distro=rocky-9.3"},
+	})
+
+	if _, err := parseRpmSQLite([]byte("not a database"), "", ""); err == nil {
+		t.Error("parseRpmSQLite succeeded on invalid data, want error")
+	}
+}
@@ -0,0 +1,550 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// SBOM 文档的最大读取大小
+const maxSBOMSize = 64 << 20
+
+// in-toto attestation 层上记录 predicate 类型的注解
+const annotationInTotoPredicateType = "in-toto.io/predicate-type"
+
+// ErrNoSBOM 镜像没有附带可解析的 SBOM
+var ErrNoSBOM = errors.New("no SBOM attached to image")
+
+// PackageURL 解析后的 purl
+type PackageURL struct {
+	Type       string
+	Namespace  string
+	Name       string
+	Version    string
+	Qualifiers map[string]string
+}
+
+// ParsePURL 解析 pkg:type/namespace/name@version?qualifiers#subpath 格式的 purl
+func ParsePURL(s string) (*PackageURL, error) {
+	rest, ok := strings.CutPrefix(s, "pkg:")
+	if !ok {
+		return nil, fmt.Errorf("invalid purl %q", s)
+	}
+	rest, _, _ = strings.Cut(rest, "#")
+
+	p := &PackageURL{Qualifiers: map[string]string{}}
+	rest, query, _ := strings.Cut(rest, "?")
+	if query != "" {
+		values, err := url.ParseQuery(query)
+		if err == nil {
+			for k, v := range values {
+				p.Qualifiers[strings.ToLower(k)] = v[0]
+			}
+		}
+	}
+
+	typ, rest, found := strings.Cut(rest, "/")
+	if !found || typ == "" {
+		return nil, fmt.Errorf("invalid purl %q", s)
+	}
+	p.Type = strings.ToLower(typ)
+
+	if idx := strings.LastIndex(rest, "@"); idx >= 0 {
+		p.Version, _ = url.PathUnescape(rest[idx+1:])
+		rest = rest[:idx]
+	}
+
+	rest = strings.Trim(rest, "/")
+	if idx := strings.LastIndex(rest, "/"); idx >= 0 {
+		p.Namespace, _ = url.PathUnescape(rest[:idx])
+		rest = rest[idx+1:]
+	}
+	p.Name, _ = url.PathUnescape(rest)
+
+	return p, nil
+}
+
+// distroFromPURL 从 purl 的 distro 限定符推断发行版，如 debian-12 -> debian:12
+func distroFromPURL(p *PackageURL) string {
+	distro := p.Qualifiers["distro"]
+	if distro == "" {
+		return ""
+	}
+	if name, version, found := strings.Cut(distro, "-"); found {
+		return strings.ToLower(name) + ":" + version
+	}
+	if p.Namespace != "" {
+		return strings.ToLower(p.Namespace) + ":" + distro
+	}
+	return distro
+}
+
+// ParsedSBOM 解析后的 SBOM
+type ParsedSBOM struct {
+	Format   string
+	Distro   string
+	Packages []models.InventoryPackage
+}
+
+// ParseSBOM 解析 SPDX / CycloneDX JSON 文档，支持 in-toto statement 和 DSSE envelope 包装
+func ParseSBOM(data []byte) (*ParsedSBOM, error) {
+	var probe struct {
+		SPDXVersion string          `json:"spdxVersion"`
+		BOMFormat   string          `json:"bomFormat"`
+		Type        string          `json:"_type"`
+		Predicate   json.RawMessage `json:"predicate"`
+		PayloadType string          `json:"payloadType"`
+		Payload     string          `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("invalid SBOM document: %v", err)
+	}
+
+	switch {
+	case probe.SPDXVersion != "":
+		return parseSPDX(data)
+	case strings.EqualFold(probe.BOMFormat, "CycloneDX"):
+		return parseCycloneDX(data)
+	case probe.Predicate != nil:
+		// in-toto statement，predicate 即 SBOM 文档
+		return ParseSBOM(probe.Predicate)
+	case probe.Payload != "":
+		// DSSE envelope，payload 为 base64 编码的 in-toto statement
+		payload, err := base64.StdEncoding.DecodeString(probe.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DSSE payload: %v", err)
+		}
+		return ParseSBOM(payload)
+	}
+
+	return nil, errors.New("unsupported SBOM format")
+}
+
+// parseSPDX 解析 SPDX JSON
+func parseSPDX(data []byte) (*ParsedSBOM, error) {
+	var doc struct {
+		Packages []struct {
+			Name             string `json:"name"`
+			VersionInfo      string `json:"versionInfo"`
+			LicenseConcluded string `json:"licenseConcluded"`
+			LicenseDeclared  string `json:"licenseDeclared"`
+			PrimaryPurpose   string `json:"primaryPackagePurpose"`
+			ExternalRefs     []struct {
+				ReferenceCategory string `json:"referenceCategory"`
+				ReferenceType     string `json:"referenceType"`
+				ReferenceLocator  string `json:"referenceLocator"`
+			} `json:"externalRefs"`
+		} `json:"packages"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid SPDX document: %v", err)
+	}
+
+	result := &ParsedSBOM{Format: "spdx"}
+	for _, p := range doc.Packages {
+		if p.Name == "" {
+			continue
+		}
+		pkg := models.InventoryPackage{
+			Name:    p.Name,
+			Version: p.VersionInfo,
+			License: spdxLicense(p.LicenseConcluded),
+		}
+		if pkg.License == "" {
+			pkg.License = spdxLicense(p.LicenseDeclared)
+		}
+		for _, ref := range p.ExternalRefs {
+			if ref.ReferenceType == "purl" {
+				pkg.PURL = ref.ReferenceLocator
+				break
+			}
+		}
+		if !applyPURL(&pkg, result) && strings.EqualFold(p.PrimaryPurpose, "OPERATING-SYSTEM") {
+			result.Distro = strings.ToLower(p.Name) + ":" + p.VersionInfo
+			continue
+		}
+		result.Packages = append(result.Packages, pkg)
+	}
+
+	return result, nil
+}
+
+// spdxLicense 过滤 SPDX 中表示未知的许可证值
+func spdxLicense(license string) string {
+	if license == "NOASSERTION" || license == "NONE" {
+		return ""
+	}
+	return license
+}
+
+// cyclonedxComponent CycloneDX 组件
+type cyclonedxComponent struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	PURL     string `json:"purl"`
+	Licenses []struct {
+		License struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"license"`
+		Expression string `json:"expression"`
+	} `json:"licenses"`
+	Components []cyclonedxComponent `json:"components"`
+}
+
+// parseCycloneDX 解析 CycloneDX JSON
+func parseCycloneDX(data []byte) (*ParsedSBOM, error) {
+	var doc struct {
+		Components []cyclonedxComponent `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid CycloneDX document: %v", err)
+	}
+
+	result := &ParsedSBOM{Format: "cyclonedx"}
+	var walk func(components []cyclonedxComponent)
+	walk = func(components []cyclonedxComponent) {
+		for _, comp := range components {
+			walk(comp.Components)
+			if comp.Type == "operating-system" {
+				result.Distro = strings.ToLower(comp.Name) + ":" + comp.Version
+				continue
+			}
+			if comp.Name == "" {
+				continue
+			}
+			pkg := models.InventoryPackage{
+				Name:    comp.Name,
+				Version: comp.Version,
+				PURL:    comp.PURL,
+				Type:    comp.Type,
+			}
+			if comp.Group != "" {
+				pkg.Name = comp.Group + "/" + comp.Name
+			}
+			var licenses []string
+			for _, l := range comp.Licenses {
+				switch {
+				case l.Expression != "":
+					licenses = append(licenses, l.Expression)
+				case l.License.ID != "":
+					licenses = append(licenses, l.License.ID)
+				case l.License.Name != "":
+					licenses = append(licenses, l.License.Name)
+				}
+			}
+			pkg.License = strings.Join(licenses, ", ")
+			applyPURL(&pkg, result)
+			result.Packages = append(result.Packages, pkg)
+		}
+	}
+	walk(doc.Components)
+
+	return result, nil
+}
+
+// applyPURL 根据 purl 补全软件包类型和发行版信息
+func applyPURL(pkg *models.InventoryPackage, result *ParsedSBOM) bool {
+	if pkg.PURL == "" {
+		return false
+	}
+	p, err := ParsePURL(pkg.PURL)
+	if err != nil {
+		return false
+	}
+	pkg.Type = p.Type
+	if result.Distro == "" {
+		result.Distro = distroFromPURL(p)
+	}
+	return true
+}
+
+// findSBOM 查找并读取镜像附带的 SBOM，返回文档内容和 SBOM manifest 的 digest
+func (c *RegistryClient) findSBOM(repository, digest string) ([]byte, string, error) {
+	referrers, err := c.GetImageReferrers(repository, digest, "")
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, ref := range referrers.Referrers {
+		isAttestation := ref.Source == models.ReferrerSourceIndex
+		if ref.Category != models.ArtifactCategorySBOM && !isAttestation {
+			continue
+		}
+		manifest, err := c.getArtifactManifest(repository, ref.Digest)
+		if err != nil {
+			continue
+		}
+		for _, layer := range manifest.Layers {
+			if isAttestation {
+				// BuildKit 的 attestation 中只取 SBOM 类型的 predicate
+				predicate := strings.ToLower(layer.Annotations[annotationInTotoPredicateType])
+				if !strings.Contains(predicate, "spdx") && !strings.Contains(predicate, "cyclonedx") {
+					continue
+				}
+			}
+			data, err := c.GetBlob(repository, layer.Digest, maxSBOMSize)
+			if err != nil {
+				continue
+			}
+			return data, ref.Digest, nil
+		}
+	}
+
+	// 部分来源查询失败时不能断定没有 SBOM
+	if len(referrers.Warnings) > 0 {
+		return nil, "", fmt.Errorf("failed to look up SBOM referrers: %s", strings.Join(referrers.Warnings, "; "))
+	}
+	return nil, "", ErrNoSBOM
+}
+
+// IndexImageSBOM 解析镜像附带的 SBOM 并保存为软件包清单，已有清单且 refresh 为 false 时直接复用
+func IndexImageSBOM(client *RegistryClient, registryID uint, repository, reference string, refresh bool) (*models.PackageInventory, error) {
+	digest, err := client.ResolveDigest(repository, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	if !refresh {
+		var existing models.PackageInventory
+		err := config.DB.Where("digest = ? AND source = ?", digest, models.InventorySourceSBOM).First(&existing).Error
+		if err == nil {
+			return &existing, LinkInventoryImage(registryID, repository, reference, digest, digest)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	data, sbomDigest, err := client.findSBOM(repository, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := ParseSBOM(data)
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := &models.PackageInventory{
+		Digest:     digest,
+		Source:     models.InventorySourceSBOM,
+		Format:     parsed.Format,
+		SBOMDigest: sbomDigest,
+		Distro:     parsed.Distro,
+	}
+	if err := SaveInventory(inventory, parsed.Packages); err != nil {
+		return nil, err
+	}
+
+	return inventory, LinkInventoryImage(registryID, repository, reference, digest, digest)
+}
+
+// GetImageInventory 获取镜像的软件包清单：source 为 sbom 或 detected 时只使用对应来源，
+// 为空时优先使用附带的 SBOM，没有 SBOM 时从镜像层内容检测
+func GetImageInventory(client *RegistryClient, registryID uint, repository, reference, source string, refresh bool) (*models.PackageInventory, error) {
+	switch source {
+	case models.InventorySourceSBOM:
+		return IndexImageSBOM(client, registryID, repository, reference, refresh)
+	case models.InventorySourceDetected:
+		return DetectImagePackages(client, registryID, repository, reference, refresh)
+	}
+
+	inventory, err := IndexImageSBOM(client, registryID, repository, reference, refresh)
+	if errors.Is(err, ErrNoSBOM) {
+		return DetectImagePackages(client, registryID, repository, reference, refresh)
+	}
+	return inventory, err
+}
+
+// SaveInventory 保存软件包清单，替换同一 digest 和来源的旧数据
+func SaveInventory(inventory *models.PackageInventory, packages []models.InventoryPackage) error {
+	inventory.PackageCount = len(packages)
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var existing models.PackageInventory
+		err := tx.Where("digest = ? AND source = ?", inventory.Digest, inventory.Source).First(&existing).Error
+		switch {
+		case err == nil:
+			inventory.ID = existing.ID
+			inventory.CreatedAt = existing.CreatedAt
+			if err := tx.Where("inventory_id = ?", existing.ID).Delete(&models.InventoryPackage{}).Error; err != nil {
+				return err
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		if err := tx.Save(inventory).Error; err != nil {
+			return err
+		}
+
+		for i := range packages {
+			packages[i].ID = 0
+			packages[i].InventoryID = inventory.ID
+		}
+		if len(packages) > 0 {
+			if err := tx.CreateInBatches(packages, 500).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// LinkInventoryImage 记录镜像标签与清单 digest 的对应关系，引用本身是 digest 时不记录。
+// tagDigest 为标签当前指向的 digest，多架构镜像的 SBOM 清单按 index 记录、检测的清单按平台记录，
+// 一个标签可以同时对应两者
+func LinkInventoryImage(registryID uint, repository, tag, tagDigest, digest string) error {
+	if strings.HasPrefix(tag, "sha256:") {
+		return nil
+	}
+	// 标签指向新的 digest 时移除旧的对应关系
+	if err := config.DB.Where("registry_id = ? AND repository = ? AND tag = ? AND tag_digest <> ?",
+		registryID, repository, tag, tagDigest).Delete(&models.InventoryImage{}).Error; err != nil {
+		return err
+	}
+	image := models.InventoryImage{
+		RegistryID: registryID,
+		Repository: repository,
+		Tag:        tag,
+		Digest:     digest,
+		TagDigest:  tagDigest,
+	}
+	return config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "registry_id"}, {Name: "repository"}, {Name: "tag"}, {Name: "digest"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "tag_digest"}),
+	}).Create(&image).Error
+}
+
+// IndexResult 批量建立索引的结果
+type IndexResult struct {
+	Indexed int      `json:"indexed"`
+	Skipped int      `json:"skipped"`
+	Errors  []string `json:"errors"`
+}
+
+// SBOMIndexParams 建立 SBOM 索引任务的参数
+type SBOMIndexParams struct {
+	RegistryID uint   `json:"registry_id"`
+	Repository string `json:"repository"` // 为空时索引整个 Registry
+	Refresh    bool   `json:"refresh"`
+	Detect     bool   `json:"detect"`
+}
+
+func init() {
+	RegisterJobHandler(models.JobTypeSBOMIndex, func(ctx *JobContext, params json.RawMessage) (interface{}, error) {
+		var p SBOMIndexParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		client, _, err := GetRegistryClient(p.RegistryID)
+		if err != nil {
+			return nil, err
+		}
+		return IndexRepositorySBOMs(ctx, client.WithContext(ctx), p.RegistryID, p.Repository, p.Refresh, p.Detect)
+	})
+}
+
+// IndexRepositorySBOMs 为仓库（为空时为整个 Registry）的所有标签建立 SBOM 索引，
+// detect 为 true 时没有 SBOM 的镜像从层内容检测软件包
+func IndexRepositorySBOMs(ctx *JobContext, client *RegistryClient, registryID uint, repository string, refresh, detect bool) (*IndexResult, error) {
+	repositories := []string{repository}
+	if repository == "" {
+		catalog, err := client.GetCatalog()
+		if err != nil {
+			return nil, err
+		}
+		repositories = catalog.Repositories
+	}
+
+	result := &IndexResult{Errors: []string{}}
+	for i, repo := range repositories {
+		if err := ctx.Check(); err != nil {
+			return result, err
+		}
+		ctx.SetProgress(int64(i), int64(len(repositories)), "Indexing "+repo)
+		tags, err := client.GetTags(repo)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", repo, err))
+			continue
+		}
+		for _, tag := range tags.Tags {
+			if IsArtifactTag(tag) {
+				continue
+			}
+			if err := ctx.Check(); err != nil {
+				return result, err
+			}
+			_, err := IndexImageSBOM(client, registryID, repo, tag, refresh)
+			if detect && errors.Is(err, ErrNoSBOM) {
+				_, err = DetectImagePackages(client, registryID, repo, tag, refresh)
+			}
+			switch {
+			case err == nil:
+				result.Indexed++
+			case errors.Is(err, ErrNoSBOM):
+				result.Skipped++
+			default:
+				result.Errors = append(result.Errors, fmt.Sprintf("%s:%s: %v", repo, tag, err))
+				ctx.Logf("warn", "%s:%s: %v", repo, tag, err)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// IsArtifactTag 判断是否为 cosign / referrers 回退方案使用的 sha256-<hex> 标签
+func IsArtifactTag(tag string) bool {
+	return strings.HasPrefix(tag, "sha256-") && len(tag) >= len("sha256-")+64
+}
+
+// EscapeLike 转义 LIKE 模式中的 %、_ 和转义符本身，查询时需指定 ESCAPE '\'
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// SearchPackages 在已建立索引的镜像中按软件包名称和版本搜索，名称中的 * 匹配任意字符
+func SearchPackages(registryID uint, name, version string, page, pageSize int) ([]models.PackageSearchResult, int64, error) {
+	query := config.DB.Table("inventory_packages AS p").
+		Joins("JOIN package_inventories AS i ON i.id = p.inventory_id").
+		Joins("JOIN inventory_images AS m ON m.digest = i.digest").
+		Where("m.registry_id = ?", registryID)
+
+	if strings.Contains(name, "*") {
+		pattern := strings.ReplaceAll(EscapeLike(strings.ToLower(name)), "*", "%")
+		query = query.Where(`LOWER(p.name) LIKE ? ESCAPE '\'`, pattern)
+	} else {
+		query = query.Where("LOWER(p.name) = ?", strings.ToLower(name))
+	}
+	if version != "" {
+		query = query.Where("p.version = ?", version)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var results []models.PackageSearchResult
+	err := query.Select("m.registry_id, m.repository, m.tag, m.digest, i.source, p.name, p.version, p.type, p.purl").
+		Order("m.repository, m.tag, p.name").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Scan(&results).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return results, total, nil
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+func TestParsePURL(t *testing.T) {
+	tests := []struct {
+		purl string
+		want *PackageURL
+	}{
+		{"pkg:deb/debian/libssl3@3.0.11-1~deb12u2?arch=amd64&distro=debian-12", &PackageURL{
+			Type: "deb", Namespace: "debian", Name: "libssl3", Version: "3.0.11-1~deb12u2",
+			Qualifiers: map[string]string{"arch": "amd64", "distro": "debian-12"},
+		}},
+		{"pkg:npm/%40angular/core@17.0.0#packages/core", &PackageURL{
+			Type: "npm", Namespace: "@angular", Name: "core", Version: "17.0.0", Qualifiers: map[string]string{},
+		}},
+		{"pkg:golang/github.com/gin-gonic/gin@v1.9.1", &PackageURL{
+			Type: "golang", Namespace: "github.com/gin-gonic", Name: "gin", Version: "v1.9.1", Qualifiers: map[string]string{},
+		}},
+		{"pkg:PyPI/requests", &PackageURL{Type: "pypi", Name: "requests", Qualifiers: map[string]string{}}},
+		{"deb/debian/bash@5.2", nil},
+		{"pkg:bash", nil},
+	}
+	for _, tt := range tests {
+		got, err := ParsePURL(tt.purl)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("ParsePURL(%q) = %+v, want error", tt.purl, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePURL(%q): %v", tt.purl, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePURL(%q) = %+v, want %+v", tt.purl, got, tt.want)
+		}
+	}
+}
+
+func TestParseSBOM(t *testing.T) {
+	spdx := `{
+		"spdxVersion": "SPDX-2.3",
+		"packages": [
+			{"name": "debian", "versionInfo": "12", "primaryPackagePurpose": "OPERATING-SYSTEM"},
+			{"name": "libssl3", "versionInfo": "3.0.11", "licenseConcluded": "NOASSERTION", "licenseDeclared": "Apache-2.0",
+			 "externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl",
+			                   "referenceLocator": "pkg:deb/debian/libssl3@3.0.11?distro=debian-12"}]},
+			{"name": ""}
+		]
+	}`
+	spdxPackages := []models.InventoryPackage{
+		{Name: "libssl3", Version: "3.0.11", Type: "deb", License: "Apache-2.0", PURL: "pkg:deb/debian/libssl3@3.0.11?distro=debian-12"},
+	}
+	statement := fmt.Sprintf(`{"_type": "https://in-toto.io/Statement/v1", "predicateType": "https://spdx.dev/Document", "predicate": %s}`, spdx)
+	envelope := fmt.Sprintf(`{"payloadType": "application/vnd.in-toto+json", "payload": %q}`,
+		base64.StdEncoding.EncodeToString([]byte(statement)))
+
+	cyclonedx := `{
+		"bomFormat": "CycloneDX",
+		"components": [
+			{"type": "operating-system", "name": "Alpine", "version": "3.19.1"},
+			{"type": "library", "group": "org.example", "name": "core", "version": "1.0", "purl": "pkg:maven/org.example/core@1.0",
+			 "licenses": [{"license": {"id": "MIT"}}, {"expression": "Apache-2.0 OR MIT"}],
+			 "components": [{"type": "library", "name": "nested", "version": "2.0", "licenses": [{"license": {"name": "Custom"}}]}]}
+		]
+	}`
+
+	tests := []struct {
+		name     string
+		data     string
+		format   string
+		distro   string
+		packages []models.InventoryPackage
+	}{
+		{"spdx", spdx, "spdx", "debian:12", spdxPackages},
+		{"in-toto statement", statement, "spdx", "debian:12", spdxPackages},
+		{"dsse envelope", envelope, "spdx", "debian:12", spdxPackages},
+		{"cyclonedx", cyclonedx, "cyclonedx", "alpine:3.19.1", []models.InventoryPackage{
+			{Name: "nested", Version: "2.0", Type: "library", License: "Custom"},
+			{Name: "org.example/core", Version: "1.0", Type: "maven", License: "MIT, Apache-2.0 OR MIT", PURL: "pkg:maven/org.example/core@1.0"},
+		}},
+		{"unsupported", `{"foo": "bar"}`, "", "", nil},
+		{"invalid json", `{`, "", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSBOM([]byte(tt.data))
+			if tt.format == "" {
+				if err == nil {
+					t.Fatalf("got %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Format != tt.format || got.Distro != tt.distro {
+				t.Errorf("format, distro = %s, %s, want %s, %s", got.Format, got.Distro, tt.format, tt.distro)
+			}
+			checkPackages(t, got.Packages, tt.packages)
+		})
+	}
+}
+
+// saveTestInventory 保存一个只包含给定软件包的清单
+func saveTestInventory(t *testing.T, digest, source string, packages ...models.InventoryPackage) {
+	t.Helper()
+	inventory := &models.PackageInventory{Digest: digest, Source: source, Format: source}
+	if err := SaveInventory(inventory, packages); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLinkInventoryImage(t *testing.T) {
+	setupTestDB(t, &models.PackageInventory{}, &models.InventoryPackage{}, &models.InventoryImage{})
+
+	openssl := models.InventoryPackage{Name: "openssl", Version: "3.0.11", Type: "deb"}
+	saveTestInventory(t, "sha256:index", models.InventorySourceSBOM, openssl)
+	saveTestInventory(t, "sha256:amd64", models.InventorySourceDetected, openssl)
+	saveTestInventory(t, "sha256:new", models.InventorySourceDetected, openssl)
+
+	links := func() []string {
+		var images []models.InventoryImage
+		config.DB.Where("tag = ?", "v1").Order("digest").Find(&images)
+		var digests []string
+		for _, image := range images {
+			digests = append(digests, image.Digest)
+		}
+		return digests
+	}
+
+	// 多架构镜像：SBOM 按 index 记录，检测结果按平台记录，两者不应互相覆盖
+	for i := 0; i < 2; i++ {
+		if err := LinkInventoryImage(1, "app", "v1", "sha256:index", "sha256:index"); err != nil {
+			t.Fatal(err)
+		}
+		if err := LinkInventoryImage(1, "app", "v1", "sha256:index", "sha256:amd64"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := links(); !reflect.DeepEqual(got, []string{"sha256:amd64", "sha256:index"}) {
+		t.Fatalf("links = %v", got)
+	}
+	if _, total, err := SearchPackages(1, "openssl", "", 1, 10); err != nil || total != 2 {
+		t.Errorf("search total = %d, %v, want 2", total, err)
+	}
+
+	// 引用本身是 digest 时不记录
+	if err := LinkInventoryImage(1, "app", "sha256:new", "sha256:new", "sha256:new"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 标签改指后旧的对应关系全部移除
+	if err := LinkInventoryImage(1, "app", "v1", "sha256:new", "sha256:new"); err != nil {
+		t.Fatal(err)
+	}
+	if got := links(); !reflect.DeepEqual(got, []string{"sha256:new"}) {
+		t.Fatalf("links after retag = %v", got)
+	}
+}
+
+func TestSearchPackages(t *testing.T) {
+	setupTestDB(t, &models.PackageInventory{}, &models.InventoryPackage{}, &models.InventoryImage{})
+
+	saveTestInventory(t, "sha256:a", models.InventorySourceDetected,
+		models.InventoryPackage{Name: "lib_ssl", Version: "1.0", Type: "deb"},
+		models.InventoryPackage{Name: "libxssl", Version: "1.0", Type: "deb"},
+		models.InventoryPackage{Name: "lib%crypto", Version: "2.0", Type: "deb"},
+		models.InventoryPackage{Name: "OpenSSL", Version: "3.0", Type: "apk"},
+	)
+	saveTestInventory(t, "sha256:b", models.InventorySourceDetected,
+		models.InventoryPackage{Name: "openssl", Version: "3.1", Type: "apk"},
+	)
+	saveTestInventory(t, "sha256:other", models.InventorySourceDetected,
+		models.InventoryPackage{Name: "openssl", Version: "3.0", Type: "apk"},
+	)
+	for _, link := range []struct {
+		registryID uint
+		repo, tag  string
+		digest     string
+	}{
+		{1, "app", "v1", "sha256:a"},
+		{1, "app", "v2", "sha256:b"},
+		{2, "app", "v1", "sha256:other"},
+	} {
+		if err := LinkInventoryImage(link.registryID, link.repo, link.tag, link.digest, link.digest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		version string
+		want    []string // 标签:软件包
+	}{
+		{"openssl", "", []string{"v1:OpenSSL", "v2:openssl"}},
+		{"OPENSSL", "3.1", []string{"v2:openssl"}},
+		{"open*", "", []string{"v1:OpenSSL", "v2:openssl"}},
+		{"lib_*", "", []string{"v1:lib_ssl"}},
+		{"lib%*", "", []string{"v1:lib%crypto"}},
+		{"lib*ssl", "", []string{"v1:lib_ssl", "v1:libxssl"}},
+		{"ssl", "", nil},
+	}
+	for _, tt := range tests {
+		results, total, err := SearchPackages(1, tt.name, tt.version, 1, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.Tag+":"+r.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) || total != int64(len(tt.want)) {
+			t.Errorf("SearchPackages(%q, %q) = %v (total %d), want %v", tt.name, tt.version, got, total, tt.want)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// 全文索引 catalog_search（见 config.InitDB）每个标签一行。
+// labels 和 env 保存为以换行分隔并首尾带换行的 KEY=value，便于按完整的键精确匹配
+
+// ftsPhrase 将文本转为 FTS5 短语
+func ftsPhrase(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// catalogDocument 搜索索引中的一行
+type catalogDocument struct {
+	RegistryID uint
+	Repository string
+	Tag        string
+	Digest     string
+	OS         string
+	Arch       string
+	Labels     string
+	Env        string
+	Entrypoint string
+	History    string
+	Created    string
+}
+
+// appendUnique 追加不重复的非空值
+func appendUnique(values []string, v string) []string {
+	if v == "" {
+		return values
+	}
+	for _, existing := range values {
+		if existing == v {
+			return values
+		}
+	}
+	return append(values, v)
+}
+
+// keyValueLines 将 KEY=value 列表格式化为索引中保存的形式
+func keyValueLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	sort.Strings(lines)
+	return "\n" + strings.Join(lines, "\n") + "\n"
+}
+
+// indexRepository 根据仓库的爬取结果重建其所有标签的索引，仓库已不存在时只删除索引
+func indexRepository(rc *repositoryCatalog) error {
+	docs := make([]catalogDocument, 0, len(rc.tags))
+	for _, tag := range rc.tags {
+		docs = append(docs, buildCatalogDocument(tag, rc.images(tag.Digest)))
+	}
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM catalog_search WHERE rowid IN (
+			SELECT rowid FROM catalog_search WHERE catalog_search MATCH ?
+		) AND registry_id = ? AND repository = ?`, "repository : "+ftsPhrase(rc.repository), rc.registryID, rc.repository).Error; err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			err := tx.Exec(`INSERT INTO catalog_search
+				(registry_id, repository, tag, digest, os, arch, labels, env, entrypoint, history, created)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				doc.RegistryID, doc.Repository, doc.Tag, doc.Digest, doc.OS, doc.Arch,
+				doc.Labels, doc.Env, doc.Entrypoint, doc.History, doc.Created).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// buildCatalogDocument 合并标签指向的镜像（多架构镜像为所有平台）的元数据
+func buildCatalogDocument(tag models.CatalogTag, images []*models.CatalogManifest) catalogDocument {
+	doc := catalogDocument{RegistryID: tag.RegistryID, Repository: tag.Repository, Tag: tag.Tag, Digest: tag.Digest}
+	var oses, arches, labels, env, entrypoints, history []string
+	var created *time.Time
+	for _, m := range images {
+		oses = appendUnique(oses, m.OS)
+		arch := m.Architecture
+		if arch != "" && m.Variant != "" {
+			arch += "/" + m.Variant
+		}
+		arches = appendUnique(arches, arch)
+		if m.Labels != "" {
+			var values map[string]string
+			if json.Unmarshal([]byte(m.Labels), &values) == nil {
+				for k, v := range values {
+					labels = appendUnique(labels, k+"="+strings.ReplaceAll(v, "\n", " "))
+				}
+			}
+		}
+		for _, line := range strings.Split(m.Env, "\n") {
+			env = appendUnique(env, line)
+		}
+		entrypoints = appendUnique(entrypoints, m.Entrypoint)
+		for _, line := range strings.Split(m.History, "\n") {
+			history = appendUnique(history, line)
+		}
+		if m.Created != nil && (created == nil || m.Created.After(*created)) {
+			created = m.Created
+		}
+	}
+	doc.OS = strings.Join(oses, " ")
+	doc.Arch = strings.Join(arches, " ")
+	doc.Labels = keyValueLines(labels)
+	doc.Env = keyValueLines(env)
+	doc.Entrypoint = strings.Join(entrypoints, "\n")
+	doc.History = strings.Join(history, "\n")
+	if created != nil {
+		doc.Created = created.UTC().Format(time.RFC3339)
+	}
+	return doc
+}
+
+// splitSearchQuery 按空白拆分查询，双引号内的空白保留
+func splitSearchQuery(query string) []string {
+	var terms []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if current.Len() > 0 {
+				terms = append(terms, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		terms = append(terms, current.String())
+	}
+	return terms
+}
+
+// keyValueCondition 生成按 KEY 或 KEY=value 匹配 labels / env 列的条件，matchSuffix 时 KEY 也可以匹配带前缀的键，
+// 如 version 匹配 org.opencontainers.image.version
+func keyValueCondition(column, term string, matchSuffix bool) (string, []interface{}) {
+	key, value, hasValue := strings.Cut(strings.ToLower(term), "=")
+	needle := key + "="
+	if hasValue {
+		needle += value + "\n"
+	}
+	cond := "instr(lower(" + column + "), ?) > 0"
+	args := []interface{}{"\n" + needle}
+	if matchSuffix {
+		cond = "(" + cond + " OR instr(lower(" + column + "), ?) > 0)"
+		args = append(args, "."+needle)
+	}
+	return cond, args
+}
+
+// textCondition 生成仓库或标签的条件：含通配符时按 glob 匹配，否则忽略大小写包含
+func textCondition(column, term string) (string, []interface{}) {
+	if strings.ContainsAny(term, "*?[") {
+		return column + " GLOB ?", []interface{}{term}
+	}
+	return "instr(lower(" + column + "), ?) > 0", []interface{}{strings.ToLower(term)}
+}
+
+// SearchCatalog 在所有 Registry 的索引中搜索标签。查询由空格分隔的条件组成，全部满足才命中：
+//
+//	repo:team/*  tag:v1.*  registry:name  arch:arm64  os:linux
+//	label:maintainer=x  label:org.opencontainers.image.source  env:PATH  entrypoint:nginx  history:apt-get
+//
+// 其余词在仓库名、标签名、平台、镜像 label、环境变量、启动命令和构建历史中按前缀全文匹配
+func SearchCatalog(query string, page, pageSize int) ([]models.SearchResult, int64, error) {
+	var registries []models.Registry
+	if err := config.DB.Find(&registries).Error; err != nil {
+		return nil, 0, err
+	}
+	names := map[uint]string{}
+	ids := []uint{}
+	byName := map[string]uint{}
+	for _, registry := range registries {
+		names[registry.ID] = registry.Name
+		ids = append(ids, registry.ID)
+		byName[strings.ToLower(registry.Name)] = registry.ID
+	}
+	results := []models.SearchResult{}
+	if len(ids) == 0 {
+		return results, 0, nil
+	}
+
+	db := config.DB.Table("catalog_search").Where("registry_id IN ?", ids)
+	var match []string
+	for _, term := range splitSearchQuery(query) {
+		key, value, ok := strings.Cut(term, ":")
+		if !ok || value == "" {
+			key, value = "", term
+		}
+		switch strings.ToLower(key) {
+		case "repo", "repository":
+			cond, args := textCondition("repository", value)
+			db = db.Where(cond, args...)
+		case "tag":
+			cond, args := textCondition("tag", value)
+			db = db.Where(cond, args...)
+		case "registry":
+			db = db.Where("registry_id = ?", byName[strings.ToLower(value)])
+		case "label":
+			cond, args := keyValueCondition("labels", value, true)
+			db = db.Where(cond, args...)
+		case "env":
+			cond, args := keyValueCondition("env", value, false)
+			db = db.Where(cond, args...)
+		case "arch", "os", "entrypoint", "history":
+			match = append(match, strings.ToLower(key)+" : "+ftsPhrase(value))
+		default:
+			match = append(match, ftsPhrase(term)+"*")
+		}
+	}
+	if len(match) > 0 {
+		db = db.Where("catalog_search MATCH ?", strings.Join(match, " AND "))
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	order := "repository, tag"
+	if len(match) > 0 {
+		order = "rank, " + order
+	}
+	var rows []catalogDocument
+	err := db.Select("registry_id, repository, tag, digest, os, arch, labels, created").
+		Order(order).Offset((page - 1) * pageSize).Limit(pageSize).Scan(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, row := range rows {
+		result := models.SearchResult{
+			RegistryID: row.RegistryID,
+			Registry:   names[row.RegistryID],
+			Repository: row.Repository,
+			Tag:        row.Tag,
+			Digest:     row.Digest,
+			OS:         strings.Fields(row.OS),
+			Arch:       strings.Fields(row.Arch),
+			Created:    row.Created,
+			Labels:     map[string]string{},
+		}
+		for _, line := range strings.Split(strings.Trim(row.Labels, "\n"), "\n") {
+			if k, v, ok := strings.Cut(line, "="); ok {
+				result.Labels[k] = v
+			}
+		}
+		results = append(results, result)
+	}
+	return results, total, nil
+}
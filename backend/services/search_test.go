@@ -0,0 +1,82 @@
+package services
+
+import (
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestSplitSearchQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", nil},
+		{"  nginx  ", []string{"nginx"}},
+		{"repo:team/* tag:v1.*\tarch:arm64\nos:linux", []string{"repo:team/*", "tag:v1.*", "arch:arm64", "os:linux"}},
+		{`label:"maintainer=Jane Doe" nginx`, []string{"label:maintainer=Jane Doe", "nginx"}},
+		{`"hello world"`, []string{"hello world"}},
+		{`history:"apt-get install`, []string{"history:apt-get install"}},
+	}
+	for _, tt := range tests {
+		if got := splitSearchQuery(tt.query); !slices.Equal(got, tt.want) {
+			t.Errorf("splitSearchQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSearchCatalog(t *testing.T) {
+	setupCatalogDB(t)
+	r := newTestRegistry(t)
+	client, registry := newTestClient(t, r)
+
+	r.pushImage("team/web", "v1", "linux/amd64", []byte("web v1"))
+	r.pushImage("team/web", "v2-arm", "linux/arm64", []byte("web v2"))
+	r.pushImage("tools/cli", "latest", "linux/amd64", []byte("cli"))
+	if _, err := CrawlRegistry(testJobContext(), client, registry.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"team/web:v1", "team/web:v2-arm", "tools/cli:latest"}},
+		{"repo:team/*", []string{"team/web:v1", "team/web:v2-arm"}},
+		{"repo:WEB", []string{"team/web:v1", "team/web:v2-arm"}},
+		{"tag:v?", []string{"team/web:v1"}},
+		{"arch:arm64", []string{"team/web:v2-arm"}},
+		{"os:linux tag:latest", []string{"tools/cli:latest"}},
+		{"label:app=tools/cli", []string{"tools/cli:latest"}},
+		{"label:app=tools", nil},
+		{"label:app", []string{"team/web:v1", "team/web:v2-arm", "tools/cli:latest"}},
+		{"cli", []string{"tools/cli:latest"}},
+		{"arm", []string{"team/web:v2-arm"}},
+		{"registry:TEST tag:v1", []string{"team/web:v1"}},
+		{"registry:missing", nil},
+	}
+	for _, tt := range tests {
+		results, total, err := SearchCatalog(tt.query, 1, 20)
+		if err != nil {
+			t.Errorf("SearchCatalog(%q): %v", tt.query, err)
+			continue
+		}
+		var got []string
+		for _, result := range results {
+			got = append(got, result.Repository+":"+result.Tag)
+		}
+		sort.Strings(got)
+		if !slices.Equal(got, tt.want) || total != int64(len(tt.want)) {
+			t.Errorf("SearchCatalog(%q) = %v (total %d), want %v", tt.query, got, total, tt.want)
+		}
+	}
+
+	results, total, err := SearchCatalog("repo:team/web", 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(results) != 1 || results[0].Tag != "v2-arm" || results[0].Registry != "test" ||
+		!slices.Equal(results[0].Arch, []string{"arm64"}) || results[0].Labels["app"] != "team/web" {
+		t.Errorf("second page = %+v (total %d)", results, total)
+	}
+}
@@ -0,0 +1,324 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// StorageAnalysisParams 存储分析任务的参数
+type StorageAnalysisParams struct {
+	RegistryID uint `json:"registry_id"`
+}
+
+// storageHistoryLimit 每个 Registry 保留的快照数，标签级别的用量只保留在最新的快照中
+const storageHistoryLimit = 200
+
+func init() {
+	RegisterJobHandler(models.JobTypeStorageAnalysis, runStorageAnalysisJob)
+}
+
+// runStorageAnalysisJob 爬取 Registry 后计算存储用量
+func runStorageAnalysisJob(ctx *JobContext, params json.RawMessage) (interface{}, error) {
+	var p StorageAnalysisParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	client, _, err := GetRegistryClient(p.RegistryID)
+	if err != nil {
+		return nil, err
+	}
+	client = client.WithContext(ctx)
+
+	crawl, err := CrawlRegistry(ctx, client, p.RegistryID, false)
+	if err != nil {
+		return crawl, err
+	}
+	ctx.Logf("info", "Crawled %d repositories and %d tags, fetched %d new manifests", crawl.Repositories, crawl.Tags, crawl.Manifests)
+
+	ctx.SetProgress(0, 0, "Computing storage usage")
+	snapshot, err := AnalyzeStorage(p.RegistryID, ctx.JobID())
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// blobUsage 一个 blob 的大小及引用它的仓库和标签
+type blobUsage struct {
+	size  int64
+	repos map[string]bool
+	tags  map[string]bool
+}
+
+// catalogGraph 从数据库加载的 manifest 引用关系
+type catalogGraph struct {
+	children map[string][]models.CatalogReference // manifest digest -> 引用
+}
+
+// loadCatalogGraph 加载 Registry 所有 manifest 的引用
+func loadCatalogGraph(registryID uint) (*catalogGraph, error) {
+	var refs []models.CatalogReference
+	if err := config.DB.Where("registry_id = ?", registryID).Find(&refs).Error; err != nil {
+		return nil, err
+	}
+	g := &catalogGraph{children: map[string][]models.CatalogReference{}}
+	for _, ref := range refs {
+		g.children[ref.ManifestDigest] = append(g.children[ref.ManifestDigest], ref)
+	}
+	return g, nil
+}
+
+// blobs 返回 manifest（包括 index 的子 manifest）引用的 config 和镜像层，digest -> 大小
+func (g *catalogGraph) blobs(digest string) map[string]int64 {
+	result := map[string]int64{}
+	visited := map[string]bool{}
+	var walk func(string)
+	walk = func(d string) {
+		if visited[d] {
+			return
+		}
+		visited[d] = true
+		for _, ref := range g.children[d] {
+			if ref.Kind == models.ReferenceKindManifest {
+				walk(ref.Digest)
+			} else {
+				result[ref.Digest] = ref.Size
+			}
+		}
+	}
+	walk(digest)
+	return result
+}
+
+// namespacePrefixes 返回仓库路径的所有上级命名空间，如 a/b/c -> a, a/b
+func namespacePrefixes(repository string) []string {
+	parts := strings.Split(repository, "/")
+	prefixes := make([]string, 0, len(parts)-1)
+	for i := 1; i < len(parts); i++ {
+		prefixes = append(prefixes, strings.Join(parts[:i], "/"))
+	}
+	return prefixes
+}
+
+// commonPath 返回所有仓库路径按段计算的最长公共前缀，只有一个仓库时为仓库本身，没有时为空
+func commonPath(repos map[string]bool) string {
+	var common []string
+	first := true
+	for repo := range repos {
+		parts := strings.Split(repo, "/")
+		if first {
+			common = parts
+			first = false
+			continue
+		}
+		n := 0
+		for n < len(common) && n < len(parts) && common[n] == parts[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	return strings.Join(common, "/")
+}
+
+// AnalyzeStorage 根据爬取结果按 blob digest 去重，计算各仓库、标签和命名空间独占与共享的存储，并保存为快照
+func AnalyzeStorage(registryID, jobID uint) (*models.StorageSnapshot, error) {
+	var tags []models.CatalogTag
+	if err := config.DB.Where("registry_id = ?", registryID).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	graph, err := loadCatalogGraph(registryID)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &models.StorageSnapshot{RegistryID: registryID, JobID: jobID, Tags: len(tags)}
+	usage := map[string]*blobUsage{}
+	tagBlobs := map[string]map[string]int64{} // 仓库:标签 -> blob
+	repoBlobs := map[string]map[string]bool{}
+	digestBlobs := map[string]map[string]int64{}
+	for _, tag := range tags {
+		blobs, ok := digestBlobs[tag.Digest]
+		if !ok {
+			blobs = graph.blobs(tag.Digest)
+			digestBlobs[tag.Digest] = blobs
+		}
+		name := tag.Repository + ":" + tag.Tag
+		tagBlobs[name] = blobs
+		if repoBlobs[tag.Repository] == nil {
+			repoBlobs[tag.Repository] = map[string]bool{}
+		}
+		for digest, size := range blobs {
+			u := usage[digest]
+			if u == nil {
+				u = &blobUsage{size: size, repos: map[string]bool{}, tags: map[string]bool{}}
+				usage[digest] = u
+			}
+			u.repos[tag.Repository] = true
+			u.tags[name] = true
+			repoBlobs[tag.Repository][digest] = true
+			snapshot.LogicalBytes += size
+		}
+	}
+	snapshot.Repositories = len(repoBlobs)
+	snapshot.Blobs = len(usage)
+
+	var rows []models.StorageUsage
+	add := func(kind, name string, blobs []string, unique func(string, *blobUsage) bool) {
+		row := models.StorageUsage{Kind: kind, Name: name, Blobs: len(blobs)}
+		for _, digest := range blobs {
+			u := usage[digest]
+			row.TotalBytes += u.size
+			if unique(digest, u) {
+				row.UniqueBytes += u.size
+			}
+		}
+		row.SharedBytes = row.TotalBytes - row.UniqueBytes
+		rows = append(rows, row)
+	}
+
+	for repo, blobs := range repoBlobs {
+		digests := make([]string, 0, len(blobs))
+		for digest := range blobs {
+			digests = append(digests, digest)
+		}
+		add(models.StorageKindRepository, repo, digests, func(_ string, u *blobUsage) bool { return len(u.repos) == 1 })
+	}
+	for name, blobs := range tagBlobs {
+		digests := make([]string, 0, len(blobs))
+		for digest := range blobs {
+			digests = append(digests, digest)
+		}
+		add(models.StorageKindTag, name, digests, func(_ string, u *blobUsage) bool { return len(u.tags) == 1 })
+	}
+
+	// 命名空间：blob 计入其引用仓库的所有上级命名空间；仓库路径本身也是命名空间时（如 a/b 与 a/b/c 同时存在），
+	// 同样计入该命名空间，使命名空间的大小覆盖路径下的全部仓库。
+	// 只有当引用它的仓库都在同一路径下时，才计为该命名空间（及其上级）独占
+	namespaces := map[string]bool{}
+	for repo := range repoBlobs {
+		for _, prefix := range namespacePrefixes(repo) {
+			namespaces[prefix] = true
+		}
+	}
+	namespaceBlobs := map[string][]string{}
+	namespaceUnique := map[string]map[string]bool{}
+	for digest, u := range usage {
+		snapshot.TotalBytes += u.size
+		seen := map[string]bool{}
+		for repo := range u.repos {
+			prefixes := namespacePrefixes(repo)
+			if namespaces[repo] {
+				prefixes = append(prefixes, repo)
+			}
+			for _, prefix := range prefixes {
+				if !seen[prefix] {
+					seen[prefix] = true
+					namespaceBlobs[prefix] = append(namespaceBlobs[prefix], digest)
+				}
+			}
+		}
+		if common := commonPath(u.repos); common != "" {
+			for _, prefix := range append(namespacePrefixes(common), common) {
+				if namespaceUnique[prefix] == nil {
+					namespaceUnique[prefix] = map[string]bool{}
+				}
+				namespaceUnique[prefix][digest] = true
+			}
+		}
+	}
+	for prefix, digests := range namespaceBlobs {
+		owned := namespaceUnique[prefix]
+		add(models.StorageKindNamespace, prefix, digests, func(digest string, _ *blobUsage) bool { return owned[digest] })
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(snapshot).Error; err != nil {
+			return err
+		}
+		for i := range rows {
+			rows[i].SnapshotID = snapshot.ID
+		}
+		if len(rows) > 0 {
+			if err := tx.CreateInBatches(rows, 500).Error; err != nil {
+				return err
+			}
+		}
+		return pruneStorageHistory(tx, registryID, snapshot.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// pruneStorageHistory 删除旧快照的标签级别用量，以及超过保留数量的快照
+func pruneStorageHistory(tx *gorm.DB, registryID, latestID uint) error {
+	older := tx.Model(&models.StorageSnapshot{}).Select("id").Where("registry_id = ? AND id <> ?", registryID, latestID)
+	if err := tx.Where("kind = ? AND snapshot_id IN (?)", models.StorageKindTag, older).Delete(&models.StorageUsage{}).Error; err != nil {
+		return err
+	}
+
+	var expired []uint
+	if err := tx.Model(&models.StorageSnapshot{}).Where("registry_id = ?", registryID).
+		Order("id DESC").Offset(storageHistoryLimit).Pluck("id", &expired).Error; err != nil {
+		return err
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	if err := tx.Where("snapshot_id IN ?", expired).Delete(&models.StorageUsage{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("id IN ?", expired).Delete(&models.StorageSnapshot{}).Error
+}
+
+// LatestStorageSnapshot 返回 Registry 最新的存储快照
+func LatestStorageSnapshot(registryID uint) (*models.StorageSnapshot, error) {
+	var snapshot models.StorageSnapshot
+	if err := config.DB.Where("registry_id = ?", registryID).Order("id DESC").First(&snapshot).Error; err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// ListStorageSnapshots 按时间升序返回 Registry 的快照，用于绘制总量变化
+func ListStorageSnapshots(registryID uint) ([]models.StorageSnapshot, error) {
+	snapshots := []models.StorageSnapshot{}
+	err := config.DB.Where("registry_id = ?", registryID).Order("id").Find(&snapshots).Error
+	return snapshots, err
+}
+
+// TopStorageUsage 返回最新快照中占用最大的仓库、标签或命名空间，orderBy 为 total 或 unique，prefix 限定名称前缀
+func TopStorageUsage(registryID uint, kind, orderBy, prefix string, limit int) ([]models.StorageUsage, error) {
+	snapshot, err := LatestStorageSnapshot(registryID)
+	if err != nil {
+		return nil, err
+	}
+	column := "total_bytes"
+	if orderBy == "unique" {
+		column = "unique_bytes"
+	}
+	query := config.DB.Where("snapshot_id = ? AND kind = ?", snapshot.ID, kind)
+	if prefix != "" {
+		query = query.Where("substr(name, 1, ?) = ?", len(prefix), prefix)
+	}
+	usages := []models.StorageUsage{}
+	err = query.Order(column + " DESC, name").Limit(limit).Find(&usages).Error
+	return usages, err
+}
+
+// StorageHistory 返回仓库或命名空间在各快照中的用量
+func StorageHistory(registryID uint, kind, name string) ([]models.StorageHistoryPoint, error) {
+	points := []models.StorageHistoryPoint{}
+	err := config.DB.Model(&models.StorageUsage{}).
+		Select("storage_snapshots.id AS snapshot_id, storage_snapshots.created_at, storage_usages.total_bytes, storage_usages.unique_bytes, storage_usages.shared_bytes").
+		Joins("JOIN storage_snapshots ON storage_snapshots.id = storage_usages.snapshot_id").
+		Where("storage_snapshots.registry_id = ? AND storage_usages.kind = ? AND storage_usages.name = ?", registryID, kind, name).
+		Order("storage_snapshots.id").Scan(&points).Error
+	return points, err
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+func TestNamespacePrefixes(t *testing.T) {
+	tests := []struct {
+		repository string
+		want       []string
+	}{
+		{"app", []string{}},
+		{"team/app", []string{"team"}},
+		{"team/app/worker", []string{"team", "team/app"}},
+	}
+	for _, tt := range tests {
+		if got := namespacePrefixes(tt.repository); !slices.Equal(got, tt.want) {
+			t.Errorf("namespacePrefixes(%q) = %v, want %v", tt.repository, got, tt.want)
+		}
+	}
+}
+
+func TestCommonPath(t *testing.T) {
+	tests := []struct {
+		repos []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"team/app"}, "team/app"},
+		{[]string{"team/app", "team/app/worker"}, "team/app"},
+		{[]string{"team/app", "team/application"}, "team"},
+		{[]string{"team/app", "other"}, ""},
+	}
+	for _, tt := range tests {
+		repos := map[string]bool{}
+		for _, repo := range tt.repos {
+			repos[repo] = true
+		}
+		if got := commonPath(repos); got != tt.want {
+			t.Errorf("commonPath(%v) = %q, want %q", tt.repos, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzeStorage(t *testing.T) {
+	setupCatalogDB(t)
+
+	// base 被所有镜像共用；team/app 既是仓库也是 team/app/worker 的命名空间；team/tool 是多架构镜像
+	layers := map[string][]string{
+		"m1": {"base", "app1"},
+		"m2": {"base", "app2"},
+		"m3": {"base", "worker"},
+		"m4": {"base", "other"},
+		"m5": {"tool", "cfg"},
+	}
+	sizes := map[string]int64{"base": 100, "app1": 10, "app2": 20, "worker": 30, "other": 50, "tool": 40, "cfg": 5}
+	var refs []models.CatalogReference
+	for manifest, blobs := range layers {
+		for _, blob := range blobs {
+			refs = append(refs, models.CatalogReference{RegistryID: 1, ManifestDigest: manifest, Kind: models.ReferenceKindLayer, Digest: blob, Size: sizes[blob]})
+		}
+	}
+	refs = append(refs, models.CatalogReference{RegistryID: 1, ManifestDigest: "i1", Kind: models.ReferenceKindManifest, Digest: "m5", Platform: "linux/amd64"})
+	config.DB.Create(&refs)
+	now := time.Now()
+	config.DB.Create(&[]models.CatalogTag{
+		{RegistryID: 1, Repository: "team/app", Tag: "v1", Digest: "m1", CrawledAt: now},
+		{RegistryID: 1, Repository: "team/app", Tag: "v2", Digest: "m2", CrawledAt: now},
+		{RegistryID: 1, Repository: "team/app/worker", Tag: "v1", Digest: "m3", CrawledAt: now},
+		{RegistryID: 1, Repository: "other", Tag: "latest", Digest: "m4", CrawledAt: now},
+		{RegistryID: 1, Repository: "other", Tag: "v1", Digest: "m4", CrawledAt: now},
+		{RegistryID: 1, Repository: "team/tool", Tag: "v1", Digest: "i1", CrawledAt: now},
+		{RegistryID: 2, Repository: "team/app", Tag: "v1", Digest: "m1", CrawledAt: now},
+	})
+
+	snapshot, err := AnalyzeStorage(1, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.StorageSnapshot{RegistryID: 1, JobID: 7, Repositories: 4, Tags: 6, Blobs: 7, TotalBytes: 255, LogicalBytes: 705}
+	want.ID, want.CreatedAt = snapshot.ID, snapshot.CreatedAt
+	if *snapshot != want {
+		t.Errorf("snapshot = %+v, want %+v", *snapshot, want)
+	}
+
+	tests := []struct {
+		kind, name    string
+		total, unique int64
+		blobs         int
+	}{
+		{models.StorageKindRepository, "team/app", 130, 30, 3},
+		{models.StorageKindRepository, "team/app/worker", 130, 30, 2},
+		{models.StorageKindRepository, "other", 150, 50, 2},
+		{models.StorageKindRepository, "team/tool", 45, 45, 2},
+		{models.StorageKindTag, "team/app:v1", 110, 10, 2},
+		{models.StorageKindTag, "other:latest", 150, 0, 2},
+		{models.StorageKindTag, "team/tool:v1", 45, 45, 2},
+		{models.StorageKindNamespace, "team", 205, 105, 6},
+		{models.StorageKindNamespace, "team/app", 160, 60, 4},
+	}
+	for _, tt := range tests {
+		var usage models.StorageUsage
+		if err := config.DB.Where("snapshot_id = ? AND kind = ? AND name = ?", snapshot.ID, tt.kind, tt.name).First(&usage).Error; err != nil {
+			t.Errorf("%s %s: %v", tt.kind, tt.name, err)
+			continue
+		}
+		if usage.TotalBytes != tt.total || usage.UniqueBytes != tt.unique || usage.SharedBytes != tt.total-tt.unique || usage.Blobs != tt.blobs {
+			t.Errorf("%s %s = total %d, unique %d, shared %d, blobs %d; want total %d, unique %d, shared %d, blobs %d",
+				tt.kind, tt.name, usage.TotalBytes, usage.UniqueBytes, usage.SharedBytes, usage.Blobs,
+				tt.total, tt.unique, tt.total-tt.unique, tt.blobs)
+		}
+	}
+	var namespaces int64
+	config.DB.Model(&models.StorageUsage{}).Where("snapshot_id = ? AND kind = ?", snapshot.ID, models.StorageKindNamespace).Count(&namespaces)
+	if namespaces != 2 {
+		t.Errorf("%d namespaces, want 2", namespaces)
+	}
+
+	// 只有最新的快照保留标签级别的用量
+	latest, err := AnalyzeStorage(1, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tags int64
+	config.DB.Model(&models.StorageUsage{}).Where("snapshot_id = ? AND kind = ?", snapshot.ID, models.StorageKindTag).Count(&tags)
+	if tags != 0 {
+		t.Errorf("previous snapshot kept %d tag rows", tags)
+	}
+	top, err := TopStorageUsage(1, models.StorageKindRepository, "unique", "team/", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 2 || top[0].Name != "team/tool" || top[1].Name != "team/app" || top[0].SnapshotID != latest.ID {
+		t.Errorf("top repositories = %+v", top)
+	}
+}
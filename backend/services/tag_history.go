@@ -0,0 +1,138 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+var (
+	// ErrDigestNotInHistory 标签从未指向过该 digest
+	ErrDigestNotInHistory = errors.New("tag has never pointed to this digest")
+	// ErrManifestUnavailable 历史 digest 的 manifest 已被删除
+	ErrManifestUnavailable = errors.New("manifest no longer exists in the registry")
+)
+
+// RecordTagChange 记录标签在 at 时刻指向 digest（为空表示删除），与当时已知的指向相同时不记录。
+// 通知晚于爬取到达时，将爬取记录的同一变化提前到通知的时间
+func RecordTagChange(registryID uint, repository, tag, digest, source, actor string, at time.Time) error {
+	scope := config.DB.Where("registry_id = ? AND repository = ? AND tag = ?", registryID, repository, tag)
+
+	var previous []models.TagHistory
+	if err := scope.Session(&gorm.Session{}).Where("observed_at <= ?", at).Order("observed_at DESC, id DESC").Limit(1).Find(&previous).Error; err != nil {
+		return err
+	}
+	previousDigest := ""
+	if len(previous) > 0 {
+		previousDigest = previous[0].Digest
+	}
+	if previousDigest == digest {
+		return nil
+	}
+
+	var next []models.TagHistory
+	if err := scope.Session(&gorm.Session{}).Where("observed_at > ?", at).Order("observed_at, id").Limit(1).Find(&next).Error; err != nil {
+		return err
+	}
+	if len(next) > 0 && next[0].Digest == digest {
+		return config.DB.Model(&next[0]).Updates(map[string]interface{}{"observed_at": at, "source": source, "actor": actor}).Error
+	}
+
+	// 插入到已有记录之前时，后一条记录的原指向变为本次的 digest
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.TagHistory{
+			RegistryID:     registryID,
+			Repository:     repository,
+			Tag:            tag,
+			ObservedAt:     at,
+			Digest:         digest,
+			PreviousDigest: previousDigest,
+			Source:         source,
+			Actor:          actor,
+		}).Error; err != nil {
+			return err
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		return tx.Model(&next[0]).Update("previous_digest", digest).Error
+	})
+}
+
+// ListTagHistory 按时间倒序列出仓库中标签的变化，tag 为空时列出所有标签
+func ListTagHistory(registryID uint, repository, tag string, page, pageSize int) ([]models.TagHistory, int64, error) {
+	query := config.DB.Model(&models.TagHistory{}).Where("registry_id = ? AND repository = ?", registryID, repository)
+	if tag != "" {
+		query = query.Where("tag = ?", tag)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	history := []models.TagHistory{}
+	err := query.Order("observed_at DESC, id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&history).Error
+	return history, total, err
+}
+
+// TagHistoryAt 返回 at 时刻标签的指向，没有更早的记录时返回 nil
+func TagHistoryAt(registryID uint, repository, tag string, at time.Time) (*models.TagHistory, error) {
+	var history []models.TagHistory
+	err := config.DB.Where("registry_id = ? AND repository = ? AND tag = ? AND observed_at <= ?", registryID, repository, tag, at).
+		Order("observed_at DESC, id DESC").Limit(1).Find(&history).Error
+	if err != nil || len(history) == 0 {
+		return nil, err
+	}
+	return &history[0], nil
+}
+
+// CheckHistoryAvailability 检查历史记录中的 manifest 是否仍然存在，每个 digest 只请求一次
+func CheckHistoryAvailability(client *RegistryClient, repository string, history []models.TagHistory) {
+	available := map[string]bool{}
+	for i := range history {
+		digest := history[i].Digest
+		if digest == "" {
+			continue
+		}
+		ok, checked := available[digest]
+		if !checked {
+			_, _, found, err := client.HeadManifest(repository, digest)
+			ok = err == nil && found
+			available[digest] = ok
+		}
+		history[i].Available = &ok
+	}
+}
+
+// RestoreTag 将标签移回历史上指向过的 digest，要求该 manifest 仍然存在
+func RestoreTag(client *RegistryClient, req *models.TagRestoreRequest, actor string) (*models.RetagResult, error) {
+	var count int64
+	if err := config.DB.Model(&models.TagHistory{}).
+		Where("registry_id = ? AND repository = ? AND tag = ? AND digest = ?", client.RegistryID, req.Repo, req.Tag, req.Digest).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrDigestNotInHistory
+	}
+	_, _, found, err := client.HeadManifest(req.Repo, req.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrManifestUnavailable
+	}
+
+	result, err := RetagImage(client, req.Repo, req.Digest, req.Tag, true, req.ExpectedDigest)
+	if err != nil {
+		return nil, err
+	}
+	if err := RecordTagChange(client.RegistryID, req.Repo, req.Tag, result.Digest, models.TagSourceRetag, actor, time.Now()); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
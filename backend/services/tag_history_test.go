@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// tagHistoryChain 按时间顺序格式化标签历史，如 d1<-,d2<-d1
+func tagHistoryChain(t *testing.T, tag string) string {
+	t.Helper()
+	var history []models.TagHistory
+	if err := config.DB.Where("tag = ?", tag).Order("observed_at, id").Find(&history).Error; err != nil {
+		t.Fatal(err)
+	}
+	var parts []string
+	for _, h := range history {
+		parts = append(parts, fmt.Sprintf("%s<-%s", h.Digest, h.PreviousDigest))
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestRecordTagChange(t *testing.T) {
+	setupTestDB(t, &models.TagHistory{})
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+
+	steps := []struct {
+		name    string
+		digest  string
+		minutes int
+		want    string
+	}{
+		{"first push", "d1", 0, "d1<-"},
+		{"moved", "d2", 20, "d1<-,d2<-d1"},
+		{"unchanged", "d2", 30, "d1<-,d2<-d1"},
+		{"late notification between two crawls", "d3", 10, "d1<-,d3<-d1,d2<-d3"},
+		{"same change observed earlier", "d3", 5, "d1<-,d3<-d1,d2<-d3"},
+		{"deleted", "", 40, "d1<-,d3<-d1,d2<-d3,<-d2"},
+		{"late deletion before the last move", "", 15, "d1<-,d3<-d1,<-d3,d2<-,<-d2"},
+	}
+	for _, step := range steps {
+		if err := RecordTagChange(1, "app", "v1", step.digest, models.TagSourceWebhook, "", at(step.minutes)); err != nil {
+			t.Fatal(err)
+		}
+		if got := tagHistoryChain(t, "v1"); got != step.want {
+			t.Errorf("%s: history = %s, want %s", step.name, got, step.want)
+		}
+	}
+
+	var moved models.TagHistory
+	config.DB.Where("digest = ?", "d3").First(&moved)
+	if !moved.ObservedAt.Equal(at(5)) {
+		t.Errorf("d3 observed at %s, want %s", moved.ObservedAt, at(5))
+	}
+}
+
+func TestRecordImageDeletion(t *testing.T) {
+	setupTestDB(t, &models.TagHistory{}, &models.CatalogTag{}, &models.CatalogManifest{}, &models.CatalogReference{},
+		&models.CatalogRepository{}, &models.RegistryEvent{})
+	createSearchIndex(t)
+
+	now := time.Now()
+	config.DB.Create(&[]models.CatalogTag{
+		{RegistryID: 1, Repository: "app", Tag: "v1", Digest: "sha256:a", CrawledAt: now},
+		{RegistryID: 1, Repository: "app", Tag: "latest", Digest: "sha256:a", CrawledAt: now},
+		{RegistryID: 1, Repository: "app", Tag: "v2", Digest: "sha256:b", CrawledAt: now},
+	})
+	for _, tag := range []string{"v1", "latest"} {
+		if err := RecordTagChange(1, "app", tag, "sha256:a", models.TagSourceCrawler, "", now.Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RecordImageDeletion(1, "app", []string{"latest", "v1"}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	var remaining []string
+	config.DB.Model(&models.CatalogTag{}).Order("tag").Pluck("tag", &remaining)
+	if strings.Join(remaining, ",") != "v2" {
+		t.Errorf("crawled tags = %v, want [v2]", remaining)
+	}
+	for _, tag := range []string{"v1", "latest"} {
+		var last models.TagHistory
+		config.DB.Where("tag = ?", tag).Order("observed_at DESC").First(&last)
+		if last.Digest != "" || last.PreviousDigest != "sha256:a" || last.Source != models.TagSourceDelete || last.Actor != "admin" {
+			t.Errorf("%s: last history = %+v", tag, last)
+		}
+	}
+	var repo models.CatalogRepository
+	if err := config.DB.Where("name = ?", "app").First(&repo).Error; err != nil || repo.TagCount != 1 {
+		t.Errorf("repository = %+v, %v, want 1 tag", repo, err)
+	}
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// blobChunkSize 分块上传时每块的大小
+const blobChunkSize = 10 << 20
+
+// WithoutTimeout 返回不限制整体请求时长的客户端副本，用于传输大 blob，仍限制等待响应头的时间
+func (c *RegistryClient) WithoutTimeout() *RegistryClient {
+	clone := *c
+	httpClient := *c.HTTPClient
+	httpClient.Timeout = 0
+	if tr, ok := c.HTTPClient.Transport.(*http.Transport); ok {
+		tr = tr.Clone()
+		tr.ResponseHeaderTimeout = 60 * time.Second
+		httpClient.Transport = tr
+	}
+	clone.HTTPClient = &httpClient
+	return &clone
+}
+
+// resolveLocation 将上传会话的 Location 转换为完整 URL
+func (c *RegistryClient) resolveLocation(location string) string {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return location
+	}
+	return c.BaseURL + location
+}
+
+// BlobExists 检查仓库中是否已存在 blob
+func (c *RegistryClient) BlobExists(repository, digest string) (bool, error) {
+	path := fmt.Sprintf("/v2/%s/blobs/%s", repository, digest)
+	resp, err := c.doRequest("HEAD", path, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check blob: %d", resp.StatusCode)
+}
+
+// MountBlob 从同一 Registry 的其他仓库挂载 blob。挂载成功返回 mounted=true；
+// Registry 不支持或无法挂载时返回新建上传会话的 location，调用方可继续上传
+func (c *RegistryClient) MountBlob(repository, digest, fromRepository string) (mounted bool, location string, err error) {
+	query := url.Values{"mount": {digest}, "from": {fromRepository}}
+	path := fmt.Sprintf("/v2/%s/blobs/uploads/?%s", repository, query.Encode())
+	resp, err := c.doRequestURL("POST", c.BaseURL+path, nil, nil)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return true, "", nil
+	case http.StatusAccepted:
+		return false, c.resolveLocation(resp.Header.Get("Location")), nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return false, "", fmt.Errorf("failed to mount blob: %d - %s", resp.StatusCode, string(body))
+}
+
+// startUpload 新建 blob 上传会话，返回上传地址
+func (c *RegistryClient) startUpload(repository string) (string, error) {
+	path := fmt.Sprintf("/v2/%s/blobs/uploads/", repository)
+	resp, err := c.doRequestURL("POST", c.BaseURL+path, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to start upload: %d - %s", resp.StatusCode, string(body))
+	}
+	return c.resolveLocation(resp.Header.Get("Location")), nil
+}
+
+// UploadBlob 分块上传 blob，location 为空时新建上传会话。progress 在每块上传后回调已上传的字节数
+func (c *RegistryClient) UploadBlob(repository, digest, location string, r io.Reader, progress func(uploaded int64)) error {
+	if location == "" {
+		var err error
+		if location, err = c.startUpload(repository); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, blobChunkSize)
+	var offset int64
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			headers := map[string]string{
+				"Content-Type":  "application/octet-stream",
+				"Content-Range": fmt.Sprintf("%d-%d", offset, offset+int64(n)-1),
+			}
+			resp, err := c.doRequestURL("PATCH", location, headers, bytes.NewReader(buf[:n]))
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNoContent {
+				return fmt.Errorf("failed to upload blob chunk: %d", resp.StatusCode)
+			}
+			if next := resp.Header.Get("Location"); next != "" {
+				location = c.resolveLocation(next)
+			}
+			offset += int64(n)
+			if progress != nil {
+				progress(offset)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	query := u.Query()
+	query.Set("digest", digest)
+	u.RawQuery = query.Encode()
+
+	resp, err := c.doRequestURL("PUT", u.String(), map[string]string{"Content-Type": "application/octet-stream"}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to complete blob upload: %d - %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
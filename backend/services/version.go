@@ -0,0 +1,390 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// CompareVersions 按生态系统的规则比较两个版本号，返回 -1、0、1
+func CompareVersions(ecosystem, a, b string) int {
+	switch ecosystem {
+	case "debian", "ubuntu":
+		return compareDpkgVersions(a, b)
+	case "alpine", "wolfi", "chainguard":
+		return compareApkVersions(a, b)
+	case "red hat", "rocky linux", "almalinux", "opensuse", "suse", "mageia", "openeuler":
+		return compareRpmVersions(a, b)
+	case "go", "npm", "crates.io", "packagist", "rubygems", "nuget", "hex", "pub":
+		return compareSemver(a, b)
+	}
+	return compareNatural(a, b)
+}
+
+// splitEpoch 拆分 epoch:version
+func splitEpoch(v string) (int, string) {
+	if idx := strings.Index(v, ":"); idx > 0 {
+		if epoch, err := strconv.Atoi(v[:idx]); err == nil {
+			return epoch, v[idx+1:]
+		}
+	}
+	return 0, v
+}
+
+// compareInts 比较整数
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareDpkgVersions 按 dpkg 规则比较 [epoch:]upstream[-revision]
+func compareDpkgVersions(a, b string) int {
+	epochA, restA := splitEpoch(a)
+	epochB, restB := splitEpoch(b)
+	if c := compareInts(epochA, epochB); c != 0 {
+		return c
+	}
+
+	upstreamA, revisionA := restA, ""
+	if idx := strings.LastIndex(restA, "-"); idx >= 0 {
+		upstreamA, revisionA = restA[:idx], restA[idx+1:]
+	}
+	upstreamB, revisionB := restB, ""
+	if idx := strings.LastIndex(restB, "-"); idx >= 0 {
+		upstreamB, revisionB = restB[:idx], restB[idx+1:]
+	}
+
+	if c := compareDpkgPart(upstreamA, upstreamB); c != 0 {
+		return c
+	}
+	return compareDpkgPart(revisionA, revisionB)
+}
+
+// dpkgOrder dpkg 非数字部分的字符排序：~ 最小，字母小于其他符号
+func dpkgOrder(r byte) int {
+	switch {
+	case r == '~':
+		return -1
+	case r >= '0' && r <= '9':
+		return 0
+	case (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+		return int(r)
+	}
+	return int(r) + 256
+}
+
+// compareDpkgPart dpkg 的 verrevcmp 算法
+func compareDpkgPart(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		firstDiff := 0
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac, bc := 0, 0
+			if i < len(a) && !isDigit(a[i]) {
+				ac = dpkgOrder(a[i])
+			}
+			if j < len(b) && !isDigit(b[j]) {
+				bc = dpkgOrder(b[j])
+			}
+			if ac != bc {
+				return compareInts(ac, bc)
+			}
+			i++
+			j++
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if firstDiff == 0 {
+				firstDiff = compareInts(int(a[i]), int(b[j]))
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return firstDiff
+		}
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// compareRpmVersions 按 rpmvercmp 规则比较 [epoch:]version[-release]
+func compareRpmVersions(a, b string) int {
+	epochA, restA := splitEpoch(a)
+	epochB, restB := splitEpoch(b)
+	if c := compareInts(epochA, epochB); c != 0 {
+		return c
+	}
+
+	versionA, releaseA, _ := strings.Cut(restA, "-")
+	versionB, releaseB, _ := strings.Cut(restB, "-")
+	if c := rpmvercmp(versionA, versionB); c != 0 {
+		return c
+	}
+	// 一方没有 release 时只比较 version
+	if releaseA == "" || releaseB == "" {
+		return 0
+	}
+	return rpmvercmp(releaseA, releaseB)
+}
+
+// rpmvercmp rpm 的分段比较算法
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	isAlnum := func(c byte) bool { return isDigit(c) || unicode.IsLetter(rune(c)) }
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for i < len(a) && !isAlnum(a[i]) && a[i] != '~' && a[i] != '^' {
+			i++
+		}
+		for j < len(b) && !isAlnum(b[j]) && b[j] != '~' && b[j] != '^' {
+			j++
+		}
+
+		// ~ 排在任何内容之前
+		if (i < len(a) && a[i] == '~') || (j < len(b) && b[j] == '~') {
+			if i >= len(a) || a[i] != '~' {
+				return 1
+			}
+			if j >= len(b) || b[j] != '~' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+		// ^ 排在任何内容之后，但在字符串结尾之前
+		if (i < len(a) && a[i] == '^') || (j < len(b) && b[j] == '^') {
+			if i >= len(a) {
+				return -1
+			}
+			if j >= len(b) {
+				return 1
+			}
+			if a[i] != '^' {
+				return 1
+			}
+			if b[j] != '^' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+
+		if i >= len(a) || j >= len(b) {
+			break
+		}
+
+		startA, startB := i, j
+		numeric := isDigit(a[i])
+		if numeric {
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+		} else {
+			for i < len(a) && unicode.IsLetter(rune(a[i])) {
+				i++
+			}
+			for j < len(b) && unicode.IsLetter(rune(b[j])) {
+				j++
+			}
+		}
+		segA, segB := a[startA:i], b[startB:j]
+
+		// 类型不同的段：数字段更新
+		if segB == "" {
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+
+		if numeric {
+			segA = strings.TrimLeft(segA, "0")
+			segB = strings.TrimLeft(segB, "0")
+			if c := compareInts(len(segA), len(segB)); c != 0 {
+				return c
+			}
+		}
+		if c := strings.Compare(segA, segB); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case i >= len(a) && j >= len(b):
+		return 0
+	case i >= len(a):
+		return -1
+	}
+	return 1
+}
+
+// apkSuffixOrder apk 版本后缀的排序，_alpha < _beta < _pre < _rc < 无后缀 < _cvs < _svn < _git < _hg < _p
+var apkSuffixOrder = map[string]int{
+	"alpha": -4, "beta": -3, "pre": -2, "rc": -1,
+	"cvs": 1, "svn": 2, "git": 3, "hg": 4, "p": 5,
+}
+
+// compareApkVersions 比较 apk 版本，如 1.2.3_rc1-r2
+func compareApkVersions(a, b string) int {
+	versionA, releaseA := a, ""
+	if idx := strings.LastIndex(a, "-r"); idx >= 0 {
+		versionA, releaseA = a[:idx], a[idx+2:]
+	}
+	versionB, releaseB := b, ""
+	if idx := strings.LastIndex(b, "-r"); idx >= 0 {
+		versionB, releaseB = b[:idx], b[idx+2:]
+	}
+
+	mainA, suffixA, _ := strings.Cut(versionA, "_")
+	mainB, suffixB, _ := strings.Cut(versionB, "_")
+
+	if c := compareNatural(mainA, mainB); c != 0 {
+		return c
+	}
+	if c := compareApkSuffix(suffixA, suffixB); c != 0 {
+		return c
+	}
+	relA, _ := strconv.Atoi(releaseA)
+	relB, _ := strconv.Atoi(releaseB)
+	return compareInts(relA, relB)
+}
+
+// compareApkSuffix 比较 apk 版本后缀
+func compareApkSuffix(a, b string) int {
+	if a == b {
+		return 0
+	}
+	nameA := strings.TrimRightFunc(a, unicode.IsDigit)
+	nameB := strings.TrimRightFunc(b, unicode.IsDigit)
+	if c := compareInts(apkSuffixOrder[nameA], apkSuffixOrder[nameB]); c != 0 {
+		return c
+	}
+	numA, _ := strconv.Atoi(a[len(nameA):])
+	numB, _ := strconv.Atoi(b[len(nameB):])
+	return compareInts(numA, numB)
+}
+
+// compareSemver 比较语义化版本，忽略前缀 v / go 和构建元数据
+func compareSemver(a, b string) int {
+	normalize := func(v string) (string, string) {
+		v = strings.TrimPrefix(strings.TrimPrefix(v, "go"), "v")
+		v, _, _ = strings.Cut(v, "+")
+		core, pre, _ := strings.Cut(v, "-")
+		return core, pre
+	}
+	coreA, preA := normalize(a)
+	coreB, preB := normalize(b)
+
+	partsA := strings.Split(coreA, ".")
+	partsB := strings.Split(coreB, ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var x, y int
+		if i < len(partsA) {
+			x, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			y, _ = strconv.Atoi(partsB[i])
+		}
+		if c := compareInts(x, y); c != 0 {
+			return c
+		}
+	}
+
+	// 有预发布标识的版本更旧
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	return compareNatural(preA, preB)
+}
+
+// compareNatural 将版本拆分为数字段和非数字段依次比较，作为通用的回退规则
+func compareNatural(a, b string) int {
+	segA, segB := naturalSegments(a), naturalSegments(b)
+	for i := 0; i < len(segA) && i < len(segB); i++ {
+		x, y := segA[i], segB[i]
+		nx, errX := strconv.Atoi(x)
+		ny, errY := strconv.Atoi(y)
+		var c int
+		switch {
+		case errX == nil && errY == nil:
+			c = compareInts(nx, ny)
+		case errX == nil:
+			c = 1
+		case errY == nil:
+			c = -1
+		default:
+			c = strings.Compare(x, y)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(segA), len(segB))
+}
+
+// naturalSegments 按数字 / 字母拆分版本号，忽略分隔符
+func naturalSegments(v string) []string {
+	var segments []string
+	var current strings.Builder
+	lastDigit := false
+	flush := func() {
+		if current.Len() > 0 {
+			segments = append(segments, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range v {
+		switch {
+		case unicode.IsDigit(r):
+			if !lastDigit {
+				flush()
+			}
+			lastDigit = true
+			current.WriteRune(r)
+		case unicode.IsLetter(r):
+			if lastDigit {
+				flush()
+			}
+			lastDigit = false
+			current.WriteRune(r)
+		default:
+			flush()
+			lastDigit = false
+		}
+	}
+	flush()
+	return segments
+}
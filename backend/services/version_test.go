@@ -0,0 +1,52 @@
+package services
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		ecosystem string
+		a, b      string
+		want      int
+	}{
+		// dpkg
+		{"debian", "1.2.3-1", "1.2.3-1", 0},
+		{"debian", "1.2.3-1", "1.2.3-2", -1},
+		{"debian", "1:1.0-1", "2.0-1", 1},
+		{"debian", "1.0~rc1-1", "1.0-1", -1},
+		{"debian", "1.0-1", "1.0+deb12u1-1", -1},
+		{"ubuntu", "3.0.2-0ubuntu1.10", "3.0.2-0ubuntu1.9", 1},
+		{"debian", "2.36.1-8+deb11u1", "2.36.1-8", 1},
+		// rpm
+		{"red hat", "1.0-1.el9", "1.0-1.el9", 0},
+		{"red hat", "1.0.1-1.el9", "1.0-1.el9", 1},
+		{"rocky linux", "1:1.0-1", "2.0-1", 1},
+		{"almalinux", "1.0~rc1-1", "1.0-1", -1},
+		{"red hat", "1.0a-1", "1.0-1", 1},
+		{"red hat", "1.0-1", "1.0", 0},
+		{"red hat", "5.1.8-6.el9", "5.1.8-10.el9", -1},
+		// apk
+		{"alpine", "1.2.3-r0", "1.2.3-r1", -1},
+		{"alpine", "1.2.3_rc1-r0", "1.2.3-r0", -1},
+		{"alpine", "1.2.3_p1-r0", "1.2.3-r0", 1},
+		{"alpine", "1.2.10-r0", "1.2.9-r5", 1},
+		{"wolfi", "3.1.4_alpha2-r0", "3.1.4_beta1-r0", -1},
+		// semver
+		{"go", "v1.2.3", "1.2.3", 0},
+		{"go", "v1.10.0", "v1.9.9", 1},
+		{"npm", "1.0.0-alpha", "1.0.0", -1},
+		{"npm", "1.0.0-alpha.1", "1.0.0-alpha.2", -1},
+		{"crates.io", "1.0.0+build.5", "1.0.0", 0},
+		{"go", "go1.21.5", "go1.21.10", -1},
+		// 通用回退
+		{"pypi", "2.10", "2.9", 1},
+		{"pypi", "1.0.post1", "1.0", 1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.ecosystem, tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q, %q) = %d, want %d", tt.ecosystem, tt.a, tt.b, got, tt.want)
+		}
+		if got := CompareVersions(tt.ecosystem, tt.b, tt.a); got != -tt.want {
+			t.Errorf("CompareVersions(%q, %q, %q) = %d, want %d", tt.ecosystem, tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
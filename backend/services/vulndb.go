@@ -0,0 +1,554 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// ErrNoVulnerabilityDB 尚未导入漏洞库
+var ErrNoVulnerabilityDB = errors.New("vulnerability database has not been imported")
+
+// osvSeverity OSV 中的严重等级评分
+type osvSeverity struct {
+	Type  string `json:"type"`
+	Score string `json:"score"`
+}
+
+// osvRange OSV 中的受影响版本范围
+type osvRange struct {
+	Type   string              `json:"type"`
+	Events []map[string]string `json:"events"`
+}
+
+// osvAffected OSV 中受影响的软件包
+type osvAffected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Severity          []osvSeverity          `json:"severity"`
+	Ranges            []osvRange             `json:"ranges"`
+	Versions          []string               `json:"versions"`
+	EcosystemSpecific map[string]interface{} `json:"ecosystem_specific"`
+	DatabaseSpecific  map[string]interface{} `json:"database_specific"`
+}
+
+// osvRecord OSV 格式的漏洞记录
+type osvRecord struct {
+	ID               string                 `json:"id"`
+	Summary          string                 `json:"summary"`
+	Details          string                 `json:"details"`
+	Aliases          []string               `json:"aliases"`
+	Upstream         []string               `json:"upstream"`
+	Published        string                 `json:"published"`
+	Modified         string                 `json:"modified"`
+	Withdrawn        string                 `json:"withdrawn"`
+	Severity         []osvSeverity          `json:"severity"`
+	Affected         []osvAffected          `json:"affected"`
+	DatabaseSpecific map[string]interface{} `json:"database_specific"`
+}
+
+// osvImporter 将 OSV 记录分批写入数据库
+type osvImporter struct {
+	ctx        *JobContext
+	tx         *gorm.DB
+	advisories []models.Advisory
+	affected   [][]models.AdvisoryAffected
+	result     *models.VulnerabilityDB
+}
+
+const osvImportBatchSize = 500
+
+// VulnDBImportParams 导入漏洞库任务的参数
+type VulnDBImportParams struct {
+	Source string `json:"source"`
+	Upload bool   `json:"upload"` // Source 是上传时保存的临时文件，导入结束后删除其所在目录
+}
+
+// VulnDBImportResult 导入漏洞库任务的结果
+type VulnDBImportResult struct {
+	DB        *models.VulnerabilityDB `json:"db"`
+	RescanJob *models.Job             `json:"rescan_job,omitempty"`
+}
+
+func init() {
+	RegisterJobHandler(models.JobTypeVulnImport, runVulnDBImportJob)
+}
+
+// ResolveVulnDBPath 检查通过 ?path= 指定的导入路径，只允许 VULN_DB_PATH 本身或其下的文件，
+// 相对路径相对于 VULN_DB_PATH 解析，p 为空时返回 VULN_DB_PATH
+func ResolveVulnDBPath(p string) (string, error) {
+	base := os.Getenv("VULN_DB_PATH")
+	switch {
+	case base == "" && p == "":
+		return "", errors.New("file upload or VULN_DB_PATH is required")
+	case base == "":
+		return "", errors.New("path parameter requires VULN_DB_PATH to be configured")
+	case p == "":
+		return base, nil
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(base, p)
+	}
+
+	// 解析符号链接后再比较，避免通过链接访问目录之外的文件
+	realBase, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		return "", err
+	}
+	realPath, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", errors.New("path not found")
+	}
+	rel, err := filepath.Rel(realBase, realPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("path must be inside VULN_DB_PATH")
+	}
+	return realPath, nil
+}
+
+// runVulnDBImportJob 导入漏洞库，成功后创建重新匹配所有清单的任务
+func runVulnDBImportJob(ctx *JobContext, params json.RawMessage) (interface{}, error) {
+	var p VulnDBImportParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Upload {
+		defer os.RemoveAll(filepath.Dir(p.Source))
+	}
+
+	ctx.SetProgress(0, 0, "Importing "+filepath.Base(p.Source))
+	db, err := ImportVulnerabilityDB(ctx, p.Source)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Logf("info", "Imported %d advisories affecting %d packages, skipped %d files",
+		db.AdvisoryCount, db.AffectedCount, db.SkippedFiles)
+
+	result := &VulnDBImportResult{DB: db}
+	result.RescanJob, err = EnqueueJob(models.JobTypeVulnRescan, 0, nil)
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// ImportVulnerabilityDB 从 OSV 数据（目录、zip 压缩包或单个 JSON 文件）导入漏洞库，替换已有数据
+func ImportVulnerabilityDB(ctx *JobContext, source string) (*models.VulnerabilityDB, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.VulnerabilityDB{Source: source}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.AdvisoryAffected{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("1 = 1").Delete(&models.Advisory{}).Error; err != nil {
+			return err
+		}
+
+		importer := &osvImporter{ctx: ctx, tx: tx, result: result}
+		var err error
+		switch {
+		case info.IsDir():
+			err = filepath.WalkDir(source, func(p string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				switch strings.ToLower(filepath.Ext(p)) {
+				case ".json":
+					return importer.addFile(p)
+				case ".zip":
+					return importer.addZip(p)
+				}
+				return nil
+			})
+		case strings.EqualFold(filepath.Ext(source), ".zip"):
+			err = importer.addZip(source)
+		default:
+			err = importer.addFile(source)
+		}
+		if err != nil {
+			return err
+		}
+		if err := importer.flush(); err != nil {
+			return err
+		}
+		if result.AdvisoryCount == 0 {
+			return errors.New("no OSV records found in " + source)
+		}
+		return tx.Create(result).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// addFile 导入单个 JSON 文件
+func (im *osvImporter) addFile(p string) error {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	return im.addData(data)
+}
+
+// addZip 导入 zip 压缩包中的所有 JSON 文件（osv.dev 按生态系统提供的 all.zip）
+func (im *osvImporter) addZip(p string) error {
+	reader, err := zip.OpenReader(p)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() || !strings.EqualFold(filepath.Ext(f.Name), ".json") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if err := im.addData(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addData 解析单条记录或记录数组，无法解析的文件计入 SkippedFiles
+func (im *osvImporter) addData(data []byte) error {
+	var records []osvRecord
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal(data, &records); err != nil {
+			im.result.SkippedFiles++
+			return nil
+		}
+	} else {
+		var record osvRecord
+		if err := json.Unmarshal(data, &record); err != nil || record.ID == "" {
+			im.result.SkippedFiles++
+			return nil
+		}
+		records = append(records, record)
+	}
+
+	for i := range records {
+		if err := im.add(&records[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add 转换单条 OSV 记录，攒满一批后写入数据库
+func (im *osvImporter) add(record *osvRecord) error {
+	if record.ID == "" || record.Withdrawn != "" || len(record.Affected) == 0 {
+		return nil
+	}
+
+	severity, score := advisorySeverity(record.Severity, record.DatabaseSpecific)
+	summary := record.Summary
+	if summary == "" {
+		summary, _, _ = strings.Cut(strings.TrimSpace(record.Details), "\n")
+	}
+	aliases := append(append([]string{}, record.Aliases...), record.Upstream...)
+	advisory := models.Advisory{
+		AdvisoryID: record.ID,
+		CVE:        firstCVE(record.ID, aliases),
+		Aliases:    strings.Join(aliases, ","),
+		Summary:    summary,
+		Severity:   severity,
+		Score:      score,
+		Published:  record.Published,
+		Modified:   record.Modified,
+	}
+
+	var affected []models.AdvisoryAffected
+	for _, a := range record.Affected {
+		if a.Package.Name == "" || a.Package.Ecosystem == "" {
+			continue
+		}
+		ecosystem, release := parseOSVEcosystem(a.Package.Ecosystem)
+		ranges, _ := json.Marshal(a.Ranges)
+		versions, _ := json.Marshal(a.Versions)
+		affectedSeverity := ""
+		if len(a.Severity) > 0 || a.EcosystemSpecific["severity"] != nil || a.DatabaseSpecific["severity"] != nil {
+			affectedSeverity, _ = advisorySeverity(a.Severity, a.EcosystemSpecific, a.DatabaseSpecific)
+		}
+		affected = append(affected, models.AdvisoryAffected{
+			Ecosystem: ecosystem,
+			Release:   release,
+			Package:   normalizePackageName(ecosystem, a.Package.Name),
+			Ranges:    string(ranges),
+			Versions:  string(versions),
+			Severity:  affectedSeverity,
+		})
+	}
+	if len(affected) == 0 {
+		return nil
+	}
+
+	im.advisories = append(im.advisories, advisory)
+	im.affected = append(im.affected, affected)
+	if len(im.advisories) >= osvImportBatchSize {
+		return im.flush()
+	}
+	return nil
+}
+
+// flush 写入当前批次，同一 ID 的公告以后出现的为准
+func (im *osvImporter) flush() error {
+	if len(im.advisories) == 0 {
+		return nil
+	}
+	// 导入在一个事务中进行，期间不能通过 ctx 写入任务进度，只检查是否取消
+	if err := im.ctx.Check(); err != nil {
+		return err
+	}
+
+	for i := range im.advisories {
+		var existing models.Advisory
+		err := im.tx.Where("advisory_id = ?", im.advisories[i].AdvisoryID).First(&existing).Error
+		switch {
+		case err == nil:
+			if err := im.tx.Where("advisory_id = ?", existing.ID).Delete(&models.AdvisoryAffected{}).Error; err != nil {
+				return err
+			}
+			if err := im.tx.Delete(&existing).Error; err != nil {
+				return err
+			}
+			im.result.AdvisoryCount--
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+		if err := im.tx.Create(&im.advisories[i]).Error; err != nil {
+			return err
+		}
+		im.result.AdvisoryCount++
+	}
+
+	var affected []models.AdvisoryAffected
+	for i, list := range im.affected {
+		for _, a := range list {
+			a.AdvisoryID = im.advisories[i].ID
+			affected = append(affected, a)
+		}
+	}
+	if err := im.tx.CreateInBatches(affected, osvImportBatchSize).Error; err != nil {
+		return err
+	}
+	im.result.AffectedCount += len(affected)
+
+	im.advisories = im.advisories[:0]
+	im.affected = im.affected[:0]
+	return nil
+}
+
+var cvePattern = regexp.MustCompile(`^CVE-\d{4}-\d+$`)
+
+// firstCVE 返回记录 ID 或别名中的第一个 CVE 编号
+func firstCVE(id string, aliases []string) string {
+	if cvePattern.MatchString(id) {
+		return id
+	}
+	for _, alias := range aliases {
+		if cvePattern.MatchString(alias) {
+			return alias
+		}
+	}
+	return ""
+}
+
+// parseOSVEcosystem 拆分 OSV 生态系统名称，如 "Debian:12" -> ("debian", "12")、"Ubuntu:22.04:LTS" -> ("ubuntu", "22.04")
+func parseOSVEcosystem(ecosystem string) (string, string) {
+	parts := strings.Split(ecosystem, ":")
+	name := strings.ToLower(strings.TrimSpace(parts[0]))
+	release := ""
+	if len(parts) > 1 {
+		release = strings.TrimSpace(parts[1])
+	}
+	return name, release
+}
+
+var pypiNameSeparators = regexp.MustCompile(`[-_.]+`)
+
+// normalizePackageName 统一软件包名称的大小写和分隔符，便于匹配
+func normalizePackageName(ecosystem, name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if ecosystem == "pypi" {
+		name = pypiNameSeparators.ReplaceAllString(name, "-")
+	}
+	return name
+}
+
+// normalizeSeverity 将各数据源的严重等级统一为 CRITICAL / HIGH / MEDIUM / LOW
+func normalizeSeverity(severity string) string {
+	switch strings.ToUpper(strings.TrimSpace(severity)) {
+	case "CRITICAL":
+		return models.SeverityCritical
+	case "HIGH", "IMPORTANT":
+		return models.SeverityHigh
+	case "MEDIUM", "MODERATE":
+		return models.SeverityMedium
+	case "LOW", "NEGLIGIBLE", "UNIMPORTANT", "MINOR":
+		return models.SeverityLow
+	}
+	return ""
+}
+
+// severityFromScore 按 CVSS 评分划分严重等级
+func severityFromScore(score float64) string {
+	switch {
+	case score >= 9.0:
+		return models.SeverityCritical
+	case score >= 7.0:
+		return models.SeverityHigh
+	case score >= 4.0:
+		return models.SeverityMedium
+	case score > 0:
+		return models.SeverityLow
+	}
+	return models.SeverityUnknown
+}
+
+// advisorySeverity 计算严重等级：优先使用数据源给出的等级，其次按 CVSS v3 向量计算
+func advisorySeverity(severities []osvSeverity, specifics ...map[string]interface{}) (string, float64) {
+	score := 0.0
+	for _, s := range severities {
+		if strings.HasPrefix(s.Type, "CVSS_V3") {
+			if v, ok := cvss3BaseScore(s.Score); ok && v > score {
+				score = v
+			}
+		}
+	}
+
+	for _, specific := range specifics {
+		if level, ok := specific["severity"].(string); ok {
+			if normalized := normalizeSeverity(level); normalized != "" {
+				return normalized, score
+			}
+		}
+	}
+	// Ubuntu 等数据源在 severity 中直接给出等级
+	for _, s := range severities {
+		if !strings.HasPrefix(s.Type, "CVSS_") {
+			if normalized := normalizeSeverity(s.Score); normalized != "" {
+				return normalized, score
+			}
+		}
+	}
+	return severityFromScore(score), score
+}
+
+// cvss3BaseScore 按 CVSS v3.x 规范计算向量的基础评分
+func cvss3BaseScore(vector string) (float64, bool) {
+	weights := map[string]map[string]float64{
+		"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+		"AC": {"L": 0.77, "H": 0.44},
+		"UI": {"N": 0.85, "R": 0.62},
+		"C":  {"H": 0.56, "L": 0.22, "N": 0},
+		"I":  {"H": 0.56, "L": 0.22, "N": 0},
+		"A":  {"H": 0.56, "L": 0.22, "N": 0},
+	}
+
+	metrics := map[string]string{}
+	for _, part := range strings.Split(vector, "/") {
+		if key, value, found := strings.Cut(part, ":"); found {
+			metrics[key] = value
+		}
+	}
+	if !strings.HasPrefix(metrics["CVSS"], "3") {
+		return 0, false
+	}
+
+	values := map[string]float64{}
+	for metric, table := range weights {
+		v, ok := table[metrics[metric]]
+		if !ok {
+			return 0, false
+		}
+		values[metric] = v
+	}
+
+	changed := metrics["S"] == "C"
+	var pr float64
+	switch metrics["PR"] {
+	case "N":
+		pr = 0.85
+	case "L":
+		pr = 0.62
+		if changed {
+			pr = 0.68
+		}
+	case "H":
+		pr = 0.27
+		if changed {
+			pr = 0.5
+		}
+	default:
+		return 0, false
+	}
+
+	iss := 1 - (1-values["C"])*(1-values["I"])*(1-values["A"])
+	var impact float64
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	} else {
+		impact = 6.42 * iss
+	}
+	if impact <= 0 {
+		return 0, true
+	}
+
+	exploitability := 8.22 * values["AV"] * values["AC"] * pr * values["UI"]
+	if changed {
+		return cvssRoundUp(math.Min(1.08*(impact+exploitability), 10)), true
+	}
+	return cvssRoundUp(math.Min(impact+exploitability, 10)), true
+}
+
+// cvssRoundUp CVSS v3.1 规定的向上取整到一位小数
+func cvssRoundUp(v float64) float64 {
+	n := int(math.Round(v * 100000))
+	if n%10000 == 0 {
+		return float64(n) / 100000
+	}
+	return float64(n/10000+1) / 10
+}
+
+// GetVulnerabilityDB 获取最近一次导入的漏洞库
+func GetVulnerabilityDB() (*models.VulnerabilityDB, error) {
+	var db models.VulnerabilityDB
+	err := config.DB.Order("id DESC").First(&db).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoVulnerabilityDB
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load vulnerability database: %w", err)
+	}
+	return &db, nil
+}
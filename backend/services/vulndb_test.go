@@ -0,0 +1,109 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+func TestResolveVulnDBPath(t *testing.T) {
+	root := t.TempDir()
+	base := filepath.Join(root, "osv")
+	outside := filepath.Join(root, "secret.json")
+	for _, dir := range []string{base, filepath.Join(base, "debian")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{outside, filepath.Join(base, "debian", "all.zip")} {
+		if err := os.WriteFile(file, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(base, "link.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		env   string
+		path  string
+		want  string
+		error bool
+	}{
+		{name: "default", env: base, want: base},
+		{name: "relative", env: base, path: "debian/all.zip", want: filepath.Join(base, "debian", "all.zip")},
+		{name: "absolute inside", env: base, path: filepath.Join(base, "debian"), want: filepath.Join(base, "debian")},
+		{name: "parent", env: base, path: "../secret.json", error: true},
+		{name: "absolute outside", env: base, path: outside, error: true},
+		{name: "symlink outside", env: base, path: "link.json", error: true},
+		{name: "missing", env: base, path: "missing.json", error: true},
+		{name: "not configured", path: outside, error: true},
+		{name: "nothing", error: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("VULN_DB_PATH", tt.env)
+			got, err := ResolveVulnDBPath(tt.path)
+			if tt.error {
+				if err == nil {
+					t.Fatalf("got %s, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, _ := filepath.EvalSymlinks(tt.want); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestRunVulnDBImportJob(t *testing.T) {
+	setupTestDB(t, &models.Advisory{}, &models.AdvisoryAffected{}, &models.VulnerabilityDB{}, &models.Job{}, &models.JobLog{})
+
+	dir := filepath.Join(t.TempDir(), "upload")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(dir, "osv.json")
+	osv := `[
+		{"id": "DSA-1", "aliases": ["CVE-2024-0001"], "summary": "first",
+		 "affected": [{"package": {"ecosystem": "Debian:12", "name": "openssl"}, "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "3.0.12"}]}]}]},
+		{"id": "GHSA-2", "withdrawn": "2024-01-01T00:00:00Z",
+		 "affected": [{"package": {"ecosystem": "npm", "name": "left-pad"}}]},
+		{"id": "GHSA-3", "summary": "third",
+		 "affected": [{"package": {"ecosystem": "npm", "name": "lodash"}, "versions": ["4.17.20"]},
+		              {"package": {"ecosystem": "npm", "name": "lodash-es"}, "versions": ["4.17.20"]}]}
+	]`
+	if err := os.WriteFile(source, []byte(osv), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	params, _ := json.Marshal(VulnDBImportParams{Source: source, Upload: true})
+	out, err := runVulnDBImportJob(testJobContext(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := out.(*VulnDBImportResult)
+	if result.DB.AdvisoryCount != 2 || result.DB.AffectedCount != 3 {
+		t.Errorf("advisories, affected = %d, %d, want 2, 3", result.DB.AdvisoryCount, result.DB.AffectedCount)
+	}
+	if result.RescanJob == nil || result.RescanJob.Type != models.JobTypeVulnRescan {
+		t.Errorf("rescan job = %+v", result.RescanJob)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("upload directory was not removed: %v", err)
+	}
+
+	var advisory models.Advisory
+	if err := config.DB.Where("advisory_id = ?", "DSA-1").First(&advisory).Error; err != nil || advisory.CVE != "CVE-2024-0001" {
+		t.Errorf("advisory = %+v, %v", advisory, err)
+	}
+}
@@ -0,0 +1,530 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// packageTypeEcosystems 语言生态软件包类型与 OSV 生态系统的对应关系
+var packageTypeEcosystems = map[string]string{
+	"golang":   "go",
+	"npm":      "npm",
+	"pypi":     "pypi",
+	"cargo":    "crates.io",
+	"gem":      "rubygems",
+	"composer": "packagist",
+	"maven":    "maven",
+	"nuget":    "nuget",
+	"hex":      "hex",
+	"pub":      "pub",
+}
+
+// rpmDistroEcosystems os-release 中的发行版 ID 与 OSV 生态系统的对应关系
+var rpmDistroEcosystems = map[string]string{
+	"rocky":               "rocky linux",
+	"almalinux":           "almalinux",
+	"rhel":                "red hat",
+	"centos":              "red hat",
+	"redhat":              "red hat",
+	"opensuse-leap":       "opensuse",
+	"opensuse-tumbleweed": "opensuse",
+	"sles":                "suse",
+	"mageia":              "mageia",
+	"openeuler":           "openeuler",
+}
+
+// packageMatch 软件包在漏洞库中的查询条件
+type packageMatch struct {
+	ecosystem string
+	release   string
+	names     []string
+}
+
+// matchPackage 根据软件包类型和发行版确定 OSV 生态系统、发行版版本及候选名称（包括源码包名称），
+// 无法匹配的类型返回 nil
+func matchPackage(pkg models.InventoryPackage, distro string) *packageMatch {
+	p, _ := ParsePURL(pkg.PURL)
+	if p != nil {
+		if d := distroFromPURL(p); d != "" {
+			distro = d
+		}
+	}
+	distroID, distroVersion, _ := strings.Cut(distro, ":")
+
+	m := &packageMatch{}
+	switch pkg.Type {
+	case "deb":
+		m.ecosystem = "debian"
+		if distroID == "ubuntu" || (p != nil && p.Namespace == "ubuntu") {
+			m.ecosystem = "ubuntu"
+		}
+		m.release = distroVersion
+	case "apk":
+		m.ecosystem = "alpine"
+		if distroID == "wolfi" || distroID == "chainguard" {
+			m.ecosystem = distroID
+		}
+		m.release = distroVersion
+	case "rpm":
+		ecosystem, ok := rpmDistroEcosystems[distroID]
+		if !ok {
+			return nil
+		}
+		m.ecosystem = ecosystem
+		m.release = distroVersion
+	default:
+		ecosystem, ok := packageTypeEcosystems[pkg.Type]
+		if !ok {
+			return nil
+		}
+		m.ecosystem = ecosystem
+	}
+
+	m.names = append(m.names, normalizePackageName(m.ecosystem, pkg.Name))
+	if p != nil {
+		if upstream := p.Qualifiers["upstream"]; upstream != "" {
+			m.names = append(m.names, normalizePackageName(m.ecosystem, upstream))
+		}
+		// maven 在 OSV 中使用 groupId:artifactId
+		if m.ecosystem == "maven" && p.Namespace != "" {
+			m.names = append(m.names, normalizePackageName(m.ecosystem, p.Namespace+":"+p.Name))
+		}
+	}
+	return m
+}
+
+// releaseMatches 判断公告的发行版版本是否适用于镜像的发行版，任一方未知时视为适用
+func releaseMatches(advisoryRelease, distroVersion string) bool {
+	advisoryRelease = strings.TrimPrefix(advisoryRelease, "v")
+	distroVersion = strings.TrimPrefix(distroVersion, "v")
+	if advisoryRelease == "" || distroVersion == "" {
+		return true
+	}
+	return distroVersion == advisoryRelease || strings.HasPrefix(distroVersion, advisoryRelease+".")
+}
+
+// versionAffected 按 OSV 的 ranges 和 versions 判断版本是否受影响，返回修复版本（可能为空）
+func versionAffected(ecosystem, version string, ranges []osvRange, versions []string) (bool, string) {
+	affected := false
+	for _, v := range versions {
+		if v == version {
+			affected = true
+			break
+		}
+	}
+
+	fixedVersion := ""
+	for _, r := range ranges {
+		var compare func(a, b string) int
+		switch r.Type {
+		case "SEMVER":
+			compare = compareSemver
+		case "ECOSYSTEM":
+			compare = func(a, b string) int { return CompareVersions(ecosystem, a, b) }
+		default:
+			// GIT 范围需要提交历史，无法离线判断
+			continue
+		}
+
+		inRange, fix := false, ""
+		for _, event := range sortedEvents(r.Events, compare) {
+			if introduced, ok := event["introduced"]; ok {
+				if introduced == "0" || compare(version, introduced) >= 0 {
+					inRange, fix = true, ""
+				}
+			} else if fixed, ok := event["fixed"]; ok {
+				if compare(version, fixed) >= 0 {
+					inRange = false
+				} else if inRange && fix == "" {
+					fix = fixed
+				}
+			} else if lastAffected, ok := event["last_affected"]; ok {
+				if compare(version, lastAffected) > 0 {
+					inRange = false
+				}
+			} else if limit, ok := event["limit"]; ok {
+				if compare(version, limit) >= 0 {
+					inRange = false
+				}
+			}
+		}
+		if inRange {
+			affected = true
+			if fixedVersion == "" {
+				fixedVersion = fix
+			}
+		}
+	}
+	return affected, fixedVersion
+}
+
+// eventVersion 返回事件中的版本，introduced 为 "0" 时表示从最早的版本开始
+func eventVersion(event map[string]string) string {
+	for _, key := range []string{"introduced", "fixed", "last_affected", "limit"} {
+		if v, ok := event[key]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// sortedEvents 按版本排序 OSV 事件，规范不保证事件有序；版本相同时保持原有顺序
+func sortedEvents(events []map[string]string, compare func(a, b string) int) []map[string]string {
+	sorted := append([]map[string]string(nil), events...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := eventVersion(sorted[i]), eventVersion(sorted[j])
+		if a == "0" || b == "0" {
+			return a == "0" && b != "0"
+		}
+		return compare(a, b) < 0
+	})
+	return sorted
+}
+
+// severityRank 严重等级排序，越严重越小
+var severityRank = map[string]int{
+	models.SeverityCritical: 0,
+	models.SeverityHigh:     1,
+	models.SeverityMedium:   2,
+	models.SeverityLow:      3,
+	models.SeverityUnknown:  4,
+}
+
+// ScanInventory 将软件包清单与漏洞库匹配并保存结果，匹配到之前没有的漏洞时发出事件
+func ScanInventory(inventory *models.PackageInventory) (*models.VulnerabilityScan, error) {
+	scan, found, err := scanInventory(inventory)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) > 0 {
+		emitVulnerabilitiesFound(inventory, found)
+	}
+	return scan, nil
+}
+
+// scanInventory 匹配并保存结果，同时返回上次匹配结果中没有的漏洞
+func scanInventory(inventory *models.PackageInventory) (*models.VulnerabilityScan, []models.ImageVulnerability, error) {
+	db, err := GetVulnerabilityDB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var packages []models.InventoryPackage
+	if err := config.DB.Where("inventory_id = ?", inventory.ID).Find(&packages).Error; err != nil {
+		return nil, nil, err
+	}
+
+	// 按生态系统收集需要查询的软件包名称
+	matches := make([]*packageMatch, len(packages))
+	names := map[string]map[string]bool{}
+	for i, pkg := range packages {
+		m := matchPackage(pkg, inventory.Distro)
+		if m == nil {
+			continue
+		}
+		matches[i] = m
+		if names[m.ecosystem] == nil {
+			names[m.ecosystem] = map[string]bool{}
+		}
+		for _, name := range m.names {
+			names[m.ecosystem][name] = true
+		}
+	}
+
+	candidates := map[string][]models.AdvisoryAffected{}
+	advisoryIDs := map[uint]bool{}
+	for ecosystem, set := range names {
+		list := make([]string, 0, len(set))
+		for name := range set {
+			list = append(list, name)
+		}
+		for start := 0; start < len(list); start += 500 {
+			end := start + 500
+			if end > len(list) {
+				end = len(list)
+			}
+			var rows []models.AdvisoryAffected
+			if err := config.DB.Where("ecosystem = ? AND package IN ?", ecosystem, list[start:end]).Find(&rows).Error; err != nil {
+				return nil, nil, err
+			}
+			for _, row := range rows {
+				key := row.Ecosystem + "\x00" + row.Package
+				candidates[key] = append(candidates[key], row)
+				advisoryIDs[row.AdvisoryID] = true
+			}
+		}
+	}
+
+	advisories := map[uint]models.Advisory{}
+	if len(advisoryIDs) > 0 {
+		ids := make([]uint, 0, len(advisoryIDs))
+		for id := range advisoryIDs {
+			ids = append(ids, id)
+		}
+		var rows []models.Advisory
+		if err := config.DB.Where("id IN ?", ids).Find(&rows).Error; err != nil {
+			return nil, nil, err
+		}
+		for _, row := range rows {
+			advisories[row.ID] = row
+		}
+	}
+
+	var vulnerabilities []models.ImageVulnerability
+	seen := map[string]bool{}
+	for i, pkg := range packages {
+		m := matches[i]
+		if m == nil {
+			continue
+		}
+		for _, name := range m.names {
+			for _, row := range candidates[m.ecosystem+"\x00"+name] {
+				advisory, ok := advisories[row.AdvisoryID]
+				if !ok || !releaseMatches(row.Release, m.release) {
+					continue
+				}
+				key := advisory.AdvisoryID + "\x00" + pkg.Name + "\x00" + pkg.Version
+				if seen[key] {
+					continue
+				}
+
+				var ranges []osvRange
+				var versions []string
+				json.Unmarshal([]byte(row.Ranges), &ranges)
+				json.Unmarshal([]byte(row.Versions), &versions)
+				affected, fixed := versionAffected(m.ecosystem, packageVersion(pkg), ranges, versions)
+				if !affected {
+					continue
+				}
+				seen[key] = true
+
+				severity := row.Severity
+				if severity == "" {
+					severity = advisory.Severity
+				}
+				if severity == "" {
+					severity = models.SeverityUnknown
+				}
+				vulnerabilities = append(vulnerabilities, models.ImageVulnerability{
+					InventoryID:  inventory.ID,
+					Digest:       inventory.Digest,
+					AdvisoryID:   advisory.AdvisoryID,
+					CVE:          advisory.CVE,
+					Summary:      advisory.Summary,
+					Severity:     severity,
+					Score:        advisory.Score,
+					Package:      pkg.Name,
+					PackageType:  pkg.Type,
+					Version:      pkg.Version,
+					FixedVersion: fixed,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(vulnerabilities, func(i, j int) bool {
+		return severityRank[vulnerabilities[i].Severity] < severityRank[vulnerabilities[j].Severity]
+	})
+
+	scan := &models.VulnerabilityScan{
+		InventoryID: inventory.ID,
+		Digest:      inventory.Digest,
+		DBVersion:   db.ID,
+		ScannedAt:   time.Now(),
+	}
+	for _, v := range vulnerabilities {
+		scan.Add(v.Severity)
+	}
+
+	var found []models.ImageVulnerability
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var previous []models.ImageVulnerability
+		if err := tx.Select("advisory_id", "package", "version").Where("inventory_id = ?", inventory.ID).Find(&previous).Error; err != nil {
+			return err
+		}
+		known := map[string]bool{}
+		for _, v := range previous {
+			known[v.AdvisoryID+"\x00"+v.Package+"\x00"+v.Version] = true
+		}
+		for _, v := range vulnerabilities {
+			if !known[v.AdvisoryID+"\x00"+v.Package+"\x00"+v.Version] {
+				found = append(found, v)
+			}
+		}
+
+		if err := tx.Where("inventory_id = ?", inventory.ID).Delete(&models.ImageVulnerability{}).Error; err != nil {
+			return err
+		}
+		if len(vulnerabilities) > 0 {
+			if err := tx.CreateInBatches(vulnerabilities, 500).Error; err != nil {
+				return err
+			}
+		}
+
+		var existing models.VulnerabilityScan
+		err := tx.Where("inventory_id = ?", inventory.ID).First(&existing).Error
+		switch {
+		case err == nil:
+			scan.ID = existing.ID
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+		return tx.Save(scan).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return scan, found, nil
+}
+
+// packageVersion 返回用于比较的版本号，Go 标准库去掉 go 前缀
+func packageVersion(pkg models.InventoryPackage) string {
+	if pkg.Type == "golang" && pkg.Name == "stdlib" {
+		return strings.TrimPrefix(pkg.Version, "go")
+	}
+	return pkg.Version
+}
+
+// EnsureInventoryScan 返回清单的漏洞匹配结果，没有结果、漏洞库已更新或清单已重建时重新匹配
+func EnsureInventoryScan(inventory *models.PackageInventory) (*models.VulnerabilityScan, error) {
+	db, err := GetVulnerabilityDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var scan models.VulnerabilityScan
+	err = config.DB.Where("inventory_id = ?", inventory.ID).First(&scan).Error
+	if err == nil && scan.DBVersion == db.ID && !scan.ScannedAt.Before(inventory.UpdatedAt) {
+		return &scan, nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return ScanInventory(inventory)
+}
+
+func init() {
+	RegisterJobHandler(models.JobTypeVulnRescan, func(ctx *JobContext, _ json.RawMessage) (interface{}, error) {
+		return RescanInventories(ctx)
+	})
+}
+
+// RescanResult 重新匹配的结果
+type RescanResult struct {
+	Scanned int `json:"scanned"`
+	Failed  int `json:"failed"`
+}
+
+// RescanInventories 漏洞库导入后重新匹配所有软件包清单
+func RescanInventories(ctx *JobContext) (*RescanResult, error) {
+	var inventories []models.PackageInventory
+	if err := config.DB.Find(&inventories).Error; err != nil {
+		return nil, err
+	}
+
+	result := &RescanResult{}
+	var affected []map[string]interface{}
+	for i := range inventories {
+		if err := ctx.Check(); err != nil {
+			return result, err
+		}
+		ctx.SetProgress(int64(i), int64(len(inventories)), "Scanning "+shortDigest(inventories[i].Digest))
+		_, found, err := scanInventory(&inventories[i])
+		if err != nil {
+			result.Failed++
+			ctx.Logf("warn", "Failed to scan inventory %s: %v", inventories[i].Digest, err)
+			continue
+		}
+		result.Scanned++
+		if len(found) > 0 {
+			var summary models.VulnerabilitySummary
+			for _, v := range found {
+				summary.Add(v.Severity)
+			}
+			affected = append(affected, map[string]interface{}{
+				"digest":          inventories[i].Digest,
+				"images":          inventoryImageNames(inventories[i].Digest),
+				"vulnerabilities": summary,
+			})
+		}
+	}
+
+	// 漏洞库更新后汇总为一个事件，避免逐个镜像通知
+	if len(affected) > 0 {
+		Emit(models.Event{
+			Type:    models.EventVulnerabilityFound,
+			Summary: fmt.Sprintf("Vulnerability rescan found new vulnerabilities in %d images", len(affected)),
+			Data:    map[string]interface{}{"job_id": ctx.JobID(), "inventories": affected},
+		})
+	}
+	return result, nil
+}
+
+// GetTagVulnerabilitySummary 获取已建立清单的标签的漏洞汇总，优先使用 SBOM 清单，没有结果时返回 nil
+func GetTagVulnerabilitySummary(registryID uint, repository, tag string) *models.VulnerabilitySummary {
+	var scans []models.VulnerabilityScan
+	err := config.DB.Model(&models.VulnerabilityScan{}).
+		Joins("JOIN package_inventories ON package_inventories.id = vulnerability_scans.inventory_id").
+		Joins("JOIN inventory_images ON inventory_images.digest = package_inventories.digest").
+		Where("inventory_images.registry_id = ? AND inventory_images.repository = ? AND inventory_images.tag = ?",
+			registryID, repository, tag).
+		Order("CASE package_inventories.source WHEN 'sbom' THEN 0 ELSE 1 END").
+		Find(&scans).Error
+	if err != nil || len(scans) == 0 {
+		return nil
+	}
+	return &scans[0].VulnerabilitySummary
+}
+
+// inventoryImageNames 列出指向 digest 的镜像，格式为 仓库:标签
+func inventoryImageNames(digest string) []string {
+	var images []models.InventoryImage
+	config.DB.Where("digest = ?", digest).Order("registry_id, repository, tag").Find(&images)
+	names := make([]string, 0, len(images))
+	for _, image := range images {
+		names = append(names, image.Repository+":"+image.Tag)
+	}
+	return names
+}
+
+// emitVulnerabilitiesFound 单个镜像匹配到新的漏洞时发出事件
+func emitVulnerabilitiesFound(inventory *models.PackageInventory, found []models.ImageVulnerability) {
+	var summary models.VulnerabilitySummary
+	advisories := []string{}
+	for _, v := range found {
+		summary.Add(v.Severity)
+		if len(advisories) < 10 {
+			advisories = append(advisories, v.AdvisoryID)
+		}
+	}
+
+	event := models.Event{
+		Type:   models.EventVulnerabilityFound,
+		Digest: inventory.Digest,
+		Data: map[string]interface{}{
+			"vulnerabilities": summary,
+			"advisories":      advisories,
+			"images":          inventoryImageNames(inventory.Digest),
+		},
+	}
+	image := shortDigest(inventory.Digest)
+	var first models.InventoryImage
+	if err := config.DB.Where("digest = ?", inventory.Digest).Order("id").First(&first).Error; err == nil {
+		event.RegistryID = first.RegistryID
+		event.Repository = first.Repository
+		event.Tag = first.Tag
+		image = first.Repository + ":" + first.Tag
+	}
+	event.Summary = fmt.Sprintf("%d new vulnerabilities (%d critical, %d high) found in %s",
+		summary.Total, summary.Critical, summary.High, image)
+	Emit(event)
+}
@@ -0,0 +1,88 @@
+package services
+
+import "testing"
+
+func TestVersionAffected(t *testing.T) {
+	events := func(pairs ...string) []map[string]string {
+		var out []map[string]string
+		for i := 0; i+1 < len(pairs); i += 2 {
+			out = append(out, map[string]string{pairs[i]: pairs[i+1]})
+		}
+		return out
+	}
+	tests := []struct {
+		name      string
+		ecosystem string
+		version   string
+		ranges    []osvRange
+		versions  []string
+		affected  bool
+		fixed     string
+	}{
+		{
+			name: "introduced zero before fix", ecosystem: "go", version: "1.2.0",
+			ranges:   []osvRange{{Type: "SEMVER", Events: events("introduced", "0", "fixed", "1.2.3")}},
+			affected: true, fixed: "1.2.3",
+		},
+		{
+			name: "at fixed version", ecosystem: "go", version: "1.2.3",
+			ranges: []osvRange{{Type: "SEMVER", Events: events("introduced", "0", "fixed", "1.2.3")}},
+		},
+		{
+			name: "before introduced", ecosystem: "npm", version: "0.9.0",
+			ranges: []osvRange{{Type: "SEMVER", Events: events("introduced", "1.0.0", "fixed", "1.5.0")}},
+		},
+		{
+			name: "second affected range", ecosystem: "npm", version: "2.1.0",
+			ranges:   []osvRange{{Type: "SEMVER", Events: events("introduced", "1.0.0", "fixed", "1.5.0", "introduced", "2.0.0", "fixed", "2.3.0")}},
+			affected: true, fixed: "2.3.0",
+		},
+		{
+			name: "between ranges", ecosystem: "npm", version: "1.8.0",
+			ranges: []osvRange{{Type: "SEMVER", Events: events("introduced", "1.0.0", "fixed", "1.5.0", "introduced", "2.0.0", "fixed", "2.3.0")}},
+		},
+		{
+			name: "unsorted events", ecosystem: "npm", version: "2.1.0",
+			ranges:   []osvRange{{Type: "SEMVER", Events: events("fixed", "2.3.0", "introduced", "2.0.0", "fixed", "1.5.0", "introduced", "1.0.0")}},
+			affected: true, fixed: "2.3.0",
+		},
+		{
+			name: "unsorted events between ranges", ecosystem: "npm", version: "1.8.0",
+			ranges: []osvRange{{Type: "SEMVER", Events: events("introduced", "2.0.0", "fixed", "2.3.0", "fixed", "1.5.0", "introduced", "0")}},
+		},
+		{
+			name: "last affected", ecosystem: "debian", version: "1.0-3",
+			ranges:   []osvRange{{Type: "ECOSYSTEM", Events: events("introduced", "0", "last_affected", "1.0-3")}},
+			affected: true,
+		},
+		{
+			name: "after last affected", ecosystem: "debian", version: "1.0-4",
+			ranges: []osvRange{{Type: "ECOSYSTEM", Events: events("introduced", "0", "last_affected", "1.0-3")}},
+		},
+		{
+			name: "at limit", ecosystem: "alpine", version: "1.3-r0",
+			ranges: []osvRange{{Type: "ECOSYSTEM", Events: events("introduced", "1.0-r0", "limit", "1.3-r0")}},
+		},
+		{
+			name: "ecosystem comparison", ecosystem: "red hat", version: "1:2.0-1.el9",
+			ranges:   []osvRange{{Type: "ECOSYSTEM", Events: events("introduced", "0", "fixed", "1:2.0-3.el9")}},
+			affected: true, fixed: "1:2.0-3.el9",
+		},
+		{
+			name: "git ranges are ignored", ecosystem: "go", version: "1.0.0",
+			ranges: []osvRange{{Type: "GIT", Events: events("introduced", "0")}},
+		},
+		{
+			name: "explicit versions", ecosystem: "pypi", version: "1.4",
+			versions: []string{"1.3", "1.4"}, affected: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			affected, fixed := versionAffected(tt.ecosystem, tt.version, tt.ranges, tt.versions)
+			if affected != tt.affected || fixed != tt.fixed {
+				t.Errorf("versionAffected(%q) = %v, %q, want %v, %q", tt.version, affected, fixed, tt.affected, tt.fixed)
+			}
+		})
+	}
+}
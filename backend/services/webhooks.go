@@ -0,0 +1,480 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"dgui/config"
+	"dgui/models"
+)
+
+// WebhookEventTypes 可订阅的事件类型
+var WebhookEventTypes = []string{
+	models.EventImageDeleted,
+	models.EventRetentionFinished,
+	models.EventBulkDeleteFinished,
+	models.EventVulnerabilityFound,
+	models.EventRegistryUnreachable,
+	models.EventRegistryRecovered,
+	models.EventCertificateExpiring,
+}
+
+const (
+	defaultWebhookAttempts = 5
+	webhookBatchSize       = 20
+	webhookConcurrency     = 4
+	webhookResponseLimit   = 2048
+	webhookDeliveryMaxAge  = 30 * 24 * time.Hour
+)
+
+// ErrDeliveryPending 投递仍在等待重试，不能手动重新发送
+var ErrDeliveryPending = errors.New("delivery is still pending")
+
+// webhookHTTPClient 投递使用的 HTTP 客户端，目标通常是聊天工具或内部服务，不跳过证书校验
+var webhookHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// webhookWake 有新的投递时唤醒调度
+var webhookWake = make(chan struct{}, 1)
+
+// newEventID 生成事件 ID
+func newEventID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ValidateWebhookTarget 检查 URL、格式、订阅的事件和模板
+func ValidateWebhookTarget(target *models.WebhookTarget) error {
+	u, err := url.Parse(target.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an http(s) URL")
+	}
+	switch target.Format {
+	case models.WebhookFormatJSON, models.WebhookFormatSlack, models.WebhookFormatDingTalk, models.WebhookFormatFeishu:
+	default:
+		return fmt.Errorf("unsupported format %q", target.Format)
+	}
+	for _, event := range splitEvents(target.Events) {
+		known := false
+		for _, t := range WebhookEventTypes {
+			if event == t {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	if target.Template != "" {
+		if _, err := template.New("webhook").Parse(target.Template); err != nil {
+			return fmt.Errorf("invalid template: %v", err)
+		}
+	}
+	return nil
+}
+
+// splitEvents 解析逗号分隔的事件列表
+func splitEvents(events string) []string {
+	var list []string
+	for _, event := range strings.Split(events, ",") {
+		if event = strings.TrimSpace(event); event != "" {
+			list = append(list, event)
+		}
+	}
+	return list
+}
+
+// subscribed 判断目标是否订阅了事件，未指定事件时订阅全部
+func subscribed(target *models.WebhookTarget, eventType string) bool {
+	events := splitEvents(target.Events)
+	if len(events) == 0 {
+		return true
+	}
+	for _, event := range events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Emit 为订阅了事件的出站 Webhook 创建投递记录，由后台调度发送，失败时按退避重试
+func Emit(event models.Event) {
+	if event.ID == "" {
+		event.ID = newEventID()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	if event.RegistryID != 0 && event.Registry == "" {
+		var registry models.Registry
+		if err := config.DB.Select("name").First(&registry, event.RegistryID).Error; err == nil {
+			event.Registry = registry.Name
+		}
+	}
+
+	var targets []models.WebhookTarget
+	if err := config.DB.Where("enabled = ?", true).Find(&targets).Error; err != nil {
+		log.Printf("Failed to load webhook targets: %v", err)
+		return
+	}
+	payload, _ := json.Marshal(event)
+	queued := false
+	for i := range targets {
+		if !subscribed(&targets[i], event.Type) {
+			continue
+		}
+		if _, err := queueDelivery(targets[i].ID, event, payload, true); err != nil {
+			log.Printf("Failed to queue webhook delivery for %s: %v", targets[i].Name, err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		wakeWebhookDispatcher()
+	}
+}
+
+// queueDelivery 创建待发送的投递记录，scheduled 为 false 时由调用方立即发送，调度不会重复处理
+func queueDelivery(targetID uint, event models.Event, payload []byte, scheduled bool) (*models.WebhookDelivery, error) {
+	delivery := &models.WebhookDelivery{
+		TargetID:  targetID,
+		EventID:   event.ID,
+		EventType: event.Type,
+		Payload:   string(payload),
+		Status:    models.DeliveryStatusPending,
+	}
+	if scheduled {
+		now := time.Now()
+		delivery.NextAttemptAt = &now
+	}
+	return delivery, config.DB.Create(delivery).Error
+}
+
+// wakeWebhookDispatcher 唤醒投递调度
+func wakeWebhookDispatcher() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartWebhookDispatcher 启动出站 Webhook 投递，服务重启前未完成的投递会继续重试
+func StartWebhookDispatcher() {
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		lastPrune := time.Time{}
+		for {
+			dispatchWebhooks()
+			if time.Since(lastPrune) > time.Hour {
+				lastPrune = time.Now()
+				config.DB.Where("created_at < ? AND status <> ?", time.Now().Add(-webhookDeliveryMaxAge), models.DeliveryStatusPending).
+					Delete(&models.WebhookDelivery{})
+			}
+			select {
+			case <-ticker.C:
+			case <-webhookWake:
+			}
+		}
+	}()
+}
+
+// dispatchWebhooks 发送到期的投递
+func dispatchWebhooks() {
+	for {
+		var deliveries []models.WebhookDelivery
+		err := config.DB.Where("status = ? AND next_attempt_at <= ?", models.DeliveryStatusPending, time.Now()).
+			Order("id").Limit(webhookBatchSize).Find(&deliveries).Error
+		if err != nil {
+			log.Printf("Failed to load webhook deliveries: %v", err)
+			return
+		}
+		if len(deliveries) == 0 {
+			return
+		}
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, webhookConcurrency)
+		for i := range deliveries {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(d *models.WebhookDelivery) {
+				defer func() { <-sem; wg.Done() }()
+				deliverWebhook(d)
+			}(&deliveries[i])
+		}
+		wg.Wait()
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// webhookBackoff 第 attempt 次失败后的等待时间：30s、2m、8m、32m ...，最长 2h
+func webhookBackoff(attempt int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempt && d < 2*time.Hour; i++ {
+		d *= 4
+	}
+	if d > 2*time.Hour {
+		d = 2 * time.Hour
+	}
+	return d
+}
+
+// deliverWebhook 发送一次投递并记录结果，失败时安排重试或标记为失败
+func deliverWebhook(delivery *models.WebhookDelivery) {
+	delivery.Attempts++
+	delivery.NextAttemptAt = nil
+
+	var target models.WebhookTarget
+	err := config.DB.First(&target, delivery.TargetID).Error
+	switch {
+	case err != nil:
+		err = errors.New("webhook target not found")
+		delivery.Attempts = envInt("WEBHOOK_MAX_ATTEMPTS", defaultWebhookAttempts)
+	case !target.Enabled && delivery.EventType != models.EventWebhookTest:
+		err = errors.New("webhook target is disabled")
+		delivery.Attempts = envInt("WEBHOOK_MAX_ATTEMPTS", defaultWebhookAttempts)
+	default:
+		var event models.Event
+		if err = json.Unmarshal([]byte(delivery.Payload), &event); err == nil {
+			delivery.ResponseCode, delivery.ResponseBody, err = sendWebhook(&target, &event)
+		}
+	}
+
+	now := time.Now()
+	if err == nil {
+		delivery.Status = models.DeliveryStatusSucceeded
+		delivery.Error = ""
+		delivery.DeliveredAt = &now
+	} else {
+		delivery.Error = err.Error()
+		if delivery.Attempts >= envInt("WEBHOOK_MAX_ATTEMPTS", defaultWebhookAttempts) {
+			delivery.Status = models.DeliveryStatusFailed
+		} else {
+			next := now.Add(webhookBackoff(delivery.Attempts))
+			delivery.NextAttemptAt = &next
+		}
+	}
+	if err := config.DB.Save(delivery).Error; err != nil {
+		log.Printf("Failed to save webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// sendWebhook 按目标格式渲染并发送事件，返回响应状态码和（截断的）响应体
+func sendWebhook(target *models.WebhookTarget, event *models.Event) (int, string, error) {
+	body, endpoint, headers, err := renderWebhook(target, event, time.Now())
+	if err != nil {
+		return 0, "", err
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(respBody), fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	// 钉钉和飞书在签名或关键词校验失败时仍返回 200，错误码在响应体中
+	if target.Format == models.WebhookFormatDingTalk || target.Format == models.WebhookFormatFeishu {
+		var result struct {
+			ErrCode *int   `json:"errcode"`
+			ErrMsg  string `json:"errmsg"`
+			Code    *int   `json:"code"`
+			Msg     string `json:"msg"`
+		}
+		if json.Unmarshal(respBody, &result) == nil {
+			if result.ErrCode != nil && *result.ErrCode != 0 {
+				return resp.StatusCode, string(respBody), fmt.Errorf("errcode %d: %s", *result.ErrCode, result.ErrMsg)
+			}
+			if result.Code != nil && *result.Code != 0 {
+				return resp.StatusCode, string(respBody), fmt.Errorf("code %d: %s", *result.Code, result.Msg)
+			}
+		}
+	}
+	return resp.StatusCode, string(respBody), nil
+}
+
+// defaultWebhookText 未配置模板时聊天工具的消息文本
+func defaultWebhookText(event *models.Event) string {
+	lines := []string{"[dgui] " + event.Summary}
+	if event.Registry != "" {
+		lines = append(lines, "Registry: "+event.Registry)
+	}
+	if event.Repository != "" {
+		image := event.Repository
+		if event.Tag != "" {
+			image += ":" + event.Tag
+		}
+		lines = append(lines, "Image: "+image)
+	}
+	if event.Digest != "" {
+		lines = append(lines, "Digest: "+event.Digest)
+	}
+	if event.Actor != "" {
+		lines = append(lines, "By: "+event.Actor)
+	}
+	lines = append(lines, "Time: "+event.Timestamp.Format(time.RFC3339))
+	return strings.Join(lines, "\n")
+}
+
+// renderWebhook 生成请求体、请求地址和请求头，并按格式签名：
+// json / slack 使用 X-DGUI-Signature-256 头（请求体的 HMAC-SHA256），
+// 钉钉在 URL 中附加 timestamp 和 sign，飞书在请求体中附加 timestamp 和 sign
+func renderWebhook(target *models.WebhookTarget, event *models.Event, now time.Time) ([]byte, string, map[string]string, error) {
+	var rendered string
+	if target.Template != "" {
+		tmpl, err := template.New("webhook").Parse(target.Template)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("invalid template: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, event); err != nil {
+			return nil, "", nil, fmt.Errorf("failed to render template: %v", err)
+		}
+		rendered = buf.String()
+	}
+	text := rendered
+	if text == "" {
+		text = defaultWebhookText(event)
+	}
+
+	endpoint := target.URL
+	headers := map[string]string{
+		"Content-Type":     "application/json",
+		"User-Agent":       "dgui-webhook",
+		"X-DGUI-Event":     event.Type,
+		"X-DGUI-Event-ID":  event.ID,
+		"X-DGUI-Timestamp": strconv.FormatInt(now.Unix(), 10),
+	}
+
+	var body []byte
+	var err error
+	switch target.Format {
+	case models.WebhookFormatSlack:
+		body, err = json.Marshal(map[string]string{"text": text})
+	case models.WebhookFormatDingTalk:
+		body, err = json.Marshal(map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]string{"content": text},
+		})
+		if target.Secret != "" {
+			timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+			mac := hmac.New(sha256.New, []byte(target.Secret))
+			mac.Write([]byte(timestamp + "\n" + target.Secret))
+			sign := url.QueryEscape(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+			sep := "?"
+			if strings.Contains(endpoint, "?") {
+				sep = "&"
+			}
+			endpoint += sep + "timestamp=" + timestamp + "&sign=" + sign
+		}
+	case models.WebhookFormatFeishu:
+		msg := map[string]interface{}{
+			"msg_type": "text",
+			"content":  map[string]string{"text": text},
+		}
+		if target.Secret != "" {
+			timestamp := strconv.FormatInt(now.Unix(), 10)
+			mac := hmac.New(sha256.New, []byte(timestamp+"\n"+target.Secret))
+			msg["timestamp"] = timestamp
+			msg["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		}
+		body, err = json.Marshal(msg)
+	default:
+		if rendered != "" {
+			body = []byte(rendered)
+		} else {
+			body, err = json.Marshal(event)
+		}
+	}
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	if target.Secret != "" && (target.Format == models.WebhookFormatJSON || target.Format == models.WebhookFormatSlack) {
+		mac := hmac.New(sha256.New, []byte(target.Secret))
+		mac.Write(body)
+		headers["X-DGUI-Signature-256"] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	return body, endpoint, headers, nil
+}
+
+// SendTestWebhook 立即向目标发送一个测试事件，返回投递记录（失败时同样按退避重试）
+func SendTestWebhook(target *models.WebhookTarget) (*models.WebhookDelivery, error) {
+	event := models.Event{
+		ID:        newEventID(),
+		Type:      models.EventWebhookTest,
+		Timestamp: time.Now(),
+		Summary:   fmt.Sprintf("Test notification for webhook %q", target.Name),
+	}
+	payload, _ := json.Marshal(event)
+	delivery, err := queueDelivery(target.ID, event, payload, false)
+	if err != nil {
+		return nil, err
+	}
+	deliverWebhook(delivery)
+	return delivery, nil
+}
+
+// RedeliverWebhook 重新发送一次投递
+func RedeliverWebhook(id uint) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := config.DB.First(&delivery, id).Error; err != nil {
+		return nil, err
+	}
+	if delivery.Status == models.DeliveryStatusPending && delivery.NextAttemptAt != nil {
+		return nil, ErrDeliveryPending
+	}
+	delivery.Status = models.DeliveryStatusPending
+	delivery.Attempts = 0
+	deliverWebhook(&delivery)
+	return &delivery, nil
+}
+
+// ListWebhookDeliveries 按时间倒序列出投递记录，targetID 为 0 时列出全部
+func ListWebhookDeliveries(targetID uint, status string, page, pageSize int) ([]models.WebhookDelivery, int64, error) {
+	query := config.DB.Model(&models.WebhookDelivery{})
+	if targetID != 0 {
+		query = query.Where("target_id = ?", targetID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	deliveries := []models.WebhookDelivery{}
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&deliveries).Error
+	return deliveries, total, err
+}
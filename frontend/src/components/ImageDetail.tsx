@@ -68,6 +68,7 @@ function getRegistryHost(url: string): string {
 export function ImageDetail({ repository, tag, onBack }: ImageDetailProps) {
   const queryClient = useQueryClient()
   const [copiedDigest, setCopiedDigest] = useState<string | null>(null)
+  const [deleteOpen, setDeleteOpen] = useState(false)
   const activeRegistry = useRegistryStore((state) => state.activeRegistry)
 
   const { data: imageInfo, isLoading, error } = useQuery({
@@ -75,8 +76,15 @@ export function ImageDetail({ repository, tag, onBack }: ImageDetailProps) {
     queryFn: () => imageApi.getImageInfo(repository, tag).then(res => res.data),
   })
 
+  // 打开删除确认框时查询共享同一 digest 的标签
+  const { data: deletePreview, isLoading: isPreviewLoading } = useQuery({
+    queryKey: ['deletePreview', repository, tag],
+    queryFn: () => imageApi.getDeletePreview(repository, tag).then(res => res.data),
+    enabled: deleteOpen,
+  })
+
   const deleteMutation = useMutation({
-    mutationFn: () => imageApi.deleteImage(repository, tag),
+    mutationFn: () => imageApi.deleteImage(repository, tag, deletePreview?.digest),
     onSuccess: () => {
       queryClient.invalidateQueries({ queryKey: ['repositories'] })
       toast.success('镜像删除成功')
@@ -158,9 +166,14 @@ export function ImageDetail({ repository, tag, onBack }: ImageDetailProps) {
               </p>
             </div>
           </div>
-          <AlertDialog>
+          <AlertDialog open={deleteOpen} onOpenChange={setDeleteOpen}>
             <AlertDialogTrigger asChild>
-              <Button variant="destructive" className="flex items-center gap-2">
+              <Button
+                variant="destructive"
+                className="flex items-center gap-2"
+                disabled={activeRegistry?.mirror}
+                title={activeRegistry?.mirror ? `镜像站不支持删除，镜像来自 ${activeRegistry.upstream}` : undefined}
+              >
                 <Trash2 className="h-4 w-4" />
                 <span className="hidden sm:block">删除镜像</span>
               </Button>
@@ -171,12 +184,27 @@ export function ImageDetail({ repository, tag, onBack }: ImageDetailProps) {
                 <AlertDialogDescription>
                   确定要删除镜像 {repository}:{tag} 吗？此操作不可撤销。
                 </AlertDialogDescription>
+                {deletePreview && deletePreview.shared_tags.length > 0 && (
+                  <div className="rounded-md border border-destructive/50 bg-destructive/10 p-3 text-sm text-destructive">
+                    以下标签指向同一镜像（{shortenDigest(deletePreview.digest)}），将被一并删除：
+                    <div className="mt-2 flex flex-wrap gap-1">
+                      {deletePreview.shared_tags.map((sharedTag) => (
+                        <Badge key={sharedTag} variant="outline">{sharedTag}</Badge>
+                      ))}
+                    </div>
+                  </div>
+                )}
+                {deletePreview?.warnings?.map((warning) => (
+                  <div key={warning} className="rounded-md border p-3 text-sm text-muted-foreground">
+                    {warning}
+                  </div>
+                ))}
               </AlertDialogHeader>
               <AlertDialogFooter>
                 <AlertDialogCancel>取消</AlertDialogCancel>
                 <AlertDialogAction
                   onClick={() => deleteMutation.mutate()}
-                  disabled={deleteMutation.isPending}
+                  disabled={deleteMutation.isPending || isPreviewLoading}
                 >
                   删除
                 </AlertDialogAction>
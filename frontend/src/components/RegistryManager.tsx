@@ -25,13 +25,115 @@ import {Input} from '@/components/ui/input';
 import {Label} from '@/components/ui/label';
 import {Tooltip, TooltipContent, TooltipTrigger} from '@/components/ui/tooltip.tsx';
 
-import {type Registry, registryApi, type RegistryCreate} from '@/lib/api';
+import {Select, SelectContent, SelectItem, SelectTrigger, SelectValue} from '@/components/ui/select';
+import {type Registry, registryApi, type RegistryCreate, type RegistryKind} from '@/lib/api';
 import {cn} from '@/lib/utils.ts';
 import {useMutation, useQuery, useQueryClient} from '@tanstack/react-query';
 import {BugPlay, Check, ExternalLink, Pencil, Plus, RefreshCw, Trash2} from 'lucide-react';
 import {type FormEvent, useState} from 'react';
 import {toast} from 'sonner';
 
+// Registry 类型，Docker Hub 和 GHCR 可以不填 URL
+const registryKinds: {value: RegistryKind; label: string; defaultURL?: string}[] = [
+  {value: 'distribution', label: '自建 Registry'},
+  {value: 'dockerhub', label: 'Docker Hub', defaultURL: 'https://registry-1.docker.io'},
+  {value: 'ghcr', label: 'GitHub Container Registry', defaultURL: 'https://ghcr.io'},
+  {value: 'ecr', label: 'Amazon ECR'},
+  {value: 'harbor', label: 'Harbor'},
+  {value: 'hosted', label: '其他托管 Registry'},
+];
+
+function urlPlaceholder(kind?: RegistryKind) {
+  return registryKinds.find(k => k.value === kind)?.defaultURL ?? 'http://localhost:5000';
+}
+
+function urlRequired(kind?: RegistryKind) {
+  return !registryKinds.find(k => k.value === kind)?.defaultURL;
+}
+
+function RegistryKindSelect({id, value, onChange}: {id: string; value?: RegistryKind; onChange: (kind: RegistryKind) => void}) {
+  return (
+    <div className="grid gap-2">
+      <Label htmlFor={id}>类型</Label>
+      <Select value={value || 'distribution'} onValueChange={(v) => onChange(v as RegistryKind)}>
+        <SelectTrigger id={id} className="w-full">
+          <SelectValue/>
+        </SelectTrigger>
+        <SelectContent>
+          {registryKinds.map(k => (
+            <SelectItem key={k.value} value={k.value}>{k.label}</SelectItem>
+          ))}
+        </SelectContent>
+      </Select>
+    </div>
+  );
+}
+
+function RegistryHostedFields({id, data, onChange}: {
+  id: string;
+  data: RegistryCreate;
+  onChange: (data: RegistryCreate) => void
+}) {
+  return (
+    <>
+      <div className="grid gap-2">
+        <Label htmlFor={`${id}-repositories`}>仓库列表 (可选，每行一个)</Label>
+        <textarea
+          id={`${id}-repositories`}
+          rows={3}
+          placeholder={'Registry 不提供 _catalog 时填写，如\nlibrary/nginx\nmyorg/app'}
+          className="border-input dark:bg-input/30 placeholder:text-muted-foreground rounded-md border bg-transparent px-3 py-2 font-mono text-sm shadow-xs outline-none focus-visible:border-ring focus-visible:ring-ring/50 focus-visible:ring-[3px]"
+          value={data.repositories || ''}
+          onChange={(e) => onChange({...data, repositories: e.target.value})}
+        />
+      </div>
+      {data.kind && data.kind !== 'distribution' && (
+        <div className="grid gap-2">
+          <Label htmlFor={`${id}-auth-url`}>认证地址 (可选)</Label>
+          <Input
+            id={`${id}-auth-url`}
+            placeholder={data.kind === 'ecr' ? 'https://api.ecr.<region>.amazonaws.com' : '留空则使用 Registry 返回的 token 地址'}
+            value={data.auth_url || ''}
+            onChange={(e) => onChange({...data, auth_url: e.target.value})}
+          />
+        </div>
+      )}
+    </>
+  );
+}
+
+function RegistryMirrorFields({id, data, onChange}: {
+  id: string;
+  data: RegistryCreate;
+  onChange: (data: RegistryCreate) => void
+}) {
+  return (
+    <>
+      <div className="flex items-center gap-2">
+        <input
+          id={`${id}-mirror`}
+          type="checkbox"
+          className="size-4 accent-primary"
+          checked={!!data.mirror}
+          onChange={(e) => onChange({...data, mirror: e.target.checked})}
+        />
+        <Label htmlFor={`${id}-mirror`}>拉取缓存镜像站 (proxy.remoteurl)</Label>
+      </div>
+      {data.mirror && (
+        <div className="grid gap-2">
+          <Label htmlFor={`${id}-upstream`}>上游地址 (可选)</Label>
+          <Input
+            id={`${id}-upstream`}
+            placeholder="留空则为 Docker Hub (https://registry-1.docker.io)"
+            value={data.upstream || ''}
+            onChange={(e) => onChange({...data, upstream: e.target.value})}
+          />
+        </div>
+      )}
+    </>
+  );
+}
+
 export function RegistryManager() {
   const queryClient = useQueryClient();
   const [dialogOpen, setDialogOpen] = useState(false);
@@ -126,6 +228,11 @@ export function RegistryManager() {
       url: registry.url,
       username: registry.username || '',
       password: '',
+      kind: registry.kind || 'distribution',
+      repositories: registry.repositories || '',
+      auth_url: registry.auth_url || '',
+      mirror: registry.mirror,
+      upstream: registry.upstream || '',
     });
     setEditDialogOpen(true);
   };
@@ -170,14 +277,19 @@ export function RegistryManager() {
                       required
                     />
                   </div>
+                  <RegistryKindSelect
+                    id="kind"
+                    value={formData.kind}
+                    onChange={(kind) => setFormData({...formData, kind})}
+                  />
                   <div className="grid gap-2">
                     <Label htmlFor="url">URL</Label>
                     <Input
                       id="url"
-                      placeholder="http://localhost:5000"
+                      placeholder={urlPlaceholder(formData.kind)}
                       value={formData.url}
                       onChange={(e) => setFormData({...formData, url: e.target.value})}
-                      required
+                      required={urlRequired(formData.kind)}
                     />
                   </div>
                   <div className="grid gap-2">
@@ -199,6 +311,8 @@ export function RegistryManager() {
                       onChange={(e) => setFormData({...formData, password: e.target.value})}
                     />
                   </div>
+                  <RegistryHostedFields id="create" data={formData} onChange={setFormData}/>
+                  <RegistryMirrorFields id="create" data={formData} onChange={setFormData}/>
                 </div>
                 <DialogFooter>
                   <Button type="submit" disabled={createMutation.isPending}>
@@ -237,6 +351,39 @@ export function RegistryManager() {
                         当前
                       </Badge>
                     )}
+                    {registry.mirror && (
+                      <Tooltip>
+                        <TooltipTrigger asChild>
+                          <Badge variant="outline">镜像站</Badge>
+                        </TooltipTrigger>
+                        <TooltipContent>
+                          <p className="font-mono text-xs">上游: {registry.upstream}</p>
+                        </TooltipContent>
+                      </Tooltip>
+                    )}
+                    {registry.health && registry.health.status !== 'unknown' && (
+                      <Tooltip>
+                        <TooltipTrigger asChild>
+                          <Badge variant={registry.health.status === 'up' ? 'secondary' : 'destructive'}>
+                            {registry.health.status === 'up' ? `${registry.health.latency_ms} ms` : '不可用'}
+                          </Badge>
+                        </TooltipTrigger>
+                        <TooltipContent>
+                          <div className="text-xs space-y-1">
+                            {registry.health.error && <p>{registry.health.error}</p>}
+                            {registry.health.uptime_24h !== undefined && (
+                              <p>24 小时可用率: {registry.health.uptime_24h.toFixed(2)}%</p>
+                            )}
+                            {registry.health.uptime_7d !== undefined && (
+                              <p>7 天可用率: {registry.health.uptime_7d.toFixed(2)}%</p>
+                            )}
+                            {registry.health.cert_days_left !== undefined && (
+                              <p>证书剩余 {registry.health.cert_days_left} 天</p>
+                            )}
+                          </div>
+                        </TooltipContent>
+                      </Tooltip>
+                    )}
                   </CardTitle>
                 </div>
               </CardHeader>
@@ -326,14 +473,19 @@ export function RegistryManager() {
                   required
                 />
               </div>
+              <RegistryKindSelect
+                id="edit-kind"
+                value={editFormData.kind}
+                onChange={(kind) => setEditFormData({...editFormData, kind})}
+              />
               <div className="grid gap-2">
                 <Label htmlFor="edit-url">URL</Label>
                 <Input
                   id="edit-url"
-                  placeholder="http://localhost:5000"
+                  placeholder={urlPlaceholder(editFormData.kind)}
                   value={editFormData.url}
                   onChange={(e) => setEditFormData({...editFormData, url: e.target.value})}
-                  required
+                  required={urlRequired(editFormData.kind)}
                 />
               </div>
               <div className="grid gap-2">
@@ -355,6 +507,18 @@ export function RegistryManager() {
                   onChange={(e) => setEditFormData({...editFormData, password: e.target.value})}
                 />
               </div>
+              <div className="grid gap-2">
+                <Label htmlFor="edit-webhook-token">通知 Token (可选，留空则不修改)</Label>
+                <Input
+                  id="edit-webhook-token"
+                  type="password"
+                  placeholder="Registry 通知回调使用的 Bearer Token"
+                  value={editFormData.webhook_token || ''}
+                  onChange={(e) => setEditFormData({...editFormData, webhook_token: e.target.value})}
+                />
+              </div>
+              <RegistryHostedFields id="edit" data={editFormData} onChange={setEditFormData}/>
+              <RegistryMirrorFields id="edit" data={editFormData} onChange={setEditFormData}/>
             </div>
             <DialogFooter>
               <Button type="submit" disabled={updateMutation.isPending}>
@@ -49,6 +49,8 @@ export interface LoginResponse {
 }
 
 // Registry 类型定义
+export type RegistryKind = 'distribution' | 'dockerhub' | 'ghcr' | 'ecr' | 'hosted' | 'harbor'
+
 export interface Registry {
   id: number
   created_at: string
@@ -58,6 +60,24 @@ export interface Registry {
   username: string
   is_active: boolean
   is_default: boolean
+  kind: RegistryKind
+  repositories: string
+  auth_url: string
+  mirror: boolean
+  upstream: string
+  health?: RegistryHealth
+}
+
+export interface RegistryHealth {
+  status: 'up' | 'down' | 'unknown'
+  checked_at?: string
+  latency_ms: number
+  status_code?: number
+  error?: string
+  cert_expires_at?: string
+  cert_days_left?: number
+  uptime_24h?: number
+  uptime_7d?: number
 }
 
 export interface RegistryCreate {
@@ -65,12 +85,20 @@ export interface RegistryCreate {
   url: string
   username?: string
   password?: string
+  webhook_token?: string
+  kind?: RegistryKind
+  repositories?: string
+  auth_url?: string
+  mirror?: boolean
+  upstream?: string
 }
 
 export interface RepositoryInfo {
   name: string
   tags: string[]
   tag_count: number
+  pull_count?: number
+  description?: string
 }
 
 export interface ManifestConfig {
@@ -138,6 +166,16 @@ export interface ImageInfo {
   layer_count: number
 }
 
+// 删除镜像前的确认信息
+export interface DeletePreview {
+  repo: string
+  reference: string
+  digest: string
+  tags: string[]
+  shared_tags: string[]
+  warnings?: string[]
+}
+
 export interface RegistryTags {
   name: string
   tags: string[]
@@ -184,8 +222,10 @@ export const imageApi = {
     api.get<ImageManifest>('/images/manifest', { params: { repo: repository, ref: reference } }),
   getImageInfo: (repository: string, tag: string) => 
     api.get<ImageInfo>('/images/info', { params: { repo: repository, tag } }),
-  deleteImage: (repository: string, reference: string) => 
-    api.delete('/images/delete', { params: { repo: repository, ref: reference } }),
+  getDeletePreview: (repository: string, reference: string) =>
+    api.get<DeletePreview>('/images/delete/preview', { params: { repo: repository, ref: reference } }),
+  deleteImage: (repository: string, reference: string, acknowledge?: string) => 
+    api.delete('/images/delete', { params: { repo: repository, ref: reference, acknowledge } }),
 }
 
 // Auth API